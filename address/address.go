@@ -64,6 +64,8 @@ const (
 	Actor
 	// BLS represents the address BLS protocol.
 	BLS
+	// Ed25519 represents the address Ed25519 protocol.
+	Ed25519
 )
 
 // Protocol returns the protocol used by the address.
@@ -157,6 +159,13 @@ func NewBLSAddress(pubkey []byte) (Address, error) {
 	return newAddress(BLS, pubkey)
 }
 
+// NewEd25519Address returns an address using the Ed25519 protocol.  The
+// address holds the public key itself, as an Ed25519 signature does not
+// reveal the key that made it.
+func NewEd25519Address(pubkey []byte) (Address, error) {
+	return newAddress(Ed25519, pubkey)
+}
+
 // NewFromString returns the address represented by the string `addr`.
 func NewFromString(addr string) (Address, error) {
 	return decode(addr)
@@ -199,6 +208,10 @@ func newAddress(protocol Protocol, payload []byte) (Address, error) {
 		if len(payload) != bls.PublicKeyBytes {
 			return Undef, ErrInvalidPayload
 		}
+	case Ed25519:
+		if len(payload) != Ed25519PublicKeyBytes {
+			return Undef, ErrInvalidPayload
+		}
 	default:
 		return Undef, ErrUnknownProtocol
 	}
@@ -227,7 +240,7 @@ func encode(network Network, addr Address) (string, error) {
 
 	var strAddr string
 	switch addr.Protocol() {
-	case SECP256K1, Actor, BLS:
+	case SECP256K1, Actor, BLS, Ed25519:
 		cksm := Checksum(append([]byte{addr.Protocol()}, addr.Payload()...))
 		strAddr = ntwk + fmt.Sprintf("%d", addr.Protocol()) + AddressEncoding.WithPadding(-1).EncodeToString(append(addr.Payload(), cksm[:]...))
 	case ID:
@@ -263,6 +276,8 @@ func decode(a string) (Address, error) {
 		protocol = Actor
 	case '3':
 		protocol = BLS
+	case '4':
+		protocol = Ed25519
 	default:
 		return Undef, ErrUnknownProtocol
 	}
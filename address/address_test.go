@@ -270,6 +270,29 @@ func TestRandomBLSAddress(t *testing.T) {
 
 }
 
+func TestRandomEd25519Address(t *testing.T) {
+	tf.UnitTest(t)
+
+	pk := make([]byte, Ed25519PublicKeyBytes)
+	_, err := rand.Read(pk)
+	require.NoError(t, err)
+
+	addr, err := NewEd25519Address(pk)
+	assert.NoError(t, err)
+	assert.Equal(t, Ed25519, addr.Protocol())
+	assert.Equal(t, pk, addr.Payload())
+
+	str, err := encode(Testnet, addr)
+	assert.NoError(t, err)
+
+	maybe, err := decode(str)
+	assert.NoError(t, err)
+	assert.Equal(t, addr, maybe)
+
+	_, err = NewEd25519Address(pk[1:])
+	assert.Equal(t, ErrInvalidPayload, err)
+}
+
 func TestVectorBLSAddress(t *testing.T) {
 	tf.UnitTest(t)
 
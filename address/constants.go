@@ -71,6 +71,10 @@ var UndefAddressString = "empty"
 // PayloadHashLength defines the hash length taken over addresses using the Actor and SECP256K1 protocols.
 const PayloadHashLength = 20
 
+// Ed25519PublicKeyBytes is the length of the Ed25519 public key an address
+// using the Ed25519 protocol holds.
+const Ed25519PublicKeyBytes = 32
+
 // ChecksumHashLength defines the hash length used for calculating address checksums.
 const ChecksumHashLength = 4
 
@@ -0,0 +1,48 @@
+package chain
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// ErrNonContiguousChain is returned when fetched tipsets do not link from the
+// requested head back to a stored tipset.
+var ErrNonContiguousChain = errors.New("fetched tipsets do not form a contiguous chain to a stored tipset")
+
+// AssembleChain orders tipsets fetched in any order into the linear chain
+// ending at head.  Starting from head it follows parent links through the
+// fetched tipsets until it reaches a parent for which isStored returns true.
+// The returned chain is ordered from the tipset after the stored parent to
+// head.  Fetched tipsets not on the chain are ignored.  AssembleChain returns
+// ErrNonContiguousChain if a link is missing from fetched.
+func AssembleChain(head types.SortedCidSet, fetched []types.TipSet, isStored func(tsKey string) bool) ([]types.TipSet, error) {
+	byKey := make(map[string]types.TipSet, len(fetched))
+	for _, ts := range fetched {
+		byKey[ts.String()] = ts
+	}
+
+	var chain []types.TipSet
+	next := head
+	for !isStored(next.String()) {
+		ts, ok := byKey[next.String()]
+		if !ok {
+			return nil, errors.Wrapf(ErrNonContiguousChain, "missing tipset %s", next.String())
+		}
+		// Guard against cycles from malformed parent links.
+		delete(byKey, next.String())
+		chain = append(chain, ts)
+
+		var err error
+		next, err = ts.Parents()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Reverse to order the chain from oldest to newest.
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+	return chain, nil
+}
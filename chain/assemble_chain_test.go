@@ -0,0 +1,58 @@
+package chain_test
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/chain"
+	th "github.com/filecoin-project/go-filecoin/testhelpers"
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestAssembleChain(t *testing.T) {
+	tf.UnitTest(t)
+
+	store := th.NewFakeBlockProvider()
+	root := store.NewBlock(0)
+	b11 := store.NewBlock(1, root)
+	b12 := store.NewBlock(2, root)
+	b21 := store.NewBlock(3, b11, b12)
+	b31 := store.NewBlock(4, b21)
+	fork := store.NewBlock(5, b11)
+
+	t0 := requireTipset(t, root)
+	t1 := requireTipset(t, b11, b12)
+	t2 := requireTipset(t, b21)
+	t3 := requireTipset(t, b31)
+	tFork := requireTipset(t, fork)
+
+	isStored := func(tsKey string) bool {
+		return tsKey == t0.String()
+	}
+
+	t.Run("assembles out of order delivery", func(t *testing.T) {
+		fetched := []types.TipSet{t2, tFork, t1, t3}
+		chn, err := chain.AssembleChain(t3.ToSortedCidSet(), fetched, isStored)
+		require.NoError(t, err)
+		require.Equal(t, 3, len(chn))
+		assert.True(t, t1.Equals(chn[0]))
+		assert.True(t, t2.Equals(chn[1]))
+		assert.True(t, t3.Equals(chn[2]))
+	})
+
+	t.Run("head already stored", func(t *testing.T) {
+		chn, err := chain.AssembleChain(t0.ToSortedCidSet(), []types.TipSet{t1}, isStored)
+		require.NoError(t, err)
+		assert.Empty(t, chn)
+	})
+
+	t.Run("missing link errors", func(t *testing.T) {
+		fetched := []types.TipSet{t3, t1}
+		_, err := chain.AssembleChain(t3.ToSortedCidSet(), fetched, isStored)
+		assert.Equal(t, chain.ErrNonContiguousChain, errors.Cause(err))
+	})
+}
@@ -2,41 +2,167 @@ package chain
 
 import (
 	"sync"
+	"time"
 
-	"github.com/filecoin-project/go-filecoin/types"
+	"github.com/filecoin-project/go-filecoin/clock"
+	"github.com/filecoin-project/go-filecoin/util/lru"
 )
 
+// defaultBadTipSetCacheSize is the maximum number of tipset keys the syncer's
+// bad tipset cache retains.
+const defaultBadTipSetCacheSize = 4096
+
 // badTipSetCache keeps track of bad tipsets that the syncer should not try to
 // download. Readers and writers grab a lock. The purpose of this cache is to
 // prevent a node from having to repeatedly invalidate a block (and its children)
 // in the event that the tipset does not conform to the rules of consensus. Note
-// that the cache is only in-memory, so it is reset whenever the node is restarted.
-// TODO: this needs to be limited.
+// that the cache is only in-memory, so it is reset whenever the node is restarted,
+// except for the quarantined keys a syncer persists with QuarantineTo.
+//
+// The cache holds at most maxSize keys so that peers repeatedly sending long
+// invalid chains cannot exhaust memory.  When full, the least recently added or
+// checked key is evicted.
+//
+// Keys added as part of a chain are tagged with their tipset's height so that
+// keys below finality, which can never be resubmitted successfully, can be
+// pruned.
 type badTipSetCache struct {
-	mu  sync.Mutex
-	bad map[string]struct{}
+	mu sync.Mutex
+	// bad holds a *badTipSet for each tipset key.
+	bad *lru.Cache
+	// clock times when keys are added.
+	clock clock.Clock
+}
+
+// badTipSet is what the cache records about a bad tipset key.
+type badTipSet struct {
+	// height is the height of the tipset, if heightKnown.
+	height      uint64
+	heightKnown bool
+	// added is when the key was added.
+	added time.Time
+	// quarantine is set if the tipset may be invalid only because of a bug
+	// in the node version that validated it.  Otherwise it is hard invalid.
+	quarantine *quarantineInfo
+}
+
+// newBadTipSetCache returns an empty badTipSetCache holding at most maxSize
+// keys and timing their addition with clk.
+func newBadTipSetCache(maxSize int, clk clock.Clock) *badTipSetCache {
+	return &badTipSetCache{
+		bad:   lru.New(maxSize),
+		clock: clk,
+	}
 }
 
-// AddChain adds the chain of tipsets to the badTipSetCache.  For now it just
-// does the simplest thing and adds all blocks of the chain to the cache.
-// TODO: might want to cache a random subset once cache size is limited.
-func (cache *badTipSetCache) AddChain(chain []types.TipSet) {
-	for _, ts := range chain {
-		cache.Add(ts.String())
+// addLinks adds the tipsets identified by links, ordered from oldest to
+// newest, to the badTipSetCache.  For now it just does the simplest thing and
+// adds every tipset of the chain.  Chains longer than the cache retain only
+// their newest tipsets, which are the ones peers announce.
+func (cache *badTipSetCache) addLinks(links []tipSetLink) {
+	for _, link := range links {
+		cache.AddAtHeight(link.key.String(), link.height)
 	}
 }
 
-// Add adds a single tipset key to the badTipSetCache.
+// AddAtHeight adds a single tipset key of the given height to the
+// badTipSetCache.
+func (cache *badTipSetCache) AddAtHeight(tsKey string, h uint64) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	cache.addAtHeightLocked(tsKey, h)
+}
+
+// addAtHeightLocked is AddAtHeight for a caller holding mu.  It returns the
+// entry for tsKey.
+func (cache *badTipSetCache) addAtHeightLocked(tsKey string, h uint64) *badTipSet {
+	bts := cache.addLocked(tsKey)
+	bts.height = h
+	bts.heightKnown = true
+	return bts
+}
+
+// Add adds a single tipset key to the badTipSetCache as hard invalid,
+// lifting any quarantine.
 func (cache *badTipSetCache) Add(tsKey string) {
 	cache.mu.Lock()
 	defer cache.mu.Unlock()
-	cache.bad[tsKey] = struct{}{}
+	cache.addLocked(tsKey)
+}
+
+// addLocked is Add for a caller holding mu.  It returns the entry for tsKey.
+func (cache *badTipSetCache) addLocked(tsKey string) *badTipSet {
+	if v, ok := cache.bad.Get(tsKey); ok {
+		bts := v.(*badTipSet)
+		bts.quarantine = nil
+		return bts
+	}
+	bts := &badTipSet{added: cache.clock.Now()}
+	cache.bad.Add(tsKey, bts)
+	return bts
+}
+
+// getLocked returns the entry for tsKey without marking it used.  The caller
+// must hold mu.
+func (cache *badTipSetCache) getLocked(tsKey string) (*badTipSet, bool) {
+	v, ok := cache.bad.Peek(tsKey)
+	if !ok {
+		return nil, false
+	}
+	return v.(*badTipSet), true
 }
 
 // Has checks for membership in the badTipSetCache.
 func (cache *badTipSetCache) Has(tsKey string) bool {
 	cache.mu.Lock()
 	defer cache.mu.Unlock()
-	_, ok := cache.bad[tsKey]
+	_, ok := cache.bad.Get(tsKey)
 	return ok
 }
+
+// Len returns the number of keys in the badTipSetCache.
+func (cache *badTipSetCache) Len() int {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	return cache.bad.Len()
+}
+
+// Entries returns the keys in the badTipSetCache, most recently used first.
+func (cache *badTipSetCache) Entries() []BadTipSetEntry {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	keys := cache.bad.Keys()
+	entries := make([]BadTipSetEntry, 0, len(keys))
+	for _, tsKey := range keys {
+		bts, _ := cache.getLocked(tsKey)
+		entry := BadTipSetEntry{
+			Key:         tsKey,
+			Height:      bts.height,
+			HeightKnown: bts.heightKnown,
+			Added:       bts.added,
+		}
+		if bts.quarantine != nil {
+			entry.Quarantined = true
+			entry.Reason = bts.quarantine.reason
+			entry.Version = bts.quarantine.version
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// PruneBelow removes the keys whose height is known and less than h.  It
+// returns the number of keys removed.
+func (cache *badTipSetCache) PruneBelow(h uint64) int {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	pruned := 0
+	for _, tsKey := range cache.bad.Keys() {
+		bts, _ := cache.getLocked(tsKey)
+		if bts.heightKnown && bts.height < h {
+			cache.bad.Remove(tsKey)
+			pruned++
+		}
+	}
+	return pruned
+}
@@ -0,0 +1,87 @@
+package chain
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/filecoin-project/go-filecoin/clock"
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestBadTipSetCacheBounded(t *testing.T) {
+	tf.UnitTest(t)
+
+	cache := newBadTipSetCache(3, clock.NewSystemClock())
+	for i := 0; i < 10; i++ {
+		cache.Add(fmt.Sprintf("ts%d", i))
+	}
+
+	assert.Equal(t, 3, cache.Len())
+	assert.False(t, cache.Has("ts0"))
+	assert.False(t, cache.Has("ts6"))
+	assert.True(t, cache.Has("ts7"))
+	assert.True(t, cache.Has("ts8"))
+	assert.True(t, cache.Has("ts9"))
+}
+
+func TestBadTipSetCacheAddLinksRetainsNewest(t *testing.T) {
+	tf.UnitTest(t)
+
+	newCid := types.NewCidForTestGetter()
+	var links []tipSetLink
+	for i := 0; i < 10; i++ {
+		links = append(links, tipSetLink{key: types.NewSortedCidSet(newCid()), height: uint64(i)})
+	}
+
+	cache := newBadTipSetCache(3, clock.NewSystemClock())
+	cache.addLinks(links)
+	assert.Equal(t, 3, cache.Len())
+	for i, link := range links {
+		assert.Equal(t, i >= 7, cache.Has(link.key.String()), "height %d", i)
+	}
+}
+
+func TestBadTipSetCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	tf.UnitTest(t)
+
+	cache := newBadTipSetCache(3, clock.NewSystemClock())
+	cache.Add("a")
+	cache.Add("b")
+	cache.Add("c")
+
+	// Touching "a" makes "b" the least recently used.
+	assert.True(t, cache.Has("a"))
+	cache.Add("d")
+	assert.Equal(t, 3, cache.Len())
+	assert.False(t, cache.Has("b"))
+	assert.True(t, cache.Has("a"))
+	assert.True(t, cache.Has("c"))
+	assert.True(t, cache.Has("d"))
+
+	// Re-adding an existing key does not grow the cache.
+	cache.Add("c")
+	assert.Equal(t, 3, cache.Len())
+}
+
+func TestBadTipSetCachePruneBelow(t *testing.T) {
+	tf.UnitTest(t)
+
+	cache := newBadTipSetCache(10, clock.NewSystemClock())
+	cache.AddAtHeight("low", 3)
+	cache.AddAtHeight("high", 8)
+	cache.Add("unknown")
+
+	assert.Equal(t, 0, cache.PruneBelow(3))
+	assert.Equal(t, 3, cache.Len())
+
+	// Advancing finality past a key's height evicts it.  Keys of unknown
+	// height are retained.
+	assert.Equal(t, 1, cache.PruneBelow(4))
+	assert.Equal(t, 2, cache.Len())
+	assert.False(t, cache.Has("low"))
+	assert.True(t, cache.Has("high"))
+	assert.True(t, cache.Has("unknown"))
+}
@@ -0,0 +1,78 @@
+package chain
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultBadTipSetCompactionInterval is how often a syncer configured with
+// a finality depth prunes its bad tipset cache.
+const DefaultBadTipSetCompactionInterval = 10 * time.Minute
+
+// FinalityDepth configures the number of rounds below the head after which
+// the syncer considers the chain final.  Bad tipsets cached below the
+// finalized height can never be resubmitted successfully, so they are pruned
+// from the cache every interval by RunBadTipSetCompaction.  A depth of zero
+// disables pruning.
+func FinalityDepth(depth uint64, interval time.Duration) SyncerOpt {
+	return func(syncer *DefaultSyncer) {
+		syncer.finalityDepth = depth
+		syncer.compactionInterval = interval
+	}
+}
+
+// FinalizedHeight returns the height at and below which the syncer considers
+// the chain final.  It is zero if no finality depth is configured or the head
+// is within the finality depth of genesis.
+func (syncer *DefaultSyncer) FinalizedHeight() (uint64, error) {
+	if syncer.finalityDepth == 0 {
+		return 0, nil
+	}
+	headTs, err := syncer.chainStore.GetTipSet(syncer.chainStore.GetHead())
+	if err != nil {
+		return 0, err
+	}
+	headHeight, err := headTs.Height()
+	if err != nil {
+		return 0, err
+	}
+	if headHeight <= syncer.finalityDepth {
+		return 0, nil
+	}
+	return headHeight - syncer.finalityDepth, nil
+}
+
+// CompactBadTipSets removes bad tipsets cached below the finalized height.
+// It returns the number of tipsets removed.
+func (syncer *DefaultSyncer) CompactBadTipSets() (int, error) {
+	finalized, err := syncer.FinalizedHeight()
+	if err != nil {
+		return 0, err
+	}
+	pruned := syncer.badTipSets.PruneBelow(finalized)
+	if pruned > 0 {
+		logSyncer.Debugf("pruned %d bad tipsets below finalized height %d", pruned, finalized)
+	}
+	return pruned, nil
+}
+
+// RunBadTipSetCompaction calls CompactBadTipSets every configured interval
+// until ctx is done.  It returns immediately if no finality depth is
+// configured.
+func (syncer *DefaultSyncer) RunBadTipSetCompaction(ctx context.Context) {
+	if syncer.finalityDepth == 0 || syncer.compactionInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(syncer.compactionInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := syncer.CompactBadTipSets(); err != nil {
+				logSyncer.Warningf("failed to compact bad tipset cache: %s", err)
+			}
+		}
+	}
+}
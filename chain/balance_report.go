@@ -0,0 +1,86 @@
+package chain
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+
+	"github.com/ipfs/go-hamt-ipld"
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/actor"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// Formats of the report written by BalanceReport.
+const (
+	// BalanceReportCSV writes a header row followed by an address,balance
+	// row per actor.
+	BalanceReportCSV = "csv"
+	// BalanceReportJSON writes a JSON array of BalanceReportRow.
+	BalanceReportJSON = "json"
+)
+
+// BalanceReportRow is the balance of one actor in a balance report.
+type BalanceReportRow struct {
+	Address address.Address `json:"address"`
+	Balance *types.AttoFIL  `json:"balance"`
+}
+
+// BalanceReport writes the balance of every actor in the state of the tipset
+// with the input key, or in the head state if the key is empty, to w in the
+// given format, one of BalanceReportCSV and BalanceReportJSON.  Balances are
+// in FIL.  Rows are written as the state tree is walked, in state tree
+// order, so the report is never held in memory.  If the walk fails the
+// report written so far is incomplete.
+func BalanceReport(ctx context.Context, store latestStateChainReader, stateStore *hamt.CborIpldStore, tsKey types.SortedCidSet, w io.Writer, format string) error {
+	switch format {
+	case BalanceReportCSV:
+		return csvBalanceReport(ctx, store, stateStore, tsKey, w)
+	case BalanceReportJSON:
+		return jsonBalanceReport(ctx, store, stateStore, tsKey, w)
+	default:
+		return errors.Errorf("unknown balance report format %q", format)
+	}
+}
+
+func csvBalanceReport(ctx context.Context, store latestStateChainReader, stateStore *hamt.CborIpldStore, tsKey types.SortedCidSet, w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"address", "balance"}); err != nil {
+		return err
+	}
+	err := ForEachActor(ctx, store, stateStore, tsKey, func(addr address.Address, act *actor.Actor) error {
+		return cw.Write([]string{addr.String(), act.Balance.String()})
+	})
+	if err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func jsonBalanceReport(ctx context.Context, store latestStateChainReader, stateStore *hamt.CborIpldStore, tsKey types.SortedCidSet, w io.Writer) error {
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+	sep := "\n"
+	err := ForEachActor(ctx, store, stateStore, tsKey, func(addr address.Address, act *actor.Actor) error {
+		row, err := json.Marshal(BalanceReportRow{Address: addr, Balance: act.Balance})
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, sep); err != nil {
+			return err
+		}
+		sep = ",\n"
+		_, err = w.Write(row)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n]\n")
+	return err
+}
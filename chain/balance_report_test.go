@@ -0,0 +1,96 @@
+package chain_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"testing"
+
+	"github.com/ipfs/go-hamt-ipld"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/consensus"
+	"github.com/filecoin-project/go-filecoin/repo"
+	th "github.com/filecoin-project/go-filecoin/testhelpers"
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestBalanceReport(t *testing.T) {
+	tf.UnitTest(t)
+
+	ctx := context.Background()
+	r := repo.NewInMemoryRepo()
+	bs := bstore.NewBlockstore(r.Datastore())
+	cst := hamt.NewCborStore()
+	addrGetter := address.NewForTestGetter()
+	funded1, funded2 := addrGetter(), addrGetter()
+	genesis, err := consensus.MakeGenesisFunc(
+		consensus.ActorAccount(funded1, types.NewAttoFILFromFIL(100)),
+		consensus.ActorAccount(funded2, types.NewAttoFILFromFIL(250)),
+	)(cst, bs)
+	require.NoError(t, err)
+	genTS := th.RequireNewTipSet(t, genesis)
+	store := chain.NewDefaultStore(r.ChainDatastore(), genesis.Cid())
+	th.RequirePutTsas(ctx, t, store, &chain.TipSetAndState{TipSet: genTS, TipSetStateRoot: genesis.StateRoot})
+	require.NoError(t, store.SetHead(ctx, genTS))
+
+	// The funded accounts, the default accounts and the empty builtin
+	// actors.
+	expected := map[string]string{
+		funded1.String():                      "100",
+		funded2.String():                      "250",
+		address.NetworkAddress.String():       "10000000000",
+		address.TestAddress.String():          "50000",
+		address.TestAddress2.String():         "60000",
+		address.StorageMarketAddress.String(): "0",
+		address.PaymentBrokerAddress.String(): "0",
+	}
+	expectedTotal := types.NewAttoFILFromFIL(10000110350)
+
+	t.Run("csv", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, chain.BalanceReport(ctx, store, cst, types.SortedCidSet{}, &buf, chain.BalanceReportCSV))
+
+		records, err := csv.NewReader(&buf).ReadAll()
+		require.NoError(t, err)
+		require.Equal(t, []string{"address", "balance"}, records[0])
+		balances := make(map[string]string)
+		total := types.NewZeroAttoFIL()
+		for _, record := range records[1:] {
+			balances[record[0]] = record[1]
+			balance, ok := types.NewAttoFILFromFILString(record[1])
+			require.True(t, ok)
+			total = total.Add(balance)
+		}
+		assert.Equal(t, expected, balances)
+		assert.True(t, expectedTotal.Equal(total), "total %s", total)
+	})
+
+	t.Run("json at explicit tipset", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, chain.BalanceReport(ctx, store, cst, genTS.ToSortedCidSet(), &buf, chain.BalanceReportJSON))
+
+		var rows []chain.BalanceReportRow
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &rows))
+		balances := make(map[string]string)
+		total := types.NewZeroAttoFIL()
+		for _, row := range rows {
+			balances[row.Address.String()] = row.Balance.String()
+			total = total.Add(row.Balance)
+		}
+		assert.Equal(t, expected, balances)
+		assert.True(t, expectedTotal.Equal(total), "total %s", total)
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.Error(t, chain.BalanceReport(ctx, store, cst, types.SortedCidSet{}, &buf, "xml"))
+		assert.Equal(t, 0, buf.Len())
+	})
+}
@@ -0,0 +1,60 @@
+package chain
+
+import (
+	"github.com/ipfs/go-cid"
+
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// BlockObserver is called with each block the syncer fetches, its encoded
+// size and whether the fetcher already held it locally.
+type BlockObserver func(c cid.Cid, sizeBytes int, fromLocal bool)
+
+// localBlockChecker is implemented by fetchers that can tell whether they
+// hold a block locally without going to the network.
+type localBlockChecker interface {
+	HasLocalBlock(c cid.Cid) bool
+}
+
+// ObserveBlocks configures the syncer to call obs with each block it fetches
+// while collecting a chain, so that tooling can measure per block fetch
+// timing and sizes.  obs is called on the sync path once the blocks of a
+// tipset arrive, so it must return quickly.  Blocks are reported as local
+// only if the syncer's fetcher can tell that it held them before the fetch.
+func ObserveBlocks(obs BlockObserver) SyncerOpt {
+	return func(syncer *DefaultSyncer) {
+		syncer.blockObserver = obs
+	}
+}
+
+// localBlocks returns the subset of blkCids the syncer's fetcher holds
+// locally.  It returns nil if no block observer is configured or the fetcher
+// cannot tell.
+func (syncer *DefaultSyncer) localBlocks(blkCids []cid.Cid) map[cid.Cid]struct{} {
+	if syncer.blockObserver == nil {
+		return nil
+	}
+	checker, ok := syncer.fetcher.(localBlockChecker)
+	if !ok {
+		return nil
+	}
+	local := make(map[cid.Cid]struct{})
+	for _, c := range blkCids {
+		if checker.HasLocalBlock(c) {
+			local[c] = struct{}{}
+		}
+	}
+	return local
+}
+
+// observeBlocks reports the fetched blocks blks to the block observer, if
+// any.  local holds the cids of the blocks held locally before the fetch.
+func (syncer *DefaultSyncer) observeBlocks(blks []*types.Block, local map[cid.Cid]struct{}) {
+	if syncer.blockObserver == nil {
+		return
+	}
+	for _, blk := range blks {
+		_, fromLocal := local[blk.Cid()]
+		syncer.blockObserver(blk.Cid(), len(blk.ToNode().RawData()), fromLocal)
+	}
+}
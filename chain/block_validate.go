@@ -0,0 +1,76 @@
+package chain
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// ErrMinerNotAllowed is returned by a MinerAllowlist validator for a block
+// mined by a miner not on the list.
+var ErrMinerNotAllowed = errors.New("block mined by a miner not on the allowlist")
+
+// BlockValidator returns an error if blk is not valid on its own.
+type BlockValidator func(ctx context.Context, blk *types.Block) error
+
+// ValidateBlocks configures the syncer to check every block of each tipset it
+// fetches with validate.  A tipset holding a block that fails is rejected and
+// cached as bad, along with its descendants.  Widen checks each stored block
+// it would add to a tipset with validate too, and leaves out the blocks that
+// fail rather than the whole stored tipset, so that one bad block in a
+// stored sibling does not keep its valid blocks from the widened tipset.
+func ValidateBlocks(validate BlockValidator) SyncerOpt {
+	return func(syncer *DefaultSyncer) {
+		syncer.validateBlock = validate
+	}
+}
+
+// MinerAllowlist returns a BlockValidator that accepts only blocks mined by
+// one of miners, for permissioned networks.  Blocks from other miners fail
+// with ErrMinerNotAllowed.  An empty list accepts every block.
+func MinerAllowlist(miners []address.Address) BlockValidator {
+	allowed := make(map[address.Address]struct{}, len(miners))
+	for _, miner := range miners {
+		allowed[miner] = struct{}{}
+	}
+	return func(ctx context.Context, blk *types.Block) error {
+		if len(allowed) == 0 {
+			return nil
+		}
+		if _, ok := allowed[blk.Miner]; !ok {
+			return errors.Wrapf(ErrMinerNotAllowed, "block %s mined by %s", blk.Cid().String(), blk.Miner.String())
+		}
+		return nil
+	}
+}
+
+// checkBlocks returns the error of the first block of ts that fails the
+// syncer's block validator, if it has one.
+func (syncer *DefaultSyncer) checkBlocks(ctx context.Context, ts types.TipSet) error {
+	if syncer.validateBlock == nil {
+		return nil
+	}
+	for _, blk := range ts.ToSlice() {
+		if err := syncer.validateBlock(ctx, blk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// widenBlockValid returns true if blk, a block of a stored sibling of the
+// tipset being widened, passes the syncer's block validator, if it has one.
+func (syncer *DefaultSyncer) widenBlockValid(ctx context.Context, blk *types.Block) bool {
+	if syncer.validateBlock == nil {
+		return true
+	}
+	if err := syncer.validateBlock(ctx, blk); err != nil {
+		logSyncer.Infof("leaving block %s out of widened tipset: %s", blk.Cid().String(), err)
+		widenBlocksSkippedCt.Inc(ctx, 1)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,48 @@
+package chain_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/chain/synctest"
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+)
+
+func TestMinerAllowlist(t *testing.T) {
+	tf.UnitTest(t)
+	ctx := context.Background()
+
+	h := synctest.NewHarness(t)
+	h.Build(
+		synctest.Spec{Name: "approved"},
+		synctest.Spec{Name: "other"},
+	)
+	approved := h.TipSet("approved").ToSlice()[0]
+	other := h.TipSet("other").ToSlice()[0]
+
+	t.Run("an empty allowlist accepts every miner", func(t *testing.T) {
+		validate := chain.MinerAllowlist(nil)
+		assert.NoError(t, validate(ctx, approved))
+		assert.NoError(t, validate(ctx, other))
+	})
+
+	t.Run("the syncer rejects blocks of unapproved miners", func(t *testing.T) {
+		syncer := chain.NewDefaultSyncer(h.StateStore, h.Consensus, h.Store, h.Fetcher,
+			chain.ValidateBlocks(chain.MinerAllowlist([]address.Address{approved.Miner})),
+		)
+
+		err := syncer.HandleNewTipset(ctx, h.TipSet("other").ToSortedCidSet())
+		require.Error(t, err)
+		assert.Equal(t, chain.ErrMinerNotAllowed, errors.Cause(err))
+		h.RequireHead(synctest.GenesisName)
+
+		require.NoError(t, syncer.HandleNewTipset(ctx, h.TipSet("approved").ToSortedCidSet()))
+		h.RequireHead("approved")
+	})
+}
@@ -0,0 +1,99 @@
+package chain
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ipfs/go-cid"
+
+	"github.com/filecoin-project/go-filecoin/types"
+	"github.com/filecoin-project/go-filecoin/util/lru"
+)
+
+// DefaultTipSetCacheSize is the number of tipsets and blocks a
+// CachingChainReader keeps in memory by default.
+const DefaultTipSetCacheSize = 256
+
+// CachingChainReader decorates a syncer's chain store with bounded LRU caches
+// of tipsets and blocks so that tipsets near the head, which the syncer reads
+// repeatedly, are served from memory.  Tipsets and blocks are immutable given
+// their keys, so entries only need to be dropped when the underlying store
+// rewrites a tipset with PutTipSetAndState.  Values returned from the cache
+// are shared and must not be modified.
+type CachingChainReader struct {
+	syncerChainReader
+
+	mu      sync.Mutex
+	tipSets *lru.Cache
+	blocks  *lru.Cache
+}
+
+// NewCachingChainReader returns a CachingChainReader in front of s holding at
+// most size tipsets and size blocks.
+func NewCachingChainReader(s syncerChainReader, size int) *CachingChainReader {
+	return &CachingChainReader{
+		syncerChainReader: s,
+		tipSets:           lru.New(size),
+		blocks:            lru.New(size),
+	}
+}
+
+// GetTipSet returns the tipset with the given key, reading through to the
+// underlying store on a miss.
+func (c *CachingChainReader) GetTipSet(tsKey types.SortedCidSet) (*types.TipSet, error) {
+	key := tsKey.String()
+	c.mu.Lock()
+	cached, ok := c.tipSets.Get(key)
+	c.mu.Unlock()
+	if ok {
+		return cached.(*types.TipSet), nil
+	}
+
+	ts, err := c.syncerChainReader.GetTipSet(tsKey)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.tipSets.Add(key, ts)
+	c.mu.Unlock()
+	return ts, nil
+}
+
+// GetBlock returns the block with cid blkCid, reading through to the
+// underlying store on a miss.
+func (c *CachingChainReader) GetBlock(ctx context.Context, blkCid cid.Cid) (*types.Block, error) {
+	key := blkCid.KeyString()
+	c.mu.Lock()
+	cached, ok := c.blocks.Get(key)
+	c.mu.Unlock()
+	if ok {
+		return cached.(*types.Block), nil
+	}
+
+	blk, err := c.syncerChainReader.GetBlock(ctx, blkCid)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.blocks.Add(key, blk)
+	c.mu.Unlock()
+	return blk, nil
+}
+
+// PutTipSetAndState writes tsas to the underlying store and drops any cached
+// copy of its tipset.
+func (c *CachingChainReader) PutTipSetAndState(ctx context.Context, tsas *TipSetAndState) error {
+	c.mu.Lock()
+	c.tipSets.Remove(tsas.TipSet.String())
+	c.mu.Unlock()
+	return c.syncerChainReader.PutTipSetAndState(ctx, tsas)
+}
+
+// SetHead sets the head of the underlying store and drops any cached copy of
+// the new head so that the next read reflects the store.
+func (c *CachingChainReader) SetHead(ctx context.Context, ts types.TipSet) error {
+	c.mu.Lock()
+	c.tipSets.Remove(ts.String())
+	c.mu.Unlock()
+	return c.syncerChainReader.SetHead(ctx, ts)
+}
@@ -0,0 +1,126 @@
+package chain_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/repo"
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestCachingChainReader(t *testing.T) {
+	tf.UnitTest(t)
+	ctx := context.Background()
+	dstP := initDSTParams()
+	initStoreTest(ctx, t, dstP)
+
+	newCache := func() (*chain.CachingChainReader, chain.Store) {
+		cs := newChainStore(dstP)
+		require.NoError(t, cs.PutTipSetAndState(ctx, &chain.TipSetAndState{TipSet: dstP.genTS, TipSetStateRoot: dstP.genStateRoot}))
+		require.NoError(t, cs.SetHead(ctx, dstP.genTS))
+		return chain.NewCachingChainReader(cs, 2), cs
+	}
+
+	t.Run("reads through to the store", func(t *testing.T) {
+		cache, _ := newCache()
+		for i := 0; i < 2; i++ {
+			ts, err := cache.GetTipSet(dstP.genTS.ToSortedCidSet())
+			require.NoError(t, err)
+			assert.Equal(t, dstP.genTS, *ts)
+
+			blk, err := cache.GetBlock(ctx, dstP.genesis.Cid())
+			require.NoError(t, err)
+			assert.True(t, dstP.genesis.Cid().Equals(blk.Cid()))
+		}
+	})
+
+	t.Run("misses are not cached", func(t *testing.T) {
+		cache, _ := newCache()
+		_, err := cache.GetTipSet(dstP.link1.ToSortedCidSet())
+		assert.Error(t, err)
+
+		require.NoError(t, cache.PutTipSetAndState(ctx, &chain.TipSetAndState{TipSet: dstP.link1, TipSetStateRoot: dstP.link1State}))
+		ts, err := cache.GetTipSet(dstP.link1.ToSortedCidSet())
+		require.NoError(t, err)
+		assert.Equal(t, dstP.link1, *ts)
+	})
+
+	t.Run("never stale after updates", func(t *testing.T) {
+		cache, cs := newCache()
+		for _, tsas := range []*chain.TipSetAndState{
+			{TipSet: dstP.link1, TipSetStateRoot: dstP.link1State},
+			{TipSet: dstP.link2, TipSetStateRoot: dstP.link2State},
+			{TipSet: dstP.link3, TipSetStateRoot: dstP.link3State},
+		} {
+			require.NoError(t, cache.PutTipSetAndState(ctx, tsas))
+			require.NoError(t, cache.SetHead(ctx, tsas.TipSet))
+
+			head, err := cache.GetTipSet(cache.GetHead())
+			require.NoError(t, err)
+			assert.Equal(t, tsas.TipSet, *head)
+
+			// The cache agrees with the store for every tipset, including
+			// those evicted from the cache.
+			for _, ts := range []types.TipSet{dstP.genTS, dstP.link1, dstP.link2, dstP.link3} {
+				fromStore, storeErr := cs.GetTipSet(ts.ToSortedCidSet())
+				fromCache, cacheErr := cache.GetTipSet(ts.ToSortedCidSet())
+				assert.Equal(t, storeErr == nil, cacheErr == nil)
+				if storeErr == nil {
+					assert.Equal(t, *fromStore, *fromCache)
+				}
+			}
+		}
+	})
+}
+
+// BenchmarkCachingChainReader measures the syncer's access pattern of
+// repeatedly reading the head and its recent ancestors.
+func BenchmarkCachingChainReader(b *testing.B) {
+	ctx := context.Background()
+	cs := chain.NewDefaultStore(repo.NewInMemoryRepo().ChainDatastore(), types.SomeCid())
+
+	var recent []types.TipSet
+	var parent *types.Block
+	for i := 0; i < 100; i++ {
+		blk := types.NewBlockForTest(parent, uint64(i))
+		blk.StateRoot = types.SomeCid()
+		ts, err := types.NewTipSet(blk)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := cs.PutTipSetAndState(ctx, &chain.TipSetAndState{TipSet: ts, TipSetStateRoot: blk.StateRoot}); err != nil {
+			b.Fatal(err)
+		}
+		recent = append(recent, ts)
+		parent = blk
+	}
+	recent = recent[len(recent)-chain.DefaultTipSetCacheSize/16:]
+
+	run := func(b *testing.B, reader interface {
+		GetTipSet(types.SortedCidSet) (*types.TipSet, error)
+		GetBlock(context.Context, cid.Cid) (*types.Block, error)
+	}) {
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			for _, ts := range recent {
+				if _, err := reader.GetTipSet(ts.ToSortedCidSet()); err != nil {
+					b.Fatal(err)
+				}
+				for _, c := range ts.ToSortedCidSet().ToSlice() {
+					if _, err := reader.GetBlock(ctx, c); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		}
+	}
+
+	b.Run("store", func(b *testing.B) { run(b, cs) })
+	b.Run("cached", func(b *testing.B) { run(b, chain.NewCachingChainReader(cs, chain.DefaultTipSetCacheSize)) })
+}
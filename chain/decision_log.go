@@ -0,0 +1,171 @@
+package chain
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/filecoin-project/go-filecoin/state"
+	"github.com/filecoin-project/go-filecoin/types"
+	"github.com/filecoin-project/go-filecoin/util/lru"
+)
+
+// DecisionOutcome is what the syncer finally did with a tipset.
+type DecisionOutcome string
+
+const (
+	// OutcomePending means the syncer has not finished with the tipset.
+	OutcomePending = DecisionOutcome("")
+	// OutcomeHead means the tipset became the head.
+	OutcomeHead = DecisionOutcome("became head")
+	// OutcomeNotHeaviest means the tipset was valid and stored, but not
+	// heavier than the head.
+	OutcomeNotHeaviest = DecisionOutcome("not heaviest")
+	// OutcomeDampened means the tipset was heavier than the head, but the
+	// reorg to it was dampened while the head was thrashing.
+	OutcomeDampened = DecisionOutcome("reorg dampened")
+	// OutcomeInvalid means the tipset failed validation.
+	OutcomeInvalid = DecisionOutcome("invalid")
+	// OutcomeRejected means the tipset, or a tipset of its chain, was
+	// rejected while fetching the chain, before validation.
+	OutcomeRejected = DecisionOutcome("rejected")
+)
+
+// TipSetDecision records how the syncer decided what to do with a tipset.
+type TipSetDecision struct {
+	// Key is the key of the tipset.
+	Key types.SortedCidSet
+	// FetchedAt is when the syncer fetched the tipset's blocks.  It is zero
+	// if the syncer did not fetch them, e.g. because widen built the tipset
+	// from stored blocks.
+	FetchedAt time.Time
+	// Validated is true once the tipset passed validation.
+	Validated bool
+	// Reason is why validation failed, if it did.
+	Reason string
+	// Head is the key of the head the tipset was weighed against.
+	Head types.SortedCidSet
+	// Weight is the weight of the tipset.
+	Weight uint64
+	// HeadWeight is the weight of the head it was weighed against.
+	HeadWeight uint64
+	// Heavier is true if the tipset was heavier than the head.
+	Heavier bool
+	// ReorgDepth is the depth of the reorg to the tipset, zero if switching
+	// to it was not a reorg.
+	ReorgDepth int
+	// Outcome is what the syncer finally did with the tipset.
+	Outcome DecisionOutcome
+	// DecidedAt is when the syncer reached the outcome.
+	DecidedAt time.Time
+}
+
+// RecordDecisions configures the syncer to keep a log of how it decided what
+// to do with each of the last size tipsets it handled, queryable with
+// DecisionLog.  Logging costs an extra weighing of each tipset against the
+// head, so it is meant for diagnosis.  A size of zero or less disables the
+// log.
+func RecordDecisions(size int) SyncerOpt {
+	return func(syncer *DefaultSyncer) {
+		if size > 0 {
+			syncer.decisions = newDecisionLog(size)
+		}
+	}
+}
+
+// DecisionLog returns the syncer's record of its decision on the tipset with
+// key tsKey, and false if it has none.
+func (syncer *DefaultSyncer) DecisionLog(tsKey types.SortedCidSet) (TipSetDecision, bool) {
+	return syncer.decisions.get(tsKey.String())
+}
+
+// decisionLog holds the decisions on the most recently handled tipsets.  A
+// nil log records nothing.
+type decisionLog struct {
+	mu sync.Mutex
+	// decisions holds a *TipSetDecision for each tipset key, evicting the
+	// least recently updated.
+	decisions *lru.Cache
+}
+
+func newDecisionLog(size int) *decisionLog {
+	return &decisionLog{
+		decisions: lru.New(size),
+	}
+}
+
+// update applies f to the decision on the tipset with key tsKey, adding it
+// if it is new and evicting the least recently updated decision if the log
+// is full.
+func (dl *decisionLog) update(tsKey types.SortedCidSet, f func(d *TipSetDecision)) {
+	if dl == nil {
+		return
+	}
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+
+	key := tsKey.String()
+	d, ok := dl.decisions.Get(key)
+	if !ok {
+		d = &TipSetDecision{Key: tsKey}
+		dl.decisions.Add(key, d)
+	}
+	f(d.(*TipSetDecision))
+}
+
+func (dl *decisionLog) get(key string) (TipSetDecision, bool) {
+	if dl == nil {
+		return TipSetDecision{}, false
+	}
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+
+	d, ok := dl.decisions.Peek(key)
+	if !ok {
+		return TipSetDecision{}, false
+	}
+	return *d.(*TipSetDecision), true
+}
+
+// decide records outcome as the syncer's decision on ts.
+func (syncer *DefaultSyncer) decide(ts types.TipSet, outcome DecisionOutcome, reason error) {
+	syncer.decideKey(ts.ToSortedCidSet(), outcome, reason)
+}
+
+// decideKey records outcome as the syncer's decision on the tipset with key
+// tsKey.
+func (syncer *DefaultSyncer) decideKey(tsKey types.SortedCidSet, outcome DecisionOutcome, reason error) {
+	if syncer.decisions == nil {
+		return
+	}
+	now := syncer.clock.Now()
+	syncer.decisions.update(tsKey, func(d *TipSetDecision) {
+		d.Outcome = outcome
+		d.DecidedAt = now
+		if reason != nil {
+			d.Reason = reason.Error()
+		}
+	})
+}
+
+// noteWeighed records the weighing of next against head in the decision log.
+func (syncer *DefaultSyncer) noteWeighed(ctx context.Context, next, head types.TipSet, nextParentSt, headParentSt state.Tree, heavier bool) {
+	if syncer.decisions == nil {
+		return
+	}
+	nextW, err := syncer.consensus.Weight(ctx, next, nextParentSt)
+	if err != nil {
+		logSyncer.Warningf("failed to weigh %s for the decision log: %s", next.String(), err)
+	}
+	headW, err := syncer.consensus.Weight(ctx, head, headParentSt)
+	if err != nil {
+		logSyncer.Warningf("failed to weigh %s for the decision log: %s", head.String(), err)
+	}
+	syncer.decisions.update(next.ToSortedCidSet(), func(d *TipSetDecision) {
+		d.Validated = true
+		d.Head = head.ToSortedCidSet()
+		d.Weight = nextW
+		d.HeadWeight = headW
+		d.Heavier = heavier
+	})
+}
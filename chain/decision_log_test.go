@@ -0,0 +1,91 @@
+package chain_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/chain/synctest"
+	th "github.com/filecoin-project/go-filecoin/testhelpers"
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+)
+
+func TestDecisionLog(t *testing.T) {
+	tf.UnitTest(t)
+	now := time.Unix(1234567890, 0)
+	h := synctest.NewHarness(t, chain.SyncerClock(th.NewFakeClock(now)), chain.RecordDecisions(16))
+	h.Build(synctest.Linear("main", "", 3)...)
+	h.Build(synctest.Spec{Name: "fork", Parent: "main1"})
+	h.Build(synctest.Spec{Name: "bad", Parent: "main3", Bad: true})
+
+	h.RequireSync("main3")
+	h.RequireSync("fork")
+	h.RequireHead("main3")
+
+	main, ok := h.Syncer.DecisionLog(h.TipSet("main3").ToSortedCidSet())
+	require.True(t, ok)
+	assert.Equal(t, chain.OutcomeHead, main.Outcome)
+	assert.True(t, main.Heavier)
+
+	// The competing tipset was valid but lighter than the head.
+	fork, ok := h.Syncer.DecisionLog(h.TipSet("fork").ToSortedCidSet())
+	require.True(t, ok)
+	assert.Equal(t, now, fork.FetchedAt)
+	assert.True(t, fork.Validated)
+	assert.Equal(t, h.TipSet("main3").ToSortedCidSet(), fork.Head)
+	assert.Equal(t, h.Weight("fork"), fork.Weight)
+	assert.Equal(t, h.Weight("main3"), fork.HeadWeight)
+	assert.False(t, fork.Heavier)
+	assert.Equal(t, 0, fork.ReorgDepth)
+	assert.Equal(t, chain.OutcomeNotHeaviest, fork.Outcome)
+	assert.Equal(t, now, fork.DecidedAt)
+
+	assert.Error(t, h.Sync("bad"))
+	bad, ok := h.Syncer.DecisionLog(h.TipSet("bad").ToSortedCidSet())
+	require.True(t, ok)
+	assert.False(t, bad.Validated)
+	assert.Equal(t, chain.OutcomeInvalid, bad.Outcome)
+	assert.NotEmpty(t, bad.Reason)
+
+	// A descendant of the bad tipset is rejected while fetching its chain.
+	h.Build(synctest.Spec{Name: "child", Parent: "bad"})
+	assert.Equal(t, chain.ErrChainHasBadTipSet, errors.Cause(h.Sync("child")))
+	child, ok := h.Syncer.DecisionLog(h.TipSet("child").ToSortedCidSet())
+	require.True(t, ok)
+	assert.Equal(t, chain.OutcomeRejected, child.Outcome)
+	bad, ok = h.Syncer.DecisionLog(h.TipSet("bad").ToSortedCidSet())
+	require.True(t, ok)
+	assert.Equal(t, chain.OutcomeInvalid, bad.Outcome)
+
+	_, ok = h.Syncer.DecisionLog(h.TipSet(synctest.GenesisName).ToSortedCidSet())
+	assert.False(t, ok)
+}
+
+func TestDecisionLogRecordsRejections(t *testing.T) {
+	tf.UnitTest(t)
+	h := synctest.NewHarness(t, chain.RecordDecisions(16), chain.RequireNetworkName("testnet"))
+	h.Build(synctest.Linear("link", "", 2)...)
+
+	assert.Equal(t, chain.ErrWrongNetwork, errors.Cause(h.Sync("link2")))
+	d, ok := h.Syncer.DecisionLog(h.TipSet("link2").ToSortedCidSet())
+	require.True(t, ok)
+	assert.Equal(t, chain.OutcomeRejected, d.Outcome)
+	assert.False(t, d.Validated)
+	assert.NotEmpty(t, d.Reason)
+}
+
+func TestDecisionLogIsBounded(t *testing.T) {
+	tf.UnitTest(t)
+	h := synctest.NewHarness(t, chain.SyncerClock(th.NewFakeClock(time.Unix(0, 0))), chain.RecordDecisions(2))
+	h.Build(synctest.Linear("link", "", 3)...)
+	h.RequireSync("link3")
+
+	_, ok := h.Syncer.DecisionLog(h.TipSet("link1").ToSortedCidSet())
+	assert.False(t, ok)
+	_, ok = h.Syncer.DecisionLog(h.TipSet("link3").ToSortedCidSet())
+	assert.True(t, ok)
+}
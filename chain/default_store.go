@@ -6,7 +6,7 @@ import (
 	"runtime/debug"
 	"sync"
 
-	"github.com/cskr/pubsub"
+	blocks "github.com/ipfs/go-block-format"
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-datastore"
 	bstore "github.com/ipfs/go-ipfs-blockstore"
@@ -37,6 +37,17 @@ type DefaultStore struct {
 	// to set and get chain meta-data, specifically the tipset cidset to
 	// state root mapping, and the heaviest tipset cids.
 	ds repo.Datastore
+	// codec encodes blocks in bsPriv.
+	codec types.Codec
+
+	// messageDepth is the number of rounds below the head within which
+	// blocks keep their message bodies.  Zero keeps all messages.
+	messageDepth uint64
+	// pruneMu protects messagesPrunedBelow.
+	pruneMu sync.Mutex
+	// messagesPrunedBelow is the height below which PruneMessages has
+	// pruned message bodies since the store was created.
+	messagesPrunedBelow uint64
 
 	// genesis is the CID of the genesis block.
 	genesis cid.Cid
@@ -45,31 +56,54 @@ type DefaultStore struct {
 	// Protects head and genesisCid.
 	mu sync.RWMutex
 
-	// headEvents is a pubsub channel that publishes an event every time the head changes.
-	// We operate under the assumption that tipsets published to this channel
-	// will always be queued and delivered to subscribers in the order discovered.
-	// Successive published tipsets may be supersets of previously published tipsets.
-	// TODO: rename to notifications.  Also, reconsider ordering assumption depending
-	// on decisions made around the FC node notification system.
-	headEvents *pubsub.PubSub
+	// headSubs holds the subscriptions to head changes through bounded
+	// buffers.
+	headSubs map[*HeadSubscription]struct{}
+	// subsMu protects headSubs.
+	subsMu sync.Mutex
 
 	// Tracks tipsets by height/parentset for use by expected consensus.
 	tipIndex *TipIndex
+
+	// headStateStore loads the state of each new head before it is set.
+	// It is nil if head state is not verified.
+	headStateStore StateStore
+
+	// supplyTotals caches the total supply of state trees by state root.
+	supplyTotals map[cid.Cid]*types.AttoFIL
+	// supplyMu protects supplyTotals.
+	supplyMu sync.Mutex
 }
 
 // Ensure DefaultStore satisfies the Store interface at compile time.
 var _ Store = (*DefaultStore)(nil)
 
+// StoreOpt configures optional behavior of a DefaultStore.
+type StoreOpt func(*DefaultStore)
+
+// WithCodec configures the store to encode and decode blocks with codec
+// rather than types.CborCodec.  Blocks are still keyed by their cids.
+func WithCodec(codec types.Codec) StoreOpt {
+	return func(store *DefaultStore) {
+		store.codec = codec
+	}
+}
+
 // NewDefaultStore constructs a new default store.
-func NewDefaultStore(ds repo.Datastore, genesisCid cid.Cid) *DefaultStore {
+func NewDefaultStore(ds repo.Datastore, genesisCid cid.Cid, opts ...StoreOpt) *DefaultStore {
 	priv := bstore.NewBlockstore(ds)
-	return &DefaultStore{
-		bsPriv:     priv,
-		ds:         ds,
-		headEvents: pubsub.New(128),
-		tipIndex:   NewTipIndex(),
-		genesis:    genesisCid,
+	store := &DefaultStore{
+		bsPriv:   priv,
+		ds:       ds,
+		codec:    types.CborCodec,
+		headSubs: make(map[*HeadSubscription]struct{}),
+		tipIndex: NewTipIndex(),
+		genesis:  genesisCid,
+	}
+	for _, opt := range opts {
+		opt(store)
 	}
+	return store
 }
 
 // Load rebuilds the DefaultStore's caches by traversing backwards from the
@@ -87,11 +121,18 @@ func NewDefaultStore(ds repo.Datastore, genesisCid cid.Cid) *DefaultStore {
 // head does not link back to the expected genesis block, or the Store's
 // datastore does not store a link in the chain.  In case of error the caller
 // should not consider the chain useable and propagate the error.
+//
+// A store without a head, as when its datastore was wiped, loads empty.  The
+// syncer's CheckGenesis reports it.
 func (store *DefaultStore) Load(ctx context.Context) (err error) {
 	ctx, span := trace.StartSpan(ctx, "DefaultStore.Load")
 	defer tracing.AddErrorEndSpan(ctx, span, &err)
 
 	tipCids, err := store.loadHead()
+	if errors.Cause(err) == datastore.ErrNotFound {
+		logStore.Warning("chain store has no head, loading an empty chain")
+		return nil
+	}
 	if err != nil {
 		return err
 	}
@@ -114,7 +155,7 @@ func (store *DefaultStore) Load(ctx context.Context) (err error) {
 	logStatusEvery := startHeight / 10
 
 	var genesii types.TipSet
-	for iterator := IterAncestors(ctx, store, headTs); !iterator.Complete(); err = iterator.Next() {
+	for iterator := IterAncestors(ctx, headerProvider{store}, headTs); !iterator.Complete(); err = iterator.Next() {
 		if err != nil {
 			return err
 		}
@@ -126,13 +167,14 @@ func (store *DefaultStore) Load(ctx context.Context) (err error) {
 		if logStatusEvery != 0 && (types.Uint64(height)%logStatusEvery) == 0 {
 			logStore.Infof("load tipset: %s, height: %v", iterator.Value().String(), height)
 		}
-		stateRoot, err := store.loadStateRoot(iterator.Value())
+		stateRoot, gasUsed, err := store.loadTipSetState(iterator.Value())
 		if err != nil {
 			return err
 		}
 		err = store.PutTipSetAndState(ctx, &TipSetAndState{
 			TipSet:          iterator.Value(),
 			TipSetStateRoot: stateRoot,
+			GasUsed:         gasUsed,
 		})
 		if err != nil {
 			return err
@@ -172,28 +214,47 @@ func (store *DefaultStore) loadHead() (types.SortedCidSet, error) {
 	return cids, nil
 }
 
-func (store *DefaultStore) loadStateRoot(ts types.TipSet) (cid.Cid, error) {
+// loadTipSetState loads the state root and gas used recorded for ts.
+func (store *DefaultStore) loadTipSetState(ts types.TipSet) (cid.Cid, types.GasUnits, error) {
 	h, err := ts.Height()
 	if err != nil {
-		return cid.Undef, err
+		return cid.Undef, 0, err
 	}
 	key := datastore.NewKey(makeKey(ts.String(), h))
 	bb, err := store.ds.Get(key)
 	if err != nil {
-		return cid.Undef, errors.Wrapf(err, "failed to read tipset key %s", ts.String())
+		return cid.Undef, 0, errors.Wrapf(err, "failed to read tipset key %s", ts.String())
 	}
 
-	var stateRoot cid.Cid
-	err = json.Unmarshal(bb, &stateRoot)
+	var rec tipSetStateRecord
+	if err := json.Unmarshal(bb, &rec); err != nil {
+		return cid.Undef, 0, errors.Wrapf(err, "failed to cast state of tipset %s", ts.String())
+	}
+	if rec.Version == 0 {
+		// Records written before gas was recorded hold the bare state root.
+		if err := json.Unmarshal(bb, &rec.StateRoot); err != nil {
+			return cid.Undef, 0, errors.Wrapf(err, "failed to cast state root of tipset %s", ts.String())
+		}
+	}
+	return rec.StateRoot, rec.GasUsed, nil
+}
+
+// encodeBlk encodes a block with the store's codec, keyed by its cid.
+func (store *DefaultStore) encodeBlk(block *types.Block) (blocks.Block, error) {
+	data, err := store.codec.EncodeBlock(block)
 	if err != nil {
-		return cid.Undef, errors.Wrapf(err, "failed to cast state root of tipset %s", ts.String())
+		return nil, errors.Wrapf(err, "failed to encode block %s", block.Cid().String())
 	}
-	return stateRoot, nil
+	return blocks.NewBlockWithCid(data, block.Cid())
 }
 
 // putBlk persists a block to disk.
 func (store *DefaultStore) putBlk(ctx context.Context, block *types.Block) error {
-	if err := store.bsPriv.Put(block.ToNode()); err != nil {
+	encoded, err := store.encodeBlk(block)
+	if err != nil {
+		return err
+	}
+	if err := store.bsPriv.Put(encoded); err != nil {
 		return errors.Wrap(err, "failed to put block")
 	}
 	return nil
@@ -221,6 +282,64 @@ func (store *DefaultStore) PutTipSetAndState(ctx context.Context, tsas *TipSetAn
 	return nil
 }
 
+// PutTipSetAndStates persists the blocks of many tipsets and their tipset
+// index entries at once.  Every tipset is checked and staged before anything
+// is written, the state root mappings are written in a single datastore
+// batch, and the in-memory index is only updated after that batch commits.
+// Indexing a tipset that passed the checks cannot fail, so an error leaves
+// none of the tipsets indexed.  Blocks are content addressed and may be left
+// in the blockstore by a failed call, but they are unreachable without an
+// index entry.
+func (store *DefaultStore) PutTipSetAndStates(ctx context.Context, tsass []*TipSetAndState) (err error) {
+	ctx, span := trace.StartSpan(ctx, "DefaultStore.PutTipSetAndStates")
+	defer tracing.AddErrorEndSpan(ctx, span, &err)
+
+	batch, err := store.ds.Batch()
+	if err != nil {
+		return errors.Wrap(err, "failed to start datastore batch")
+	}
+
+	// Stage all writes before touching any storage.  Checking the parents
+	// here too means the index updates below cannot fail after the batch
+	// has committed.
+	var blks []blocks.Block
+	for _, tsas := range tsass {
+		if _, err := tsas.TipSet.Parents(); err != nil {
+			return errors.Wrapf(err, "failed to stage tipset %s", tsas.TipSet.String())
+		}
+		key, val, err := tipSetAndStateEntry(tsas)
+		if err != nil {
+			return errors.Wrapf(err, "failed to stage tipset %s", tsas.TipSet.String())
+		}
+		if err := batch.Put(key, val); err != nil {
+			return errors.Wrapf(err, "failed to stage tipset %s", tsas.TipSet.String())
+		}
+		for _, blk := range tsas.TipSet {
+			encoded, err := store.encodeBlk(blk)
+			if err != nil {
+				return err
+			}
+			blks = append(blks, encoded)
+		}
+	}
+
+	if err := store.bsPriv.PutMany(blks); err != nil {
+		return errors.Wrap(err, "failed to put blocks")
+	}
+	if err := batch.Commit(); err != nil {
+		return errors.Wrap(err, "failed to commit tipset states")
+	}
+
+	// Update tipindex.  Put only fails on a tipset without a height or
+	// parents, which were both checked above.
+	for _, tsas := range tsass {
+		if err := store.tipIndex.Put(tsas); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // GetTipSet returns the tipset whose block
 // cids correspond to the input sorted cid set.
 func (store *DefaultStore) GetTipSet(tsKey types.SortedCidSet) (*types.TipSet, error) {
@@ -233,6 +352,16 @@ func (store *DefaultStore) GetTipSetStateRoot(tsKey types.SortedCidSet) (cid.Cid
 	return store.tipIndex.GetTipSetStateRoot(tsKey.String())
 }
 
+// GasUsedAt returns the total gas used by the messages of the tipset whose
+// block cids correspond to the input sorted cid set.
+func (store *DefaultStore) GasUsedAt(tsKey types.SortedCidSet) (types.GasUnits, error) {
+	tsas, err := store.tipIndex.Get(tsKey.String())
+	if err != nil {
+		return 0, err
+	}
+	return tsas.GasUsed, nil
+}
+
 // HasTipSetAndState returns true iff the default store's tipindex is indexing
 // the tipset referenced in the input key.
 func (store *DefaultStore) HasTipSetAndState(ctx context.Context, tsKey string) bool {
@@ -241,7 +370,7 @@ func (store *DefaultStore) HasTipSetAndState(ctx context.Context, tsKey string)
 
 // GetTipSetAndStatesByParentsAndHeight returns the the tipsets and states tracked by
 // the default store's tipIndex that have the parent set corresponding to the
-// input key.
+// input key, ordered by tipset ID.
 func (store *DefaultStore) GetTipSetAndStatesByParentsAndHeight(pTsKey string, h uint64) ([]*TipSetAndState, error) {
 	return store.tipIndex.GetByParentsAndHeight(pTsKey, h)
 }
@@ -252,6 +381,20 @@ func (store *DefaultStore) HasTipSetAndStatesWithParentsAndHeight(pTsKey string,
 	return store.tipIndex.HasByParentsAndHeight(pTsKey, h)
 }
 
+// GetTipSetsByHeight returns every tipset the default store holds at height
+// h, including tipsets on forks off the head's chain.
+func (store *DefaultStore) GetTipSetsByHeight(h uint64) ([]*types.TipSet, error) {
+	tsass, err := store.tipIndex.GetByHeight(h)
+	if err != nil {
+		return nil, err
+	}
+	var tipsets []*types.TipSet
+	for _, tsas := range tsass {
+		tipsets = append(tipsets, &tsas.TipSet)
+	}
+	return tipsets, nil
+}
+
 // GetBlocks retrieves the blocks referenced in the input cid set.
 func (store *DefaultStore) GetBlocks(ctx context.Context, cids types.SortedCidSet) (blks []*types.Block, err error) {
 	ctx, span := trace.StartSpan(ctx, "DefaultStore.GetBlocks")
@@ -270,13 +413,45 @@ func (store *DefaultStore) GetBlocks(ctx context.Context, cids types.SortedCidSe
 	return blocks, nil
 }
 
-// GetBlock retrieves a block by cid.
+// GetBlock retrieves a block by cid.  It fails with ErrMessagesPruned if the
+// block's message bodies were pruned; GetBlockHeader reads such blocks.
 func (store *DefaultStore) GetBlock(ctx context.Context, c cid.Cid) (*types.Block, error) {
+	blk, pruned, err := store.getStoredBlock(c)
+	if err != nil {
+		return nil, err
+	}
+	if pruned {
+		return nil, errors.Wrapf(ErrMessagesPruned, "block %s", c.String())
+	}
+	return blk, nil
+}
+
+// GetBlockHeader retrieves a block by cid, without its messages if their
+// bodies were pruned.  Such a block must not be validated or sent to peers.
+func (store *DefaultStore) GetBlockHeader(ctx context.Context, c cid.Cid) (*types.Block, error) {
+	blk, pruned, err := store.getStoredBlock(c)
+	if err != nil {
+		return nil, err
+	}
+	if pruned {
+		// A pruned block's header does not hash to the block's cid.
+		blk = blk.WithoutMessages(c)
+	}
+	return blk, nil
+}
+
+// getStoredBlock decodes the stored block with cid c, reporting whether its
+// message bodies were pruned.
+func (store *DefaultStore) getStoredBlock(c cid.Cid) (*types.Block, bool, error) {
 	data, err := store.bsPriv.Get(c)
 	if err != nil {
-		return nil, errors.Wrapf(err, "failed to get block %s", c.String())
+		return nil, false, errors.Wrapf(err, "failed to get block %s", c.String())
 	}
-	return types.DecodeBlock(data.RawData())
+	blk, err := store.codec.DecodeBlock(data.RawData())
+	if err != nil {
+		return nil, false, err
+	}
+	return blk, len(blk.Messages) == 0 && store.MessagesPruned(c), nil
 }
 
 // HasAllBlocks indicates whether the blocks are in the store.
@@ -293,17 +468,11 @@ func (store *DefaultStore) HasAllBlocks(ctx context.Context, cids []cid.Cid) boo
 func (store *DefaultStore) HasBlock(ctx context.Context, c cid.Cid) bool {
 	// TODO: consider adding Has method to HamtIpldCborstore if this used much,
 	// or using a different store interface for quick Has.
-	blk, err := store.GetBlock(ctx, c)
+	blk, err := store.GetBlockHeader(ctx, c)
 
 	return blk != nil && err == nil
 }
 
-// HeadEvents returns a pubsub interface the pushes events each time the
-// default store's head is reset.
-func (store *DefaultStore) HeadEvents() *pubsub.PubSub {
-	return store.headEvents
-}
-
 // SetHead sets the passed in tipset as the new head of this chain.
 func (store *DefaultStore) SetHead(ctx context.Context, ts types.TipSet) error {
 	logStore.Debugf("SetHead %s", ts.String())
@@ -314,12 +483,16 @@ func (store *DefaultStore) SetHead(ctx context.Context, ts types.TipSet) error {
 		logStore.Error(debug.Stack())
 	}
 
+	if err := store.checkHeadState(ctx, ts); err != nil {
+		return err
+	}
+
 	if err := store.setHeadPersistent(ctx, ts); err != nil {
 		return err
 	}
 
 	// Publish an event that we have a new head.
-	store.HeadEvents().Pub(ts, NewHeadTopic)
+	store.publishHead(ts)
 
 	return nil
 }
@@ -352,18 +525,42 @@ func (store *DefaultStore) writeHead(ctx context.Context, cids types.SortedCidSe
 // writeTipSetAndState writes the tipset key and the state root id to the
 // datastore.
 func (store *DefaultStore) writeTipSetAndState(tsas *TipSetAndState) error {
-	val, err := json.Marshal(tsas.TipSetStateRoot)
+	key, val, err := tipSetAndStateEntry(tsas)
 	if err != nil {
 		return err
 	}
+	return store.ds.Put(key, val)
+}
+
+// tipSetStateVersion is the version of the tipset state records the store
+// writes.  Records of version 0 hold only the bare state root.
+const tipSetStateVersion = 1
+
+// tipSetStateRecord is the value the store keeps for each tipset.
+type tipSetStateRecord struct {
+	Version   int            `json:"version"`
+	StateRoot cid.Cid        `json:"stateRoot"`
+	GasUsed   types.GasUnits `json:"gasUsed"`
+}
+
+// tipSetAndStateEntry returns the datastore key and value recording the state
+// root and gas used of a tipset.
+func tipSetAndStateEntry(tsas *TipSetAndState) (datastore.Key, []byte, error) {
+	val, err := json.Marshal(tipSetStateRecord{
+		Version:   tipSetStateVersion,
+		StateRoot: tsas.TipSetStateRoot,
+		GasUsed:   tsas.GasUsed,
+	})
+	if err != nil {
+		return datastore.Key{}, nil, err
+	}
 
-	// datastore keeps tsKey:stateRoot (k,v) pairs.
+	// datastore keeps tsKey:tipSetStateRecord (k,v) pairs.
 	h, err := tsas.TipSet.Height()
 	if err != nil {
-		return err
+		return datastore.Key{}, nil, err
 	}
-	key := datastore.NewKey(makeKey(tsas.TipSet.String(), h))
-	return store.ds.Put(key, val)
+	return datastore.NewKey(makeKey(tsas.TipSet.String(), h)), val, nil
 }
 
 // GetHead returns the current head tipset cids.
@@ -397,5 +594,10 @@ func (store *DefaultStore) GenesisCid() cid.Cid {
 
 // Stop stops all activities and cleans up.
 func (store *DefaultStore) Stop() {
-	store.headEvents.Shutdown()
+	store.subsMu.Lock()
+	defer store.subsMu.Unlock()
+	for sub := range store.headSubs {
+		delete(store.headSubs, sub)
+		close(sub.heads)
+	}
 }
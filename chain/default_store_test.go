@@ -3,6 +3,7 @@ package chain_test
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -101,6 +102,55 @@ func TestPutTipSet(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+// Many tipsets can be added to the store in one batch.
+func TestPutTipSetAndStates(t *testing.T) {
+	tf.UnitTest(t)
+	dstP := initDSTParams()
+
+	ctx := context.Background()
+	initStoreTest(ctx, t, dstP)
+
+	tsass := []*chain.TipSetAndState{
+		{TipSet: dstP.genTS, TipSetStateRoot: dstP.genStateRoot},
+		{TipSet: dstP.link1, TipSetStateRoot: dstP.link1State},
+		{TipSet: dstP.link2, TipSetStateRoot: dstP.link2State},
+		{TipSet: dstP.link3, TipSetStateRoot: dstP.link3State},
+		{TipSet: dstP.link4, TipSetStateRoot: dstP.link4State},
+	}
+
+	t.Run("all tipsets are indexed and persisted", func(t *testing.T) {
+		ds := repo.NewInMemoryRepo().ChainDatastore()
+		cs := chain.NewDefaultStore(ds, dstP.genCid)
+		require.NoError(t, cs.PutTipSetAndStates(ctx, tsass))
+
+		for _, tsas := range tsass {
+			assertTsAdded(t, cs, tsas.TipSet)
+			assert.Equal(t, tsas.TipSetStateRoot, requireGetTipSetStateRoot(ctx, t, cs, tsas.TipSet.ToSortedCidSet()))
+		}
+		got4 := requireGetTsasByParentAndHeight(t, cs, dstP.link3.String(), uint64(6))
+		assert.Equal(t, dstP.link4, got4[0].TipSet)
+
+		// A fresh store over the same datastore can load the chain.
+		require.NoError(t, cs.SetHead(ctx, dstP.link4))
+		loaded := chain.NewDefaultStore(ds, dstP.genCid)
+		require.NoError(t, loaded.Load(ctx))
+		assertHead(t, loaded, dstP.link4)
+	})
+
+	t.Run("a bad tipset mid batch adds nothing", func(t *testing.T) {
+		cs := newChainStore(dstP)
+		bad := append([]*chain.TipSetAndState{}, tsass[:2]...)
+		bad = append(bad, &chain.TipSetAndState{TipSet: types.TipSet{}, TipSetStateRoot: dstP.link2State})
+		bad = append(bad, tsass[2:]...)
+
+		assert.Error(t, cs.PutTipSetAndStates(ctx, bad))
+		for _, tsas := range tsass {
+			assert.False(t, cs.HasTipSetAndState(ctx, tsas.TipSet.String()))
+		}
+		assert.False(t, cs.HasTipSetAndStatesWithParentsAndHeight(dstP.genTS.String(), uint64(1)))
+	})
+}
+
 // Tipsets can be retrieved by key (all block cids).
 func TestGetByKey(t *testing.T) {
 	tf.UnitTest(t)
@@ -207,6 +257,8 @@ func TestGetMultipleByParent(t *testing.T) {
 	th.RequirePutTsas(ctx, t, chainStore, newChildTsas)
 	gotNew1 := requireGetTsasByParentAndHeight(t, chainStore, pk1, uint64(1))
 	require.Equal(t, 2, len(gotNew1))
+	// Siblings come back in tipset ID order.
+	assert.True(t, gotNew1[0].TipSet.String() < gotNew1[1].TipSet.String())
 	for _, tsas := range gotNew1 {
 		if len(tsas.TipSet) == 1 {
 			assert.Equal(t, newRoot, tsas.TipSetStateRoot)
@@ -216,6 +268,54 @@ func TestGetMultipleByParent(t *testing.T) {
 	}
 }
 
+// All tipsets at a height can be retrieved, whatever their parents.
+func TestGetTipSetsByHeight(t *testing.T) {
+	tf.UnitTest(t)
+	dstP := initDSTParams()
+
+	ctx := context.Background()
+	initStoreTest(ctx, t, dstP)
+	chainStore := newChainStore(dstP)
+	requirePutTestChain(t, chainStore, dstP)
+
+	mockSigner, ki := types.NewMockSignersAndKeyInfo(2)
+	fakeChildParams := th.FakeChildParams{
+		Parent:         dstP.genTS,
+		GenesisCid:     dstP.genCid,
+		StateRoot:      dstP.genStateRoot,
+		MinerAddr:      dstP.minerAddress,
+		Nonce:          uint64(5),
+		NullBlockCount: uint64(1),
+		Signer:         mockSigner,
+		MinerPubKey:    ki[0].PublicKey(),
+	}
+
+	// fork is a child of genesis at link2's height.
+	fork := th.RequireNewTipSet(t, th.RequireMkFakeChild(t, fakeChildParams))
+	th.RequirePutTsas(ctx, t, chainStore, &chain.TipSetAndState{
+		TipSet:          fork,
+		TipSetStateRoot: dstP.cidGetter(),
+	})
+
+	atHeight, err := chainStore.GetTipSetsByHeight(uint64(2))
+	require.NoError(t, err)
+	require.Equal(t, 2, len(atHeight))
+	var got []string
+	for _, ts := range atHeight {
+		got = append(got, ts.String())
+	}
+	assert.Contains(t, got, dstP.link2.String())
+	assert.Contains(t, got, fork.String())
+
+	atHeight, err = chainStore.GetTipSetsByHeight(uint64(1))
+	require.NoError(t, err)
+	require.Equal(t, 1, len(atHeight))
+	assert.Equal(t, dstP.link1, *atHeight[0])
+
+	_, err = chainStore.GetTipSetsByHeight(uint64(4))
+	assert.Equal(t, chain.ErrNotFound, err)
+}
+
 // All blocks of a tipset can be retrieved after putting their wrapping tipset.
 func TestGetBlocks(t *testing.T) {
 	tf.UnitTest(t)
@@ -245,6 +345,49 @@ func TestGetBlocks(t *testing.T) {
 	assert.Equal(t, len(blks), len(gotBlks))
 }
 
+// reversedCodec is a trivial alternate codec storing the cbor encoding
+// backwards.
+type reversedCodec struct{}
+
+func reverse(data []byte) []byte {
+	out := make([]byte, len(data))
+	for i, b := range data {
+		out[len(data)-1-i] = b
+	}
+	return out
+}
+
+func (reversedCodec) EncodeBlock(blk *types.Block) ([]byte, error) {
+	data, err := types.CborCodec.EncodeBlock(blk)
+	return reverse(data), err
+}
+
+func (reversedCodec) DecodeBlock(data []byte) (*types.Block, error) {
+	return types.CborCodec.DecodeBlock(reverse(data))
+}
+
+// Blocks round trip through a store configured with an alternate codec.
+func TestStoreWithCodec(t *testing.T) {
+	tf.UnitTest(t)
+	dstP := initDSTParams()
+
+	ctx := context.Background()
+	initStoreTest(ctx, t, dstP)
+	ds := repo.NewInMemoryRepo().Datastore()
+	store := chain.NewDefaultStore(ds, dstP.genCid, chain.WithCodec(reversedCodec{}))
+	requirePutTestChain(t, store, dstP)
+
+	// The block is stored in the codec's encoding under its cid.
+	raw, err := bstore.NewBlockstore(ds).Get(dstP.link1blk1.Cid())
+	require.NoError(t, err)
+	assert.Equal(t, reverse(dstP.link1blk1.ToNode().RawData()), raw.RawData())
+
+	gotBlk, err := store.GetBlock(ctx, dstP.link1blk1.Cid())
+	require.NoError(t, err)
+	assert.Equal(t, dstP.link1blk1.Cid(), gotBlk.Cid())
+	assert.True(t, dstP.link1blk1.Equals(gotBlk))
+}
+
 // chain.Store correctly indicates that is has all blocks in put tipsets
 func TestHasAllBlocks(t *testing.T) {
 	tf.UnitTest(t)
@@ -315,7 +458,7 @@ func TestHead(t *testing.T) {
 	assert.Equal(t, dstP.genTS.ToSortedCidSet(), chain.GetHead())
 }
 
-func assertEmptyCh(t *testing.T, ch <-chan interface{}) {
+func assertEmptyCh(t *testing.T, ch <-chan types.TipSet) {
 	select {
 	case <-ch:
 		assert.True(t, false)
@@ -323,7 +466,7 @@ func assertEmptyCh(t *testing.T, ch <-chan interface{}) {
 	}
 }
 
-// Head events are propagated on HeadEvents.
+// Head events are propagated to head subscriptions in order.
 func TestHeadEvents(t *testing.T) {
 	tf.UnitTest(t)
 	dstP := initDSTParams()
@@ -333,9 +476,9 @@ func TestHeadEvents(t *testing.T) {
 	chainStore := newChainStore(dstP)
 	requirePutTestChain(t, chainStore, dstP)
 
-	ps := chainStore.HeadEvents()
-	chA := ps.Sub(chain.NewHeadTopic)
-	chB := ps.Sub(chain.NewHeadTopic)
+	store := chainStore.(*chain.DefaultStore)
+	chA := store.SubscribeHeads(9, chain.DropNewestHead).Heads()
+	chB := store.SubscribeHeads(9, chain.DropNewestHead).Heads()
 
 	assertSetHead(t, chainStore, dstP.genTS)
 	assertSetHead(t, chainStore, dstP.link1)
@@ -362,6 +505,59 @@ func TestHeadEvents(t *testing.T) {
 	assertEmptyCh(t, chB)
 }
 
+// Slow subscribers to SubscribeHeads never block SetHead and are told when
+// they miss heads.
+func TestSubscribeHeads(t *testing.T) {
+	tf.UnitTest(t)
+	dstP := initDSTParams()
+
+	ctx := context.Background()
+	initStoreTest(ctx, t, dstP)
+	chainStore := newChainStore(dstP)
+	requirePutTestChain(t, chainStore, dstP)
+	store := chainStore.(*chain.DefaultStore)
+
+	// Neither subscriber reads until every head is set.
+	oldest := store.SubscribeHeads(2, chain.DropOldestHead)
+	newest := store.SubscribeHeads(2, chain.DropNewestHead)
+
+	heads := []types.TipSet{dstP.genTS, dstP.link1, dstP.link2, dstP.link3, dstP.link4}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, ts := range heads {
+			assertSetHead(t, chainStore, ts)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("SetHead blocked on a slow subscriber")
+	}
+
+	for _, sub := range []*chain.HeadSubscription{oldest, newest} {
+		assert.Equal(t, uint64(3), sub.Dropped())
+		select {
+		case <-sub.Missed():
+		default:
+			t.Error("subscriber was not told it missed heads")
+		}
+	}
+	assert.Equal(t, dstP.link3, <-oldest.Heads())
+	assert.Equal(t, dstP.link4, <-oldest.Heads())
+	assert.Equal(t, dstP.genTS, <-newest.Heads())
+	assert.Equal(t, dstP.link1, <-newest.Heads())
+
+	// A subscriber keeping up misses nothing.
+	assertSetHead(t, chainStore, dstP.genTS)
+	assert.Equal(t, dstP.genTS, <-oldest.Heads())
+	assert.Equal(t, uint64(3), oldest.Dropped())
+
+	store.UnsubscribeHeads(oldest)
+	_, ok := <-oldest.Heads()
+	assert.False(t, ok)
+}
+
 /* Loading  */
 // Load does not error and gives the chain store access to all blocks and
 // tipset indexes along the heaviest chain.
@@ -3,24 +3,25 @@ package chain
 import (
 	"context"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ipfs/go-cid"
-	"github.com/ipfs/go-hamt-ipld"
 	logging "github.com/ipfs/go-log"
 	"github.com/pkg/errors"
 	"go.opencensus.io/trace"
 
-	"github.com/filecoin-project/go-filecoin/actor/builtin"
+	"github.com/filecoin-project/go-filecoin/clock"
 	"github.com/filecoin-project/go-filecoin/consensus"
+	"github.com/filecoin-project/go-filecoin/metrics"
 	"github.com/filecoin-project/go-filecoin/metrics/tracing"
 	"github.com/filecoin-project/go-filecoin/sampling"
 	"github.com/filecoin-project/go-filecoin/state"
 	"github.com/filecoin-project/go-filecoin/types"
 )
 
-// The amount of time the syncer will wait while fetching the blocks of a
-// tipset over the network.
+// The default amount of time the syncer will wait while fetching the blocks of
+// a tipset over the network.
 var blkWaitTime = 30 * time.Second
 var (
 	// ErrChainHasBadTipSet is returned when the syncer traverses a chain with a cached bad tipset.
@@ -29,10 +30,65 @@ var (
 	ErrNewChainTooLong = errors.New("input chain forked from best chain too far in the past")
 	// ErrUnexpectedStoreState indicates that the syncer's chain store is violating expected invariants.
 	ErrUnexpectedStoreState = errors.New("the chain store is in an unexpected state")
+	// ErrUnexpectedStateRoot is returned when a tipset's computed state root differs from the root expected at its height.
+	ErrUnexpectedStateRoot = errors.New("computed state root does not match expected state root")
+	// ErrInvalidParentLink is returned when a tipset's parents include a block already traversed or do not have lower height than the tipset.
+	ErrInvalidParentLink = errors.New("tipset parents form a cycle or do not descend in height")
+	// ErrLateTipSet is returned when a caught up syncer receives a tipset for a round that closed more than the late block grace period ago.
+	ErrLateTipSet = errors.New("tipset arrived after its round's grace period")
+	// ErrSyncBusy is returned when the syncer already has its limit of calls
+	// to HandleNewTipset executing or waiting.
+	ErrSyncBusy = errors.New("syncer has too many pending requests")
+	// ErrCommitHookFailed is returned when the syncer's commit hook fails.
+	ErrCommitHookFailed = errors.New("commit hook failed")
+	// ErrFetchTimeout is returned when blocks are not fetched within the
+	// syncer's block wait time.
+	ErrFetchTimeout = errors.New("timed out waiting for blocks")
+	// ErrCallerDeadline is returned when the caller's context expires before
+	// blocks are fetched.
+	ErrCallerDeadline = errors.New("caller deadline exceeded waiting for blocks")
+	// ErrEquivocation is returned when a tipset holds two blocks from the
+	// same miner.
+	ErrEquivocation = errors.New("tipset holds two blocks from the same miner")
+	// ErrWidenInvariant is returned in strict widen mode when widen
+	// produces a tipset that is not a valid widening of its input.
+	ErrWidenInvariant = errors.New("widened tipset violates widen invariants")
+	// ErrWrongNetwork is returned when a tipset holds blocks produced for
+	// another network.
+	ErrWrongNetwork = errors.New("block produced for another network")
+	// ErrUnexpectedBlocks is returned when the fetcher responds to a request
+	// for blocks with a set of blocks other than the one requested.
+	ErrUnexpectedBlocks = errors.New("fetched blocks do not match the requested blocks")
+	// ErrChainStoreWrite is returned when the syncer fails to write a
+	// validated tipset to the chain store.
+	ErrChainStoreWrite = errors.New("failed to write to the chain store")
+	// ErrGenesisMismatch is returned when a chain roots in a genesis block
+	// other than the one of the syncer's store, as the chains of peers on
+	// another network do.
+	ErrGenesisMismatch = errors.New("chain roots in a different genesis block")
+	// ErrParentWeightMismatch is returned when the parent weight a tipset's
+	// blocks claim differs from the weight computed for its parent.
+	ErrParentWeightMismatch = errors.New("claimed parent weight does not match computed weight")
+	// ErrNoGenesis is returned when the chain store does not hold its
+	// genesis tipset, as when the chain datastore of an initialized repo was
+	// wiped.  The repo must be initialized again.
+	ErrNoGenesis = errors.New("chain store has no genesis tipset, re-initialize the repo")
 )
 
 var logSyncer = logging.Logger("chain.syncer")
 
+var (
+	tipSetsLostCt        = metrics.NewInt64Counter("chain/sync_tipsets_lost", "Number of tipsets validated during sync that were not heavier than the head")
+	syncStallsCt         = metrics.NewInt64Counter("chain/sync_stalls", "Number of times sync stalled on repeated fetch timeouts for a tipset")
+	reorgThrashCt        = metrics.NewInt64Counter("chain/sync_reorg_thrashing", "Number of times the syncer detected its head thrashing between forks")
+	equivocationsCt      = metrics.NewInt64Counter("chain/sync_equivocations", "Number of times the syncer saw a miner produce two blocks at the same height")
+	lowParticipationCt   = metrics.NewInt64Counter("chain/sync_low_participation", "Number of synced tipsets holding fewer blocks than expected")
+	headStallsCt         = metrics.NewInt64Counter("chain/sync_head_stalls", "Number of times a caught up syncer went without a new head for longer than the stall threshold")
+	widenBlocksSkippedCt = metrics.NewInt64Counter("chain/sync_widen_blocks_skipped", "Number of stored blocks left out of a widened tipset because they failed validation")
+	syncRetriesCt        = metrics.NewInt64Counter("chain/sync_retries", "Number of times a sync that failed with a transient error was retried")
+	syncEventsDroppedCt  = metrics.NewInt64Counter("chain/sync_events_dropped", "Number of sync events dropped because a subscriber's buffer was full")
+)
+
 type syncerChainReader interface {
 	GetBlock(context.Context, cid.Cid) (*types.Block, error)
 	GetHead() types.SortedCidSet
@@ -41,6 +97,7 @@ type syncerChainReader interface {
 	HasTipSetAndState(ctx context.Context, tsKey string) bool
 	PutTipSetAndState(ctx context.Context, tsas *TipSetAndState) error
 	SetHead(ctx context.Context, s types.TipSet) error
+	GenesisCid() cid.Cid
 	HasTipSetAndStatesWithParentsAndHeight(pTsKey string, h uint64) bool
 	GetTipSetAndStatesByParentsAndHeight(pTsKey string, h uint64) ([]*TipSetAndState, error)
 	HasAllBlocks(ctx context.Context, cs []cid.Cid) bool
@@ -76,28 +133,399 @@ type DefaultSyncer struct {
 	// fetcher is the networked block fetching service for fetching blocks
 	// and messages.
 	fetcher syncFetcher
-	// stateStore is the cborStore used for reading and writing state root
-	// to ipld object mappings.
-	stateStore *hamt.CborIpldStore
+	// stateStore provides the state trees tipsets are validated against.
+	// It need not share storage with the chain store.
+	stateStore StateStore
 	// badTipSetCache is used to filter out collections of invalid blocks.
 	badTipSets *badTipSetCache
 	consensus  consensus.Protocol
 	chainStore syncerChainReader
+
+	// finalityDepth is the number of rounds below the head after which the
+	// chain is final.  Zero disables pruning the bad tipset cache.
+	finalityDepth uint64
+	// compactionInterval is how often the bad tipset cache is pruned.
+	compactionInterval time.Duration
+
+	// targetMu protects targetHeight, targetRenewedAt and
+	// confirmedHeight.  It is separate
+	// from mu so that readers need not wait on a long running
+	// HandleNewTipset.
+	targetMu sync.Mutex
+	// targetHeight is the greatest height of any well formed tipset the
+	// syncer has fetched, as long as the tipset's chain is not found
+	// invalid.  It estimates the height of the network's head.
+	targetHeight uint64
+	// targetRenewedAt is when a tipset at targetHeight was last seen or the
+	// head last advanced toward it.
+	targetRenewedAt time.Time
+	// targetTTL is how long targetHeight is trusted without renewal.  Zero
+	// trusts it indefinitely.
+	targetTTL time.Duration
+	// confirmedHeight is the greatest height of a chain the syncer fetched
+	// back to its store, as long as the chain is not found invalid.
+	confirmedHeight uint64
+
+	// recentErrors holds the errors of the last failed calls to
+	// HandleNewTipset.
+	recentErrors *syncErrorRing
+
+	// dedup counts blocks fetched and validated more than once.
+	dedup *syncDedupTracker
+
+	// modeMu protects mode.
+	modeMu sync.Mutex
+	// mode is the sync mode last observed by Mode.
+	mode SyncMode
+	// profiles holds the fetch profile applied in each sync mode.
+	profiles map[SyncMode]FetchProfile
+
+	// pending holds a token for each call to HandleNewTipset executing or
+	// waiting to execute.  It is nil if the number of calls is unlimited.
+	pending chan struct{}
+
+	// transientRetries is the number of times HandleNewTipset retries a
+	// sync that failed with a transient error.
+	transientRetries int
+	// retryBackoff is the wait before the first retry.  It doubles with
+	// each retry.
+	retryBackoff time.Duration
+
+	// stallThreshold is the number of consecutive fetch timeouts on the
+	// same blocks after which sync is considered stalled.  Zero disables
+	// stall detection.
+	stallThreshold int
+	// onStall is called with the blocks sync stalled on.  It may be nil.
+	onStall func(blks types.SortedCidSet)
+	// stallFallback is tried for blocks sync stalled on.  It may be nil.
+	stallFallback syncFetcher
+	// stallKey and stallCount track consecutive fetch timeouts.  They are
+	// protected by mu.
+	stallKey   string
+	stallCount int
+
+	// blkWaitTime is the longest the syncer waits while fetching the blocks
+	// of a tipset.
+	blkWaitTime time.Duration
+
+	// blockObserver is called with each fetched block.  It may be nil.
+	blockObserver BlockObserver
+
+	// commitHook is called with each validated tipset before it is stored.
+	// It may be nil.
+	commitHook CommitHook
+
+	// tipSetsLost counts tipsets validated but not heavier than the head.
+	// It is accessed atomically.
+	tipSetsLost uint64
+
+	// phaseMu protects phase.  It is separate from mu so that readers need
+	// not wait on a long running HandleNewTipset.
+	phaseMu sync.Mutex
+	// phase is the step of HandleNewTipset the syncer is executing.
+	phase SyncPhase
+
+	// maxReorgs is the number of reorgs within reorgWindow above which the
+	// head is considered to be thrashing.  Zero disables detection.
+	maxReorgs   int
+	reorgWindow time.Duration
+	// reorgMargin is the weight by which a reorg must exceed the head while
+	// thrashing.
+	reorgMargin uint64
+	// onThrash is called when thrashing is detected.  It may be nil.
+	onThrash func(reorgs int)
+	// thrashMu protects reorgTimes.
+	thrashMu sync.Mutex
+	// reorgTimes holds the times of recent reorgs, oldest first.
+	reorgTimes []time.Time
+	// reorgHistoryMu protects reorgHistory.
+	reorgHistoryMu sync.Mutex
+	// reorgHistory holds the most recent reorgs, oldest first.
+	reorgHistory []ReorgInfo
+
+	// events delivers sync events to subscribers.
+	events syncEventHub
+
+	// versionMu protects version.
+	versionMu sync.Mutex
+	// version identifies the node software validating tipsets.  Tipsets
+	// quarantined by another version are released for revalidation.
+	version string
+	// quarantineStore, if not nil, persists the quarantined tipsets.
+	quarantineStore QuarantineStore
+
+	// decisions logs the syncer's decisions on recent tipsets.  It is nil
+	// unless configured.
+	decisions *decisionLog
+
+	// orphanWindow is how long a tipset whose parent is not stored is
+	// buffered awaiting its parent.  Zero disables buffering.
+	orphanWindow time.Duration
+	// orphans holds buffered tipsets by the key of their parent.  It is
+	// protected by mu.
+	orphans map[string][]bufferedOrphan
+
+	// streamBuffer is the number of fetched tipsets buffered ahead of
+	// validation when streaming a chain into the store.  Zero collects the
+	// whole chain before validating it.
+	streamBuffer int
+	// maxBlocksPerSync caps the blocks fetched by one call to
+	// HandleNewTipset.  Zero means no cap.
+	maxBlocksPerSync int
+	// checkpoint records the walk of the last call stopped at
+	// maxBlocksPerSync.  It may be nil and is protected by mu.
+	checkpoint *syncCheckpoint
+	// checkpointStore, if not nil, persists checkpoint.
+	checkpointStore CheckpointStore
+
+	// peerDialer is asked to dial peers when a fetch starts with fewer
+	// than minPeers peers.  It may be nil.
+	peerDialer PeerDialer
+	minPeers   int
+
+	// equivocations tracks the blocks of each miner at recent heights.  It
+	// is nil if equivocation detection is disabled and is protected by mu.
+	equivocations *equivocationTracker
+	// rejectEquivocation rejects tipsets holding two blocks from one
+	// miner.
+	rejectEquivocation bool
+	// onEquivocation is called with each equivocation.  It may be nil.
+	onEquivocation func(Equivocation)
+
+	// widenDisabled skips the widen step so that sync is purely linear.
+	widenDisabled bool
+	// strictWiden checks the invariants of every widened tipset.
+	strictWiden bool
+	// panicOnWidenViolation panics rather than errors when a widened
+	// tipset violates the invariants.
+	panicOnWidenViolation bool
+
+	// checkNetwork rejects tipsets holding blocks whose network name is
+	// not networkName.
+	checkNetwork bool
+	networkName  string
+	// validateBlock, if not nil, checks each block of every fetched
+	// tipset and each stored block widen would add to a tipset.
+	validateBlock BlockValidator
+
+	// minBlocksPerTipSet is the number of blocks below which a synced
+	// tipset is reported as low participation.  Zero disables the check.
+	minBlocksPerTipSet int
+	// onLowParticipation is called with each tipset reported as low
+	// participation.  It may be nil.
+	onLowParticipation func(types.TipSet)
+
+	// lookback is the number of tipsets gathered for randomness sampling
+	// before the live proving periods of a tipset being validated.
+	lookback uint
+
+	// expectedRoots maps heights to the state root that syncing a tipset
+	// of that height must compute.
+	expectedRoots map[uint64]cid.Cid
+
+	// clock is the syncer's source of time.
+	clock clock.Clock
+	// lateBlockGrace is how long after the head advances that a caught up
+	// syncer still accepts tipsets for the head's round and the round
+	// before it.  Zero disables the check.
+	lateBlockGrace time.Duration
+	// headAdvanceMu protects headAdvancedAt and headStalled.
+	headAdvanceMu sync.Mutex
+	// headAdvancedAt is when syncOne last set a higher head.
+	headAdvancedAt time.Time
+	// headStalled is whether the head stall alert was raised since the
+	// head last advanced.
+	headStalled bool
+	// createdAt is when the syncer was created.  A head that never
+	// advanced is timed from it.
+	createdAt time.Time
+
+	// headStallThreshold is how long a caught up syncer may go without
+	// setting a new head before its head is considered stalled.  Zero
+	// disables detection.
+	headStallThreshold time.Duration
+	// onHeadStall is called when the head stalls.  It may be nil.
+	onHeadStall func(since time.Duration)
+
+	// restoreGenesis, if not nil, returns the genesis block to restore into
+	// a chain store that lacks it.
+	restoreGenesis func(ctx context.Context) (*types.Block, error)
 }
 
 var _ Syncer = (*DefaultSyncer)(nil)
 
+// SyncerOpt configures optional behavior of a DefaultSyncer.
+type SyncerOpt func(*DefaultSyncer)
+
+// DisableWiden configures the syncer to skip the widen step.  Widen is an
+// optimization for finding heavier tipsets sooner, so disabling it does not
+// affect correctness.  It is useful for isolating fork choice anomalies.
+func DisableWiden() SyncerOpt {
+	return func(syncer *DefaultSyncer) {
+		syncer.widenDisabled = true
+	}
+}
+
+// ExpectedStateRoots configures the syncer to reject any tipset whose
+// computed state root differs from the root given for its height.  Networks
+// may publish such roots at checkpoints to catch state computation bugs
+// during sync.
+func ExpectedStateRoots(roots map[uint64]cid.Cid) SyncerOpt {
+	return func(syncer *DefaultSyncer) {
+		syncer.expectedRoots = roots
+	}
+}
+
+// SamplingLookback configures the number of tipsets preceding the live
+// proving periods that the syncer gathers for consensus to sample randomness
+// from when validating a tipset.  It defaults to sampling.LookbackParameter.
+// The lookback must cover the tipsets consensus samples, so changing it is
+// for tests and networks whose protocol samples with a different lookback.
+func SamplingLookback(lookback uint) SyncerOpt {
+	return func(syncer *DefaultSyncer) {
+		syncer.lookback = lookback
+	}
+}
+
+// RequireNetworkName configures the syncer to reject tipsets holding any
+// block whose network name is not name, so that blocks produced for one
+// network cannot be replayed on another.  Rejected tipsets are cached as bad.
+func RequireNetworkName(name string) SyncerOpt {
+	return func(syncer *DefaultSyncer) {
+		syncer.checkNetwork = true
+		syncer.networkName = name
+	}
+}
+
+// SyncerClock configures the syncer's source of time.  It times the late
+// block grace period, reorg thrashing, head stalls, buffered orphans and the
+// decision log.  It defaults to the system clock.
+func SyncerClock(clk clock.Clock) SyncerOpt {
+	return func(syncer *DefaultSyncer) {
+		syncer.clock = clk
+	}
+}
+
+// LateBlockGracePeriod configures a caught up syncer to accept tipsets for
+// the current or immediately prior round only within grace of the head
+// advancing.  Later tipsets for those rounds, and tipsets for older rounds,
+// are dropped with ErrLateTipSet.  A grace period absorbs network latency so
+// that legitimate late blocks can still widen the head while bounding the
+// work spent on stale rounds.
+func LateBlockGracePeriod(grace time.Duration) SyncerOpt {
+	return func(syncer *DefaultSyncer) {
+		syncer.lateBlockGrace = grace
+	}
+}
+
+// DetectStalls configures the syncer to treat threshold consecutive fetch
+// timeouts for the same blocks as a stalled sync, which usually means no peer
+// is serving them.  On a stall the syncer logs an error, calls onStall if it
+// is not nil and retries the fetch from fallback, an alternate source such as
+// an HTTP mirror, if it is not nil.
+func DetectStalls(threshold int, onStall func(blks types.SortedCidSet), fallback syncFetcher) SyncerOpt {
+	return func(syncer *DefaultSyncer) {
+		syncer.stallThreshold = threshold
+		syncer.onStall = onStall
+		syncer.stallFallback = fallback
+	}
+}
+
+// CommitHook is called by the syncer with a validated tipset and its state
+// root before it stores the tipset and considers it for head.
+type CommitHook func(ctx context.Context, ts types.TipSet, stateRoot cid.Cid) error
+
+// WithCommitHook configures the syncer to call hook with each validated
+// tipset before storing it, so that integrators can mirror chain state in
+// step with the node.  If the hook errors the sync of the tipset is aborted
+// before it is stored.  The failure is not a consensus failure, so the tipset
+// is not cached as bad, and a later sync of it or its descendants validates
+// it and calls the hook again.  The hook may therefore be called more than
+// once with a tipset.
+func WithCommitHook(hook CommitHook) SyncerOpt {
+	return func(syncer *DefaultSyncer) {
+		syncer.commitHook = hook
+	}
+}
+
+// BlockWaitTime configures the longest the syncer waits while fetching the
+// blocks of a tipset.  A caller deadline that expires sooner still applies.
+func BlockWaitTime(wait time.Duration) SyncerOpt {
+	return func(syncer *DefaultSyncer) {
+		syncer.blkWaitTime = wait
+	}
+}
+
+// DefaultRetryBackoff is the wait before the first retry of a sync that
+// failed with a transient error.
+const DefaultRetryBackoff = time.Second
+
+// RetryTransient configures HandleNewTipset to retry a sync that fails with
+// a transient error, see IsTransient, up to retries times before returning
+// the error.  It waits backoff before the first retry and twice as long
+// before each further retry, without holding the syncer's lock.  Transient
+// failures never mark tipsets bad, so a retry syncs a valid chain once the
+// glitch passes.
+func RetryTransient(retries int, backoff time.Duration) SyncerOpt {
+	return func(syncer *DefaultSyncer) {
+		syncer.transientRetries = retries
+		syncer.retryBackoff = backoff
+	}
+}
+
+// MaxPendingSyncs limits the number of calls to HandleNewTipset that may be
+// executing or waiting to execute at once.  Calls over the limit return
+// ErrSyncBusy immediately so that callers drop rather than buffer work under
+// bursts of announcements.  A limit of zero or less means no limit.
+func MaxPendingSyncs(limit int) SyncerOpt {
+	return func(syncer *DefaultSyncer) {
+		if limit <= 0 {
+			syncer.pending = nil
+			return
+		}
+		syncer.pending = make(chan struct{}, limit)
+	}
+}
+
 // NewDefaultSyncer constructs a DefaultSyncer ready for use.
-func NewDefaultSyncer(cst *hamt.CborIpldStore, c consensus.Protocol, s syncerChainReader, f syncFetcher) *DefaultSyncer {
-	return &DefaultSyncer{
-		fetcher:    f,
-		stateStore: cst,
-		badTipSets: &badTipSetCache{
-			bad: make(map[string]struct{}),
+func NewDefaultSyncer(stateStore StateStore, c consensus.Protocol, s syncerChainReader, f syncFetcher, opts ...SyncerOpt) *DefaultSyncer {
+	syncer := &DefaultSyncer{
+		fetcher:      f,
+		stateStore:   stateStore,
+		consensus:    c,
+		chainStore:   s,
+		recentErrors: newSyncErrorRing(syncErrorHistorySize),
+		dedup:        newSyncDedupTracker(syncDedupHistorySize),
+		mode:         CaughtUp,
+		profiles: map[SyncMode]FetchProfile{
+			Syncing:  DefaultSyncingProfile,
+			CaughtUp: DefaultCaughtUpProfile,
 		},
-		consensus:  c,
-		chainStore: s,
+		blkWaitTime: blkWaitTime,
+		clock:       clock.NewSystemClock(),
+		lookback:    sampling.LookbackParameter,
+		targetTTL:   DefaultSyncTargetTTL,
 	}
+	for _, opt := range opts {
+		opt(syncer)
+	}
+	syncer.badTipSets = newBadTipSetCache(defaultBadTipSetCacheSize, syncer.clock)
+	syncer.targetRenewedAt = syncer.clock.Now()
+	syncer.createdAt = syncer.targetRenewedAt
+	syncer.restoreQuarantine()
+	return syncer
+}
+
+// RecentErrors returns the errors of the most recent failed calls to
+// HandleNewTipset, oldest first.
+func (syncer *DefaultSyncer) RecentErrors() []SyncError {
+	return syncer.recentErrors.List()
+}
+
+// DedupStats returns counts of the blocks the syncer fetched and the tipsets
+// it validated, distinguishing repeated from new work.
+func (syncer *DefaultSyncer) DedupStats() SyncDedupStats {
+	return syncer.dedup.Stats()
 }
 
 // getBlksMaybeFromNet resolves cids of blocks.  It gets blocks through the
@@ -105,13 +533,122 @@ func NewDefaultSyncer(cst *hamt.CborIpldStore, c consensus.Protocol, s syncerCha
 // and the bitswap exchange wraps the node's shared blockstore.  So if blocks
 // are available in the node's blockstore they will be resolved locally, and
 // otherwise resolved over the network.  This method will timeout if blocks
-// are unavailable.  This method is all or nothing, it will error if any of the
-// blocks cannot be resolved.
+// are unavailable, waiting no longer than the sooner of the caller's deadline
+// and the syncer's block wait time.  Timeouts are reported as
+// ErrCallerDeadline or ErrFetchTimeout respectively.  This method is all or
+// nothing, it will error if any of the blocks cannot be resolved, and it
+// rejects a response holding other blocks than those requested with
+// ErrUnexpectedBlocks.  Requests are split according to the fetch profile of
+// the syncer's current mode.
 func (syncer *DefaultSyncer) getBlksMaybeFromNet(ctx context.Context, blkCids []cid.Cid) ([]*types.Block, error) {
-	ctx, cancel := context.WithTimeout(ctx, blkWaitTime)
+	local := syncer.localBlocks(blkCids)
+	fetchCtx, cancel := context.WithTimeout(ctx, syncer.blkWaitTime)
+	defer cancel()
+
+	blks, err := syncer.fetchConcurrently(fetchCtx, blkCids, syncer.ActiveFetchProfile().Concurrency)
+	if err != nil {
+		err = classifyFetchError(ctx, fetchCtx, blkCids, err)
+		if syncer.isStalled(blkCids, err) {
+			blks, err = syncer.fetchAfterStall(ctx, blkCids)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := checkFetchedBlocks(blkCids, blks); err != nil {
+		return nil, err
+	}
+	syncer.stallKey, syncer.stallCount = "", 0
+	syncer.dedup.recordFetch(ctx, blkCids)
+	fetchedAt := syncer.clock.Now()
+	syncer.decisions.update(types.NewSortedCidSet(blkCids...), func(d *TipSetDecision) { d.FetchedAt = fetchedAt })
+	syncer.observeBlocks(blks, local)
+	return blks, nil
+}
+
+// checkFetchedBlocks returns ErrUnexpectedBlocks unless blks holds exactly
+// the blocks with cids blkCids, each once.  A response holding extra or
+// missing blocks says nothing about the tipset requested, only about the
+// fetcher, so it is not cached as bad and a later request may succeed.
+func checkFetchedBlocks(blkCids []cid.Cid, blks []*types.Block) error {
+	requested := make(map[cid.Cid]bool, len(blkCids))
+	for _, c := range blkCids {
+		requested[c] = false
+	}
+	for _, blk := range blks {
+		c := blk.Cid()
+		seen, ok := requested[c]
+		if !ok {
+			return errors.Wrapf(ErrUnexpectedBlocks, "block %s was not requested", c.String())
+		}
+		if seen {
+			return errors.Wrapf(ErrUnexpectedBlocks, "block %s returned twice", c.String())
+		}
+		requested[c] = true
+	}
+	if len(blks) != len(requested) {
+		return errors.Wrapf(ErrUnexpectedBlocks, "fetched %d of %d blocks", len(blks), len(requested))
+	}
+	return nil
+}
+
+// classifyFetchError distinguishes a fetch of blkCids that failed with err
+// because the caller's context ctx expired from one that failed because the
+// fetch context fetchCtx, bounded by the block wait time, expired.  Other
+// errors are returned unchanged.
+func classifyFetchError(ctx, fetchCtx context.Context, blkCids []cid.Cid, err error) error {
+	blks := types.NewSortedCidSet(blkCids...).String()
+	if ctx.Err() == context.DeadlineExceeded {
+		return errors.Wrapf(ErrCallerDeadline, "fetching %s", blks)
+	}
+	if errors.Cause(err) == context.DeadlineExceeded || fetchCtx.Err() == context.DeadlineExceeded {
+		return errors.Wrapf(ErrFetchTimeout, "fetching %s", blks)
+	}
+	return err
+}
+
+// isStalled records the fetch of blkCids failing with err and returns true
+// if it is a fetch timeout and the consecutive timeouts fetching blkCids have
+// reached the stall threshold.  Caller deadlines do not count towards a
+// stall.  The caller must hold syncer.mu.
+func (syncer *DefaultSyncer) isStalled(blkCids []cid.Cid, err error) bool {
+	if syncer.stallThreshold <= 0 {
+		return false
+	}
+	if errors.Cause(err) != ErrFetchTimeout {
+		return false
+	}
+
+	key := types.NewSortedCidSet(blkCids...).String()
+	if key != syncer.stallKey {
+		syncer.stallKey, syncer.stallCount = key, 0
+	}
+	syncer.stallCount++
+	return syncer.stallCount >= syncer.stallThreshold
+}
+
+// fetchAfterStall reports that fetching blkCids stalled and tries the
+// fallback source, if any.
+func (syncer *DefaultSyncer) fetchAfterStall(ctx context.Context, blkCids []cid.Cid) ([]*types.Block, error) {
+	blks := types.NewSortedCidSet(blkCids...)
+	logSyncer.Errorf("sync stalled, no peers serving %s after %d fetch timeouts", blks.String(), syncer.stallCount)
+	syncStallsCt.Inc(ctx, 1)
+	if syncer.onStall != nil {
+		syncer.onStall(blks)
+	}
+	if syncer.stallFallback == nil {
+		return nil, errors.Wrapf(ErrFetchTimeout, "sync stalled fetching %s", blks.String())
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, syncer.blkWaitTime)
 	defer cancel()
+	return syncer.stallFallback.GetBlocks(ctx, blkCids)
+}
 
-	return syncer.fetcher.GetBlocks(ctx, blkCids)
+// tipSetLink identifies a tipset of a collected chain.
+type tipSetLink struct {
+	key    types.SortedCidSet
+	height uint64
 }
 
 // collectChain resolves the cids of the head tipset and its ancestors to
@@ -121,15 +658,70 @@ func (syncer *DefaultSyncer) getBlksMaybeFromNet(ctx context.Context, blkCids []
 // from the syncer's fetcher.  In production the fetcher wraps a bitswap
 // session.  collectChain errors if any set of cids in the chain resolves to
 // blocks that do not form a tipset, or if any tipset has already been recorded
-// as the head of an invalid chain.  collectChain is the entrypoint to the code
-// that interacts with the network. It does NOT add tipsets to the chainStore..
+// as the head of an invalid chain.  Fetched tipsets are assembled into the
+// returned chain by linking on parents once fetching completes, so the order
+// in which ancestors arrive does not matter.  collectChain is the entrypoint
+// to the code that interacts with the network. It does NOT add tipsets to the
+// chainStore..
 func (syncer *DefaultSyncer) collectChain(ctx context.Context, tipsetCids types.SortedCidSet) (ts []types.TipSet, err error) {
 	ctx, span := trace.StartSpan(ctx, "DefaultSyncer.collectChain")
 	span.AddAttributes(trace.StringAttribute("tipset", tipsetCids.String()))
 	defer tracing.AddErrorEndSpan(ctx, span, &err)
 
-	var chain []types.TipSet
+	fetched, _, err := syncer.walkChain(ctx, tipsetCids, true, 0)
+	if err != nil {
+		return nil, err
+	}
+	isStored := func(tsKey string) bool {
+		return syncer.chainStore.HasTipSetAndState(ctx, tsKey)
+	}
+	return AssembleChain(tipsetCids, fetched, isStored)
+}
+
+// collectChainLinks walks the chain like collectChain but retains only the
+// key and height of each tipset, so that long chains can be streamed into
+// the store without holding their blocks in memory.  The links are ordered
+// from the tipset after the stored parent to the head.
+func (syncer *DefaultSyncer) collectChainLinks(ctx context.Context, tipsetCids types.SortedCidSet) (links []tipSetLink, err error) {
+	ctx, span := trace.StartSpan(ctx, "DefaultSyncer.collectChainLinks")
+	span.AddAttributes(trace.StringAttribute("tipset", tipsetCids.String()))
+	defer tracing.AddErrorEndSpan(ctx, span, &err)
+
+	_, links, err = syncer.walkChain(ctx, tipsetCids, false, syncer.maxBlocksPerSync)
+	if err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(links)-1; i < j; i, j = i+1, j-1 {
+		links[i], links[j] = links[j], links[i]
+	}
+	return links, nil
+}
+
+// walkChain fetches the tipsets of the chain from tipsetCids back to a
+// tipset in the store.  It returns the link of each tipset walked, head
+// first, and the tipsets themselves if retain is true.  If maxBlocks is
+// positive, walkChain fetches at most maxBlocks blocks: it records a
+// checkpoint and returns ErrSyncIncomplete rather than exceed them, and it
+// picks up the walk recorded by a checkpoint when it reaches a tipset the
+// checkpoint walked.  Checkpoints hold only links, so retain must be false.
+// A walk failing otherwise than at the cap clears the checkpoint, so that a
+// later walk does not resume into a chain that failed.
+func (syncer *DefaultSyncer) walkChain(ctx context.Context, tipsetCids types.SortedCidSet, retain bool, maxBlocks int) (_ []types.TipSet, _ []tipSetLink, err error) {
+	if maxBlocks > 0 {
+		defer func() {
+			if err != nil && errors.Cause(err) != ErrSyncIncomplete && syncer.checkpoint != nil {
+				syncer.setCheckpoint(nil)
+			}
+		}()
+	}
+
+	var fetched []types.TipSet
+	var links []tipSetLink
 	var count uint64
+	var blocksFetched int
+	resumed := false
+	// traversed holds the cids of every tipset requested so far.
+	traversed := make(map[cid.Cid]struct{})
 	fetchedHead := tipsetCids
 	defer logSyncer.Infof("chain fetch from network complete %v", fetchedHead)
 
@@ -140,41 +732,310 @@ func (syncer *DefaultSyncer) collectChain(ctx context.Context, tipsetCids types.
 
 		// Finish traversal if the tipset made is tracked in the store.
 		if syncer.chainStore.HasTipSetAndState(ctx, tsKey) {
-			return chain, nil
+			if resumed {
+				syncer.setCheckpoint(nil)
+			}
+			return fetched, links, nil
+		}
+
+		if maxBlocks > 0 {
+			if cpLinks, frontier, ok := syncer.checkpoint.resume(tsKey); ok {
+				links = append(links, cpLinks...)
+				for _, link := range cpLinks {
+					for it := link.key.Iter(); !it.Complete(); it.Next() {
+						traversed[it.Value()] = struct{}{}
+					}
+				}
+				tipsetCids = frontier
+				resumed = true
+				continue
+			}
+			// A tipset larger than the cap is fetched on its own so that
+			// the walk always makes progress.
+			if blocksFetched > 0 && blocksFetched+tipsetCids.Len() > maxBlocks {
+				syncer.setCheckpoint(newSyncCheckpoint(links, tipsetCids))
+				return nil, nil, errors.Wrapf(ErrSyncIncomplete, "fetched %d blocks, next tipset %s", blocksFetched, tsKey)
+			}
 		}
 
 		logSyncer.Debugf("CollectChain next link: %s", tsKey)
 
 		if syncer.badTipSets.Has(tsKey) {
-			return nil, ErrChainHasBadTipSet
+			// The decision on a tipset already cached as bad was logged
+			// when it was rejected.
+			if !fetchedHead.Equals(tipsetCids) {
+				syncer.decideKey(fetchedHead, OutcomeRejected, ErrChainHasBadTipSet)
+			}
+			return nil, nil, ErrChainHasBadTipSet
 		}
 
 		blks, err := syncer.getBlksMaybeFromNet(ctx, tipsetCids.ToSlice())
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
 		ts, err := syncer.consensus.NewValidTipSet(ctx, blks)
 		if err != nil {
-			syncer.badTipSets.Add(tsKey)
-			syncer.badTipSets.AddChain(chain)
-			return nil, err
+			return nil, nil, syncer.rejectWalked(tipsetCids, fetchedHead, links, err)
 		}
 
+		// Crafted parent links must not keep this loop from terminating.
+		// Heights must strictly descend along the walk, and no parent may
+		// link back to a tipset already walked.
+		if err := checkHeightDescends(ts, links); err != nil {
+			return nil, nil, syncer.rejectWalked(tipsetCids, fetchedHead, links, err)
+		}
+		for it := tipsetCids.Iter(); !it.Complete(); it.Next() {
+			traversed[it.Value()] = struct{}{}
+		}
+		if err := checkParentLinks(ts, traversed); err != nil {
+			return nil, nil, syncer.rejectWalked(tipsetCids, fetchedHead, links, err)
+		}
+
+		if err := syncer.checkNetworkName(ts); err != nil {
+			return nil, nil, syncer.rejectWalked(tipsetCids, fetchedHead, links, err)
+		}
+		if err := syncer.checkGenesis(ts); err != nil {
+			return nil, nil, syncer.rejectWalked(tipsetCids, fetchedHead, links, err)
+		}
+		if err := syncer.checkBlocks(ctx, ts); err != nil {
+			return nil, nil, syncer.rejectWalked(tipsetCids, fetchedHead, links, err)
+		}
+
+		if err := syncer.observeHeight(ts); err != nil {
+			return nil, nil, err
+		}
+		// Observe any mode transition the height causes.
+		syncer.Mode()
+
 		count++
+		blocksFetched += len(blks)
 		if count%500 == 0 {
 			logSyncer.Infof("fetching the chain, %d blocks fetched", count)
 		}
 
 		// Update values to traverse next tipset
-		chain = append([]types.TipSet{ts}, chain...)
+		h, err := ts.Height()
+		if err != nil {
+			return nil, nil, err
+		}
+		links = append(links, tipSetLink{key: tipsetCids, height: h})
+		if retain {
+			fetched = append(fetched, ts)
+		}
 		tipsetCids, err = ts.Parents()
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 	}
 }
 
+// rejectWalked caches the tipset with key tsKey, rejected with err while
+// walking the chain with head walkHead, and the tipsets walked before it,
+// links, as bad.  It records the rejection of both the tipset and the walk's
+// head in the decision log and returns err.
+func (syncer *DefaultSyncer) rejectWalked(tsKey, walkHead types.SortedCidSet, links []tipSetLink, err error) error {
+	syncer.badTipSets.Add(tsKey.String())
+	// links run from the walk's head back, so add them oldest first.
+	oldestFirst := make([]tipSetLink, len(links))
+	for i, link := range links {
+		oldestFirst[len(links)-1-i] = link
+	}
+	syncer.badTipSets.addLinks(oldestFirst)
+	syncer.decideKey(tsKey, OutcomeRejected, err)
+	if !walkHead.Equals(tsKey) {
+		syncer.decideKey(walkHead, OutcomeRejected, err)
+	}
+	return err
+}
+
+// checkNetworkName returns ErrWrongNetwork if the syncer requires a network
+// name and any block of ts was produced for another network.
+func (syncer *DefaultSyncer) checkNetworkName(ts types.TipSet) error {
+	if !syncer.checkNetwork {
+		return nil
+	}
+	for _, blk := range ts.ToSlice() {
+		if blk.NetworkName != syncer.networkName {
+			return errors.Wrapf(ErrWrongNetwork, "block %s has network %q, expected %q", blk.Cid().String(), blk.NetworkName, syncer.networkName)
+		}
+	}
+	return nil
+}
+
+// checkGenesis returns ErrGenesisMismatch if ts is a genesis tipset other
+// than the store's.  The store holds its own genesis, so a walk only fetches
+// a tipset at height zero when the chain roots elsewhere.
+func (syncer *DefaultSyncer) checkGenesis(ts types.TipSet) error {
+	h, err := ts.Height()
+	if err != nil {
+		return err
+	}
+	if h != 0 {
+		return nil
+	}
+	genesis := syncer.chainStore.GenesisCid()
+	if blks := ts.ToSlice(); len(blks) != 1 || !blks[0].Cid().Equals(genesis) {
+		return errors.Wrapf(ErrGenesisMismatch, "chain roots in %s, expected %s", ts.String(), genesis.String())
+	}
+	return nil
+}
+
+// checkHeightDescends returns ErrInvalidParentLink if ts, the parent of the
+// last tipset walked, is not strictly lower than that tipset.
+func checkHeightDescends(ts types.TipSet, walked []tipSetLink) error {
+	if len(walked) == 0 {
+		return nil
+	}
+	h, err := ts.Height()
+	if err != nil {
+		return err
+	}
+	childHeight := walked[len(walked)-1].height
+	if h >= childHeight {
+		return errors.Wrapf(ErrInvalidParentLink, "parent height %d, child height %d", h, childHeight)
+	}
+	return nil
+}
+
+// checkParentLinks returns ErrInvalidParentLink if any of ts's parents has
+// already been traversed.
+func checkParentLinks(ts types.TipSet, traversed map[cid.Cid]struct{}) error {
+	parents, err := ts.Parents()
+	if err != nil {
+		return err
+	}
+	for it := parents.Iter(); !it.Complete(); it.Next() {
+		if _, ok := traversed[it.Value()]; ok {
+			return errors.Wrapf(ErrInvalidParentLink, "parent %s already traversed", it.Value().String())
+		}
+	}
+	return nil
+}
+
+// observeHeight raises the syncer's estimate of the network's head height
+// to the height of ts if ts is higher, and renews the estimate if ts is at
+// least as high.
+func (syncer *DefaultSyncer) observeHeight(ts types.TipSet) error {
+	h, err := ts.Height()
+	if err != nil {
+		return err
+	}
+	syncer.targetMu.Lock()
+	defer syncer.targetMu.Unlock()
+	if h >= syncer.targetHeight {
+		syncer.targetHeight = h
+		syncer.targetRenewedAt = syncer.clock.Now()
+	}
+	return nil
+}
+
+// IsCaughtUpForMining returns true if the height of the store's head is
+// within tolerance rounds of the greatest height the syncer has seen on the
+// network.  Heights claimed by chains found invalid are not counted.  Miners
+// should not produce blocks while this is false as blocks mined on a stale
+// head will be orphaned.
+func (syncer *DefaultSyncer) IsCaughtUpForMining(tolerance uint64) bool {
+	headTs, err := syncer.chainStore.GetTipSet(syncer.chainStore.GetHead())
+	if err != nil {
+		return false
+	}
+	headHeight, err := headTs.Height()
+	if err != nil {
+		return false
+	}
+
+	target := syncer.currentTarget()
+	if headHeight >= target {
+		return true
+	}
+	return target-headHeight <= tolerance
+}
+
+// TipSetsLost returns the number of tipsets the syncer validated that were not
+// heavier than its head.  Each is work spent on a non-canonical fork.
+func (syncer *DefaultSyncer) TipSetsLost() uint64 {
+	return atomic.LoadUint64(&syncer.tipSetsLost)
+}
+
+// recordLostTipSet counts that next was validated but is not heavier than
+// head, and logs the weight gap.
+func (syncer *DefaultSyncer) recordLostTipSet(ctx context.Context, next, head types.TipSet, nextParentSt, headParentSt state.Tree) {
+	atomic.AddUint64(&syncer.tipSetsLost, 1)
+	tipSetsLostCt.Inc(ctx, 1)
+
+	nextWeight, err := syncer.consensus.Weight(ctx, next, nextParentSt)
+	if err != nil {
+		logSyncer.Debugf("validated %s but it lost to head %s", next.Describe(), head.Describe())
+		return
+	}
+	headWeight, err := syncer.consensus.Weight(ctx, head, headParentSt)
+	if err != nil {
+		logSyncer.Debugf("validated %s but it lost to head %s", next.Describe(), head.Describe())
+		return
+	}
+	logSyncer.Debugf("validated %s but it lost to head %s, weight %d against head weight %d", next.Describe(), head.Describe(), nextWeight, headWeight)
+}
+
+// recordHeadAdvance notes the time, ending any head stall, if next, which
+// replaced head, is higher than head.
+func (syncer *DefaultSyncer) recordHeadAdvance(next, head types.TipSet) error {
+	nextHeight, err := next.Height()
+	if err != nil {
+		return err
+	}
+	headHeight, err := head.Height()
+	if err != nil {
+		return err
+	}
+	if nextHeight > headHeight {
+		syncer.headAdvanceMu.Lock()
+		defer syncer.headAdvanceMu.Unlock()
+		syncer.headAdvancedAt = syncer.clock.Now()
+		syncer.headStalled = false
+	}
+	return nil
+}
+
+// lastHeadAdvance returns when syncOne last set a higher head, zero if it
+// never did.
+func (syncer *DefaultSyncer) lastHeadAdvance() time.Time {
+	syncer.headAdvanceMu.Lock()
+	defer syncer.headAdvanceMu.Unlock()
+	return syncer.headAdvancedAt
+}
+
+// checkLate returns ErrLateTipSet if the syncer is caught up and a tipset of
+// height h belongs to a round the syncer considers closed.  The head's round
+// and the one before it stay open for the late block grace period after the
+// head advances.
+func (syncer *DefaultSyncer) checkLate(h uint64) error {
+	advancedAt := syncer.lastHeadAdvance()
+	if syncer.lateBlockGrace == 0 || advancedAt.IsZero() {
+		return nil
+	}
+	// While catching up every round is needed.
+	if !syncer.IsCaughtUpForMining(0) {
+		return nil
+	}
+
+	headTs, err := syncer.chainStore.GetTipSet(syncer.chainStore.GetHead())
+	if err != nil {
+		return err
+	}
+	headHeight, err := headTs.Height()
+	if err != nil {
+		return err
+	}
+	if h > headHeight {
+		return nil
+	}
+	if h+1 >= headHeight && syncer.clock.Now().Sub(advancedAt) <= syncer.lateBlockGrace {
+		return nil
+	}
+	return errors.Wrapf(ErrLateTipSet, "height %d, head height %d", h, headHeight)
+}
+
 // tipSetState returns the state resulting from applying the input tipset to
 // the chain.  Precondition: the tipset must be in the store
 func (syncer *DefaultSyncer) tipSetState(ctx context.Context, tsKey types.SortedCidSet) (state.Tree, error) {
@@ -185,13 +1046,57 @@ func (syncer *DefaultSyncer) tipSetState(ctx context.Context, tsKey types.Sorted
 	if err != nil {
 		return nil, err
 	}
-	st, err := state.LoadStateTree(ctx, syncer.stateStore, stateCid, builtin.Actors)
+	st, err := syncer.stateStore.LoadStateTree(ctx, stateCid)
 	if err != nil {
 		return nil, err
 	}
 	return st, nil
 }
 
+// validateTipSet runs the state transition of next on the state of parent,
+// which must be in the store, and returns the root of the resulting state and
+// the gas used by the messages of next.
+func (syncer *DefaultSyncer) validateTipSet(ctx context.Context, parent, next types.TipSet) (cid.Cid, types.GasUnits, error) {
+	// Lookup parent state. It is guaranteed by the syncer that it is in
+	// the chainStore.
+	st, err := syncer.tipSetState(ctx, parent.ToSortedCidSet())
+	if err != nil {
+		return cid.Undef, 0, err
+	}
+
+	if err := syncer.checkParentWeight(ctx, parent, next); err != nil {
+		return cid.Undef, 0, err
+	}
+
+	// Gather ancestor chain needed to process state transition.
+	h, err := next.Height()
+	if err != nil {
+		return cid.Undef, 0, err
+	}
+	newBlockHeight := types.NewBlockHeight(h)
+	ancestorHeight := types.NewBlockHeight(consensus.AncestorRoundsNeeded)
+	ancestors, err := GetRecentAncestors(ctx, parent, syncer.chainStore, newBlockHeight, ancestorHeight, syncer.lookback)
+	if err != nil {
+		return cid.Undef, 0, err
+	}
+
+	// Run a state transition to validate the tipset and compute
+	// a new state to add to the store.
+	syncer.dedup.recordValidation(ctx, next)
+	st, gasUsed, err := syncer.consensus.RunStateTransition(ctx, next, ancestors, st)
+	if err != nil {
+		return cid.Undef, 0, err
+	}
+	root, err := st.Flush(ctx)
+	if err != nil {
+		return cid.Undef, 0, err
+	}
+	if expected, ok := syncer.expectedRoots[h]; ok && !expected.Equals(root) {
+		return cid.Undef, 0, errors.Wrapf(ErrUnexpectedStateRoot, "height %d: computed %s, expected %s", h, root.String(), expected.String())
+	}
+	return root, gasUsed, nil
+}
+
 // syncOne syncs a single tipset with the chain store. syncOne calculates the
 // parent state of the tipset and calls into consensus to run a state transition
 // in order to validate the tipset.  In the case the input tipset is valid,
@@ -208,43 +1113,39 @@ func (syncer *DefaultSyncer) syncOne(ctx context.Context, parent, next types.Tip
 		return nil
 	}
 
-	// Lookup parent state. It is guaranteed by the syncer that it is in
-	// the chainStore.
-	st, err := syncer.tipSetState(ctx, parent.ToSortedCidSet())
+	root, gasUsed, err := syncer.validateTipSet(ctx, parent, next)
 	if err != nil {
+		syncer.decide(next, OutcomeInvalid, err)
 		return err
 	}
-
-	// Gather ancestor chain needed to process state transition.
-	h, err := next.Height()
+	// Only validated blocks are checked for equivocation, so that blocks
+	// forged in a miner's name cannot implicate it.
+	equivocates, err := syncer.detectEquivocation(ctx, next)
 	if err != nil {
 		return err
 	}
-	newBlockHeight := types.NewBlockHeight(h)
-	ancestorHeight := types.NewBlockHeight(consensus.AncestorRoundsNeeded)
-	ancestors, err := GetRecentAncestors(ctx, parent, syncer.chainStore, newBlockHeight, ancestorHeight, sampling.LookbackParameter)
-	if err != nil {
-		return err
-	}
-
-	// Run a state transition to validate the tipset and compute
-	// a new state to add to the store.
-	st, err = syncer.consensus.RunStateTransition(ctx, next, ancestors, st)
-	if err != nil {
+	if equivocates && syncer.rejectEquivocation {
+		err := errors.Wrapf(ErrEquivocation, "tipset %s", next.String())
+		syncer.decide(next, OutcomeInvalid, err)
 		return err
 	}
-	root, err := st.Flush(ctx)
-	if err != nil {
-		return err
+	// The hook runs before the tipset is stored so that a tipset whose hook
+	// failed is synced, and the hook called, again.
+	if syncer.commitHook != nil {
+		if err := syncer.commitHook(ctx, next, root); err != nil {
+			return errors.Wrapf(ErrCommitHookFailed, "tipset %s: %s", next.String(), err)
+		}
 	}
 	err = syncer.chainStore.PutTipSetAndState(ctx, &TipSetAndState{
 		TipSet:          next,
 		TipSetStateRoot: root,
+		GasUsed:         gasUsed,
 	})
 	if err != nil {
-		return err
+		return errors.Wrapf(ErrChainStoreWrite, "tipset %s: %s", next.String(), err)
 	}
-	logSyncer.Debugf("Successfully updated store with %s", next.String())
+	logSyncer.Debugf("Successfully updated store with %s", next.Describe())
+	syncer.checkParticipation(ctx, next)
 
 	// TipSet is validated and added to store, now check if it is the heaviest.
 	// If it is the heaviest update the chainStore.
@@ -260,6 +1161,8 @@ func (syncer *DefaultSyncer) syncOne(ctx context.Context, parent, next types.Tip
 	if err != nil {
 		return err
 	}
+	// A genesis head has no parent state.  Consensus weighs the genesis
+	// tipset without one.
 	var headParentSt state.Tree
 	if headParentCids.Len() != 0 { // head is not genesis
 		headParentSt, err = syncer.tipSetState(ctx, headParentCids)
@@ -272,6 +1175,7 @@ func (syncer *DefaultSyncer) syncOne(ctx context.Context, parent, next types.Tip
 	if err != nil {
 		return err
 	}
+	syncer.noteWeighed(ctx, next, *headTipSet, nextParentSt, headParentSt, heavier)
 
 	if heavier {
 		// Gather the entire new chain for reorg comparison.
@@ -282,12 +1186,45 @@ func (syncer *DefaultSyncer) syncOne(ctx context.Context, parent, next types.Tip
 			return err
 		}
 		newChain = append(newChain, next)
-		if IsReorg(*headTipSet, newChain) {
-			logSyncer.Infof("reorg occurring while switching from %s to %s", headTipSet.String(), next.String())
+		reorg := IsReorg(*headTipSet, newChain)
+		if reorg {
+			dampened, err := syncer.dampenReorg(ctx, next, *headTipSet, nextParentSt, headParentSt)
+			if err != nil {
+				return err
+			}
+			if dampened {
+				syncer.recordLostTipSet(ctx, next, *headTipSet, nextParentSt, headParentSt)
+				syncer.decide(next, OutcomeDampened, nil)
+				return nil
+			}
+		}
+		if reorg {
+			logSyncer.Infof("reorg occurring while switching from %s to %s", headTipSet.Describe(), next.Describe())
+			syncer.setPhase(PhaseReorg)
+			defer syncer.setPhase(PhaseValidating)
 		}
 		if err = syncer.chainStore.SetHead(ctx, next); err != nil {
 			return err
 		}
+		// Only a reorg that took effect is recorded.
+		if reorg {
+			syncer.recordReorg(ctx)
+			if info, ok := syncer.recordReorgHistory(ctx, next, *headTipSet, newChain, nextParentSt, headParentSt); ok {
+				syncer.decisions.update(next.ToSortedCidSet(), func(d *TipSetDecision) { d.ReorgDepth = info.Depth })
+				syncer.events.emit(SyncEvent{Kind: EventReorg, Reorg: info})
+			}
+		}
+		if err := syncer.recordHeadAdvance(next, *headTipSet); err != nil {
+			return err
+		}
+		syncer.renewTarget()
+		syncer.decide(next, OutcomeHead, nil)
+		syncer.events.emit(SyncEvent{Kind: EventHead, Head: next})
+		// Observe any mode transition the new head causes.
+		syncer.Mode()
+	} else {
+		syncer.recordLostTipSet(ctx, next, *headTipSet, nextParentSt, headParentSt)
+		syncer.decide(next, OutcomeNotHeaviest, nil)
 	}
 
 	return nil
@@ -304,6 +1241,10 @@ func (syncer *DefaultSyncer) widen(ctx context.Context, ts types.TipSet) (types.
 	if err != nil {
 		return nil, err
 	}
+	// Genesis has no siblings to widen with.
+	if parentSet.Len() == 0 {
+		return nil, nil
+	}
 	height, err := ts.Height()
 	if err != nil {
 		return nil, err
@@ -319,17 +1260,22 @@ func (syncer *DefaultSyncer) widen(ctx context.Context, ts types.TipSet) (types.
 		return nil, nil
 	}
 
-	// Only take the tipset with the most blocks (this is EC specific logic)
+	// Only take the tipset with the most blocks (this is EC specific logic).
+	// Ties go to the lowest tipset ID so that every node widens alike.
 	max := candidates[0]
-	for _, candidate := range candidates[0:] {
-		if len(candidate.TipSet) > len(max.TipSet) {
+	for _, candidate := range candidates[1:] {
+		if len(candidate.TipSet) > len(max.TipSet) ||
+			(len(candidate.TipSet) == len(max.TipSet) && candidate.TipSet.String() < max.TipSet.String()) {
 			max = candidate
 		}
 	}
 
-	// Add blocks of the biggest tipset in the store to a copy of ts
+	// Add the valid blocks of the biggest tipset in the store to a copy of ts
 	wts := ts.Clone()
-	for _, blk := range max.TipSet {
+	for _, blk := range max.TipSet.ToSlice() {
+		if _, ok := wts[blk.Cid()]; ok || !syncer.widenBlockValid(ctx, blk) {
+			continue
+		}
 		if err = wts.AddBlock(blk); err != nil {
 			return nil, err
 		}
@@ -340,58 +1286,189 @@ func (syncer *DefaultSyncer) widen(ctx context.Context, ts types.TipSet) (types.
 		return nil, nil
 	}
 
+	// Never widen into a tipset holding two blocks from one miner.
+	equivocates, err := syncer.detectEquivocation(ctx, wts)
+	if err != nil {
+		return nil, err
+	}
+	if equivocates && syncer.rejectEquivocation {
+		return nil, nil
+	}
+
 	return wts, nil
 }
 
 // HandleNewTipset extends the Syncer's chain store with the given tipset if they
 // represent a valid extension. It limits the length of new chains it will
 // attempt to validate and caches invalid blocks it has encountered to
-// help prevent DOS.
+// help prevent DOS.  See RetryTransient for retrying transient failures.
 func (syncer *DefaultSyncer) HandleNewTipset(ctx context.Context, tipsetCids types.SortedCidSet) (err error) {
+	if syncer.pending != nil {
+		select {
+		case syncer.pending <- struct{}{}:
+			defer func() { <-syncer.pending }()
+		default:
+			return ErrSyncBusy
+		}
+	}
+
 	logSyncer.Debugf("Begin fetch and sync of chain with head %v", tipsetCids)
 	ctx, span := trace.StartSpan(ctx, "DefaultSyncer.HandleNewTipset")
 	span.AddAttributes(trace.StringAttribute("tipset", tipsetCids.String()))
 	defer tracing.AddErrorEndSpan(ctx, span, &err)
+	defer func() {
+		if err != nil {
+			syncer.recentErrors.Add(SyncError{
+				Time:      syncer.clock.Now(),
+				TipSetKey: tipsetCids.String(),
+				Err:       err,
+			})
+			syncer.events.emit(SyncEvent{Kind: EventError, Target: tipsetCids, Err: err})
+		}
+	}()
 
+	backoff := syncer.retryBackoff
+	for retry := 0; ; retry++ {
+		err = syncer.syncLocked(ctx, tipsetCids)
+		if err == nil || retry >= syncer.transientRetries || !IsTransient(err) {
+			return err
+		}
+		logSyncer.Infof("retrying sync of %s in %s after transient error: %s", tipsetCids.String(), backoff, err)
+		timer := syncer.clock.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.Chan():
+		}
+		syncRetriesCt.Inc(ctx, 1)
+		backoff *= 2
+	}
+}
+
+// syncLocked takes the syncer's lock and syncs the chain with head
+// tipsetCids.
+func (syncer *DefaultSyncer) syncLocked(ctx context.Context, tipsetCids types.SortedCidSet) error {
 	// This lock could last a long time as we fetch all the blocks needed to block the chain.
 	// This is justified because the app is pretty useless until it is synced.
 	// It's better for multiple calls to wait here than to try to fetch the chain independently.
 	syncer.mu.Lock()
 	defer syncer.mu.Unlock()
+	defer syncer.setPhase(PhaseIdle)
+
+	if !syncer.hasGenesis(ctx) {
+		return errors.Wrapf(ErrNoGenesis, "genesis %s", syncer.chainStore.GenesisCid().String())
+	}
+	target := syncer.currentTarget()
+	if err := syncer.syncChain(ctx, tipsetCids); err != nil {
+		// The heights a chain claims are only trusted while it may be
+		// valid.
+		if errors.Cause(err) == ErrChainHasBadTipSet || syncer.badTipSets.Has(tipsetCids.String()) {
+			syncer.withdrawTarget(target)
+			syncer.Mode()
+		}
+		return err
+	}
+	syncer.settleConfirmed()
+	syncer.releaseOrphans(ctx)
+	return nil
+}
 
+// syncChain syncs the chain with head tipsetCids into the store.  The caller
+// must hold syncer.mu.
+func (syncer *DefaultSyncer) syncChain(ctx context.Context, tipsetCids types.SortedCidSet) error {
 	// If the store already has all these blocks the syncer is finished.
 	if syncer.chainStore.HasAllBlocks(ctx, tipsetCids.ToSlice()) {
 		return nil
 	}
 
+	buffered, err := syncer.bufferOrphan(ctx, tipsetCids)
+	if err != nil {
+		return err
+	}
+	if buffered {
+		return nil
+	}
+
+	syncer.dialPeersIfThin()
+
+	// A capped walk resumes from checkpoints holding only links, so it
+	// streams the chain into the store.
+	if syncer.streamBuffer > 0 || syncer.maxBlocksPerSync > 0 {
+		return syncer.syncStreamed(ctx, tipsetCids)
+	}
+
 	// Walk the chain given by the input blocks back to a known tipset in
 	// the store. This is the only code that may go to the network to
 	// resolve cids to blocks.
+	syncer.setPhase(PhaseCollecting)
 	chain, err := syncer.collectChain(ctx, tipsetCids)
 	if err != nil {
 		return err
 	}
-	parentCids, err := chain[0].Parents()
-	if err != nil {
-		return err
+	links := make([]tipSetLink, len(chain))
+	for i, ts := range chain {
+		h, err := ts.Height()
+		if err != nil {
+			return err
+		}
+		links[i] = tipSetLink{key: ts.ToSortedCidSet(), height: h}
 	}
-	parentTs, err := syncer.chainStore.GetTipSet(parentCids)
-	if err != nil {
+	i := 0
+	return syncer.applyChain(ctx, links, func() (types.TipSet, error) {
+		ts := chain[i]
+		i++
+		return ts, nil
+	})
+}
+
+// applyChain validates the collected chain identified by links, ordered from
+// the tipset after a stored parent to the head, and adds its tipsets to the
+// store, checking for new heaviest tipsets.  next returns the tipsets of the
+// chain in order.  If a tipset fails to sync, it and the rest of the chain
+// are cached as bad.
+func (syncer *DefaultSyncer) applyChain(ctx context.Context, links []tipSetLink, next func() (types.TipSet, error)) error {
+	if len(links) == 0 {
+		return nil
+	}
+	head := links[len(links)-1]
+	if err := syncer.checkLate(head.height); err != nil {
 		return err
 	}
-	parent := *parentTs
+	syncer.confirmTarget(head.height)
 
 	// Try adding the tipsets of the chain to the store, checking for new
 	// heaviest tipsets.
-	for i, ts := range chain {
+	syncer.setPhase(PhaseValidating)
+	var parent types.TipSet
+	for i := range links {
+		ts, err := next()
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			parentCids, err := ts.Parents()
+			if err != nil {
+				return err
+			}
+			parentTs, err := syncer.chainStore.GetTipSet(parentCids)
+			if err != nil {
+				return err
+			}
+			parent = *parentTs
+		}
+
 		// TODO: this "i==0" leaks EC specifics into syncer abstraction
 		// for the sake of efficiency, consider plugging up this leak.
-		if i == 0 {
+		if i == 0 && !syncer.widenDisabled {
 			wts, err := syncer.widen(ctx, ts)
 			if err != nil {
 				return err
 			}
 			if wts != nil {
+				if err := syncer.checkWiden(ts, wts); err != nil {
+					return err
+				}
 				logSyncer.Debug("attempt to sync after widen")
 				err = syncer.syncOne(ctx, parent, wts)
 				if err != nil {
@@ -400,16 +1477,28 @@ func (syncer *DefaultSyncer) HandleNewTipset(ctx context.Context, tipsetCids typ
 			}
 		}
 		if err = syncer.syncOne(ctx, parent, ts); err != nil {
+			// A transient failure, such as a failing commit hook or
+			// store write, is an infrastructure failure that says
+			// nothing about the validity of the chain.
+			if IsTransient(err) {
+				return err
+			}
 			// While `syncOne` can indeed fail for reasons other than consensus,
 			// adding to the badTipSets at this point is the simplest, since we
 			// have access to the chain. If syncOne fails for non-consensus reasons,
 			// there is no assumption that the running node's data is valid at all,
 			// so we don't really lose anything with this simplification.
-			syncer.badTipSets.AddChain(chain[i:])
+			// Failures a fixed node could pass only quarantine the chain.
+			if IsHardInvalid(err) {
+				syncer.badTipSets.addLinks(links[i:])
+			} else {
+				syncer.badTipSets.quarantine(links[i:], err.Error(), syncer.nodeVersion())
+				syncer.persistQuarantine()
+			}
 			return err
 		}
 		if i%500 == 0 {
-			logSyncer.Infof("processing block %d of %v for chain with head at %v", i, len(chain), tipsetCids.String())
+			logSyncer.Infof("processing block %d of %v for chain with head at %v", i, len(links), head.key.String())
 		}
 		parent = ts
 	}
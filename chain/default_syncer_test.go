@@ -2,12 +2,15 @@ package chain_test
 
 import (
 	"context"
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-hamt-ipld"
 	bstore "github.com/ipfs/go-ipfs-blockstore"
 	"github.com/libp2p/go-libp2p-peer"
+	"github.com/pkg/errors"
 
 	"github.com/filecoin-project/go-filecoin/actor/builtin"
 	"github.com/filecoin-project/go-filecoin/address"
@@ -204,7 +207,7 @@ func loadSyncerFromRepo(t *testing.T, r repo.Repo, dstP *DefaultSyncerTestParams
 	chainStore := chain.NewDefaultStore(chainDS, calcGenBlk.Cid())
 
 	blockSource := th.NewTestFetcher()
-	syncer := chain.NewDefaultSyncer(cst, con, chainStore, blockSource) // note we use same cst for on and offline for tests
+	syncer := chain.NewDefaultSyncer(chain.NewCborStateStore(cst), con, chainStore, blockSource) // note we use same cst for on and offline for tests
 
 	ctx := context.Background()
 	err = chainStore.Load(ctx)
@@ -214,7 +217,7 @@ func loadSyncerFromRepo(t *testing.T, r repo.Repo, dstP *DefaultSyncerTestParams
 
 // initSyncTestDefault creates and returns the datastructures (chain store, syncer, etc)
 // needed to run tests.  It also sets the global test variables appropriately.
-func initSyncTestDefault(t *testing.T, dstP *DefaultSyncerTestParams) (*chain.DefaultSyncer, chain.Store, repo.Repo, *th.TestFetcher) {
+func initSyncTestDefault(t *testing.T, dstP *DefaultSyncerTestParams, opts ...chain.SyncerOpt) (*chain.DefaultSyncer, chain.Store, repo.Repo, *th.TestFetcher) {
 	processor := th.NewTestProcessor()
 	powerTable := &th.TestView{}
 	r := repo.NewInMemoryRepo()
@@ -226,7 +229,7 @@ func initSyncTestDefault(t *testing.T, dstP *DefaultSyncerTestParams) (*chain.De
 	initGenesisWrapper := func(cst *hamt.CborIpldStore, bs bstore.Blockstore) (*types.Block, error) {
 		return initGenesis(dstP.minerAddress, dstP.minerOwnerAddress, dstP.minerPeerID, cst, bs)
 	}
-	return initSyncTest(t, con, initGenesisWrapper, cst, bs, r, dstP)
+	return initSyncTest(t, con, initGenesisWrapper, cst, bs, r, dstP, opts...)
 }
 
 // initSyncTestWithPowerTable creates and returns the datastructures (chain store, syncer, etc)
@@ -246,7 +249,7 @@ func initSyncTestWithPowerTable(t *testing.T, powerTable consensus.PowerTableVie
 	return sync, testchain, con, fetcher
 }
 
-func initSyncTest(t *testing.T, con consensus.Protocol, genFunc func(cst *hamt.CborIpldStore, bs bstore.Blockstore) (*types.Block, error), cst *hamt.CborIpldStore, bs bstore.Blockstore, r repo.Repo, dstP *DefaultSyncerTestParams) (*chain.DefaultSyncer, chain.Store, repo.Repo, *th.TestFetcher) {
+func initSyncTest(t *testing.T, con consensus.Protocol, genFunc func(cst *hamt.CborIpldStore, bs bstore.Blockstore) (*types.Block, error), cst *hamt.CborIpldStore, bs bstore.Blockstore, r repo.Repo, dstP *DefaultSyncerTestParams, opts ...chain.SyncerOpt) (*chain.DefaultSyncer, chain.Store, repo.Repo, *th.TestFetcher) {
 	ctx := context.Background()
 
 	calcGenBlk, err := genFunc(cst, bs) // flushes state
@@ -256,7 +259,7 @@ func initSyncTest(t *testing.T, con consensus.Protocol, genFunc func(cst *hamt.C
 	chainStore := chain.NewDefaultStore(chainDS, calcGenBlk.Cid())
 
 	fetcher := th.NewTestFetcher()
-	syncer := chain.NewDefaultSyncer(cst, con, chainStore, fetcher) // note we use same cst for on and offline for tests
+	syncer := chain.NewDefaultSyncer(chain.NewCborStateStore(cst), con, chainStore, fetcher, opts...) // note we use same cst for on and offline for tests
 
 	// Initialize stores to contain dstP.genesis block and state
 	calcGenTS := th.RequireNewTipSet(t, calcGenBlk)
@@ -469,6 +472,72 @@ func TestSyncChainHead(t *testing.T) {
 	assertHead(t, chainStore, dstP.link4)
 }
 
+// Syncer reports whether its head is close enough to the network's head to mine.
+func TestIsCaughtUpForMining(t *testing.T) {
+	tf.UnitTest(t)
+	dstP := initDSTParams()
+
+	syncer, chainStore, _, blockSource := initSyncTestDefault(t, dstP)
+	ctx := context.Background()
+
+	// Nothing seen on the network yet.
+	assert.True(t, syncer.IsCaughtUpForMining(0))
+
+	// Fetching fails at link1 so the syncer learns of link4 (height 6)
+	// while its head stays at genesis.
+	_ = requirePutBlocks(t, blockSource, dstP.link2.ToSlice()...)
+	_ = requirePutBlocks(t, blockSource, dstP.link3.ToSlice()...)
+	cids4 := requirePutBlocks(t, blockSource, dstP.link4.ToSlice()...)
+	assert.Error(t, syncer.HandleNewTipset(ctx, cids4))
+	assertHead(t, chainStore, dstP.genTS)
+
+	assert.False(t, syncer.IsCaughtUpForMining(0))
+	assert.False(t, syncer.IsCaughtUpForMining(5))
+	assert.True(t, syncer.IsCaughtUpForMining(6))
+
+	// Once the chain is available the syncer catches up.
+	_ = requirePutBlocks(t, blockSource, dstP.link1.ToSlice()...)
+	require.NoError(t, syncer.HandleNewTipset(ctx, cids4))
+	assertHead(t, chainStore, dstP.link4)
+	assert.True(t, syncer.IsCaughtUpForMining(0))
+}
+
+// Syncer records the errors of failed syncs.
+func TestRecentErrors(t *testing.T) {
+	tf.UnitTest(t)
+	dstP := initDSTParams()
+
+	syncer, _, _, blockSource := initSyncTestDefault(t, dstP)
+	ctx := context.Background()
+	assert.Empty(t, syncer.RecentErrors())
+
+	// None of these blocks are available so every sync fails.
+	failing := []types.SortedCidSet{
+		dstP.link3.ToSortedCidSet(),
+		dstP.link1.ToSortedCidSet(),
+		dstP.link2.ToSortedCidSet(),
+	}
+	before := time.Now()
+	for _, cids := range failing {
+		assert.Error(t, syncer.HandleNewTipset(ctx, cids))
+	}
+
+	// A successful sync is not recorded.
+	cids1 := requirePutBlocks(t, blockSource, dstP.link1.ToSlice()...)
+	require.NoError(t, syncer.HandleNewTipset(ctx, cids1))
+
+	recent := syncer.RecentErrors()
+	require.Equal(t, len(failing), len(recent))
+	for i, se := range recent {
+		assert.Equal(t, failing[i].String(), se.TipSetKey)
+		assert.Error(t, se.Err)
+		assert.False(t, se.Time.Before(before))
+		if i > 0 {
+			assert.False(t, se.Time.Before(recent[i-1].Time))
+		}
+	}
+}
+
 // Syncer determines the heavier fork.
 func TestSyncIgnoreLightFork(t *testing.T) {
 	tf.UnitTest(t)
@@ -504,11 +573,15 @@ func TestSyncIgnoreLightFork(t *testing.T) {
 	assert.NoError(t, err)
 	assertTsAdded(t, chainStore, dstP.link4)
 	assertHead(t, chainStore, dstP.link4)
+	assert.Equal(t, uint64(0), syncer.TipSetsLost())
 
 	// lighter fork should be processed but not change head.
 	assert.NoError(t, syncer.HandleNewTipset(ctx, forkCids1))
 	assertTsAdded(t, chainStore, forklink1)
 	assertHead(t, chainStore, dstP.link4)
+
+	// Both the fork base and its child were validated and lost to head.
+	assert.Equal(t, uint64(2), syncer.TipSetsLost())
 }
 
 // Correctly sync a heavier fork
@@ -802,6 +875,301 @@ func TestWidenChainAncestor(t *testing.T) {
 	assertTsAdded(t, chainStore, link2Union)
 }
 
+// Syncer reaches the same head with widen disabled, without tracking the
+// widened tipset.
+func TestWidenDisabledSameHead(t *testing.T) {
+	tf.UnitTest(t)
+
+	for _, disabled := range []bool{false, true} {
+		dstP := initDSTParams()
+		var opts []chain.SyncerOpt
+		if disabled {
+			opts = append(opts, chain.DisableWiden())
+		}
+		syncer, chainStore, _, blockSource := initSyncTestDefault(t, dstP, opts...)
+		ctx := context.Background()
+
+		signer, ki := types.NewMockSignersAndKeyInfo(2)
+		link2blkother := th.RequireMkFakeChild(t, th.FakeChildParams{
+			MinerAddr:   dstP.minerAddress,
+			Parent:      dstP.link1,
+			GenesisCid:  dstP.genCid,
+			StateRoot:   dstP.genStateRoot,
+			Signer:      signer,
+			MinerPubKey: ki[0].PublicKey(),
+			Nonce:       uint64(27),
+		})
+		link2intersect := th.RequireNewTipSet(t, dstP.link2blk1, link2blkother)
+
+		_ = requirePutBlocks(t, blockSource, dstP.link1.ToSlice()...)
+		_ = requirePutBlocks(t, blockSource, dstP.link2.ToSlice()...)
+		_ = requirePutBlocks(t, blockSource, dstP.link3.ToSlice()...)
+		cids4 := requirePutBlocks(t, blockSource, dstP.link4.ToSlice()...)
+		intersectCids := requirePutBlocks(t, blockSource, link2intersect.ToSlice()...)
+
+		require.NoError(t, syncer.HandleNewTipset(ctx, intersectCids))
+		require.NoError(t, syncer.HandleNewTipset(ctx, cids4))
+		assertTsAdded(t, chainStore, dstP.link4)
+		assertHead(t, chainStore, dstP.link4)
+
+		link2Union := th.RequireNewTipSet(t, dstP.link2blk1, dstP.link2blk2, dstP.link2blk3, link2blkother)
+		assert.Equal(t, !disabled, chainStore.HasTipSetAndState(ctx, link2Union.String()))
+	}
+}
+
+func TestExpectedStateRoots(t *testing.T) {
+	tf.UnitTest(t)
+	ctx := context.Background()
+
+	t.Run("matching root passes", func(t *testing.T) {
+		dstP := initDSTParams()
+		roots := map[uint64]cid.Cid{1: dstP.genStateRoot}
+		syncer, chainStore, _, blockSource := initSyncTestDefault(t, dstP, chain.ExpectedStateRoots(roots))
+
+		cids1 := requirePutBlocks(t, blockSource, dstP.link1.ToSlice()...)
+		require.NoError(t, syncer.HandleNewTipset(ctx, cids1))
+		assertTsAdded(t, chainStore, dstP.link1)
+		assertHead(t, chainStore, dstP.link1)
+	})
+
+	t.Run("mismatched root is rejected", func(t *testing.T) {
+		dstP := initDSTParams()
+		roots := map[uint64]cid.Cid{1: types.SomeCid()}
+		syncer, chainStore, _, blockSource := initSyncTestDefault(t, dstP, chain.ExpectedStateRoots(roots))
+
+		cids1 := requirePutBlocks(t, blockSource, dstP.link1.ToSlice()...)
+		err := syncer.HandleNewTipset(ctx, cids1)
+		require.Error(t, err)
+		assert.Equal(t, chain.ErrUnexpectedStateRoot, errors.Cause(err))
+		assertNoAdd(t, chainStore, cids1)
+		assertHead(t, chainStore, dstP.genTS)
+
+		// The tipset is now cached as bad.
+		err = syncer.HandleNewTipset(ctx, cids1)
+		assert.Equal(t, chain.ErrChainHasBadTipSet, errors.Cause(err))
+	})
+}
+
+func TestLateBlockGracePeriod(t *testing.T) {
+	tf.UnitTest(t)
+	ctx := context.Background()
+	dstP := initDSTParams()
+	clk := th.NewFakeClock(time.Unix(1234567890, 0))
+	syncer, chainStore, _, blockSource := initSyncTestDefault(t, dstP, chain.SyncerClock(clk), chain.LateBlockGracePeriod(5*time.Second))
+
+	cids1 := requirePutBlocks(t, blockSource, dstP.link1.ToSlice()...)
+	require.NoError(t, syncer.HandleNewTipset(ctx, cids1))
+	assertHead(t, chainStore, dstP.link1)
+
+	signer, ki := types.NewMockSignersAndKeyInfo(1)
+	lateBlock := func(nonce uint64) types.TipSet {
+		return th.RequireNewTipSet(t, th.RequireMkFakeChild(t, th.FakeChildParams{
+			MinerAddr:   dstP.minerAddress,
+			Parent:      dstP.genTS,
+			GenesisCid:  dstP.genCid,
+			StateRoot:   dstP.genStateRoot,
+			Signer:      signer,
+			MinerPubKey: ki[0].PublicKey(),
+			Nonce:       nonce,
+		}))
+	}
+
+	// A block for the head's round within the grace period is accepted.
+	clk.Advance(4 * time.Second)
+	inGrace := lateBlock(100)
+	require.NoError(t, syncer.HandleNewTipset(ctx, requirePutBlocks(t, blockSource, inGrace.ToSlice()...)))
+	assert.True(t, chainStore.HasTipSetAndState(ctx, inGrace.String()))
+
+	// After the grace period it is dropped.
+	clk.Advance(2 * time.Second)
+	outOfGrace := lateBlock(101)
+	err := syncer.HandleNewTipset(ctx, requirePutBlocks(t, blockSource, outOfGrace.ToSlice()...))
+	assert.Equal(t, chain.ErrLateTipSet, errors.Cause(err))
+	assert.False(t, chainStore.HasTipSetAndState(ctx, outOfGrace.String()))
+
+	// Blocks for new rounds are always accepted.
+	cids2 := requirePutBlocks(t, blockSource, dstP.link2.ToSlice()...)
+	require.NoError(t, syncer.HandleNewTipset(ctx, cids2))
+	assertHead(t, chainStore, dstP.link2)
+}
+
+// Widen and replacing the head with a heavier sibling repeat work that the
+// syncer's dedup stats record.
+func TestSyncDedupStats(t *testing.T) {
+	tf.UnitTest(t)
+	dstP := initDSTParams()
+
+	pt := th.NewTestPowerTableView(types.NewBytesAmount(1), types.NewBytesAmount(1))
+	syncer, chainStore, _, blockSource := initSyncTestWithPowerTable(t, pt, dstP)
+	ctx := context.Background()
+
+	_ = requirePutBlocks(t, blockSource, dstP.link1.ToSlice()...)
+	_ = requirePutBlocks(t, blockSource, dstP.link2.ToSlice()...)
+
+	require.NoError(t, syncer.HandleNewTipset(ctx, types.NewSortedCidSet(dstP.link1blk1.Cid())))
+	stats := syncer.DedupStats()
+	assert.Equal(t, uint64(1), stats.BlocksFetched)
+	assert.Equal(t, uint64(0), stats.BlocksRefetched)
+	assert.Equal(t, uint64(1), stats.TipSetsValidated)
+	assert.Equal(t, uint64(0), stats.TipSetsRevalidated)
+
+	// Widen validates link1blk1 again as part of the full link1 tipset.
+	require.NoError(t, syncer.HandleNewTipset(ctx, types.NewSortedCidSet(dstP.link1blk2.Cid())))
+	assertHead(t, chainStore, dstP.link1)
+	stats = syncer.DedupStats()
+	assert.Equal(t, uint64(0), stats.BlocksRefetched)
+	assert.Equal(t, uint64(1), stats.TipSetsRevalidated)
+
+	// Replacing the head with a heavier sibling fetches and validates
+	// link2blk1 again.
+	require.NoError(t, syncer.HandleNewTipset(ctx, types.NewSortedCidSet(dstP.link2blk1.Cid())))
+	require.NoError(t, syncer.HandleNewTipset(ctx, dstP.link2.ToSortedCidSet()))
+	assertHead(t, chainStore, dstP.link2)
+	stats = syncer.DedupStats()
+	assert.Equal(t, uint64(1), stats.BlocksRefetched)
+	assert.True(t, stats.TipSetsRevalidated > 1)
+}
+
+// The syncer applies its syncing fetch profile while behind the network and
+// its caught up profile once its head reaches the network's height.
+func TestSyncModeFetchProfiles(t *testing.T) {
+	tf.UnitTest(t)
+	dstP := initDSTParams()
+
+	syncing := chain.FetchProfile{Concurrency: 4}
+	caughtUp := chain.FetchProfile{Concurrency: 1}
+	syncer, chainStore, _, blockSource := initSyncTestDefault(t, dstP, chain.FetchProfiles(syncing, caughtUp))
+	ctx := context.Background()
+
+	assert.Equal(t, chain.CaughtUp, syncer.Mode())
+	assert.Equal(t, caughtUp, syncer.ActiveFetchProfile())
+
+	// Fetching link4 reveals the network's height, but its ancestors are
+	// not yet available so the syncer stays behind.
+	cids4 := requirePutBlocks(t, blockSource, dstP.link4.ToSlice()...)
+	assert.Error(t, syncer.HandleNewTipset(ctx, cids4))
+	assert.Equal(t, chain.Syncing, syncer.Mode())
+	assert.Equal(t, syncing, syncer.ActiveFetchProfile())
+
+	_ = requirePutBlocks(t, blockSource, dstP.link1.ToSlice()...)
+	_ = requirePutBlocks(t, blockSource, dstP.link2.ToSlice()...)
+	_ = requirePutBlocks(t, blockSource, dstP.link3.ToSlice()...)
+	require.NoError(t, syncer.HandleNewTipset(ctx, cids4))
+	assertHead(t, chainStore, dstP.link4)
+	assert.Equal(t, chain.CaughtUp, syncer.Mode())
+	assert.Equal(t, caughtUp, syncer.ActiveFetchProfile())
+}
+
+// The syncer chooses heads by the weight function consensus is configured
+// with.  Weighing tipsets by block count keeps the three block link2 as head
+// over its single block child link3.
+func TestPluggableWeightFunc(t *testing.T) {
+	tf.UnitTest(t)
+	dstP := initDSTParams()
+
+	blockCount := func(ctx context.Context, ts types.TipSet, pSt state.Tree) (uint64, error) {
+		return uint64(len(ts)), nil
+	}
+	r := repo.NewInMemoryRepo()
+	bs := bstore.NewBlockstore(r.Datastore())
+	cst := hamt.NewCborStore()
+	con := consensus.NewExpected(cst, bs, th.NewTestProcessor(), &th.TestView{}, dstP.genCid, proofs.NewFakeVerifier(true, nil), consensus.WithWeightFunc(blockCount))
+	requireSetTestChain(t, con, false, dstP)
+	initGenesisWrapper := func(cst *hamt.CborIpldStore, bs bstore.Blockstore) (*types.Block, error) {
+		return initGenesis(dstP.minerAddress, dstP.minerOwnerAddress, dstP.minerPeerID, cst, bs)
+	}
+	syncer, chainStore, _, blockSource := initSyncTest(t, con, initGenesisWrapper, cst, bs, r, dstP)
+	ctx := context.Background()
+
+	_ = requirePutBlocks(t, blockSource, dstP.link1.ToSlice()...)
+	cids2 := requirePutBlocks(t, blockSource, dstP.link2.ToSlice()...)
+	cids3 := requirePutBlocks(t, blockSource, dstP.link3.ToSlice()...)
+
+	require.NoError(t, syncer.HandleNewTipset(ctx, cids2))
+	assertHead(t, chainStore, dstP.link2)
+
+	require.NoError(t, syncer.HandleNewTipset(ctx, cids3))
+	assertTsAdded(t, chainStore, dstP.link3)
+	assertHead(t, chainStore, dstP.link2)
+}
+
+// mappedFetcher serves the given block for each requested cid regardless of
+// the block's own cid, as a peer serving crafted data would.
+type mappedFetcher map[cid.Cid]*types.Block
+
+func (f mappedFetcher) GetBlocks(ctx context.Context, cids []cid.Cid) ([]*types.Block, error) {
+	var blks []*types.Block
+	for _, c := range cids {
+		blk, ok := f[c]
+		if !ok {
+			return nil, fmt.Errorf("failed to fetch block: %s", c.String())
+		}
+		blks = append(blks, blk)
+	}
+	return blks, nil
+}
+
+// Syncer rejects chains whose parent links cycle or do not descend in height
+// rather than following them forever.
+func TestRejectInvalidParentLinks(t *testing.T) {
+	tf.UnitTest(t)
+	dstP := initDSTParams()
+
+	_, chainStore, con, _ := initSyncTestWithPowerTable(t, &th.TestView{}, dstP)
+	ctx := context.Background()
+
+	// relinked returns a copy of blk with parents whose cid matches its
+	// content.
+	relinked := func(blk *types.Block, parents ...cid.Cid) *types.Block {
+		cpy := *blk
+		cpy.Parents = types.NewSortedCidSet(parents...)
+		out, err := types.DecodeBlock(cpy.ToNode().RawData())
+		require.NoError(t, err)
+		return out
+	}
+
+	t.Run("self referential parent", func(t *testing.T) {
+		// A block can only name itself as parent when served under a cid
+		// other than its own, and the syncer rejects such responses.
+		head := dstP.cidGetter()
+		blk := *dstP.link1blk1
+		blk.Parents = types.NewSortedCidSet(head)
+		syncer := chain.NewDefaultSyncer(chain.NewCborStateStore(hamt.NewCborStore()), con, chainStore, mappedFetcher{head: &blk})
+
+		err := syncer.HandleNewTipset(ctx, types.NewSortedCidSet(head))
+		assert.Equal(t, chain.ErrUnexpectedBlocks, errors.Cause(err))
+
+		err = syncer.HandleNewTipset(ctx, types.NewSortedCidSet(head))
+		assert.Equal(t, chain.ErrUnexpectedBlocks, errors.Cause(err))
+	})
+
+	t.Run("parent at same height", func(t *testing.T) {
+		sameHeight := relinked(dstP.link2blk2, dstP.cidGetter())
+		child := relinked(dstP.link2blk1, sameHeight.Cid())
+		head, parent := child.Cid(), sameHeight.Cid()
+		syncer := chain.NewDefaultSyncer(chain.NewCborStateStore(hamt.NewCborStore()), con, chainStore, mappedFetcher{head: child, parent: sameHeight})
+
+		err := syncer.HandleNewTipset(ctx, types.NewSortedCidSet(head))
+		assert.Equal(t, chain.ErrInvalidParentLink, errors.Cause(err))
+
+		// Both the crafted parent and the child linking to it are bad.
+		err = syncer.HandleNewTipset(ctx, types.NewSortedCidSet(parent))
+		assert.Equal(t, chain.ErrChainHasBadTipSet, err)
+		err = syncer.HandleNewTipset(ctx, types.NewSortedCidSet(head))
+		assert.Equal(t, chain.ErrChainHasBadTipSet, err)
+	})
+
+	t.Run("parent at greater height", func(t *testing.T) {
+		higher := relinked(dstP.link2blk1, dstP.cidGetter())
+		child := relinked(dstP.link1blk1, higher.Cid())
+		head, parent := child.Cid(), higher.Cid()
+		syncer := chain.NewDefaultSyncer(chain.NewCborStateStore(hamt.NewCborStore()), con, chainStore, mappedFetcher{head: child, parent: higher})
+
+		err := syncer.HandleNewTipset(ctx, types.NewSortedCidSet(head))
+		assert.Equal(t, chain.ErrInvalidParentLink, errors.Cause(err))
+	})
+}
+
 type powerTableForWidenTest struct{}
 
 func (pt *powerTableForWidenTest) Total(ctx context.Context, st state.Tree, bs bstore.Blockstore) (*types.BytesAmount, error) {
@@ -982,7 +1350,7 @@ func TestTipSetWeightDeep(t *testing.T) {
 	// Now sync the chainStore with consensus using a MarketView.
 	verifier = proofs.NewFakeVerifier(true, nil)
 	con = consensus.NewExpected(cst, bs, th.NewTestProcessor(), &consensus.MarketView{}, calcGenBlk.Cid(), verifier)
-	syncer := chain.NewDefaultSyncer(cst, con, chainStore, blockSource)
+	syncer := chain.NewDefaultSyncer(chain.NewCborStateStore(cst), con, chainStore, blockSource)
 	baseTS := requireHeadTipset(t, chainStore) // this is the last block of the bootstrapping chain creating miners
 	require.Equal(t, 1, len(baseTS))
 	bootstrapStateRoot := baseTS.ToSlice()[0].StateRoot
@@ -1114,3 +1482,755 @@ func initGenesis(minerAddress address.Address, minerOwnerAddress address.Address
 		consensus.MinerActor(minerAddress, minerOwnerAddress, []byte{}, 1000, minerPeerID, types.ZeroAttoFIL, types.OneKiBSectorSize),
 	)(cst, bs)
 }
+
+// blockingFetcher signals each fetch request on started and fails it once
+// release is closed.
+type blockingFetcher struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (f *blockingFetcher) GetBlocks(ctx context.Context, cids []cid.Cid) ([]*types.Block, error) {
+	f.started <- struct{}{}
+	<-f.release
+	return nil, errors.New("fetch released")
+}
+
+// The syncer reports the phase of HandleNewTipset it is executing.
+func TestSyncPhase(t *testing.T) {
+	tf.UnitTest(t)
+	dstP := initDSTParams()
+
+	_, chainStore, con, _ := initSyncTestWithPowerTable(t, &th.TestView{}, dstP)
+	fetcher := &blockingFetcher{
+		started: make(chan struct{}, 1),
+		release: make(chan struct{}),
+	}
+	syncer := chain.NewDefaultSyncer(chain.NewCborStateStore(hamt.NewCborStore()), con, chainStore, fetcher)
+	ctx := context.Background()
+
+	assert.Equal(t, chain.PhaseIdle, syncer.CurrentPhase())
+
+	done := make(chan error)
+	go func() {
+		done <- syncer.HandleNewTipset(ctx, dstP.link1.ToSortedCidSet())
+	}()
+
+	<-fetcher.started
+	assert.Equal(t, chain.PhaseCollecting, syncer.CurrentPhase())
+	assert.Equal(t, chain.PhaseCollecting, syncer.Status().Phase)
+
+	close(fetcher.release)
+	assert.Error(t, <-done)
+	assert.Equal(t, chain.PhaseIdle, syncer.CurrentPhase())
+	assert.Equal(t, chain.PhaseIdle, syncer.Status().Phase)
+}
+
+// Calls to HandleNewTipset over the pending limit fail fast.
+func TestMaxPendingSyncs(t *testing.T) {
+	tf.UnitTest(t)
+	dstP := initDSTParams()
+
+	_, chainStore, con, _ := initSyncTestWithPowerTable(t, &th.TestView{}, dstP)
+	fetcher := &blockingFetcher{
+		started: make(chan struct{}, 1),
+		release: make(chan struct{}),
+	}
+	syncer := chain.NewDefaultSyncer(chain.NewCborStateStore(hamt.NewCborStore()), con, chainStore, fetcher, chain.MaxPendingSyncs(2))
+	ctx := context.Background()
+
+	results := make(chan error)
+	handle := func() {
+		results <- syncer.HandleNewTipset(ctx, dstP.link1.ToSortedCidSet())
+	}
+
+	// The first call holds the syncer while it fetches.
+	go handle()
+	<-fetcher.started
+
+	// One more call may wait; the rest are turned away.
+	for i := 0; i < 4; i++ {
+		go handle()
+	}
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, chain.ErrSyncBusy, <-results)
+	}
+
+	close(fetcher.release)
+	for i := 0; i < 2; i++ {
+		err := <-results
+		assert.Error(t, err)
+		assert.NotEqual(t, chain.ErrSyncBusy, err)
+	}
+}
+
+// A failing commit hook stops a tipset from becoming head without marking
+// its chain bad, and the hook is retried when the chain syncs again.
+func TestCommitHook(t *testing.T) {
+	tf.UnitTest(t)
+	dstP := initDSTParams()
+
+	var committed []string
+	failed := false
+	hook := func(ctx context.Context, ts types.TipSet, stateRoot cid.Cid) error {
+		if ts.Equals(dstP.link2) && !failed {
+			failed = true
+			return errors.New("external database unavailable")
+		}
+		committed = append(committed, ts.String())
+		return nil
+	}
+	syncer, chainStore, _, blockSource := initSyncTestDefault(t, dstP, chain.WithCommitHook(hook))
+	ctx := context.Background()
+
+	_ = requirePutBlocks(t, blockSource, dstP.link1.ToSlice()...)
+	cids2 := requirePutBlocks(t, blockSource, dstP.link2.ToSlice()...)
+	cids3 := requirePutBlocks(t, blockSource, dstP.link3.ToSlice()...)
+
+	err := syncer.HandleNewTipset(ctx, cids2)
+	assert.Equal(t, chain.ErrCommitHookFailed, errors.Cause(err))
+	assertHead(t, chainStore, dstP.link1)
+	assert.Equal(t, []string{dstP.link1.String()}, committed)
+	assert.False(t, chainStore.HasTipSetAndState(ctx, dstP.link2.String()))
+
+	// The hook failure did not mark the chain bad, and link2 is committed
+	// on the next sync.
+	require.NoError(t, syncer.HandleNewTipset(ctx, cids3))
+	assertHead(t, chainStore, dstP.link3)
+	assert.Equal(t, []string{dstP.link1.String(), dstP.link2.String(), dstP.link3.String()}, committed)
+}
+
+// timeoutFetcher fails every fetch with a timeout.
+type timeoutFetcher struct{}
+
+func (timeoutFetcher) GetBlocks(ctx context.Context, cids []cid.Cid) ([]*types.Block, error) {
+	return nil, context.DeadlineExceeded
+}
+
+// The syncer reports a stall after repeated fetch timeouts on the same
+// tipset and tries its fallback source.
+func TestDetectStalls(t *testing.T) {
+	tf.UnitTest(t)
+	ctx := context.Background()
+
+	t.Run("stall fires at the threshold", func(t *testing.T) {
+		dstP := initDSTParams()
+		_, chainStore, con, _ := initSyncTestWithPowerTable(t, &th.TestView{}, dstP)
+
+		var stalls []types.SortedCidSet
+		onStall := func(blks types.SortedCidSet) {
+			stalls = append(stalls, blks)
+		}
+		syncer := chain.NewDefaultSyncer(chain.NewCborStateStore(hamt.NewCborStore()), con, chainStore, timeoutFetcher{}, chain.DetectStalls(3, onStall, nil))
+
+		for i := 0; i < 2; i++ {
+			assert.Error(t, syncer.HandleNewTipset(ctx, dstP.link1.ToSortedCidSet()))
+		}
+		assert.Empty(t, stalls)
+
+		assert.Error(t, syncer.HandleNewTipset(ctx, dstP.link1.ToSortedCidSet()))
+		require.Equal(t, 1, len(stalls))
+		assert.Equal(t, dstP.link1.ToSortedCidSet(), stalls[0])
+	})
+
+	t.Run("stalled fetch falls back", func(t *testing.T) {
+		dstP := initDSTParams()
+		r := repo.NewInMemoryRepo()
+		bs := bstore.NewBlockstore(r.Datastore())
+		cst := hamt.NewCborStore()
+		con := consensus.NewExpected(cst, bs, th.NewTestProcessor(), &th.TestView{}, dstP.genCid, proofs.NewFakeVerifier(true, nil))
+		requireSetTestChain(t, con, false, dstP)
+		initGenesisWrapper := func(cst *hamt.CborIpldStore, bs bstore.Blockstore) (*types.Block, error) {
+			return initGenesis(dstP.minerAddress, dstP.minerOwnerAddress, dstP.minerPeerID, cst, bs)
+		}
+		_, chainStore, _, _ := initSyncTest(t, con, initGenesisWrapper, cst, bs, r, dstP)
+
+		fallback := th.NewTestFetcher()
+		cids1 := requirePutBlocks(t, fallback, dstP.link1.ToSlice()...)
+		syncer := chain.NewDefaultSyncer(chain.NewCborStateStore(cst), con, chainStore, timeoutFetcher{}, chain.DetectStalls(1, nil, fallback))
+
+		require.NoError(t, syncer.HandleNewTipset(ctx, cids1))
+		assertHead(t, chainStore, dstP.link1)
+	})
+}
+
+// Syncer syncs the first tipset on top of a genesis only store, including
+// one that follows more null rounds than the ancestors validation gathers.
+func TestSyncFirstTipSetAfterGenesis(t *testing.T) {
+	tf.UnitTest(t)
+
+	for _, nullBlocks := range []uint64{0, consensus.AncestorRoundsNeeded + 1} {
+		dstP := initDSTParams()
+		syncer, chainStore, con, blockSource := initSyncTestWithPowerTable(t, &th.TestView{}, dstP)
+		ctx := context.Background()
+
+		signer, _ := types.NewMockSignersAndKeyInfo(1)
+		signerPubKey := signer.PubKeys[0]
+		blk := th.RequireMkFakeChildWithCon(t, th.FakeChildParams{
+			Parent:         dstP.genTS,
+			GenesisCid:     dstP.genCid,
+			StateRoot:      dstP.genStateRoot,
+			Consensus:      con,
+			MinerAddr:      dstP.minerAddress,
+			MinerPubKey:    signerPubKey,
+			Signer:         signer,
+			NullBlockCount: nullBlocks,
+		})
+		var err error
+		blk.Proof, blk.Ticket, err = th.MakeProofAndWinningTicket(signerPubKey, types.NewBytesAmount(25), types.NewBytesAmount(100), signer)
+		require.NoError(t, err)
+		first := th.RequireNewTipSet(t, blk)
+
+		assertHead(t, chainStore, dstP.genTS)
+		require.NoError(t, syncer.HandleNewTipset(ctx, requirePutBlocks(t, blockSource, blk)))
+		assertTsAdded(t, chainStore, first)
+		assertHead(t, chainStore, first)
+	}
+}
+
+func TestFinalizedHeight(t *testing.T) {
+	tf.UnitTest(t)
+	dstP := initDSTParams()
+	ctx := context.Background()
+
+	t.Run("zero without a finality depth", func(t *testing.T) {
+		syncer, _, _, blockSource := initSyncTestDefault(t, dstP)
+		cids1 := requirePutBlocks(t, blockSource, dstP.link1.ToSlice()...)
+		require.NoError(t, syncer.HandleNewTipset(ctx, cids1))
+		finalized, err := syncer.FinalizedHeight()
+		require.NoError(t, err)
+		assert.Equal(t, uint64(0), finalized)
+	})
+
+	t.Run("trails the head by the finality depth", func(t *testing.T) {
+		syncer, chainStore, _, blockSource := initSyncTestDefault(t, dstP, chain.FinalityDepth(4, time.Hour))
+		finalized, err := syncer.FinalizedHeight()
+		require.NoError(t, err)
+		assert.Equal(t, uint64(0), finalized)
+
+		cids4 := requirePutBlocks(t, blockSource, dstP.link4.ToSlice()...)
+		_ = requirePutBlocks(t, blockSource, dstP.link1.ToSlice()...)
+		_ = requirePutBlocks(t, blockSource, dstP.link2.ToSlice()...)
+		_ = requirePutBlocks(t, blockSource, dstP.link3.ToSlice()...)
+		require.NoError(t, syncer.HandleNewTipset(ctx, cids4))
+		assertHead(t, chainStore, dstP.link4)
+
+		finalized, err = syncer.FinalizedHeight()
+		require.NoError(t, err)
+		assert.Equal(t, uint64(2), finalized)
+
+		pruned, err := syncer.CompactBadTipSets()
+		require.NoError(t, err)
+		assert.Equal(t, 0, pruned)
+	})
+}
+
+// waitingFetcher blocks each fetch until its context is done.
+type waitingFetcher struct{}
+
+func (waitingFetcher) GetBlocks(ctx context.Context, cids []cid.Cid) ([]*types.Block, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+// The syncer waits for blocks no longer than the sooner of the caller's
+// deadline and its block wait time, and reports which one expired.
+func TestBlockWaitTime(t *testing.T) {
+	tf.UnitTest(t)
+
+	t.Run("caller deadline shorter than block wait time", func(t *testing.T) {
+		dstP := initDSTParams()
+		_, chainStore, con, _ := initSyncTestWithPowerTable(t, &th.TestView{}, dstP)
+		syncer := chain.NewDefaultSyncer(chain.NewCborStateStore(hamt.NewCborStore()), con, chainStore, waitingFetcher{}, chain.BlockWaitTime(time.Hour))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		err := syncer.HandleNewTipset(ctx, dstP.link1.ToSortedCidSet())
+		assert.Equal(t, chain.ErrCallerDeadline, errors.Cause(err))
+		assert.True(t, time.Since(start) < time.Minute)
+	})
+
+	t.Run("block wait time shorter than caller deadline", func(t *testing.T) {
+		dstP := initDSTParams()
+		_, chainStore, con, _ := initSyncTestWithPowerTable(t, &th.TestView{}, dstP)
+		syncer := chain.NewDefaultSyncer(chain.NewCborStateStore(hamt.NewCborStore()), con, chainStore, waitingFetcher{}, chain.BlockWaitTime(50*time.Millisecond))
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+		defer cancel()
+		err := syncer.HandleNewTipset(ctx, dstP.link1.ToSortedCidSet())
+		assert.Equal(t, chain.ErrFetchTimeout, errors.Cause(err))
+	})
+}
+
+// Sync progress is unknown until the syncer sees the network's height and
+// then advances monotonically to completion.
+func TestSyncProgress(t *testing.T) {
+	tf.UnitTest(t)
+	dstP := initDSTParams()
+	syncer, chainStore, _, blockSource := initSyncTestDefault(t, dstP)
+	ctx := context.Background()
+
+	assert.Equal(t, chain.SyncProgressUnknown, syncer.SyncProgress())
+
+	// An announcement of link4 raises the target height even though its
+	// ancestors cannot be fetched yet.
+	cids4 := requirePutBlocks(t, blockSource, dstP.link4.ToSlice()...)
+	assert.Error(t, syncer.HandleNewTipset(ctx, cids4))
+	assert.Equal(t, uint64(6), syncer.Status().TargetHeight)
+
+	last := syncer.SyncProgress()
+	assert.Equal(t, 0.0, last)
+	for _, ts := range []types.TipSet{dstP.link1, dstP.link2, dstP.link3, dstP.link4} {
+		cids := requirePutBlocks(t, blockSource, ts.ToSlice()...)
+		require.NoError(t, syncer.HandleNewTipset(ctx, cids))
+		progress := syncer.SyncProgress()
+		assert.True(t, progress > last)
+		last = progress
+	}
+	assertHead(t, chainStore, dstP.link4)
+	assert.Equal(t, 1.0, last)
+	assert.Equal(t, 1.0, syncer.Status().Progress)
+}
+
+func TestSyncTargetHeight(t *testing.T) {
+	tf.UnitTest(t)
+	dstP := initDSTParams()
+	syncer, _, _, blockSource := initSyncTestDefault(t, dstP, chain.SyncTargetHeight(4))
+	ctx := context.Background()
+
+	assert.Equal(t, 0.0, syncer.SyncProgress())
+	cids1 := requirePutBlocks(t, blockSource, dstP.link1.ToSlice()...)
+	require.NoError(t, syncer.HandleNewTipset(ctx, cids1))
+	assert.Equal(t, 0.25, syncer.SyncProgress())
+}
+
+// The syncer detects its head flipping between forks and, while thrashing,
+// only reorgs to tipsets outweighing its head by a margin.
+func TestReorgThrashing(t *testing.T) {
+	tf.UnitTest(t)
+	dstP := initDSTParams()
+	ctx := context.Background()
+
+	// Weight is ten per round so each round ahead outweighs the head by ten.
+	heightWeight := func(ctx context.Context, ts types.TipSet, pSt state.Tree) (uint64, error) {
+		h, err := ts.Height()
+		return 10 * h, err
+	}
+	r := repo.NewInMemoryRepo()
+	bs := bstore.NewBlockstore(r.Datastore())
+	cst := hamt.NewCborStore()
+	con := consensus.NewExpected(cst, bs, th.NewTestProcessor(), &th.TestView{}, dstP.genCid, proofs.NewFakeVerifier(true, nil), consensus.WithWeightFunc(heightWeight))
+	requireSetTestChain(t, con, false, dstP)
+	initGenesisWrapper := func(cst *hamt.CborIpldStore, bs bstore.Blockstore) (*types.Block, error) {
+		return initGenesis(dstP.minerAddress, dstP.minerOwnerAddress, dstP.minerPeerID, cst, bs)
+	}
+	clk := th.NewFakeClock(time.Unix(1234567890, 0))
+	var alerts []int
+	onThrash := func(reorgs int) {
+		alerts = append(alerts, reorgs)
+	}
+	syncer, chainStore, _, blockSource := initSyncTest(t, con, initGenesisWrapper, cst, bs, r, dstP, chain.SyncerClock(clk), chain.DetectReorgThrashing(2, time.Minute, 15, onThrash))
+
+	// Fork a holds tipsets at odd heights and fork b at even heights so
+	// that each tipset announced alternately on either fork outweighs the
+	// head.
+	signer, ki := types.NewMockSignersAndKeyInfo(1)
+	child := func(parent types.TipSet, nullBlocks uint64) types.TipSet {
+		return th.RequireNewTipSet(t, th.RequireMkFakeChild(t, th.FakeChildParams{
+			MinerAddr:      dstP.minerAddress,
+			Parent:         parent,
+			GenesisCid:     dstP.genCid,
+			StateRoot:      dstP.genStateRoot,
+			Signer:         signer,
+			MinerPubKey:    ki[0].PublicKey(),
+			NullBlockCount: nullBlocks,
+		}))
+	}
+	a1 := child(dstP.genTS, 0)
+	b1 := child(dstP.genTS, 1)
+	a2 := child(a1, 1)
+	b2 := child(b1, 1)
+	a3 := child(a2, 1)
+	a4 := child(a3, 1)
+	for _, ts := range []types.TipSet{a1, b1, a2, b2, a3, a4} {
+		_ = requirePutBlocks(t, blockSource, ts.ToSlice()...)
+	}
+
+	syncTo := func(ts types.TipSet) {
+		require.NoError(t, syncer.HandleNewTipset(ctx, ts.ToSortedCidSet()))
+	}
+
+	syncTo(a1)
+	syncTo(b1)
+	syncTo(a2)
+	assertHead(t, chainStore, a2)
+	assert.False(t, syncer.IsThrashing())
+	assert.Empty(t, alerts)
+
+	// The third reorg within the window raises the alert.
+	syncTo(b2)
+	assertHead(t, chainStore, b2)
+	assert.True(t, syncer.IsThrashing())
+	assert.Equal(t, []int{3}, alerts)
+
+	// While thrashing a reorg within the margin is dampened.
+	syncTo(a3)
+	assertTsAdded(t, chainStore, a3)
+	assertHead(t, chainStore, b2)
+
+	// A reorg outweighing the head by the margin still happens.
+	syncTo(a4)
+	assertHead(t, chainStore, a4)
+	assert.Equal(t, []int{3}, alerts)
+
+	// Thrashing ends once the reorgs leave the window.
+	clk.Advance(2 * time.Minute)
+	assert.False(t, syncer.IsThrashing())
+}
+
+// A syncer streaming chains into the store syncs chains much longer than its
+// buffer and caches the suffix of a chain from an invalid tipset as bad.
+func TestStreamChain(t *testing.T) {
+	tf.UnitTest(t)
+	ctx := context.Background()
+
+	signer, ki := types.NewMockSignersAndKeyInfo(1)
+	longChain := func(dstP *DefaultSyncerTestParams, n int) []types.TipSet {
+		return th.RequireMkFakeChain(t, dstP.genTS, n, th.FakeChildParams{
+			MinerAddr:   dstP.minerAddress,
+			GenesisCid:  dstP.genCid,
+			StateRoot:   dstP.genStateRoot,
+			Signer:      signer,
+			MinerPubKey: ki[0].PublicKey(),
+		})
+	}
+
+	t.Run("syncs a long chain with a small buffer", func(t *testing.T) {
+		dstP := initDSTParams()
+		syncer, chainStore, _, blockSource := initSyncTestDefault(t, dstP, chain.StreamChain(2))
+		tipsets := longChain(dstP, 200)
+		for _, ts := range tipsets {
+			_ = requirePutBlocks(t, blockSource, ts.ToSlice()...)
+		}
+
+		head := tipsets[len(tipsets)-1]
+		require.NoError(t, syncer.HandleNewTipset(ctx, head.ToSortedCidSet()))
+		assertHead(t, chainStore, head)
+		for _, ts := range tipsets {
+			assertTsAdded(t, chainStore, ts)
+		}
+	})
+
+	t.Run("caches the chain from an invalid tipset as bad", func(t *testing.T) {
+		dstP := initDSTParams()
+		badRoot := map[uint64]cid.Cid{50: types.SomeCid()}
+		syncer, chainStore, _, blockSource := initSyncTestDefault(t, dstP, chain.StreamChain(2), chain.ExpectedStateRoots(badRoot))
+		tipsets := longChain(dstP, 100)
+		for _, ts := range tipsets {
+			_ = requirePutBlocks(t, blockSource, ts.ToSlice()...)
+		}
+
+		err := syncer.HandleNewTipset(ctx, tipsets[len(tipsets)-1].ToSortedCidSet())
+		assert.Equal(t, chain.ErrUnexpectedStateRoot, errors.Cause(err))
+		assertHead(t, chainStore, tipsets[48])
+
+		// Every tipset from height 50 is cached as bad.
+		err = syncer.HandleNewTipset(ctx, tipsets[60].ToSortedCidSet())
+		assert.Equal(t, chain.ErrChainHasBadTipSet, errors.Cause(err))
+		err = syncer.HandleNewTipset(ctx, tipsets[49].ToSortedCidSet())
+		assert.Equal(t, chain.ErrChainHasBadTipSet, errors.Cause(err))
+	})
+}
+
+func TestDetectEquivocation(t *testing.T) {
+	tf.UnitTest(t)
+	ctx := context.Background()
+
+	t.Run("rejects a tipset with two blocks from one miner", func(t *testing.T) {
+		dstP := initDSTParams()
+		var found []chain.Equivocation
+		onEquivocation := func(eq chain.Equivocation) {
+			found = append(found, eq)
+		}
+		syncer, chainStore, _, blockSource := initSyncTestDefault(t, dstP, chain.DetectEquivocation(true, onEquivocation))
+
+		// Both blocks of link1 are from the test miner.
+		link1 := requirePutBlocks(t, blockSource, dstP.link1.ToSlice()...)
+		err := syncer.HandleNewTipset(ctx, link1)
+		assert.Equal(t, chain.ErrEquivocation, errors.Cause(err))
+		assertHead(t, chainStore, dstP.genTS)
+
+		require.Len(t, found, 1)
+		assert.Equal(t, dstP.minerAddress, found[0].Miner)
+		assert.Equal(t, uint64(1), found[0].Height)
+		assert.True(t, link1.Has(found[0].First))
+		assert.True(t, link1.Has(found[0].Second))
+
+		// The tipset is cached as bad.
+		err = syncer.HandleNewTipset(ctx, link1)
+		assert.Equal(t, chain.ErrChainHasBadTipSet, errors.Cause(err))
+	})
+
+	t.Run("flags blocks from one miner at one height across tipsets", func(t *testing.T) {
+		dstP := initDSTParams()
+		var found []chain.Equivocation
+		onEquivocation := func(eq chain.Equivocation) {
+			found = append(found, eq)
+		}
+		syncer, chainStore, _, blockSource := initSyncTestDefault(t, dstP, chain.DetectEquivocation(true, onEquivocation))
+
+		signer, ki := types.NewMockSignersAndKeyInfo(1)
+		params := th.FakeChildParams{
+			MinerAddr:   dstP.minerAddress,
+			Parent:      dstP.genTS,
+			GenesisCid:  dstP.genCid,
+			StateRoot:   dstP.genStateRoot,
+			Signer:      signer,
+			MinerPubKey: ki[0].PublicKey(),
+		}
+		first := th.RequireNewTipSet(t, th.RequireMkFakeChild(t, params))
+		params.Nonce = 1
+		second := th.RequireNewTipSet(t, th.RequireMkFakeChild(t, params))
+
+		require.NoError(t, syncer.HandleNewTipset(ctx, requirePutBlocks(t, blockSource, first.ToSlice()...)))
+		assertHead(t, chainStore, first)
+		assert.Empty(t, found)
+
+		// Neither tipset is invalid on its own, but they are not widened
+		// into one.
+		require.NoError(t, syncer.HandleNewTipset(ctx, requirePutBlocks(t, blockSource, second.ToSlice()...)))
+		assertTsAdded(t, chainStore, second)
+		assert.Len(t, requireHeadTipset(t, chainStore), 1)
+
+		require.Len(t, found, 1)
+		assert.Equal(t, chain.Equivocation{
+			Miner:  dstP.minerAddress,
+			Height: 1,
+			First:  first.ToSlice()[0].Cid(),
+			Second: second.ToSlice()[0].Cid(),
+		}, found[0])
+	})
+
+	t.Run("ignores blocks of invalid tipsets", func(t *testing.T) {
+		dstP := initDSTParams()
+		var found []chain.Equivocation
+		onEquivocation := func(eq chain.Equivocation) {
+			found = append(found, eq)
+		}
+		syncer, chainStore, _, blockSource := initSyncTestDefault(t, dstP, chain.DetectEquivocation(true, onEquivocation))
+
+		signer, ki := types.NewMockSignersAndKeyInfo(1)
+		params := th.FakeChildParams{
+			MinerAddr:   dstP.minerAddress,
+			Parent:      dstP.genTS,
+			GenesisCid:  dstP.genCid,
+			StateRoot:   types.SomeCid(),
+			Signer:      signer,
+			MinerPubKey: ki[0].PublicKey(),
+		}
+		forged := th.RequireNewTipSet(t, th.RequireMkFakeChild(t, params))
+		params.Nonce = 1
+		params.StateRoot = dstP.genStateRoot
+		valid := th.RequireNewTipSet(t, th.RequireMkFakeChild(t, params))
+
+		assert.Error(t, syncer.HandleNewTipset(ctx, requirePutBlocks(t, blockSource, forged.ToSlice()...)))
+		require.NoError(t, syncer.HandleNewTipset(ctx, requirePutBlocks(t, blockSource, valid.ToSlice()...)))
+		assertHead(t, chainStore, valid)
+		assert.Empty(t, found)
+	})
+}
+
+// localFetcher is a test fetcher reporting the blocks in local as held
+// locally.
+type localFetcher struct {
+	*th.TestFetcher
+	local types.SortedCidSet
+}
+
+func (f *localFetcher) HasLocalBlock(c cid.Cid) bool {
+	return f.local.Has(c)
+}
+
+// blockArrival records a call to a block observer.
+type blockArrival struct {
+	c         cid.Cid
+	sizeBytes int
+	fromLocal bool
+}
+
+func TestObserveBlocks(t *testing.T) {
+	tf.UnitTest(t)
+	ctx := context.Background()
+
+	expectedArrivals := func(fromLocal bool, tipsets ...types.TipSet) []blockArrival {
+		var arrivals []blockArrival
+		for _, ts := range tipsets {
+			for _, blk := range ts.ToSlice() {
+				arrivals = append(arrivals, blockArrival{blk.Cid(), len(blk.ToNode().RawData()), fromLocal})
+			}
+		}
+		return arrivals
+	}
+
+	t.Run("observer is called once per fetched block", func(t *testing.T) {
+		dstP := initDSTParams()
+		var arrivals []blockArrival
+		observer := func(c cid.Cid, sizeBytes int, fromLocal bool) {
+			arrivals = append(arrivals, blockArrival{c, sizeBytes, fromLocal})
+		}
+		syncer, chainStore, _, blockSource := initSyncTestDefault(t, dstP, chain.ObserveBlocks(observer))
+		_ = requirePutBlocks(t, blockSource, dstP.link1.ToSlice()...)
+		_ = requirePutBlocks(t, blockSource, dstP.link2.ToSlice()...)
+		_ = requirePutBlocks(t, blockSource, dstP.link3.ToSlice()...)
+		head := requirePutBlocks(t, blockSource, dstP.link4.ToSlice()...)
+
+		require.NoError(t, syncer.HandleNewTipset(ctx, head))
+		assertHead(t, chainStore, dstP.link4)
+		assert.ElementsMatch(t, expectedArrivals(false, dstP.link1, dstP.link2, dstP.link3, dstP.link4), arrivals)
+	})
+
+	t.Run("observer reports blocks held locally", func(t *testing.T) {
+		dstP := initDSTParams()
+		_, chainStore, con, blockSource := initSyncTestWithPowerTable(t, &th.TestView{}, dstP)
+		fetcher := &localFetcher{TestFetcher: blockSource, local: dstP.link1.ToSortedCidSet()}
+		var arrivals []blockArrival
+		observer := func(c cid.Cid, sizeBytes int, fromLocal bool) {
+			arrivals = append(arrivals, blockArrival{c, sizeBytes, fromLocal})
+		}
+		syncer := chain.NewDefaultSyncer(chain.NewCborStateStore(hamt.NewCborStore()), con, chainStore, fetcher, chain.ObserveBlocks(observer))
+		_ = requirePutBlocks(t, blockSource, dstP.link1.ToSlice()...)
+		head := requirePutBlocks(t, blockSource, dstP.link2.ToSlice()...)
+
+		// Only chain collection matters here, not validation.
+		_ = syncer.HandleNewTipset(ctx, head)
+		expected := append(expectedArrivals(true, dstP.link1), expectedArrivals(false, dstP.link2)...)
+		assert.ElementsMatch(t, expected, arrivals)
+	})
+}
+
+// A strict syncer checks widened tipsets without disturbing valid widening.
+func TestStrictWidenChainAncestor(t *testing.T) {
+	tf.UnitTest(t)
+	dstP := initDSTParams()
+
+	syncer, chainStore, _, blockSource := initSyncTestDefault(t, dstP, chain.StrictWiden(true))
+	ctx := context.Background()
+
+	signer, ki := types.NewMockSignersAndKeyInfo(1)
+	link2blkother := th.RequireMkFakeChild(t, th.FakeChildParams{
+		MinerAddr:   dstP.minerAddress,
+		Parent:      dstP.link1,
+		GenesisCid:  dstP.genCid,
+		StateRoot:   dstP.genStateRoot,
+		Signer:      signer,
+		MinerPubKey: ki[0].PublicKey(),
+		Nonce:       uint64(27),
+	})
+	link2intersect := th.RequireNewTipSet(t, dstP.link2blk1, link2blkother)
+
+	_ = requirePutBlocks(t, blockSource, dstP.link1.ToSlice()...)
+	_ = requirePutBlocks(t, blockSource, dstP.link2.ToSlice()...)
+	_ = requirePutBlocks(t, blockSource, dstP.link3.ToSlice()...)
+	cids4 := requirePutBlocks(t, blockSource, dstP.link4.ToSlice()...)
+	intersectCids := requirePutBlocks(t, blockSource, link2intersect.ToSlice()...)
+
+	require.NoError(t, syncer.HandleNewTipset(ctx, intersectCids))
+	require.NoError(t, syncer.HandleNewTipset(ctx, cids4))
+	assertHead(t, chainStore, dstP.link4)
+	assertTsAdded(t, chainStore, th.RequireNewTipSet(t, dstP.link2blk1, dstP.link2blk2, dstP.link2blk3, link2blkother))
+}
+
+// A syncer requiring a network name accepts blocks produced for its network
+// and rejects blocks produced for another.
+func TestRequireNetworkName(t *testing.T) {
+	tf.UnitTest(t)
+	ctx := context.Background()
+
+	dstP := initDSTParams()
+	syncer, chainStore, _, blockSource := initSyncTestDefault(t, dstP, chain.RequireNetworkName("testnet"))
+
+	signer, ki := types.NewMockSignersAndKeyInfo(1)
+	params := th.FakeChildParams{
+		MinerAddr:   dstP.minerAddress,
+		Parent:      dstP.genTS,
+		GenesisCid:  dstP.genCid,
+		StateRoot:   dstP.genStateRoot,
+		Signer:      signer,
+		MinerPubKey: ki[0].PublicKey(),
+	}
+	// childOnNetwork returns a child of genesis produced for network name.
+	childOnNetwork := func(name string) types.TipSet {
+		cpy := *th.RequireMkFakeChild(t, params)
+		cpy.NetworkName = name
+		blk, err := types.DecodeBlock(cpy.ToNode().RawData())
+		require.NoError(t, err)
+		params.Nonce++
+		return th.RequireNewTipSet(t, blk)
+	}
+
+	wrong := childOnNetwork("mainnet")
+	err := syncer.HandleNewTipset(ctx, requirePutBlocks(t, blockSource, wrong.ToSlice()...))
+	assert.Equal(t, chain.ErrWrongNetwork, errors.Cause(err))
+	assertHead(t, chainStore, dstP.genTS)
+	err = syncer.HandleNewTipset(ctx, wrong.ToSortedCidSet())
+	assert.Equal(t, chain.ErrChainHasBadTipSet, errors.Cause(err))
+
+	right := childOnNetwork("testnet")
+	require.NoError(t, syncer.HandleNewTipset(ctx, requirePutBlocks(t, blockSource, right.ToSlice()...)))
+	assertHead(t, chainStore, right)
+}
+
+// gasProtocol reports gasUsed as the gas used by every state transition it
+// runs.
+type gasProtocol struct {
+	consensus.Protocol
+	gasUsed types.GasUnits
+}
+
+func (p *gasProtocol) RunStateTransition(ctx context.Context, ts types.TipSet, ancestors []types.TipSet, pSt state.Tree) (state.Tree, types.GasUnits, error) {
+	st, _, err := p.Protocol.RunStateTransition(ctx, ts, ancestors, pSt)
+	return st, p.gasUsed, err
+}
+
+// The syncer stores the gas used by each tipset it validates.
+func TestSyncRecordsGasUsed(t *testing.T) {
+	tf.UnitTest(t)
+	ctx := context.Background()
+	dstP := initDSTParams()
+
+	r := repo.NewInMemoryRepo()
+	bs := bstore.NewBlockstore(r.Datastore())
+	cst := hamt.NewCborStore()
+	con := &gasProtocol{
+		Protocol: consensus.NewExpected(cst, bs, th.NewTestProcessor(), &th.TestView{}, dstP.genCid, proofs.NewFakeVerifier(true, nil)),
+		gasUsed:  300,
+	}
+	requireSetTestChain(t, con, false, dstP)
+	initGenesisWrapper := func(cst *hamt.CborIpldStore, bs bstore.Blockstore) (*types.Block, error) {
+		return initGenesis(dstP.minerAddress, dstP.minerOwnerAddress, dstP.minerPeerID, cst, bs)
+	}
+	syncer, chainStore, _, fetcher := initSyncTest(t, con, initGenesisWrapper, cst, bs, r, dstP)
+	store := chainStore.(*chain.DefaultStore)
+
+	requirePutBlocks(t, fetcher, dstP.link1.ToSlice()...)
+	require.NoError(t, syncer.HandleNewTipset(ctx, dstP.link1.ToSortedCidSet()))
+	assertHead(t, store, dstP.link1)
+
+	gasUsed, err := store.GasUsedAt(dstP.link1.ToSortedCidSet())
+	require.NoError(t, err)
+	assert.Equal(t, types.GasUnits(300), gasUsed)
+	gasUsed, err = store.GasUsedAt(dstP.genTS.ToSortedCidSet())
+	require.NoError(t, err)
+	assert.Equal(t, types.GasUnits(0), gasUsed)
+
+	// The gas used survives reloading the store.
+	rebooted := chain.NewDefaultStore(r.ChainDatastore(), dstP.genCid)
+	require.NoError(t, rebooted.Load(ctx))
+	gasUsed, err = rebooted.GasUsedAt(dstP.link1.ToSortedCidSet())
+	require.NoError(t, err)
+	assert.Equal(t, types.GasUnits(300), gasUsed)
+
+	_, err = rebooted.GasUsedAt(dstP.link2.ToSortedCidSet())
+	assert.Equal(t, chain.ErrNotFound, err)
+}
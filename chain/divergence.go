@@ -0,0 +1,51 @@
+package chain
+
+import (
+	"context"
+
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// DivergenceSpan returns the tipsets on the chain of a but not that of b,
+// those on the chain of b but not that of a, and common, the most recent
+// tipset the two chains share.  Each branch is ordered newest first and holds
+// the tipsets strictly above common, so a branch is empty when its end is an
+// ancestor of the other.  It returns ErrNoCommonAncestor if the chains share
+// no tipset.
+//
+// The walk mirrors FindCommonAncestor: whichever branch is at the greater
+// height steps back, and both step back at equal heights.
+func DivergenceSpan(ctx context.Context, store BlockProvider, a, b types.TipSet) (onlyA, onlyB []types.TipSet, common types.TipSet, err error) {
+	aIter := IterAncestors(ctx, store, a)
+	bIter := IterAncestors(ctx, store, b)
+	for !aIter.Complete() && !bIter.Complete() {
+		aTs := aIter.Value()
+		bTs := bIter.Value()
+		if aTs.Equals(bTs) {
+			return onlyA, onlyB, aTs, nil
+		}
+
+		aHeight, err := aTs.Height()
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		bHeight, err := bTs.Height()
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		if aHeight >= bHeight {
+			onlyA = append(onlyA, aTs)
+			if err := aIter.Next(); err != nil {
+				return nil, nil, nil, err
+			}
+		}
+		if bHeight >= aHeight {
+			onlyB = append(onlyB, bTs)
+			if err := bIter.Next(); err != nil {
+				return nil, nil, nil, err
+			}
+		}
+	}
+	return nil, nil, nil, ErrNoCommonAncestor
+}
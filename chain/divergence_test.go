@@ -0,0 +1,56 @@
+package chain_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/chain/synctest"
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestDivergenceSpan(t *testing.T) {
+	tf.UnitTest(t)
+	ctx := context.Background()
+
+	// a1 - a2 - a3 - a4
+	//   \
+	//    b1 - (null) - (null) - b2
+	h := synctest.NewHarness(t)
+	h.Build(synctest.Linear("a", "", 4)...)
+	h.Build(
+		synctest.Spec{Name: "b1", Parent: "a1"},
+		synctest.Spec{Name: "b2", Parent: "b1", NullRounds: 2},
+	)
+	h.RequireSync("a4")
+	h.RequireSync("b2")
+	h.RequireHead("a4")
+
+	tipsets := func(names ...string) []types.TipSet {
+		var tss []types.TipSet
+		for _, name := range names {
+			tss = append(tss, h.TipSet(name))
+		}
+		return tss
+	}
+
+	t.Run("fork", func(t *testing.T) {
+		onlyA, onlyB, common, err := chain.DivergenceSpan(ctx, h.Store, h.TipSet("a4"), h.TipSet("b2"))
+		require.NoError(t, err)
+		assert.Equal(t, tipsets("a4", "a3", "a2"), onlyA)
+		assert.Equal(t, tipsets("b2", "b1"), onlyB)
+		assert.Equal(t, h.TipSet("a1"), common)
+	})
+
+	t.Run("ancestor", func(t *testing.T) {
+		onlyA, onlyB, common, err := chain.DivergenceSpan(ctx, h.Store, h.TipSet("a2"), h.TipSet("a4"))
+		require.NoError(t, err)
+		assert.Empty(t, onlyA)
+		assert.Equal(t, tipsets("a4", "a3"), onlyB)
+		assert.Equal(t, h.TipSet("a2"), common)
+	})
+}
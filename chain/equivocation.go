@@ -0,0 +1,145 @@
+package chain
+
+import (
+	"context"
+
+	"github.com/ipfs/go-cid"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// defaultEquivocationDepth is the number of rounds below the highest height
+// seen for which the syncer remembers the blocks of each miner.
+const defaultEquivocationDepth = 900
+
+// Equivocation records a miner producing two distinct blocks at the same
+// height, which Expected Consensus penalizes.
+type Equivocation struct {
+	// Miner is the address of the miner that equivocated.
+	Miner address.Address
+	// Height is the height of both blocks.
+	Height uint64
+	// First is the block from Miner the syncer saw first.
+	First cid.Cid
+	// Second is the block from Miner that conflicts with First.
+	Second cid.Cid
+}
+
+// DetectEquivocation configures the syncer to track the blocks each miner
+// produces at each height and flag a miner producing two distinct blocks at
+// the same height.  Only blocks of tipsets that pass validation are tracked.
+// The syncer logs each equivocation and calls onEquivocation, if it is not
+// nil, so that it can be reported for slashing.
+// If reject is true a tipset holding two blocks from the same miner is
+// rejected with ErrEquivocation and cached as bad, and is never formed by
+// widening.  Blocks from the same miner at the same height in different
+// tipsets are only flagged, as neither tipset is invalid on its own.
+func DetectEquivocation(reject bool, onEquivocation func(Equivocation)) SyncerOpt {
+	return func(syncer *DefaultSyncer) {
+		syncer.equivocations = newEquivocationTracker(defaultEquivocationDepth)
+		syncer.rejectEquivocation = reject
+		syncer.onEquivocation = onEquivocation
+	}
+}
+
+// detectEquivocation records the blocks of ts and reports every equivocation
+// they reveal.  It returns true if ts itself holds two blocks from the same
+// miner.  It does nothing if equivocation detection is disabled.  The caller
+// must hold syncer.mu.
+func (syncer *DefaultSyncer) detectEquivocation(ctx context.Context, ts types.TipSet) (bool, error) {
+	if syncer.equivocations == nil {
+		return false, nil
+	}
+	h, err := ts.Height()
+	if err != nil {
+		return false, err
+	}
+
+	tsKey := ts.ToSortedCidSet()
+	within := false
+	for _, eq := range syncer.equivocations.record(ts.ToSlice(), h) {
+		logSyncer.Warningf("miner %s equivocated at height %d with blocks %s and %s", eq.Miner, eq.Height, eq.First, eq.Second)
+		equivocationsCt.Inc(ctx, 1)
+		if syncer.onEquivocation != nil {
+			syncer.onEquivocation(eq)
+		}
+		if tsKey.Has(eq.First) {
+			within = true
+		}
+	}
+	return within, nil
+}
+
+// equivocationTracker remembers the blocks each miner produced at recent
+// heights.  It is not threadsafe.
+type equivocationTracker struct {
+	// depth is the number of rounds below maxHeight that are remembered.
+	depth     uint64
+	maxHeight uint64
+	// blocks maps heights to the distinct blocks each miner produced at
+	// that height, in the order they were seen.
+	blocks map[uint64]map[address.Address][]cid.Cid
+}
+
+func newEquivocationTracker(depth uint64) *equivocationTracker {
+	return &equivocationTracker{
+		depth:  depth,
+		blocks: make(map[uint64]map[address.Address][]cid.Cid),
+	}
+}
+
+// record remembers blks, all at height h, and returns an equivocation for
+// each block not seen before from a miner that already produced a block at
+// h.
+func (t *equivocationTracker) record(blks []*types.Block, h uint64) []Equivocation {
+	if h > t.maxHeight {
+		t.maxHeight = h
+		t.prune()
+	}
+	if h+t.depth < t.maxHeight {
+		return nil
+	}
+
+	miners, ok := t.blocks[h]
+	if !ok {
+		miners = make(map[address.Address][]cid.Cid)
+		t.blocks[h] = miners
+	}
+
+	var found []Equivocation
+	for _, blk := range blks {
+		seen := miners[blk.Miner]
+		if containsCid(seen, blk.Cid()) {
+			continue
+		}
+		if len(seen) > 0 {
+			found = append(found, Equivocation{
+				Miner:  blk.Miner,
+				Height: h,
+				First:  seen[0],
+				Second: blk.Cid(),
+			})
+		}
+		miners[blk.Miner] = append(seen, blk.Cid())
+	}
+	return found
+}
+
+// prune forgets heights more than depth rounds below maxHeight.
+func (t *equivocationTracker) prune() {
+	for h := range t.blocks {
+		if h+t.depth < t.maxHeight {
+			delete(t.blocks, h)
+		}
+	}
+}
+
+func containsCid(cids []cid.Cid, c cid.Cid) bool {
+	for _, other := range cids {
+		if other.Equals(c) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,139 @@
+package chain
+
+import (
+	"context"
+	"io"
+
+	"github.com/ipfs/go-car"
+	carutil "github.com/ipfs/go-car/util"
+	"github.com/ipfs/go-cid"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	cbor "github.com/ipfs/go-ipld-cbor"
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// ExportRange writes to w a CAR holding the tipsets of the store's chain with
+// heights from fromHeight to toHeight inclusive, the state their state roots
+// reference and the state of the parent of the lowest of them, so that the
+// lowest tipset can be validated.  The CAR's roots are the blocks of the
+// highest tipset in the range.  It imports with Import or ImportMulti into a
+// store holding the parent of the lowest tipset.  bs must hold the state of
+// the exported tipsets.  It is an error for the range to hold no tipset, and
+// it fails with ErrMessagesPruned if the range holds a block whose messages
+// were pruned.
+func ExportRange(ctx context.Context, store *DefaultStore, bs bstore.Blockstore, fromHeight, toHeight uint64, w io.Writer) error {
+	if fromHeight > toHeight {
+		return errors.Errorf("invalid height range %d to %d", fromHeight, toHeight)
+	}
+	head, err := store.GetTipSet(store.GetHead())
+	if err != nil {
+		return err
+	}
+
+	// tipsets holds the tipsets in the range, newest first.
+	var tipsets []types.TipSet
+	for it := IterAncestors(ctx, headerProvider{store}, *head); !it.Complete(); {
+		h, err := it.Value().Height()
+		if err != nil {
+			return err
+		}
+		if h < fromHeight {
+			break
+		}
+		if h <= toHeight {
+			if err := store.checkMessagesKept(it.Value()); err != nil {
+				return err
+			}
+			tipsets = append(tipsets, it.Value())
+		}
+		if err := it.Next(); err != nil {
+			return err
+		}
+	}
+	if len(tipsets) == 0 {
+		return errors.Errorf("no tipsets between heights %d and %d", fromHeight, toHeight)
+	}
+
+	stateRoots := make([]cid.Cid, 0, len(tipsets)+1)
+	for _, ts := range tipsets {
+		root, err := store.GetTipSetStateRoot(ts.ToSortedCidSet())
+		if err != nil {
+			return errors.Wrapf(err, "failed to load state root of tipset %s", ts.String())
+		}
+		stateRoots = append(stateRoots, root)
+	}
+	parents, err := tipsets[len(tipsets)-1].Parents()
+	if err != nil {
+		return err
+	}
+	if parents.Len() > 0 {
+		root, err := store.GetTipSetStateRoot(parents)
+		if err != nil {
+			return errors.Wrapf(err, "failed to load state root of tipset %s", parents.String())
+		}
+		stateRoots = append(stateRoots, root)
+	}
+
+	if err := car.WriteHeader(&car.CarHeader{Roots: tipsets[0].ToSortedCidSet().ToSlice(), Version: 1}, w); err != nil {
+		return err
+	}
+	for _, ts := range tipsets {
+		for _, blk := range ts.ToSlice() {
+			if err := carutil.LdWrite(w, blk.Cid().Bytes(), blk.ToNode().RawData()); err != nil {
+				return err
+			}
+		}
+	}
+	// States of adjacent tipsets share most of their objects, which are
+	// written once.
+	seen := make(map[cid.Cid]struct{})
+	for _, root := range stateRoots {
+		if err := exportDag(ctx, bs, root, seen, w); err != nil {
+			return errors.Wrapf(err, "failed to export state %s", root.String())
+		}
+	}
+	logStore.Infof("exported %d tipsets from height %d to %d", len(tipsets), fromHeight, toHeight)
+	return nil
+}
+
+// exportDag writes to w the objects of the dag rooted at root that are not in
+// seen, and adds them to seen.  Raw objects missing from bs, such as the
+// builtin actor code objects state links to, are skipped.
+func exportDag(ctx context.Context, bs bstore.Blockstore, root cid.Cid, seen map[cid.Cid]struct{}, w io.Writer) error {
+	stack := []cid.Cid{root}
+	for len(stack) > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		c := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if _, ok := seen[c]; ok {
+			continue
+		}
+		seen[c] = struct{}{}
+
+		blk, err := bs.Get(c)
+		if err == bstore.ErrNotFound && c.Prefix().Codec == cid.Raw {
+			continue
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed to load object %s", c.String())
+		}
+		if err := carutil.LdWrite(w, c.Bytes(), blk.RawData()); err != nil {
+			return err
+		}
+		if c.Prefix().Codec != cid.DagCBOR {
+			continue
+		}
+		nd, err := cbor.Decode(blk.RawData(), types.DefaultHashFunction, -1)
+		if err != nil {
+			return errors.Wrapf(err, "failed to decode object %s", c.String())
+		}
+		for _, link := range nd.Links() {
+			stack = append(stack, link.Cid)
+		}
+	}
+	return nil
+}
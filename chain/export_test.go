@@ -0,0 +1,159 @@
+package chain_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	bserv "github.com/ipfs/go-blockservice"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-hamt-ipld"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/actor"
+	"github.com/filecoin-project/go-filecoin/actor/builtin"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/consensus"
+	"github.com/filecoin-project/go-filecoin/proofs"
+	"github.com/filecoin-project/go-filecoin/repo"
+	"github.com/filecoin-project/go-filecoin/state"
+	th "github.com/filecoin-project/go-filecoin/testhelpers"
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestExportRange(t *testing.T) {
+	tf.UnitTest(t)
+	ctx := context.Background()
+
+	// A chain of five tipsets above genesis, each with its own state: every
+	// tipset's message advances the sender's nonce.
+	bs := bstore.NewBlockstore(repo.NewInMemoryRepo().Datastore())
+	cst := &hamt.CborIpldStore{Blocks: bserv.New(bs, offline.Exchange(bs))}
+	addrGetter := address.NewForTestGetter()
+	sender, recipient := addrGetter(), addrGetter()
+	root, st := th.RequireMakeStateTree(t, cst, map[address.Address]*actor.Actor{
+		sender:    th.RequireNewAccountActor(t, types.NewAttoFILFromFIL(100)),
+		recipient: th.RequireNewAccountActor(t, types.ZeroAttoFIL),
+	})
+
+	genesis := types.NewBlockForTest(nil, 0)
+	genesis.StateRoot = root
+	chainTs := []types.TipSet{th.MustNewTipSet(genesis)}
+	roots := []cid.Cid{root}
+	parent := genesis
+	for i := uint64(1); i <= 5; i++ {
+		msg := types.NewMessage(sender, recipient, i-1, types.ZeroAttoFIL, "", nil)
+		_, err := th.ApplyTestMessage(st, th.VMStorage(), msg, types.NewBlockHeight(i))
+		require.NoError(t, err)
+		root, err := st.Flush(ctx)
+		require.NoError(t, err)
+
+		blk := types.NewBlockForTest(parent, 0)
+		blk.StateRoot = root
+		chainTs = append(chainTs, th.MustNewTipSet(blk))
+		roots = append(roots, root)
+		parent = blk
+	}
+
+	// newStore returns a store holding the chain up to height top.
+	newStore := func(top int) *chain.DefaultStore {
+		store := chain.NewDefaultStore(repo.NewInMemoryRepo().ChainDatastore(), genesis.Cid())
+		for i := 0; i <= top; i++ {
+			th.RequirePutTsas(ctx, t, store, &chain.TipSetAndState{TipSet: chainTs[i], TipSetStateRoot: roots[i]})
+		}
+		require.NoError(t, store.SetHead(ctx, chainTs[top]))
+		return store
+	}
+	src := newStore(5)
+
+	t.Run("a middle range imports on top of its parent", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, chain.ExportRange(ctx, src, bs, 3, 4, &buf))
+
+		dst := newStore(2)
+		dstBs := bstore.NewBlockstore(repo.NewInMemoryRepo().Datastore())
+		imported, err := chain.Import(ctx, dst, dstBs, &buf)
+		require.NoError(t, err)
+		assert.Equal(t, chainTs[4], imported)
+		assert.Equal(t, chainTs[4].ToSortedCidSet(), dst.GetHead())
+		assert.False(t, dst.HasTipSetAndState(ctx, chainTs[5].String()))
+
+		// The state of the range and of its parent is complete.
+		dstCst := &hamt.CborIpldStore{Blocks: bserv.New(dstBs, offline.Exchange(dstBs))}
+		for i := 2; i <= 4; i++ {
+			tree, err := state.LoadStateTree(ctx, dstCst, roots[i], builtin.Actors)
+			require.NoError(t, err)
+			act, err := tree.GetActor(ctx, sender)
+			require.NoError(t, err)
+			assert.Equal(t, types.Uint64(i), act.Nonce)
+		}
+
+		// Blocks outside the range are not exported.
+		for _, i := range []int{1, 2, 5} {
+			has, err := dstBs.Has(chainTs[i].ToSlice()[0].Cid())
+			require.NoError(t, err)
+			assert.False(t, has)
+		}
+	})
+
+	t.Run("an empty range is an error", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.Error(t, chain.ExportRange(ctx, src, bs, 4, 3, &buf))
+		assert.Error(t, chain.ExportRange(ctx, src, bs, 6, 10, &buf))
+	})
+}
+
+// An exported range validates through consensus when imported into a store
+// holding its parent and verified with that store's syncer.
+func TestExportRangeSyncs(t *testing.T) {
+	tf.UnitTest(t)
+	ctx := context.Background()
+	dstP := initDSTParams()
+	newCon := func(cst *hamt.CborIpldStore, bs bstore.Blockstore) consensus.Protocol {
+		return consensus.NewExpected(cst, bs, th.NewTestProcessor(), &th.TestView{}, dstP.genCid, proofs.NewFakeVerifier(true, nil))
+	}
+	// Both syncers validate the same blocks, built once.
+	requireSetTestChain(t, newCon(hamt.NewCborStore(), bstore.NewBlockstore(repo.NewInMemoryRepo().Datastore())), false, dstP)
+
+	// newSyncer returns a syncer of dstP's chain whose state is held in a
+	// blockstore, as the node's is, so that it can be exported.
+	newSyncer := func(t *testing.T) (*chain.DefaultSyncer, *chain.DefaultStore, bstore.Blockstore, *th.TestFetcher) {
+		r := repo.NewInMemoryRepo()
+		bs := bstore.NewBlockstore(r.Datastore())
+		cst := &hamt.CborIpldStore{Blocks: bserv.New(bs, offline.Exchange(bs))}
+		con := newCon(cst, bs)
+		genFunc := func(cst *hamt.CborIpldStore, bs bstore.Blockstore) (*types.Block, error) {
+			return initGenesis(dstP.minerAddress, dstP.minerOwnerAddress, dstP.minerPeerID, cst, bs)
+		}
+		syncer, store, _, fetcher := initSyncTest(t, con, genFunc, cst, bs, r, dstP)
+		return syncer, store.(*chain.DefaultStore), bs, fetcher
+	}
+	// syncTo syncs syncer to the last of tipsets, serving all of them.
+	syncTo := func(t *testing.T, syncer *chain.DefaultSyncer, fetcher *th.TestFetcher, tipsets ...types.TipSet) {
+		var head types.SortedCidSet
+		for _, ts := range tipsets {
+			head = requirePutBlocks(t, fetcher, ts.ToSlice()...)
+		}
+		require.NoError(t, syncer.HandleNewTipset(ctx, head))
+	}
+
+	srcSyncer, src, srcBs, srcFetcher := newSyncer(t)
+	syncTo(t, srcSyncer, srcFetcher, dstP.link1, dstP.link2, dstP.link3, dstP.link4)
+
+	var buf bytes.Buffer
+	require.NoError(t, chain.ExportRange(ctx, src, srcBs, 3, 4, &buf))
+
+	dstSyncer, dst, dstBs, dstFetcher := newSyncer(t)
+	syncTo(t, dstSyncer, dstFetcher, dstP.link1, dstP.link2)
+
+	imported, err := chain.Import(ctx, dst, dstBs, &buf, chain.VerifyState(dstSyncer))
+	require.NoError(t, err)
+	assert.Equal(t, dstP.link4, imported)
+	assertHead(t, dst, dstP.link4)
+	assert.True(t, dst.HasTipSetAndState(ctx, dstP.link3.String()))
+}
@@ -0,0 +1,53 @@
+package chain_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/chain/synctest"
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// paddingFetcher returns the blocks of its inner fetcher plus extra, if set.
+type paddingFetcher struct {
+	inner interface {
+		GetBlocks(context.Context, []cid.Cid) ([]*types.Block, error)
+	}
+	extra *types.Block
+}
+
+func (f *paddingFetcher) GetBlocks(ctx context.Context, cids []cid.Cid) ([]*types.Block, error) {
+	blks, err := f.inner.GetBlocks(ctx, cids)
+	if err != nil || f.extra == nil {
+		return blks, err
+	}
+	return append(blks, f.extra), nil
+}
+
+func TestSyncRejectsUnrequestedBlocks(t *testing.T) {
+	tf.UnitTest(t)
+	ctx := context.Background()
+
+	h := synctest.NewHarness(t)
+	h.Build(synctest.Linear("a", "", 2)...)
+	h.Build(synctest.Spec{Name: "sibling", Parent: "a1"})
+
+	fetcher := &paddingFetcher{inner: h.Fetcher, extra: h.TipSet("sibling").ToSlice()[0]}
+	syncer := chain.NewDefaultSyncer(h.StateStore, h.Consensus, h.Store, fetcher)
+
+	err := syncer.HandleNewTipset(ctx, h.TipSet("a2").ToSortedCidSet())
+	assert.Equal(t, chain.ErrUnexpectedBlocks, errors.Cause(err))
+	h.RequireHead(synctest.GenesisName)
+
+	// The tipset is not cached as bad, so it syncs once the fetcher behaves.
+	fetcher.extra = nil
+	require.NoError(t, syncer.HandleNewTipset(ctx, h.TipSet("a2").ToSortedCidSet()))
+	h.RequireHead("a2")
+}
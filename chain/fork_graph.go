@@ -0,0 +1,142 @@
+package chain
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// forkGraphReader is the subset of the chain store ExportForkGraph reads.
+type forkGraphReader interface {
+	BlockProvider
+	GetHead() types.SortedCidSet
+	GetTipSet(tsKey types.SortedCidSet) (*types.TipSet, error)
+	GetTipSetsByHeight(h uint64) ([]*types.TipSet, error)
+}
+
+// forkGraphNode is a tipset in an exported fork graph.
+type forkGraphNode struct {
+	ts        types.TipSet
+	height    uint64
+	canonical bool
+}
+
+// ExportForkGraph returns the DAG of tipsets the store holds from fromHeight
+// up to the head's height as a Graphviz DOT digraph.  The graph is rooted at
+// the head's ancestor at or below fromHeight and includes every stored
+// descendant of it, so forks branching off at or after that ancestor appear
+// alongside the canonical chain.  Each node is labeled with its height and
+// parent weight, and nodes on the canonical chain are drawn bold.  Edges point
+// from child to parent.
+func ExportForkGraph(ctx context.Context, store forkGraphReader, fromHeight uint64) (string, error) {
+	head, err := store.GetTipSet(store.GetHead())
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get head")
+	}
+	headHeight, err := head.Height()
+	if err != nil {
+		return "", err
+	}
+
+	// Mark the canonical chain down to the root of the graph.
+	canonical := make(map[string]bool)
+	var root types.TipSet
+	for it := IterAncestors(ctx, store, *head); !it.Complete(); err = it.Next() {
+		if err != nil {
+			return "", err
+		}
+		root = it.Value()
+		canonical[root.String()] = true
+		h, err := root.Height()
+		if err != nil {
+			return "", err
+		}
+		if h <= fromHeight {
+			break
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// Walk forward from the root one height at a time, adding each stored
+	// tipset whose parent is already in the graph.  Parents are strictly
+	// lower than their children, so a single pass finds every descendant.
+	rootHeight, err := root.Height()
+	if err != nil {
+		return "", err
+	}
+	nodes := map[string]*forkGraphNode{
+		root.String(): {ts: root, height: rootHeight, canonical: true},
+	}
+	var edges [][2]string
+	for h := rootHeight + 1; h <= headHeight; h++ {
+		tipsets, err := store.GetTipSetsByHeight(h)
+		if errors.Cause(err) == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		for _, ts := range tipsets {
+			parents, err := ts.Parents()
+			if err != nil {
+				return "", err
+			}
+			parentKey := parents.String()
+			if _, ok := nodes[parentKey]; !ok {
+				continue
+			}
+			key := ts.String()
+			nodes[key] = &forkGraphNode{ts: *ts, height: h, canonical: canonical[key]}
+			edges = append(edges, [2]string{key, parentKey})
+		}
+	}
+
+	return formatForkGraph(nodes, edges)
+}
+
+// formatForkGraph renders nodes and edges as DOT, sorted so that output is
+// deterministic.
+func formatForkGraph(nodes map[string]*forkGraphNode, edges [][2]string) (string, error) {
+	sorted := make([]*forkGraphNode, 0, len(nodes))
+	for _, n := range nodes {
+		sorted = append(sorted, n)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].height != sorted[j].height {
+			return sorted[i].height < sorted[j].height
+		}
+		return sorted[i].ts.String() < sorted[j].ts.String()
+	})
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i][0] != edges[j][0] {
+			return edges[i][0] < edges[j][0]
+		}
+		return edges[i][1] < edges[j][1]
+	})
+
+	var buf bytes.Buffer
+	buf.WriteString("digraph forks {\n")
+	for _, n := range sorted {
+		weight, err := n.ts.ParentWeight()
+		if err != nil {
+			return "", err
+		}
+		style := ""
+		if n.canonical {
+			style = ", style=bold"
+		}
+		fmt.Fprintf(&buf, "\t%q [label=\"height %d\\nparent weight %d\"%s];\n", n.ts.String(), n.height, weight, style)
+	}
+	for _, e := range edges {
+		fmt.Fprintf(&buf, "\t%q -> %q;\n", e[0], e[1])
+	}
+	buf.WriteString("}\n")
+	return buf.String(), nil
+}
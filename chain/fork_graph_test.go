@@ -0,0 +1,85 @@
+package chain_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/chain"
+	th "github.com/filecoin-project/go-filecoin/testhelpers"
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestExportForkGraph(t *testing.T) {
+	tf.UnitTest(t)
+	ctx := context.Background()
+	dstP := initDSTParams()
+	initStoreTest(ctx, t, dstP)
+
+	signer, ki := types.NewMockSignersAndKeyInfo(1)
+	fork := th.RequireNewTipSet(t, th.RequireMkFakeChild(t, th.FakeChildParams{
+		MinerAddr:   dstP.minerAddress,
+		Parent:      dstP.link1,
+		GenesisCid:  dstP.genCid,
+		StateRoot:   dstP.link1State,
+		Signer:      signer,
+		MinerPubKey: ki[0].PublicKey(),
+		Nonce:       uint64(42),
+	}))
+
+	cs := newChainStore(dstP)
+	for _, tsas := range []*chain.TipSetAndState{
+		{TipSet: dstP.genTS, TipSetStateRoot: dstP.genStateRoot},
+		{TipSet: dstP.link1, TipSetStateRoot: dstP.link1State},
+		{TipSet: dstP.link2, TipSetStateRoot: dstP.link2State},
+		{TipSet: fork, TipSetStateRoot: dstP.link2State},
+	} {
+		th.RequirePutTsas(ctx, t, cs, tsas)
+	}
+	require.NoError(t, cs.SetHead(ctx, dstP.link2))
+
+	node := func(ts types.TipSet, canonical bool) string {
+		h, err := ts.Height()
+		require.NoError(t, err)
+		w, err := ts.ParentWeight()
+		require.NoError(t, err)
+		style := ""
+		if canonical {
+			style = ", style=bold"
+		}
+		return fmt.Sprintf("%q [label=\"height %d\\nparent weight %d\"%s];", ts.String(), h, w, style)
+	}
+	edge := func(child, parent types.TipSet) string {
+		return fmt.Sprintf("%q -> %q;", child.String(), parent.String())
+	}
+
+	t.Run("whole chain", func(t *testing.T) {
+		dot, err := chain.ExportForkGraph(ctx, cs, 0)
+		require.NoError(t, err)
+
+		assert.True(t, strings.HasPrefix(dot, "digraph forks {\n"))
+		assert.Contains(t, dot, node(dstP.genTS, true))
+		assert.Contains(t, dot, node(dstP.link1, true))
+		assert.Contains(t, dot, node(dstP.link2, true))
+		assert.Contains(t, dot, node(fork, false))
+		assert.Contains(t, dot, edge(dstP.link1, dstP.genTS))
+		assert.Contains(t, dot, edge(dstP.link2, dstP.link1))
+		assert.Contains(t, dot, edge(fork, dstP.link1))
+		assert.Equal(t, 3, strings.Count(dot, "->"))
+	})
+
+	t.Run("from height", func(t *testing.T) {
+		dot, err := chain.ExportForkGraph(ctx, cs, 1)
+		require.NoError(t, err)
+
+		assert.NotContains(t, dot, dstP.genTS.String())
+		assert.Contains(t, dot, node(dstP.link1, true))
+		assert.Contains(t, dot, node(fork, false))
+		assert.Equal(t, 2, strings.Count(dot, "->"))
+	})
+}
@@ -0,0 +1,44 @@
+package chain_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/chain/synctest"
+	th "github.com/filecoin-project/go-filecoin/testhelpers"
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestGenesisMismatch(t *testing.T) {
+	tf.UnitTest(t)
+	ctx := context.Background()
+
+	fetched := 0
+	h := synctest.NewHarness(t, chain.ObserveBlocks(func(cid.Cid, int, bool) { fetched++ }))
+
+	// A chain of another network, rooting in its own genesis.
+	foreignGenesis := types.NewBlockForTest(nil, 1)
+	foreignGenesis.StateRoot = types.SomeCid()
+	link1 := types.NewBlockForTest(foreignGenesis, 0)
+	link2 := types.NewBlockForTest(link1, 0)
+	h.Fetcher.AddSourceBlocks(foreignGenesis, link1, link2)
+	head := th.RequireNewTipSet(t, link2).ToSortedCidSet()
+
+	err := h.Syncer.HandleNewTipset(ctx, head)
+	require.Error(t, err)
+	assert.Equal(t, chain.ErrGenesisMismatch, errors.Cause(err))
+	assert.Equal(t, 3, fetched)
+	h.RequireHead(synctest.GenesisName)
+
+	// The chain is cached as bad, so it is rejected without fetching.
+	err = h.Syncer.HandleNewTipset(ctx, head)
+	assert.Equal(t, chain.ErrChainHasBadTipSet, errors.Cause(err))
+	assert.Equal(t, 3, fetched)
+}
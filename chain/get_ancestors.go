@@ -9,7 +9,6 @@ import (
 
 	"github.com/filecoin-project/go-filecoin/consensus"
 	"github.com/filecoin-project/go-filecoin/metrics/tracing"
-	"github.com/filecoin-project/go-filecoin/sampling"
 	"github.com/filecoin-project/go-filecoin/types"
 )
 
@@ -23,15 +22,16 @@ type recentAncestorsChainReader interface {
 var ErrNoCommonAncestor = errors.New("no common ancestor")
 
 // GetRecentAncestorsOfHeaviestChain returns the ancestors of a `TipSet` with
-// height `descendantBlockHeight` in the heaviest chain.
-func GetRecentAncestorsOfHeaviestChain(ctx context.Context, chainReader recentAncestorsChainReader, descendantBlockHeight *types.BlockHeight) ([]types.TipSet, error) {
+// height `descendantBlockHeight` in the heaviest chain, including lookback
+// tipsets preceding the live proving periods.
+func GetRecentAncestorsOfHeaviestChain(ctx context.Context, chainReader recentAncestorsChainReader, descendantBlockHeight *types.BlockHeight, lookback uint) ([]types.TipSet, error) {
 	head := chainReader.GetHead()
 	headTipSet, err := chainReader.GetTipSet(head)
 	if err != nil {
 		return nil, err
 	}
 	ancestorHeight := types.NewBlockHeight(consensus.AncestorRoundsNeeded)
-	return GetRecentAncestors(ctx, *headTipSet, chainReader, descendantBlockHeight, ancestorHeight, sampling.LookbackParameter)
+	return GetRecentAncestors(ctx, *headTipSet, chainReader, descendantBlockHeight, ancestorHeight, lookback)
 }
 
 // GetRecentAncestors returns the ancestors of base as a slice of TipSets.
@@ -41,8 +41,9 @@ func GetRecentAncestorsOfHeaviestChain(ctx context.Context, chainReader recentAn
 // childBH - ancestorRounds, and the lookback tipsets that precede them.
 //
 // The return slice is a concatenation of two slices: append(provingPeriodAncestors, extraRandomnessAncestors...)
-//   provingPeriodAncestors: all ancestor tipsets with height greater than childBH - ancestorRoundsNeeded
-//   extraRandomnessAncestors: the lookback number of tipsets directly preceding tipsets in provingPeriodAncestors
+//
+//	provingPeriodAncestors: all ancestor tipsets with height greater than childBH - ancestorRoundsNeeded
+//	extraRandomnessAncestors: the lookback number of tipsets directly preceding tipsets in provingPeriodAncestors
 //
 // The last tipset of provingPeriodAncestors is the earliest possible tipset to
 // begin a proving period that is still "live", i.e it is valid to accept PoSts
@@ -77,6 +78,12 @@ func GetRecentAncestors(ctx context.Context, base types.TipSet, chainReader rece
 	if err != nil {
 		return nil, err
 	}
+	// base itself is older than any live proving period, as happens when
+	// many null rounds follow it, e.g. the first tipset after genesis, so
+	// the lookback tipsets begin at base.
+	if len(provingPeriodAncestors) == 0 {
+		return CollectAtMostNTipSets(ctx, IterAncestors(ctx, chainReader, base), lookback)
+	}
 	firstExtraRandomnessAncestorsCids, err := provingPeriodAncestors[len(provingPeriodAncestors)-1].Parents()
 	if err != nil {
 		return nil, err
@@ -0,0 +1,84 @@
+package chain
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultHeadStallCheckInterval is how often RunHeadStallDetection checks
+// whether the head has stalled.
+const DefaultHeadStallCheckInterval = time.Minute
+
+// DetectHeadStall configures the syncer to treat its head as stalled when it
+// is caught up but has not advanced its head for threshold.
+// A caught up node whose head stops moving has most likely stopped hearing
+// from the network, whereas a healthy node advances its head every round or
+// so.  When the head stalls the syncer logs an alert and calls onStall, if
+// it is not nil, with the time since the head last advanced.  Stalls are
+// alerted on by CheckHeadStall.
+func DetectHeadStall(threshold time.Duration, onStall func(since time.Duration)) SyncerOpt {
+	return func(syncer *DefaultSyncer) {
+		syncer.headStallThreshold = threshold
+		syncer.onHeadStall = onStall
+	}
+}
+
+// HeadStalled returns true if head stall detection is configured and the
+// syncer is caught up but has not advanced its head for the configured
+// threshold, and the time since the head last advanced, or since the syncer
+// was created if it never did.  It raises no alert.
+func (syncer *DefaultSyncer) HeadStalled() (bool, time.Duration) {
+	if syncer.headStallThreshold <= 0 {
+		return false, 0
+	}
+	caughtUp := syncer.Mode() == CaughtUp
+
+	advancedAt := syncer.lastHeadAdvance()
+	if advancedAt.IsZero() {
+		advancedAt = syncer.createdAt
+	}
+	since := syncer.clock.Now().Sub(advancedAt)
+	return caughtUp && since >= syncer.headStallThreshold, since
+}
+
+// CheckHeadStall returns whether the head is stalled, as HeadStalled, and
+// raises the alert once per stall, the first time it finds the head stalled
+// after the head advances.
+func (syncer *DefaultSyncer) CheckHeadStall(ctx context.Context) bool {
+	stalled, since := syncer.HeadStalled()
+	if !stalled {
+		return false
+	}
+
+	syncer.headAdvanceMu.Lock()
+	alert := !syncer.headStalled
+	syncer.headStalled = true
+	syncer.headAdvanceMu.Unlock()
+
+	if alert {
+		logSyncer.Errorf("head stalled, no new head for %s while caught up; the node may be isolated from the network", since)
+		headStallsCt.Inc(ctx, 1)
+		if syncer.onHeadStall != nil {
+			syncer.onHeadStall(since)
+		}
+	}
+	return true
+}
+
+// RunHeadStallDetection calls CheckHeadStall every interval until ctx is
+// done.  It returns immediately if head stall detection is not configured.
+func (syncer *DefaultSyncer) RunHeadStallDetection(ctx context.Context, interval time.Duration) {
+	if syncer.headStallThreshold <= 0 || interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			syncer.CheckHeadStall(ctx)
+		}
+	}
+}
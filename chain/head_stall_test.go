@@ -0,0 +1,56 @@
+package chain_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/chain/synctest"
+	th "github.com/filecoin-project/go-filecoin/testhelpers"
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+)
+
+func TestDetectHeadStall(t *testing.T) {
+	tf.UnitTest(t)
+	ctx := context.Background()
+
+	clk := th.NewFakeClock(time.Unix(1234567890, 0))
+	var alerts []time.Duration
+	h := synctest.NewHarness(t, chain.SyncerClock(clk), chain.DetectHeadStall(time.Minute, func(since time.Duration) {
+		alerts = append(alerts, since)
+	}))
+	h.Build(synctest.Linear("link", "", 2)...)
+
+	h.RequireSync("link1")
+	assert.Equal(t, chain.CaughtUp, h.Syncer.Mode())
+	assert.False(t, h.Syncer.CheckHeadStall(ctx))
+
+	clk.Advance(30 * time.Second)
+	assert.False(t, h.Syncer.CheckHeadStall(ctx))
+	assert.Empty(t, alerts)
+
+	// No new head arrives before the threshold passes.  Reading the stall
+	// raises no alert.
+	clk.Advance(40 * time.Second)
+	stalled, since := h.Syncer.HeadStalled()
+	assert.True(t, stalled)
+	assert.Equal(t, 70*time.Second, since)
+	assert.Empty(t, alerts)
+	assert.True(t, h.Syncer.CheckHeadStall(ctx))
+	assert.Equal(t, []time.Duration{70 * time.Second}, alerts)
+
+	// The alert is raised once per stall.
+	clk.Advance(time.Minute)
+	assert.True(t, h.Syncer.CheckHeadStall(ctx))
+	assert.Len(t, alerts, 1)
+
+	// A new head ends the stall.
+	h.RequireSync("link2")
+	assert.False(t, h.Syncer.CheckHeadStall(ctx))
+	clk.Advance(2 * time.Minute)
+	assert.True(t, h.Syncer.CheckHeadStall(ctx))
+	assert.Len(t, alerts, 2)
+}
@@ -0,0 +1,36 @@
+package chain
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// VerifyHeadState configures the store to refuse to set a head whose state
+// it cannot load from stateStore.  SetHead then returns
+// ErrUnexpectedStoreState, leaving the head alone, if the new head has no
+// stored state root or its state tree does not load, so that the head never
+// points to state that was never flushed.
+func VerifyHeadState(stateStore StateStore) StoreOpt {
+	return func(store *DefaultStore) {
+		store.headStateStore = stateStore
+	}
+}
+
+// checkHeadState returns ErrUnexpectedStoreState if the store verifies head
+// state and the state of ts cannot be loaded.
+func (store *DefaultStore) checkHeadState(ctx context.Context, ts types.TipSet) error {
+	if store.headStateStore == nil {
+		return nil
+	}
+	root, err := store.GetTipSetStateRoot(ts.ToSortedCidSet())
+	if err != nil {
+		return errors.Wrapf(ErrUnexpectedStoreState, "new head %s has no stored state root: %s", ts.String(), err)
+	}
+	if _, err := store.headStateStore.LoadStateTree(ctx, root); err != nil {
+		return errors.Wrapf(ErrUnexpectedStoreState, "state %s of new head %s does not load: %s", root.String(), ts.String(), err)
+	}
+	return nil
+}
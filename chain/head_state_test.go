@@ -0,0 +1,63 @@
+package chain_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipfs/go-hamt-ipld"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/repo"
+	"github.com/filecoin-project/go-filecoin/state"
+	th "github.com/filecoin-project/go-filecoin/testhelpers"
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestVerifyHeadState(t *testing.T) {
+	tf.UnitTest(t)
+	ctx := context.Background()
+
+	cst := hamt.NewCborStore()
+	root, err := state.NewEmptyStateTree(cst).Flush(ctx)
+	require.NoError(t, err)
+
+	genesis := &types.Block{StateRoot: root}
+	genTS := th.RequireNewTipSet(t, genesis)
+	store := chain.NewDefaultStore(repo.NewInMemoryRepo().ChainDatastore(), genesis.Cid(), chain.VerifyHeadState(chain.NewCborStateStore(cst)))
+	th.RequirePutTsas(ctx, t, store, &chain.TipSetAndState{TipSet: genTS, TipSetStateRoot: root})
+	require.NoError(t, store.SetHead(ctx, genTS))
+
+	mkChild := func(height uint64) types.TipSet {
+		return th.RequireNewTipSet(t, &types.Block{
+			Parents:   genTS.ToSortedCidSet(),
+			Height:    types.Uint64(height),
+			StateRoot: root,
+		})
+	}
+
+	t.Run("rejects a head with no stored state root", func(t *testing.T) {
+		ts := mkChild(1)
+		err := store.SetHead(ctx, ts)
+		assert.Equal(t, chain.ErrUnexpectedStoreState, errors.Cause(err))
+		assert.Equal(t, genTS.ToSortedCidSet(), store.GetHead())
+	})
+
+	t.Run("rejects a head whose state does not load", func(t *testing.T) {
+		ts := mkChild(2)
+		th.RequirePutTsas(ctx, t, store, &chain.TipSetAndState{TipSet: ts, TipSetStateRoot: types.SomeCid()})
+		err := store.SetHead(ctx, ts)
+		assert.Equal(t, chain.ErrUnexpectedStoreState, errors.Cause(err))
+		assert.Equal(t, genTS.ToSortedCidSet(), store.GetHead())
+	})
+
+	t.Run("sets a head with loadable state", func(t *testing.T) {
+		ts := mkChild(3)
+		th.RequirePutTsas(ctx, t, store, &chain.TipSetAndState{TipSet: ts, TipSetStateRoot: root})
+		require.NoError(t, store.SetHead(ctx, ts))
+		assert.Equal(t, ts.ToSortedCidSet(), store.GetHead())
+	})
+}
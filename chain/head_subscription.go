@@ -0,0 +1,111 @@
+package chain
+
+import (
+	"sync/atomic"
+
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// HeadDropPolicy chooses which head a full subscription drops.
+type HeadDropPolicy int
+
+const (
+	// DropOldestHead drops the oldest buffered head to make room for the
+	// new one, so the subscriber always sees the latest head.
+	DropOldestHead HeadDropPolicy = iota
+	// DropNewestHead drops the new head, so the subscriber sees the heads
+	// buffered before it fell behind.
+	DropNewestHead
+)
+
+// HeadSubscription delivers head changes of a DefaultStore through a bounded
+// buffer.  A subscriber that falls behind never blocks SetHead: once its
+// buffer is full heads are dropped according to the subscription's policy,
+// and Missed signals the subscriber so that it can resync its view from the
+// store.
+type HeadSubscription struct {
+	heads   chan types.TipSet
+	missed  chan struct{}
+	policy  HeadDropPolicy
+	dropped uint64
+}
+
+// Heads returns the channel on which the subscription delivers new heads.
+// It is closed when the subscription is cancelled.
+func (sub *HeadSubscription) Heads() <-chan types.TipSet {
+	return sub.heads
+}
+
+// Missed returns a channel that receives once heads have been dropped since
+// the subscriber last received from it.
+func (sub *HeadSubscription) Missed() <-chan struct{} {
+	return sub.missed
+}
+
+// Dropped returns the number of heads the subscription has dropped.
+func (sub *HeadSubscription) Dropped() uint64 {
+	return atomic.LoadUint64(&sub.dropped)
+}
+
+// deliver queues ts without blocking.
+func (sub *HeadSubscription) deliver(ts types.TipSet) {
+	select {
+	case sub.heads <- ts:
+		return
+	default:
+	}
+
+	if sub.policy == DropOldestHead {
+		// Make room by dropping the oldest head.  The subscriber may have
+		// received it meanwhile, which makes room all the same.  Only
+		// deliver sends, so the send below cannot block.
+		select {
+		case <-sub.heads:
+		default:
+		}
+		sub.heads <- ts
+	}
+	atomic.AddUint64(&sub.dropped, 1)
+	select {
+	case sub.missed <- struct{}{}:
+	default:
+	}
+}
+
+// SubscribeHeads returns a subscription to the store's head changes that
+// buffers up to buffer heads, at least one, and drops heads according to
+// policy when full.  Cancel it with UnsubscribeHeads.
+func (store *DefaultStore) SubscribeHeads(buffer int, policy HeadDropPolicy) *HeadSubscription {
+	if buffer < 1 {
+		buffer = 1
+	}
+	sub := &HeadSubscription{
+		heads:  make(chan types.TipSet, buffer),
+		missed: make(chan struct{}, 1),
+		policy: policy,
+	}
+	store.subsMu.Lock()
+	defer store.subsMu.Unlock()
+	store.headSubs[sub] = struct{}{}
+	return sub
+}
+
+// UnsubscribeHeads cancels sub and closes its Heads channel.
+func (store *DefaultStore) UnsubscribeHeads(sub *HeadSubscription) {
+	store.subsMu.Lock()
+	defer store.subsMu.Unlock()
+	if _, ok := store.headSubs[sub]; !ok {
+		return
+	}
+	delete(store.headSubs, sub)
+	close(sub.heads)
+}
+
+// publishHead delivers ts to every head subscription without blocking.
+func (store *DefaultStore) publishHead(ts types.TipSet) {
+	store.subsMu.Lock()
+	defer store.subsMu.Unlock()
+	for sub := range store.headSubs {
+		sub.deliver(ts)
+	}
+}
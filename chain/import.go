@@ -0,0 +1,282 @@
+package chain
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/ipfs/go-car"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// ErrImportStateAmbiguous is returned when the blocks of an imported tipset
+// disagree on the tipset's state root.
+var ErrImportStateAmbiguous = errors.New("blocks of imported tipset disagree on state root")
+
+// ErrImportStateMismatch is returned by a verified import when the state root
+// computed for an imported tipset differs from the imported state root.
+var ErrImportStateMismatch = errors.New("computed state root does not match imported state root")
+
+// ErrImportNotContiguous is returned by ImportMulti when the chain in a CAR
+// does not descend directly from the head of the CAR before it.
+var ErrImportNotContiguous = errors.New("imported chain does not continue the previous car")
+
+// ImportOpt configures optional behavior of Import.
+type ImportOpt func(*importConfig)
+
+type importConfig struct {
+	// verifier validates imported tipsets.  It is nil for a trusted
+	// import.
+	verifier *DefaultSyncer
+}
+
+// VerifyState configures Import to re-run the state transition of every
+// imported tipset with syncer, oldest first, rather than trusting the
+// imported state roots.  Import aborts on the first tipset that fails
+// validation or whose computed state root differs from the imported root.
+// This is much slower than a trusted import.  The syncer must read state from
+// the blockstore the CAR is imported into and sync to the same store.
+func VerifyState(syncer *DefaultSyncer) ImportOpt {
+	return func(cfg *importConfig) {
+		cfg.verifier = syncer
+	}
+}
+
+// Import loads a CAR file whose roots are the blocks of a head tipset into bs
+// and registers the chain it holds with the store, so that the store reports
+// every imported tipset as held and later syncs terminate at the imported
+// head.  The CAR must contain the chain back to a tipset already in the store
+// and the state the chain's state roots reference.  bs must be the
+// blockstore backing the syncer's state store.
+//
+// By default Import trusts its input: imported tipsets are not validated.  The
+// state root of each tipset is read from its blocks.  See VerifyState.  The
+// store's head is moved to the imported head if it is higher.  Import returns
+// the imported head.
+func Import(ctx context.Context, store *DefaultStore, bs bstore.Blockstore, in io.Reader, opts ...ImportOpt) (types.TipSet, error) {
+	var cfg importConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return importCar(ctx, store, bs, in, cfg, nil)
+}
+
+// ImportMulti imports the CARs read from ins, in order, as one chain split
+// across files.  The first CAR is imported as by Import.  The chain in each
+// later CAR must descend directly from the head of the CAR before it: walking
+// back from its head must reach that head before any other stored tipset.
+// A CAR that does not is rejected with ErrImportNotContiguous, wrapped with
+// its index, before any of its tipsets are registered; tipsets imported from
+// earlier CARs remain imported.  opts apply to every CAR.  ImportMulti returns
+// the head of the last CAR.
+func ImportMulti(ctx context.Context, store *DefaultStore, bs bstore.Blockstore, ins []io.Reader, opts ...ImportOpt) (types.TipSet, error) {
+	if len(ins) == 0 {
+		return nil, errors.New("no cars to import")
+	}
+	var cfg importConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	var head types.TipSet
+	for i, in := range ins {
+		imported, err := importCar(ctx, store, bs, in, cfg, head)
+		if err != nil {
+			return nil, errors.Wrapf(err, "car %d", i)
+		}
+		head = imported
+	}
+	return head, nil
+}
+
+// importCar imports the CAR read from in.  If prev is not nil the imported
+// chain must descend directly from prev, otherwise it must descend from any
+// stored tipset.
+func importCar(ctx context.Context, store *DefaultStore, bs bstore.Blockstore, in io.Reader, cfg importConfig, prev types.TipSet) (types.TipSet, error) {
+	ch, err := car.LoadCar(bs, in)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load car")
+	}
+	if len(ch.Roots) == 0 {
+		return nil, errors.New("car has no roots")
+	}
+
+	head, err := loadImportedTipSet(bs, store.codec, types.NewSortedCidSet(ch.Roots...))
+	if err != nil {
+		return nil, err
+	}
+
+	var tsass []*TipSetAndState
+	ts := head
+	for !store.HasTipSetAndState(ctx, ts.String()) {
+		stateRoot := ts.ToSlice()[0].StateRoot
+		for _, blk := range ts {
+			if !blk.StateRoot.Equals(stateRoot) {
+				return nil, errors.Wrapf(ErrImportStateAmbiguous, "tipset %s", ts.String())
+			}
+		}
+		tsass = append(tsass, &TipSetAndState{
+			TipSet:          ts,
+			TipSetStateRoot: stateRoot,
+		})
+
+		parents, err := ts.Parents()
+		if err != nil {
+			return nil, err
+		}
+		if parents.Len() == 0 {
+			if prev != nil {
+				return nil, errors.Wrapf(ErrImportNotContiguous, "chain ends at genesis %s", ts.String())
+			}
+			return nil, errors.New("imported chain does not link to the store")
+		}
+		if ts, err = loadImportedTipSet(bs, store.codec, parents); err != nil {
+			if prev != nil {
+				return nil, errors.Wrapf(ErrImportNotContiguous, "parents %s of tipset %s: %s", parents.String(), tsass[len(tsass)-1].TipSet.String(), err)
+			}
+			return nil, err
+		}
+	}
+	if prev != nil && !ts.Equals(prev) {
+		return nil, errors.Wrapf(ErrImportNotContiguous, "chain links to %s, not previous head %s", ts.String(), prev.String())
+	}
+
+	if cfg.verifier != nil {
+		if err := verifyImport(ctx, cfg.verifier, store, ts, tsass); err != nil {
+			return nil, err
+		}
+	} else if err := store.PutTipSetAndStates(ctx, tsass); err != nil {
+		return nil, errors.Wrap(err, "failed to register imported tipsets")
+	}
+
+	headTs, err := store.GetTipSet(store.GetHead())
+	if err != nil {
+		return nil, err
+	}
+	importedHeight, err := head.Height()
+	if err != nil {
+		return nil, err
+	}
+	headHeight, err := headTs.Height()
+	if err != nil {
+		return nil, err
+	}
+	if importedHeight > headHeight {
+		if err := store.SetHead(ctx, head); err != nil {
+			return nil, err
+		}
+	}
+	logStore.Infof("imported %d tipsets with head %s", len(tsass), head.Describe())
+	return head, nil
+}
+
+// SyncImportGap syncs the chain from networkHead, the head of the network,
+// back to the imported tipset.  Because Import registers the imported chain
+// with the store, chain collection stops at the imported head and only the
+// gap is fetched.  It does nothing if networkHead is empty or is the imported
+// head.
+func SyncImportGap(ctx context.Context, syncer Syncer, imported types.TipSet, networkHead types.SortedCidSet) error {
+	if networkHead.Len() == 0 || networkHead.Equals(imported.ToSortedCidSet()) {
+		return nil
+	}
+	logStore.Infof("syncing from imported head %s to network head %s", imported.Describe(), networkHead.String())
+	return syncer.HandleNewTipset(ctx, networkHead)
+}
+
+// CarImporter imports CARs into a store and syncs the gap from each imported
+// head to the highest head the network announced.
+type CarImporter struct {
+	store  *DefaultStore
+	bs     bstore.Blockstore
+	syncer Syncer
+
+	// mu protects announced and announcedHeight.
+	mu sync.Mutex
+	// announced is the key of the highest head announced by the network.
+	announced       types.SortedCidSet
+	announcedHeight uint64
+}
+
+// NewCarImporter returns a CarImporter importing into store and bs, see
+// Import, and syncing the gap with syncer.
+func NewCarImporter(store *DefaultStore, bs bstore.Blockstore, syncer Syncer) *CarImporter {
+	return &CarImporter{store: store, bs: bs, syncer: syncer}
+}
+
+// ObserveHead records head, announced by the network at height h, as the
+// head to sync to after an import if it is the highest announced so far.
+func (im *CarImporter) ObserveHead(head types.SortedCidSet, h uint64) {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	if im.announced.Len() == 0 || h > im.announcedHeight {
+		im.announced = head
+		im.announcedHeight = h
+	}
+}
+
+// Import imports the CAR read from in with Import and then syncs the gap to
+// the highest head announced, see SyncImportGap.  The imported chain is kept
+// if the gap fails to sync.  It returns the imported head.
+func (im *CarImporter) Import(ctx context.Context, in io.Reader) (types.TipSet, error) {
+	imported, err := Import(ctx, im.store, im.bs, in)
+	if err != nil {
+		return nil, err
+	}
+	im.mu.Lock()
+	networkHead := im.announced
+	im.mu.Unlock()
+	if err := SyncImportGap(ctx, im.syncer, imported, networkHead); err != nil {
+		return imported, errors.Wrapf(err, "imported %s but failed to sync to network head", imported.String())
+	}
+	return imported, nil
+}
+
+// verifyImport validates the imported tipsets tsass, ordered newest first,
+// on top of base, the stored tipset they descend from.  Each tipset is put in
+// the store once validated so that its state is available to its child.
+func verifyImport(ctx context.Context, syncer *DefaultSyncer, store *DefaultStore, base types.TipSet, tsass []*TipSetAndState) error {
+	syncer.mu.Lock()
+	defer syncer.mu.Unlock()
+
+	parent := base
+	for i := len(tsass) - 1; i >= 0; i-- {
+		tsas := tsass[i]
+		h, err := tsas.TipSet.Height()
+		if err != nil {
+			return err
+		}
+		root, gasUsed, err := syncer.validateTipSet(ctx, parent, tsas.TipSet)
+		if err != nil {
+			return errors.Wrapf(err, "failed to verify imported tipset at height %d", h)
+		}
+		if !root.Equals(tsas.TipSetStateRoot) {
+			return errors.Wrapf(ErrImportStateMismatch, "height %d: computed %s, imported %s", h, root.String(), tsas.TipSetStateRoot.String())
+		}
+		tsas.GasUsed = gasUsed
+		if err := store.PutTipSetAndState(ctx, tsas); err != nil {
+			return errors.Wrap(err, "failed to register imported tipset")
+		}
+		parent = tsas.TipSet
+	}
+	return nil
+}
+
+// loadImportedTipSet decodes the tipset with key tsKey from bs with codec.
+func loadImportedTipSet(bs bstore.Blockstore, codec types.Codec, tsKey types.SortedCidSet) (types.TipSet, error) {
+	var blks []*types.Block
+	for it := tsKey.Iter(); !it.Complete(); it.Next() {
+		raw, err := bs.Get(it.Value())
+		if err != nil {
+			return nil, errors.Wrapf(err, "imported chain missing block %s", it.Value().String())
+		}
+		blk, err := codec.DecodeBlock(raw.RawData())
+		if err != nil {
+			return nil, err
+		}
+		blks = append(blks, blk)
+	}
+	return types.NewTipSet(blks...)
+}
@@ -0,0 +1,186 @@
+package chain_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/ipfs/go-car"
+	carutil "github.com/ipfs/go-car/util"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/chain"
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// requireChainCar writes a car with the blocks of head as roots holding the
+// blocks of the given tipsets.
+func requireChainCar(t *testing.T, head types.TipSet, tipsets ...types.TipSet) *bytes.Buffer {
+	var buf bytes.Buffer
+	require.NoError(t, car.WriteHeader(&car.CarHeader{Roots: head.ToSortedCidSet().ToSlice(), Version: 1}, &buf))
+	for _, ts := range tipsets {
+		for _, blk := range ts.ToSlice() {
+			require.NoError(t, carutil.LdWrite(&buf, blk.Cid().Bytes(), blk.ToNode().RawData()))
+		}
+	}
+	return &buf
+}
+
+func TestImportAndSyncGap(t *testing.T) {
+	tf.UnitTest(t)
+	ctx := context.Background()
+
+	t.Run("syncs the remainder of an imported prefix", func(t *testing.T) {
+		dstP := initDSTParams()
+		syncer, chainStore, r, blockSource := initSyncTestDefault(t, dstP)
+		store := chainStore.(*chain.DefaultStore)
+
+		in := requireChainCar(t, dstP.link2, dstP.link1, dstP.link2)
+		imported, err := chain.Import(ctx, store, bstore.NewBlockstore(r.Datastore()), in)
+		require.NoError(t, err)
+		assert.Equal(t, dstP.link2, imported)
+		assertHead(t, chainStore, dstP.link2)
+		assert.True(t, chainStore.HasTipSetAndState(ctx, dstP.link1.String()))
+		assert.True(t, chainStore.HasTipSetAndState(ctx, dstP.link2.String()))
+
+		// The network only serves the gap above the imported head.
+		_ = requirePutBlocks(t, blockSource, dstP.link3.ToSlice()...)
+		networkHead := requirePutBlocks(t, blockSource, dstP.link4.ToSlice()...)
+
+		require.NoError(t, chain.SyncImportGap(ctx, syncer, imported, networkHead))
+		assertHead(t, chainStore, dstP.link4)
+	})
+
+	t.Run("an importer syncs to the highest announced head", func(t *testing.T) {
+		dstP := initDSTParams()
+		syncer, chainStore, r, blockSource := initSyncTestDefault(t, dstP)
+		importer := chain.NewCarImporter(chainStore.(*chain.DefaultStore), bstore.NewBlockstore(r.Datastore()), syncer)
+
+		_ = requirePutBlocks(t, blockSource, dstP.link3.ToSlice()...)
+		networkHead := requirePutBlocks(t, blockSource, dstP.link4.ToSlice()...)
+		importer.ObserveHead(networkHead, 4)
+		importer.ObserveHead(dstP.link3.ToSortedCidSet(), 3)
+
+		imported, err := importer.Import(ctx, requireChainCar(t, dstP.link2, dstP.link1, dstP.link2))
+		require.NoError(t, err)
+		assert.Equal(t, dstP.link2, imported)
+		assertHead(t, chainStore, dstP.link4)
+	})
+
+	t.Run("import without a link to the store fails", func(t *testing.T) {
+		dstP := initDSTParams()
+		_, chainStore, r, _ := initSyncTestDefault(t, dstP)
+		store := chainStore.(*chain.DefaultStore)
+
+		in := requireChainCar(t, dstP.link2, dstP.link2)
+		_, err := chain.Import(ctx, store, bstore.NewBlockstore(r.Datastore()), in)
+		assert.Error(t, err)
+		assert.False(t, chainStore.HasTipSetAndState(ctx, dstP.link2.String()))
+	})
+}
+
+func TestImportMulti(t *testing.T) {
+	tf.UnitTest(t)
+	ctx := context.Background()
+
+	t.Run("stitches a chain split across cars", func(t *testing.T) {
+		dstP := initDSTParams()
+		_, chainStore, r, _ := initSyncTestDefault(t, dstP)
+		store := chainStore.(*chain.DefaultStore)
+
+		ins := []io.Reader{
+			requireChainCar(t, dstP.link2, dstP.link1, dstP.link2),
+			requireChainCar(t, dstP.link4, dstP.link3, dstP.link4),
+		}
+		imported, err := chain.ImportMulti(ctx, store, bstore.NewBlockstore(r.Datastore()), ins)
+		require.NoError(t, err)
+		assert.Equal(t, dstP.link4, imported)
+		assertHead(t, chainStore, dstP.link4)
+		for _, ts := range []types.TipSet{dstP.link1, dstP.link2, dstP.link3, dstP.link4} {
+			assert.True(t, chainStore.HasTipSetAndState(ctx, ts.String()))
+		}
+	})
+
+	t.Run("a gap between cars fails", func(t *testing.T) {
+		dstP := initDSTParams()
+		_, chainStore, r, _ := initSyncTestDefault(t, dstP)
+		store := chainStore.(*chain.DefaultStore)
+
+		// link3 is in neither car.
+		ins := []io.Reader{
+			requireChainCar(t, dstP.link2, dstP.link1, dstP.link2),
+			requireChainCar(t, dstP.link4, dstP.link4),
+		}
+		_, err := chain.ImportMulti(ctx, store, bstore.NewBlockstore(r.Datastore()), ins)
+		require.Error(t, err)
+		assert.Equal(t, chain.ErrImportNotContiguous, errors.Cause(err))
+		assert.Contains(t, err.Error(), "car 1")
+		assert.True(t, chainStore.HasTipSetAndState(ctx, dstP.link2.String()))
+		assert.False(t, chainStore.HasTipSetAndState(ctx, dstP.link4.String()))
+	})
+}
+
+func TestImportVerifyState(t *testing.T) {
+	tf.UnitTest(t)
+	ctx := context.Background()
+
+	// tamperedLink2 returns link2 with every block claiming a wrong state
+	// root.
+	tamperedLink2 := func(t *testing.T, dstP *DefaultSyncerTestParams) types.TipSet {
+		var blks []*types.Block
+		for _, blk := range dstP.link2.ToSlice() {
+			cpy := *blk
+			cpy.StateRoot = dstP.genStateRoot
+			tampered, err := types.DecodeBlock(cpy.ToNode().RawData())
+			require.NoError(t, err)
+			blks = append(blks, tampered)
+		}
+		ts, err := types.NewTipSet(blks...)
+		require.NoError(t, err)
+		return ts
+	}
+
+	t.Run("verified import accepts a valid chain", func(t *testing.T) {
+		dstP := initDSTParams()
+		syncer, chainStore, r, _ := initSyncTestDefault(t, dstP)
+		store := chainStore.(*chain.DefaultStore)
+
+		in := requireChainCar(t, dstP.link2, dstP.link1, dstP.link2)
+		imported, err := chain.Import(ctx, store, bstore.NewBlockstore(r.Datastore()), in, chain.VerifyState(syncer))
+		require.NoError(t, err)
+		assert.Equal(t, dstP.link2, imported)
+		assertHead(t, chainStore, dstP.link2)
+	})
+
+	t.Run("trusted import accepts a tampered state root", func(t *testing.T) {
+		dstP := initDSTParams()
+		_, chainStore, r, _ := initSyncTestDefault(t, dstP)
+		store := chainStore.(*chain.DefaultStore)
+		tampered := tamperedLink2(t, dstP)
+
+		in := requireChainCar(t, tampered, dstP.link1, tampered)
+		imported, err := chain.Import(ctx, store, bstore.NewBlockstore(r.Datastore()), in)
+		require.NoError(t, err)
+		assert.Equal(t, tampered, imported)
+		assertHead(t, chainStore, tampered)
+	})
+
+	t.Run("verified import rejects a tampered state root", func(t *testing.T) {
+		dstP := initDSTParams()
+		syncer, chainStore, r, _ := initSyncTestDefault(t, dstP)
+		store := chainStore.(*chain.DefaultStore)
+		tampered := tamperedLink2(t, dstP)
+
+		in := requireChainCar(t, tampered, dstP.link1, tampered)
+		_, err := chain.Import(ctx, store, bstore.NewBlockstore(r.Datastore()), in, chain.VerifyState(syncer))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "height 2")
+		assert.False(t, chainStore.HasTipSetAndState(ctx, tampered.String()))
+		assertHead(t, chainStore, dstP.genTS)
+	})
+}
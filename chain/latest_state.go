@@ -2,15 +2,39 @@ package chain
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-hamt-ipld"
+	"github.com/pkg/errors"
 
+	"github.com/filecoin-project/go-filecoin/actor"
 	"github.com/filecoin-project/go-filecoin/actor/builtin"
+	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/state"
 	"github.com/filecoin-project/go-filecoin/types"
 )
 
+// ErrActorNotFound is returned by GetActor when no actor exists at the
+// requested address in the requested state.  It satisfies
+// state.IsActorNotFoundError so callers may test for either.
+type ErrActorNotFound struct {
+	Addr address.Address
+}
+
+func (e *ErrActorNotFound) Error() string {
+	return fmt.Sprintf("no actor at address %s", e.Addr)
+}
+
+// ActorNotFound marks ErrActorNotFound as an actor-not-found error.
+func (e *ErrActorNotFound) ActorNotFound() bool {
+	return true
+}
+
+// ErrStopActorWalk may be returned by the callback passed to ForEachActor to
+// end the walk early without error.
+var ErrStopActorWalk = errors.New("stop actor walk")
+
 type latestStateChainReader interface {
 	GetHead() types.SortedCidSet
 	GetTipSetStateRoot(tsKey types.SortedCidSet) (cid.Cid, error)
@@ -18,9 +42,62 @@ type latestStateChainReader interface {
 
 // LatestState gets the latest state from the state Store.
 func LatestState(ctx context.Context, store latestStateChainReader, stateStore *hamt.CborIpldStore) (state.Tree, error) {
-	stateCid, err := store.GetTipSetStateRoot(store.GetHead())
+	return TipSetState(ctx, store, stateStore, store.GetHead())
+}
+
+// TipSetState loads the state tree resulting from applying the tipset with the
+// input key.
+func TipSetState(ctx context.Context, store latestStateChainReader, stateStore *hamt.CborIpldStore, tsKey types.SortedCidSet) (state.Tree, error) {
+	if tsKey.Len() == 0 {
+		return nil, errors.New("empty tipset key")
+	}
+	stateCid, err := store.GetTipSetStateRoot(tsKey)
 	if err != nil {
 		return nil, err
 	}
 	return state.LoadStateTree(ctx, stateStore, stateCid, builtin.Actors)
 }
+
+// GetActor returns the actor at addr in the head state.  It returns
+// ErrActorNotFound if there is no actor at addr.
+func GetActor(ctx context.Context, store latestStateChainReader, stateStore *hamt.CborIpldStore, addr address.Address) (*actor.Actor, error) {
+	return GetActorAt(ctx, store, stateStore, addr, store.GetHead())
+}
+
+// GetActorAt returns the actor at addr in the state of the tipset with the
+// input key, which must not be empty.  It returns ErrActorNotFound if there is
+// no actor at addr.
+func GetActorAt(ctx context.Context, store latestStateChainReader, stateStore *hamt.CborIpldStore, addr address.Address, tsKey types.SortedCidSet) (*actor.Actor, error) {
+	st, err := TipSetState(ctx, store, stateStore, tsKey)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load state of tipset %s", tsKey.String())
+	}
+	act, err := st.GetActor(ctx, addr)
+	if state.IsActorNotFoundError(err) {
+		return nil, &ErrActorNotFound{Addr: addr}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return act, nil
+}
+
+// ForEachActor calls fn with each actor in the state of the tipset with the
+// input key, or in the head state if the key is empty.  Actors are visited in
+// state tree order.  If fn returns ErrStopActorWalk the walk ends and
+// ForEachActor returns nil; any other error from fn ends the walk and is
+// returned.
+func ForEachActor(ctx context.Context, store latestStateChainReader, stateStore *hamt.CborIpldStore, tsKey types.SortedCidSet, fn state.ActorWalkFn) error {
+	if tsKey.Len() == 0 {
+		tsKey = store.GetHead()
+	}
+	st, err := TipSetState(ctx, store, stateStore, tsKey)
+	if err != nil {
+		return errors.Wrapf(err, "failed to load state of tipset %s", tsKey.String())
+	}
+	err = st.ForEachActor(ctx, fn)
+	if err == ErrStopActorWalk {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,146 @@
+package chain_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipfs/go-hamt-ipld"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/actor"
+	"github.com/filecoin-project/go-filecoin/actor/builtin"
+	"github.com/filecoin-project/go-filecoin/actor/builtin/account"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/repo"
+	"github.com/filecoin-project/go-filecoin/state"
+	th "github.com/filecoin-project/go-filecoin/testhelpers"
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// requireStoreWithActor returns a chain store whose genesis state holds an
+// account actor with the given balance at addr.
+func requireStoreWithActor(ctx context.Context, t *testing.T, cst *hamt.CborIpldStore, addr address.Address, balance *types.AttoFIL) *chain.DefaultStore {
+	st := state.NewEmptyStateTreeWithActors(cst, builtin.Actors)
+	act, err := account.NewActor(balance)
+	require.NoError(t, err)
+	require.NoError(t, st.SetActor(ctx, addr, act))
+	root, err := st.Flush(ctx)
+	require.NoError(t, err)
+
+	genesis := types.NewBlockForTest(nil, 0)
+	genesis.StateRoot = root
+	genTS := th.MustNewTipSet(genesis)
+
+	store := chain.NewDefaultStore(repo.NewInMemoryRepo().ChainDatastore(), genesis.Cid())
+	th.RequirePutTsas(ctx, t, store, &chain.TipSetAndState{TipSet: genTS, TipSetStateRoot: root})
+	require.NoError(t, store.SetHead(ctx, genTS))
+	return store
+}
+
+func TestGetActor(t *testing.T) {
+	tf.UnitTest(t)
+
+	ctx := context.Background()
+	cst := hamt.NewCborStore()
+	addrGetter := address.NewForTestGetter()
+	addr := addrGetter()
+	store := requireStoreWithActor(ctx, t, cst, addr, types.NewAttoFILFromFIL(42))
+
+	t.Run("account actor at head", func(t *testing.T) {
+		act, err := chain.GetActor(ctx, store, cst, addr)
+		require.NoError(t, err)
+		assert.True(t, account.IsAccount(act))
+		assert.Equal(t, types.NewAttoFILFromFIL(42), act.Balance)
+	})
+
+	t.Run("account actor at explicit tipset", func(t *testing.T) {
+		act, err := chain.GetActorAt(ctx, store, cst, addr, store.GetHead())
+		require.NoError(t, err)
+		assert.Equal(t, types.NewAttoFILFromFIL(42), act.Balance)
+	})
+
+	t.Run("nonexistent address", func(t *testing.T) {
+		missing := addrGetter()
+		_, err := chain.GetActor(ctx, store, cst, missing)
+		require.Error(t, err)
+		notFound, ok := errors.Cause(err).(*chain.ErrActorNotFound)
+		require.True(t, ok)
+		assert.Equal(t, missing, notFound.Addr)
+		assert.True(t, state.IsActorNotFoundError(err))
+	})
+
+	t.Run("unknown tipset", func(t *testing.T) {
+		unknown := types.NewSortedCidSet(types.SomeCid())
+		_, err := chain.GetActorAt(ctx, store, cst, addr, unknown)
+		assert.Error(t, err)
+	})
+
+	t.Run("empty tipset key", func(t *testing.T) {
+		_, err := chain.GetActorAt(ctx, store, cst, addr, types.SortedCidSet{})
+		assert.Error(t, err)
+	})
+}
+
+func TestForEachActor(t *testing.T) {
+	tf.UnitTest(t)
+
+	ctx := context.Background()
+	cst := hamt.NewCborStore()
+	addrGetter := address.NewForTestGetter()
+	balances := map[address.Address]*types.AttoFIL{
+		addrGetter(): types.NewAttoFILFromFIL(1),
+		addrGetter(): types.NewAttoFILFromFIL(2),
+		addrGetter(): types.NewAttoFILFromFIL(3),
+	}
+
+	st := state.NewEmptyStateTreeWithActors(cst, builtin.Actors)
+	for addr, balance := range balances {
+		act, err := account.NewActor(balance)
+		require.NoError(t, err)
+		require.NoError(t, st.SetActor(ctx, addr, act))
+	}
+	root, err := st.Flush(ctx)
+	require.NoError(t, err)
+	genesis := types.NewBlockForTest(nil, 0)
+	genesis.StateRoot = root
+	genTS := th.MustNewTipSet(genesis)
+	store := chain.NewDefaultStore(repo.NewInMemoryRepo().ChainDatastore(), genesis.Cid())
+	th.RequirePutTsas(ctx, t, store, &chain.TipSetAndState{TipSet: genTS, TipSetStateRoot: root})
+	require.NoError(t, store.SetHead(ctx, genTS))
+
+	t.Run("visits each actor once", func(t *testing.T) {
+		visits := make(map[address.Address]int)
+		err := chain.ForEachActor(ctx, store, cst, types.SortedCidSet{}, func(addr address.Address, act *actor.Actor) error {
+			visits[addr]++
+			assert.Equal(t, balances[addr], act.Balance)
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, len(balances), len(visits))
+		for addr := range balances {
+			assert.Equal(t, 1, visits[addr])
+		}
+	})
+
+	t.Run("stops early", func(t *testing.T) {
+		visits := 0
+		err := chain.ForEachActor(ctx, store, cst, store.GetHead(), func(addr address.Address, act *actor.Actor) error {
+			visits++
+			return chain.ErrStopActorWalk
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 1, visits)
+	})
+
+	t.Run("callback error is returned", func(t *testing.T) {
+		walkErr := errors.New("audit failed")
+		err := chain.ForEachActor(ctx, store, cst, types.SortedCidSet{}, func(addr address.Address, act *actor.Actor) error {
+			return walkErr
+		})
+		assert.Equal(t, walkErr, err)
+	})
+}
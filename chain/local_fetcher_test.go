@@ -0,0 +1,47 @@
+package chain_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	dss "github.com/ipfs/go-datastore/sync"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/chain/synctest"
+	"github.com/filecoin-project/go-filecoin/net"
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+)
+
+func TestSyncLocalOnly(t *testing.T) {
+	tf.UnitTest(t)
+	ctx := context.Background()
+
+	h := synctest.NewHarness(t)
+	h.Build(synctest.Linear("local", "", 5)...)
+	h.Build(synctest.Spec{Name: "remote", Parent: "local5"})
+
+	// Only the blocks of the local chain are in the blockstore.
+	bs := bstore.NewBlockstore(dss.MutexWrap(datastore.NewMapDatastore()))
+	for _, spec := range synctest.Linear("local", "", 5) {
+		for _, blk := range h.TipSet(spec.Name).ToSlice() {
+			require.NoError(t, bs.Put(blk.ToNode()))
+		}
+	}
+	// A wait time this long would fail the test if the syncer waited on it.
+	syncer := chain.NewDefaultSyncer(h.StateStore, h.Consensus, h.Store, net.NewLocalFetcher(bs), chain.BlockWaitTime(time.Minute))
+
+	start := time.Now()
+	require.NoError(t, syncer.HandleNewTipset(ctx, h.TipSet("local5").ToSortedCidSet()))
+	h.RequireHead("local5")
+
+	err := syncer.HandleNewTipset(ctx, h.TipSet("remote").ToSortedCidSet())
+	assert.Equal(t, net.ErrBlockNotLocal, errors.Cause(err))
+	h.RequireHead("local5")
+	assert.True(t, time.Since(start) < 10*time.Second, "local sync waited %s", time.Since(start))
+}
@@ -0,0 +1,33 @@
+package chain
+
+import (
+	"context"
+
+	"github.com/ipfs/go-cid"
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// MessageInclusion locates the message with cid msgCid in the tipset with key
+// tsKey.  It returns the cid of the first block, in key order, containing the
+// message and the message's index in that block's message list.  found is
+// false if no block of the tipset contains the message.
+func MessageInclusion(ctx context.Context, store BlockProvider, msgCid cid.Cid, tsKey types.SortedCidSet) (blockCid cid.Cid, index int, found bool, err error) {
+	for it := tsKey.Iter(); !it.Complete(); it.Next() {
+		blk, err := store.GetBlock(ctx, it.Value())
+		if err != nil {
+			return cid.Undef, 0, false, errors.Wrapf(err, "failed to load block %s", it.Value().String())
+		}
+		for i, msg := range blk.Messages {
+			c, err := msg.Cid()
+			if err != nil {
+				return cid.Undef, 0, false, err
+			}
+			if c.Equals(msgCid) {
+				return blk.Cid(), i, true, nil
+			}
+		}
+	}
+	return cid.Undef, 0, false, nil
+}
@@ -0,0 +1,73 @@
+package chain_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/chain"
+	th "github.com/filecoin-project/go-filecoin/testhelpers"
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestMessageInclusion(t *testing.T) {
+	tf.UnitTest(t)
+
+	ctx := context.Background()
+	store := th.NewFakeBlockProvider()
+	signer, _ := types.NewMockSignersAndKeyInfo(1)
+	msgs := types.NewSignedMsgs(4, signer)
+	msgCid := func(i int) cid.Cid {
+		c, err := msgs[i].Cid()
+		require.NoError(t, err)
+		return c
+	}
+
+	root := store.NewBlock(0)
+	single := store.NewBlockWithMessages(1, []*types.SignedMessage{msgs[0], msgs[1]}, root)
+
+	t.Run("message present", func(t *testing.T) {
+		blkCid, index, found, err := chain.MessageInclusion(ctx, store, msgCid(1), types.NewSortedCidSet(single.Cid()))
+		require.NoError(t, err)
+		assert.True(t, found)
+		assert.True(t, single.Cid().Equals(blkCid))
+		assert.Equal(t, 1, index)
+	})
+
+	t.Run("message absent", func(t *testing.T) {
+		_, _, found, err := chain.MessageInclusion(ctx, store, msgCid(3), types.NewSortedCidSet(single.Cid()))
+		require.NoError(t, err)
+		assert.False(t, found)
+	})
+
+	t.Run("message in second block of tipset", func(t *testing.T) {
+		other := store.NewBlockWithMessages(2, []*types.SignedMessage{msgs[2]}, root)
+		// Find a block holding msgs[3] that sorts after other in the key.
+		var holder *types.Block
+		var tsKey types.SortedCidSet
+		for nonce := uint64(3); holder == nil; nonce++ {
+			b := store.NewBlockWithMessages(nonce, []*types.SignedMessage{msgs[2], msgs[3]}, root)
+			tsKey = types.NewSortedCidSet(other.Cid(), b.Cid())
+			if tsKey.ToSlice()[1].Equals(b.Cid()) {
+				holder = b
+			}
+		}
+
+		blkCid, index, found, err := chain.MessageInclusion(ctx, store, msgCid(3), tsKey)
+		require.NoError(t, err)
+		assert.True(t, found)
+		assert.True(t, holder.Cid().Equals(blkCid))
+		assert.Equal(t, 1, index)
+
+		// A message in both blocks is reported in the first.
+		blkCid, index, found, err = chain.MessageInclusion(ctx, store, msgCid(2), tsKey)
+		require.NoError(t, err)
+		assert.True(t, found)
+		assert.True(t, other.Cid().Equals(blkCid))
+		assert.Equal(t, 0, index)
+	})
+}
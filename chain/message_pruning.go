@@ -0,0 +1,167 @@
+package chain
+
+import (
+	"context"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// DefaultMessagePruningInterval is how often a store keeping messages only
+// within finality prunes message bodies.
+const DefaultMessagePruningInterval = 10 * time.Minute
+
+// ErrMessagesPruned is returned when reading the messages of a block whose
+// message bodies were pruned.
+var ErrMessagesPruned = errors.New("block message bodies were pruned")
+
+// prunedMessagesPrefix prefixes the datastore keys flagging blocks stored
+// without their message bodies.
+var prunedMessagesPrefix = datastore.NewKey("/chain/prunedMessages")
+
+// KeepMessagesWithinFinality configures the store to keep the message bodies
+// of blocks only within depth rounds of the head.  PruneMessages rewrites
+// blocks below that height with their headers alone, keeping the tipset
+// index and state roots, and flags each block so that GetBlock fails for it
+// with ErrMessagesPruned rather than return it without messages.  Tipsets within depth of the head, which a
+// reorg may still remove from the chain, always keep their messages.  The
+// store's datastore must not be served to peers, as pruned blocks no longer
+// match their cids.  A depth of zero keeps all messages.
+func KeepMessagesWithinFinality(depth uint64) StoreOpt {
+	return func(store *DefaultStore) {
+		store.messageDepth = depth
+	}
+}
+
+// PruneMessages drops the message bodies of the blocks of tipsets more than
+// the configured depth below the head.  It returns the number of blocks
+// pruned.
+func (store *DefaultStore) PruneMessages(ctx context.Context) (int, error) {
+	if store.messageDepth == 0 {
+		return 0, nil
+	}
+	headHeight, err := store.BlockHeight()
+	if err != nil {
+		return 0, err
+	}
+	if headHeight <= store.messageDepth {
+		return 0, nil
+	}
+	finalized := headHeight - store.messageDepth
+
+	store.pruneMu.Lock()
+	defer store.pruneMu.Unlock()
+	pruned := 0
+	for h := store.messagesPrunedBelow; h < finalized; h++ {
+		tipsets, err := store.GetTipSetsByHeight(h)
+		if err == ErrNotFound {
+			// A null round.
+			continue
+		}
+		if err != nil {
+			return pruned, err
+		}
+		for _, ts := range tipsets {
+			for _, blk := range *ts {
+				if len(blk.Messages) == 0 {
+					continue
+				}
+				if err := store.pruneBlockMessages(blk); err != nil {
+					return pruned, err
+				}
+				pruned++
+			}
+		}
+	}
+	store.messagesPrunedBelow = finalized
+	if pruned > 0 {
+		logStore.Infof("pruned message bodies of %d blocks below height %d", pruned, finalized)
+	}
+	return pruned, nil
+}
+
+// RunMessagePruning calls PruneMessages every interval until ctx is done.  It
+// returns immediately if the store keeps all messages.
+func (store *DefaultStore) RunMessagePruning(ctx context.Context, interval time.Duration) {
+	if store.messageDepth == 0 || interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := store.PruneMessages(ctx); err != nil {
+				logStore.Warningf("failed to prune message bodies: %s", err)
+			}
+		}
+	}
+}
+
+// MessagesPruned returns true if the block with cid c is stored without its
+// message bodies.  Its messages must be fetched again to be read.
+func (store *DefaultStore) MessagesPruned(c cid.Cid) bool {
+	has, err := store.ds.Has(prunedMessagesKey(c))
+	return err == nil && has
+}
+
+// checkMessagesKept returns ErrMessagesPruned if the messages of any block
+// of ts were pruned.
+func (store *DefaultStore) checkMessagesKept(ts types.TipSet) error {
+	for _, blk := range ts.ToSlice() {
+		if store.MessagesPruned(blk.Cid()) {
+			return errors.Wrapf(ErrMessagesPruned, "block %s at height %d", blk.Cid().String(), blk.Height)
+		}
+	}
+	return nil
+}
+
+// headerProvider provides the blocks of a store, without their messages if
+// their bodies were pruned, to walk the chain below the pruning height.
+type headerProvider struct {
+	store *DefaultStore
+}
+
+// GetBlock returns the block with cid c, without its messages if they were
+// pruned.
+func (p headerProvider) GetBlock(ctx context.Context, c cid.Cid) (*types.Block, error) {
+	return p.store.GetBlockHeader(ctx, c)
+}
+
+// pruneBlockMessages rewrites blk without its messages and flags it as
+// pruned.  The flag is written first so that a block is never stored
+// without messages and unflagged.
+func (store *DefaultStore) pruneBlockMessages(blk *types.Block) error {
+	if err := store.ds.Put(prunedMessagesKey(blk.Cid()), []byte{}); err != nil {
+		return errors.Wrapf(err, "failed to flag block %s as pruned", blk.Cid().String())
+	}
+	return store.replaceBlk(blk.WithoutMessages(blk.Cid()))
+}
+
+// replaceBlk overwrites the stored block with blk's cid with blk.  The
+// blockstore ignores puts of blocks it holds, so the old block is deleted
+// first.
+func (store *DefaultStore) replaceBlk(blk *types.Block) error {
+	encoded, err := store.encodeBlk(blk)
+	if err != nil {
+		return err
+	}
+	if err := store.bsPriv.DeleteBlock(blk.Cid()); err != nil && err != bstore.ErrNotFound {
+		return errors.Wrapf(err, "failed to delete block %s", blk.Cid().String())
+	}
+	if err := store.bsPriv.Put(encoded); err != nil {
+		return errors.Wrapf(err, "failed to put block %s", blk.Cid().String())
+	}
+	return nil
+}
+
+func prunedMessagesKey(c cid.Cid) datastore.Key {
+	return prunedMessagesPrefix.ChildString(c.String())
+}
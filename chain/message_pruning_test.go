@@ -0,0 +1,112 @@
+package chain_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/repo"
+	th "github.com/filecoin-project/go-filecoin/testhelpers"
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestPruneMessages(t *testing.T) {
+	tf.UnitTest(t)
+	ctx := context.Background()
+	dstP := initDSTParams()
+
+	// Build a chain of five single block tipsets, each with a message,
+	// on top of genesis.
+	signer, _ := types.NewMockSignersAndKeyInfo(1)
+	newMsg := types.NewSignedMessageForTestGetter(signer)
+	chainTs := []types.TipSet{dstP.genTS}
+	for h := 1; h <= 5; h++ {
+		blk := &types.Block{
+			Parents:   chainTs[h-1].ToSortedCidSet(),
+			Height:    types.Uint64(h),
+			StateRoot: dstP.genStateRoot,
+			Messages:  []*types.SignedMessage{newMsg()},
+		}
+		chainTs = append(chainTs, th.RequireNewTipSet(t, blk))
+	}
+
+	ds := repo.NewInMemoryRepo().Datastore()
+	store := chain.NewDefaultStore(ds, dstP.genCid, chain.KeepMessagesWithinFinality(2))
+	for _, ts := range chainTs {
+		th.RequirePutTsas(ctx, t, store, &chain.TipSetAndState{
+			TipSet:          ts,
+			TipSetStateRoot: dstP.genStateRoot,
+		})
+	}
+	assertSetHead(t, store, chainTs[5])
+
+	// Heights 1 and 2 are more than two rounds below the head at 5.
+	pruned, err := store.PruneMessages(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, pruned)
+
+	for h, ts := range chainTs {
+		orig := ts.ToSlice()[0]
+		blk, err := store.GetBlockHeader(ctx, orig.Cid())
+		require.NoError(t, err)
+		assert.Equal(t, orig.Cid(), blk.Cid())
+		assert.Equal(t, orig.StateRoot, blk.StateRoot)
+		root, err := store.GetTipSetStateRoot(ts.ToSortedCidSet())
+		require.NoError(t, err)
+		assert.Equal(t, dstP.genStateRoot, root)
+
+		switch h {
+		case 0:
+			// Genesis holds no messages.
+		case 1, 2:
+			assert.Empty(t, blk.Messages, "height %d", h)
+			assert.True(t, store.MessagesPruned(orig.Cid()), "height %d", h)
+			_, err := store.GetBlock(ctx, orig.Cid())
+			assert.Equal(t, chain.ErrMessagesPruned, errors.Cause(err), "height %d", h)
+		default:
+			assert.Len(t, blk.Messages, 1, "height %d", h)
+			assert.False(t, store.MessagesPruned(orig.Cid()), "height %d", h)
+			full, err := store.GetBlock(ctx, orig.Cid())
+			require.NoError(t, err)
+			assert.Len(t, full.Messages, 1, "height %d", h)
+		}
+	}
+
+	// Pruning again does no further work.
+	pruned, err = store.PruneMessages(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, pruned)
+
+	// Exporting a range holding pruned blocks is refused.
+	var buf bytes.Buffer
+	err = chain.ExportRange(ctx, store, bstore.NewBlockstore(ds), 2, 3, &buf)
+	assert.Equal(t, chain.ErrMessagesPruned, errors.Cause(err))
+
+	// The store loads a chain with pruned blocks.
+	rebooted := chain.NewDefaultStore(ds, dstP.genCid)
+	require.NoError(t, rebooted.Load(ctx))
+	assert.Equal(t, chainTs[5].ToSortedCidSet(), rebooted.GetHead())
+	assert.True(t, rebooted.HasBlock(ctx, chainTs[1].ToSlice()[0].Cid()))
+}
+
+func TestPruneMessagesDisabled(t *testing.T) {
+	tf.UnitTest(t)
+	ctx := context.Background()
+	dstP := initDSTParams()
+	initStoreTest(ctx, t, dstP)
+
+	store := newChainStore(dstP).(*chain.DefaultStore)
+	requirePutTestChain(t, store, dstP)
+	assertSetHead(t, store, dstP.link4)
+
+	pruned, err := store.PruneMessages(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, pruned)
+}
@@ -0,0 +1,68 @@
+package chain
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// RestoreGenesis makes CheckGenesis restore the genesis tipset into a chain
+// store that lacks it, rather than fail with ErrNoGenesis.  gen returns the
+// genesis block, whose cid must be the store's genesis cid.  Its state must
+// be available to the syncer's state store.
+func RestoreGenesis(gen func(ctx context.Context) (*types.Block, error)) SyncerOpt {
+	return func(syncer *DefaultSyncer) {
+		syncer.restoreGenesis = gen
+	}
+}
+
+// CheckGenesis checks that the chain store holds its genesis tipset, and
+// should be called once the store is loaded, before syncing.  If the store
+// lacks it, CheckGenesis restores it if the syncer was configured with
+// RestoreGenesis, and otherwise returns ErrNoGenesis.  A restored genesis
+// becomes the head of a store with no head.
+func (syncer *DefaultSyncer) CheckGenesis(ctx context.Context) error {
+	syncer.mu.Lock()
+	defer syncer.mu.Unlock()
+
+	if syncer.hasGenesis(ctx) {
+		return nil
+	}
+	genCid := syncer.chainStore.GenesisCid()
+	if syncer.restoreGenesis == nil {
+		return errors.Wrapf(ErrNoGenesis, "genesis %s", genCid.String())
+	}
+
+	genesis, err := syncer.restoreGenesis(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "failed to restore genesis %s", genCid.String())
+	}
+	if !genesis.Cid().Equals(genCid) {
+		return errors.Wrapf(ErrGenesisMismatch, "restored genesis %s, expected %s", genesis.Cid().String(), genCid.String())
+	}
+	genTs, err := types.NewTipSet(genesis)
+	if err != nil {
+		return err
+	}
+	if err := syncer.chainStore.PutTipSetAndState(ctx, &TipSetAndState{
+		TipSet:          genTs,
+		TipSetStateRoot: genesis.StateRoot,
+	}); err != nil {
+		return errors.Wrap(err, "failed to store restored genesis")
+	}
+	if syncer.chainStore.GetHead().Len() == 0 {
+		if err := syncer.chainStore.SetHead(ctx, genTs); err != nil {
+			return errors.Wrap(err, "failed to set restored genesis as head")
+		}
+	}
+	logSyncer.Warningf("restored missing genesis %s to the chain store", genCid.String())
+	return nil
+}
+
+// hasGenesis returns whether the chain store holds its genesis tipset.
+func (syncer *DefaultSyncer) hasGenesis(ctx context.Context) bool {
+	genKey := types.NewSortedCidSet(syncer.chainStore.GenesisCid())
+	return syncer.chainStore.HasTipSetAndState(ctx, genKey.String())
+}
@@ -0,0 +1,73 @@
+package chain_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/chain/synctest"
+	"github.com/filecoin-project/go-filecoin/repo"
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestNoGenesis(t *testing.T) {
+	tf.UnitTest(t)
+	ctx := context.Background()
+
+	h := synctest.NewHarness(t)
+	h.Build(synctest.Linear("link", "", 2)...)
+	genesis := h.TipSet(synctest.GenesisName).ToSlice()[0]
+
+	// emptyStore returns a store of the harness's genesis whose datastore
+	// was wiped.
+	emptyStore := func(t *testing.T) *chain.DefaultStore {
+		store := chain.NewDefaultStore(repo.NewInMemoryRepo().ChainDatastore(), genesis.Cid())
+		require.NoError(t, store.Load(ctx))
+		assert.Equal(t, 0, store.GetHead().Len())
+		return store
+	}
+
+	t.Run("an empty store refuses to sync", func(t *testing.T) {
+		syncer := chain.NewDefaultSyncer(h.StateStore, h.Consensus, emptyStore(t), h.Fetcher)
+
+		assert.Equal(t, chain.ErrNoGenesis, errors.Cause(syncer.CheckGenesis(ctx)))
+		err := syncer.HandleNewTipset(ctx, h.TipSet("link2").ToSortedCidSet())
+		assert.Equal(t, chain.ErrNoGenesis, errors.Cause(err))
+	})
+
+	t.Run("a store holding its genesis passes", func(t *testing.T) {
+		syncer := chain.NewDefaultSyncer(h.StateStore, h.Consensus, h.Store, h.Fetcher)
+		assert.NoError(t, syncer.CheckGenesis(ctx))
+	})
+
+	t.Run("the genesis is restored when configured", func(t *testing.T) {
+		store := emptyStore(t)
+		syncer := chain.NewDefaultSyncer(h.StateStore, h.Consensus, store, h.Fetcher,
+			chain.RestoreGenesis(func(context.Context) (*types.Block, error) {
+				return genesis, nil
+			}),
+		)
+
+		require.NoError(t, syncer.CheckGenesis(ctx))
+		assert.Equal(t, h.TipSet(synctest.GenesisName).ToSortedCidSet(), store.GetHead())
+
+		require.NoError(t, syncer.HandleNewTipset(ctx, h.TipSet("link2").ToSortedCidSet()))
+		assert.Equal(t, h.TipSet("link2").ToSortedCidSet(), store.GetHead())
+	})
+
+	t.Run("a restored block other than the genesis fails", func(t *testing.T) {
+		other := h.TipSet("link1").ToSlice()[0]
+		syncer := chain.NewDefaultSyncer(h.StateStore, h.Consensus, emptyStore(t), h.Fetcher,
+			chain.RestoreGenesis(func(context.Context) (*types.Block, error) {
+				return other, nil
+			}),
+		)
+
+		assert.Equal(t, chain.ErrGenesisMismatch, errors.Cause(syncer.CheckGenesis(ctx)))
+	})
+}
@@ -0,0 +1,153 @@
+package chain
+
+import (
+	"context"
+	"time"
+
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// maxBufferedOrphans bounds the number of tipsets the syncer buffers
+// awaiting their parents.
+const maxBufferedOrphans = 128
+
+// orphanHorizon is how many rounds above the head a tipset may be and still
+// be buffered as an orphan.  A tipset two rounds up is missing only the
+// tipset of the round in between, which is likely still propagating.
+const orphanHorizon = 2
+
+// bufferedOrphan is a tipset buffered awaiting its parent.
+type bufferedOrphan struct {
+	key types.SortedCidSet
+	at  time.Time
+}
+
+// BufferOrphans configures a caught up syncer to buffer a tipset whose
+// parent is not in the store for up to window rather than fetch its chain
+// immediately.  Gossip may deliver a block before its parent, and the parent
+// usually arrives moments later.  Once a later sync stores the parent the
+// buffered tipset is synced from the blocks already fetched.  Only tipsets at
+// most two rounds above the head are buffered: anything further ahead, or
+// any tipset while catching up, is fetched immediately.  A buffered tipset
+// whose parent does not arrive within window is dropped; a later
+// announcement of it, or of any of its descendants, syncs it by fetching
+// backward as usual.  A window of zero disables buffering.
+func BufferOrphans(window time.Duration) SyncerOpt {
+	return func(syncer *DefaultSyncer) {
+		syncer.orphanWindow = window
+		syncer.orphans = make(map[string][]bufferedOrphan)
+	}
+}
+
+// bufferOrphan buffers the tipset with key tsKey and returns true if it is
+// an orphan the syncer should wait on rather than sync now.  The caller must
+// hold syncer.mu.
+func (syncer *DefaultSyncer) bufferOrphan(ctx context.Context, tsKey types.SortedCidSet) (bool, error) {
+	if syncer.orphanWindow <= 0 {
+		return false, nil
+	}
+	syncer.pruneOrphans()
+	for _, orphans := range syncer.orphans {
+		for _, orphan := range orphans {
+			if orphan.key.Equals(tsKey) {
+				return true, nil
+			}
+		}
+	}
+	if syncer.countOrphans() >= maxBufferedOrphans || syncer.Mode() != CaughtUp || syncer.badTipSets.Has(tsKey.String()) {
+		return false, nil
+	}
+
+	blks, err := syncer.getBlksMaybeFromNet(ctx, tsKey.ToSlice())
+	if err != nil {
+		return false, err
+	}
+	ts, err := types.NewTipSet(blks...)
+	if err != nil {
+		// Leave malformed tipsets to the usual checks.
+		return false, nil
+	}
+	parents, err := ts.Parents()
+	if err != nil {
+		return false, nil
+	}
+	if syncer.chainStore.HasTipSetAndState(ctx, parents.String()) {
+		return false, nil
+	}
+	h, err := ts.Height()
+	if err != nil {
+		return false, nil
+	}
+	headTs, err := syncer.chainStore.GetTipSet(syncer.chainStore.GetHead())
+	if err != nil {
+		return false, err
+	}
+	headHeight, err := headTs.Height()
+	if err != nil {
+		return false, err
+	}
+	if h > headHeight+orphanHorizon {
+		return false, nil
+	}
+
+	logSyncer.Debugf("buffering %s until its parent %s arrives", tsKey.String(), parents.String())
+	syncer.orphans[parents.String()] = append(syncer.orphans[parents.String()], bufferedOrphan{
+		key: tsKey,
+		at:  syncer.clock.Now(),
+	})
+	return true, nil
+}
+
+// releaseOrphans syncs the buffered tipsets whose parents are now in the
+// store, and in turn any buffered tipsets whose parents that stores.  The
+// caller must hold syncer.mu.
+func (syncer *DefaultSyncer) releaseOrphans(ctx context.Context) {
+	if syncer.orphanWindow <= 0 {
+		return
+	}
+	syncer.pruneOrphans()
+	for released := true; released; {
+		released = false
+		for parentKey, orphans := range syncer.orphans {
+			if !syncer.chainStore.HasTipSetAndState(ctx, parentKey) {
+				continue
+			}
+			delete(syncer.orphans, parentKey)
+			released = true
+			for _, orphan := range orphans {
+				if err := syncer.syncChain(ctx, orphan.key); err != nil {
+					logSyncer.Infof("failed to sync buffered tipset %s: %s", orphan.key.String(), err)
+				}
+			}
+		}
+	}
+}
+
+// pruneOrphans drops buffered tipsets older than the orphan window.  The
+// caller must hold syncer.mu.
+func (syncer *DefaultSyncer) pruneOrphans() {
+	cutoff := syncer.clock.Now().Add(-syncer.orphanWindow)
+	for parentKey, orphans := range syncer.orphans {
+		kept := orphans[:0]
+		for _, orphan := range orphans {
+			if orphan.at.After(cutoff) {
+				kept = append(kept, orphan)
+			}
+		}
+		if len(kept) == 0 {
+			delete(syncer.orphans, parentKey)
+			continue
+		}
+		syncer.orphans[parentKey] = kept
+	}
+}
+
+// countOrphans returns the number of buffered tipsets.  The caller must hold
+// syncer.mu.
+func (syncer *DefaultSyncer) countOrphans() int {
+	n := 0
+	for _, orphans := range syncer.orphans {
+		n += len(orphans)
+	}
+	return n
+}
@@ -0,0 +1,56 @@
+package chain_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/chain/synctest"
+	th "github.com/filecoin-project/go-filecoin/testhelpers"
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+)
+
+func TestBufferOrphans(t *testing.T) {
+	tf.UnitTest(t)
+
+	newHarness := func(fetched map[cid.Cid]int) *synctest.Harness {
+		clk := th.NewFakeClock(time.Unix(1234567890, 0))
+		h := synctest.NewHarness(t,
+			chain.SyncerClock(clk),
+			chain.BufferOrphans(time.Minute),
+			chain.ObserveBlocks(func(c cid.Cid, _ int, _ bool) { fetched[c]++ }),
+		)
+		h.Build(synctest.Linear("link", "", 3)...)
+		return h
+	}
+
+	t.Run("child synced once its parent arrives", func(t *testing.T) {
+		fetched := make(map[cid.Cid]int)
+		h := newHarness(fetched)
+
+		// The child arrives first and waits without fetching its parent.
+		h.RequireSync("link2")
+		h.RequireHead(synctest.GenesisName)
+		link1 := h.TipSet("link1").ToSlice()[0].Cid()
+		assert.Equal(t, 0, fetched[link1])
+
+		// Announcing it again while it waits does nothing.
+		h.RequireSync("link2")
+		h.RequireHead(synctest.GenesisName)
+
+		// The parent arrives and the buffered child follows it.
+		h.RequireSync("link1")
+		h.RequireHead("link2")
+		assert.Equal(t, 1, fetched[link1])
+	})
+
+	t.Run("tipset far ahead of the head is fetched immediately", func(t *testing.T) {
+		h := newHarness(make(map[cid.Cid]int))
+
+		h.RequireSync("link3")
+		h.RequireHead("link3")
+	})
+}
@@ -0,0 +1,41 @@
+package chain
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/state"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// checkParentWeight returns ErrParentWeightMismatch if the parent weight the
+// blocks of next claim is not the weight consensus computes for parent, which
+// must be in the store.  Fork choice compares the weights tipsets claim, so a
+// miner inflating the claim could otherwise force a reorg onto a lighter
+// chain.
+func (syncer *DefaultSyncer) checkParentWeight(ctx context.Context, parent, next types.TipSet) error {
+	claimed, err := next.ParentWeight()
+	if err != nil {
+		return err
+	}
+	grandparents, err := parent.Parents()
+	if err != nil {
+		return err
+	}
+	// Consensus weighs genesis without a parent state.
+	var grandparentSt state.Tree
+	if grandparents.Len() != 0 {
+		if grandparentSt, err = syncer.tipSetState(ctx, grandparents); err != nil {
+			return err
+		}
+	}
+	computed, err := syncer.consensus.Weight(ctx, parent, grandparentSt)
+	if err != nil {
+		return err
+	}
+	if claimed != computed {
+		return errors.Wrapf(ErrParentWeightMismatch, "tipset %s claims %d, computed %d", next.String(), claimed, computed)
+	}
+	return nil
+}
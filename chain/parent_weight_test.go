@@ -0,0 +1,49 @@
+package chain_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/chain/synctest"
+	th "github.com/filecoin-project/go-filecoin/testhelpers"
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestParentWeightValidation(t *testing.T) {
+	tf.UnitTest(t)
+	ctx := context.Background()
+
+	h := synctest.NewHarness(t)
+	h.Build(synctest.Linear("link", "", 2)...)
+
+	// inflated returns a copy of the block of the tipset named name claiming
+	// a heavier parent.
+	inflated := func(t *testing.T, name string) types.TipSet {
+		cpy := *h.TipSet(name).ToSlice()[0]
+		cpy.ParentWeight++
+		blk, err := types.DecodeBlock(cpy.ToNode().RawData())
+		require.NoError(t, err)
+		h.Fetcher.AddSourceBlocks(blk)
+		return th.RequireNewTipSet(t, blk)
+	}
+
+	for _, name := range []string{"link1", "link2"} {
+		t.Run(name, func(t *testing.T) {
+			liar := inflated(t, name)
+			err := h.Syncer.HandleNewTipset(ctx, liar.ToSortedCidSet())
+			require.Error(t, err)
+			assert.Equal(t, chain.ErrParentWeightMismatch, errors.Cause(err))
+			assert.False(t, h.Store.HasTipSetAndState(ctx, liar.String()))
+
+			// The honest tipset syncs.
+			h.RequireSync(name)
+			h.RequireHead(name)
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package chain
+
+import (
+	"context"
+
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// WarnLowParticipation configures the syncer to warn about every tipset it
+// syncs holding fewer than minBlocks blocks, which may indicate that few
+// miners are participating in the network.  Such tipsets are still synced:
+// the syncer only logs a warning, counts it in the
+// chain/sync_low_participation metric and calls onLowParticipation, if it is
+// not nil, with the tipset.  A minBlocks of zero disables the check.
+func WarnLowParticipation(minBlocks int, onLowParticipation func(types.TipSet)) SyncerOpt {
+	return func(syncer *DefaultSyncer) {
+		syncer.minBlocksPerTipSet = minBlocks
+		syncer.onLowParticipation = onLowParticipation
+	}
+}
+
+// checkParticipation warns if the synced tipset ts holds fewer blocks than
+// the syncer expects.
+func (syncer *DefaultSyncer) checkParticipation(ctx context.Context, ts types.TipSet) {
+	if len(ts) >= syncer.minBlocksPerTipSet {
+		return
+	}
+	logSyncer.Warningf("low participation: tipset %s holds %d blocks, expected at least %d", ts.String(), len(ts), syncer.minBlocksPerTipSet)
+	lowParticipationCt.Inc(ctx, 1)
+	if syncer.onLowParticipation != nil {
+		syncer.onLowParticipation(ts)
+	}
+}
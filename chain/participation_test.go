@@ -0,0 +1,35 @@
+package chain_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/chain/synctest"
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestWarnLowParticipation(t *testing.T) {
+	tf.UnitTest(t)
+
+	var warned []types.TipSet
+	h := synctest.NewHarness(t, chain.WarnLowParticipation(2, func(ts types.TipSet) {
+		warned = append(warned, ts)
+	}))
+	h.Build(
+		synctest.Spec{Name: "full", Blocks: 2},
+		synctest.Spec{Name: "thin", Parent: "full"},
+	)
+
+	h.RequireSync("full")
+	assert.Empty(t, warned)
+
+	// The thin tipset is warned about but still synced.
+	h.RequireSync("thin")
+	h.RequireHead("thin")
+	require.Len(t, warned, 1)
+	assert.True(t, h.TipSet("thin").Equals(warned[0]))
+}
@@ -0,0 +1,33 @@
+package chain
+
+// PeerDialer improves the connectivity of the node on the syncer's behalf.
+type PeerDialer interface {
+	// PeerCount returns the number of peers the node is connected to.
+	PeerCount() int
+	// DialPeers starts dialing known peers, such as the bootstrap peers.
+	// It must not wait for the dials.
+	DialPeers()
+}
+
+// DialPeersWhenThin configures the syncer to ask dialer to dial peers when
+// it is about to fetch a chain while the node has fewer than minPeers
+// peers, so that more peers may be connected and able to serve blocks by
+// the time the fetch times out.  The sync does not wait for the dials.
+func DialPeersWhenThin(dialer PeerDialer, minPeers int) SyncerOpt {
+	return func(syncer *DefaultSyncer) {
+		syncer.peerDialer = dialer
+		syncer.minPeers = minPeers
+	}
+}
+
+// dialPeersIfThin asks the syncer's peer dialer, if any, to dial peers if
+// the node has too few.
+func (syncer *DefaultSyncer) dialPeersIfThin() {
+	if syncer.peerDialer == nil {
+		return
+	}
+	if n := syncer.peerDialer.PeerCount(); n < syncer.minPeers {
+		logSyncer.Infof("syncing with %d of %d peers, dialing more", n, syncer.minPeers)
+		syncer.peerDialer.DialPeers()
+	}
+}
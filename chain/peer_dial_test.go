@@ -0,0 +1,46 @@
+package chain_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/chain/synctest"
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+)
+
+// countingDialer reports a fixed peer count and counts requests to dial.
+type countingDialer struct {
+	peers int
+	dials int
+}
+
+func (d *countingDialer) PeerCount() int { return d.peers }
+func (d *countingDialer) DialPeers()     { d.dials++ }
+
+func TestDialPeersWhenThin(t *testing.T) {
+	tf.UnitTest(t)
+
+	t.Run("dials when peers are few", func(t *testing.T) {
+		dialer := &countingDialer{peers: 1}
+		h := synctest.NewHarness(t, chain.DialPeersWhenThin(dialer, 3))
+		h.Build(synctest.Linear("link", "", 2)...)
+
+		h.RequireSync("link2")
+		assert.Equal(t, 1, dialer.dials)
+
+		// Nothing is fetched for a synced tipset, so nothing is dialed.
+		h.RequireSync("link2")
+		assert.Equal(t, 1, dialer.dials)
+	})
+
+	t.Run("does not dial with enough peers", func(t *testing.T) {
+		dialer := &countingDialer{peers: 3}
+		h := synctest.NewHarness(t, chain.DialPeersWhenThin(dialer, 3))
+		h.Build(synctest.Linear("link", "", 2)...)
+
+		h.RequireSync("link2")
+		assert.Equal(t, 0, dialer.dials)
+	})
+}
@@ -0,0 +1,52 @@
+package chain
+
+import (
+	"context"
+
+	"github.com/ipfs/go-hamt-ipld"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/actor"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/consensus"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// PowerTable returns the power of every miner in the state of the tipset with
+// the input key, or in the head state if the key is empty, and the total power
+// of the network.  Miner power is read from the miner actors and the total
+// from the storage market actor, as consensus does.  bs holds the actors'
+// storage.
+func PowerTable(ctx context.Context, store latestStateChainReader, stateStore *hamt.CborIpldStore, bs bstore.Blockstore, tsKey types.SortedCidSet) (map[address.Address]*types.BytesAmount, *types.BytesAmount, error) {
+	st, err := TipSetState(ctx, store, stateStore, tsKey)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to load state of tipset %s", tsKey.String())
+	}
+
+	var miners []address.Address
+	err = st.ForEachActor(ctx, func(addr address.Address, act *actor.Actor) error {
+		if act.Code.Equals(types.MinerActorCodeCid) || act.Code.Equals(types.BootstrapMinerActorCodeCid) {
+			miners = append(miners, addr)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to walk actors")
+	}
+
+	view := &consensus.MarketView{}
+	powers := make(map[address.Address]*types.BytesAmount, len(miners))
+	for _, addr := range miners {
+		power, err := view.Miner(ctx, st, bs, addr)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "failed to get power of miner %s", addr.String())
+		}
+		powers[addr] = power
+	}
+	total, err := view.Total(ctx, st, bs)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to get total power")
+	}
+	return powers, total, nil
+}
@@ -0,0 +1,80 @@
+package chain_test
+
+import (
+	"context"
+	"testing"
+
+	bserv "github.com/ipfs/go-blockservice"
+	"github.com/ipfs/go-hamt-ipld"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/gengen/util"
+	"github.com/filecoin-project/go-filecoin/repo"
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestPowerTable(t *testing.T) {
+	tf.UnitTest(t)
+	ctx := context.Background()
+
+	r := repo.NewInMemoryRepo()
+	bs := bstore.NewBlockstore(r.Datastore())
+	cst := &hamt.CborIpldStore{Blocks: bserv.New(bs, offline.Exchange(bs))}
+
+	// A genesis state with miners of known power.
+	genCfg := &gengen.GenesisCfg{
+		Keys: 2,
+		Miners: []gengen.Miner{
+			{Owner: 0, NumCommittedSectors: 3},
+			{Owner: 1, NumCommittedSectors: 5},
+		},
+	}
+	var info *gengen.RenderedGenInfo
+	gen := func(cst *hamt.CborIpldStore, bs bstore.Blockstore) (*types.Block, error) {
+		var err error
+		info, err = gengen.GenGen(ctx, genCfg, cst, bs, 0)
+		if err != nil {
+			return nil, err
+		}
+		var genesis types.Block
+		if err := cst.Get(ctx, info.GenesisCid, &genesis); err != nil {
+			return nil, err
+		}
+		return &genesis, nil
+	}
+	store, err := chain.Init(ctx, r, bs, cst, gen)
+	require.NoError(t, err)
+
+	sectorPower := func(n uint64) *types.BytesAmount {
+		return types.NewBytesAmount(types.OneKiBSectorSize.Uint64() * n)
+	}
+
+	for name, tsKey := range map[string]types.SortedCidSet{
+		"at the head":       {},
+		"at a given tipset": store.GetHead(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			powers, total, err := chain.PowerTable(ctx, store, cst, bs, tsKey)
+			require.NoError(t, err)
+
+			require.Len(t, powers, 2)
+			for _, m := range info.Miners {
+				require.Contains(t, powers, m.Address)
+				assert.True(t, m.Power.Equal(powers[m.Address]), "miner %s", m.Address)
+			}
+			assert.True(t, sectorPower(3).Equal(powers[info.Miners[0].Address]))
+			assert.True(t, sectorPower(5).Equal(powers[info.Miners[1].Address]))
+			assert.True(t, sectorPower(8).Equal(total))
+		})
+	}
+
+	t.Run("an unknown tipset fails", func(t *testing.T) {
+		_, _, err := chain.PowerTable(ctx, store, cst, bs, types.NewSortedCidSet(types.SomeCid()))
+		assert.Error(t, err)
+	})
+}
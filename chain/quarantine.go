@@ -0,0 +1,242 @@
+package chain
+
+import (
+	"encoding/json"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/consensus"
+	"github.com/filecoin-project/go-filecoin/repo"
+)
+
+// quarantineKey is the datastore key under which a DatastoreQuarantineStore
+// keeps the quarantined tipsets.
+var quarantineKey = datastore.NewKey("/chain/quarantine")
+
+// quarantineInfo records why a quarantined tipset failed validation.
+type quarantineInfo struct {
+	reason  string
+	version string
+}
+
+// IsHardInvalid returns true if err, returned validating a tipset, shows the
+// tipset invalid whatever the version of the node validating it, such as for
+// a block with a losing ticket or a message with an invalid signature.  A
+// tipset failing validation otherwise, e.g.
+// on a state root mismatch, may only have exposed a bug in the node, so the
+// syncer quarantines it rather than caching it as bad for good.
+func IsHardInvalid(err error) bool {
+	switch errors.Cause(err) {
+	case consensus.ErrLosingTicket, consensus.ErrInvalidBase, consensus.ErrInvalidSignature, ErrEquivocation:
+		return true
+	default:
+		return false
+	}
+}
+
+// NodeVersion configures the version of the node software the syncer
+// records against the tipsets it quarantines.  See SetNodeVersion.
+func NodeVersion(version string) SyncerOpt {
+	return func(syncer *DefaultSyncer) {
+		syncer.version = version
+	}
+}
+
+// SetNodeVersion changes the version of the node software validating
+// tipsets, as after an upgrade applied without a restart, and releases the
+// tipsets quarantined by other versions so that syncing them again
+// revalidates them.  Hard invalid tipsets stay bad.  It returns the number of
+// tipsets released.  A syncer persisting its quarantine with QuarantineTo
+// likewise releases, when created, the tipsets quarantined by other versions.
+func (syncer *DefaultSyncer) SetNodeVersion(version string) int {
+	syncer.versionMu.Lock()
+	changed := version != syncer.version
+	syncer.version = version
+	syncer.versionMu.Unlock()
+	if !changed {
+		return 0
+	}
+	released := syncer.badTipSets.releaseQuarantined(version)
+	syncer.persistQuarantine()
+	logSyncer.Infof("node version changed to %q, released %d quarantined tipsets", version, released)
+	return released
+}
+
+// QuarantineEntry is the persisted form of a quarantined tipset.
+type QuarantineEntry struct {
+	Key     string `json:"key"`
+	Height  uint64 `json:"height"`
+	Reason  string `json:"reason"`
+	Version string `json:"version"`
+}
+
+// QuarantineStore persists the tipsets the syncer quarantines, so that a
+// restart does not revalidate them unless the node version changed.
+type QuarantineStore interface {
+	// Save replaces the stored entries with entries.
+	Save(entries []QuarantineEntry) error
+	// Load returns the stored entries.
+	Load() ([]QuarantineEntry, error)
+}
+
+// QuarantineTo configures the syncer to persist the tipsets it quarantines
+// with store.  The syncer restores the tipsets store holds that the current
+// node version quarantined, and releases the others.  Failures to persist
+// the quarantine are logged and otherwise ignored, as a lost entry only costs
+// validating its tipset again.
+func QuarantineTo(store QuarantineStore) SyncerOpt {
+	return func(syncer *DefaultSyncer) {
+		syncer.quarantineStore = store
+	}
+}
+
+// DatastoreQuarantineStore is a QuarantineStore keeping the quarantined
+// tipsets in a datastore under a reserved key.
+type DatastoreQuarantineStore struct {
+	ds repo.Datastore
+}
+
+var _ QuarantineStore = (*DatastoreQuarantineStore)(nil)
+
+// NewDatastoreQuarantineStore returns a DatastoreQuarantineStore keeping the
+// quarantined tipsets in ds.
+func NewDatastoreQuarantineStore(ds repo.Datastore) *DatastoreQuarantineStore {
+	return &DatastoreQuarantineStore{ds: ds}
+}
+
+// Save replaces the stored entries with entries.
+func (s *DatastoreQuarantineStore) Save(entries []QuarantineEntry) error {
+	val, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	return s.ds.Put(quarantineKey, val)
+}
+
+// Load returns the stored entries.
+func (s *DatastoreQuarantineStore) Load() ([]QuarantineEntry, error) {
+	val, err := s.ds.Get(quarantineKey)
+	if err == datastore.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []QuarantineEntry
+	if err := json.Unmarshal(val, &entries); err != nil {
+		return nil, errors.Wrap(err, "failed to decode quarantine")
+	}
+	return entries, nil
+}
+
+// restoreQuarantine quarantines again the tipsets the syncer's quarantine
+// store holds that the current node version quarantined, and drops the
+// others from the store.
+func (syncer *DefaultSyncer) restoreQuarantine() {
+	if syncer.quarantineStore == nil {
+		return
+	}
+	entries, err := syncer.quarantineStore.Load()
+	if err != nil {
+		logSyncer.Warningf("failed to load quarantine: %s", err)
+		return
+	}
+	version := syncer.nodeVersion()
+	released := 0
+	for _, entry := range entries {
+		if entry.Version != version {
+			released++
+			continue
+		}
+		syncer.badTipSets.restoreQuarantined(entry)
+	}
+	if released > 0 {
+		logSyncer.Infof("node version is %q, released %d quarantined tipsets", version, released)
+		syncer.persistQuarantine()
+	}
+}
+
+// persistQuarantine saves the quarantined tipsets with the syncer's
+// quarantine store, if it has one.
+func (syncer *DefaultSyncer) persistQuarantine() {
+	if syncer.quarantineStore == nil {
+		return
+	}
+	if err := syncer.quarantineStore.Save(syncer.badTipSets.quarantinedEntries()); err != nil {
+		logSyncer.Warningf("failed to persist quarantine: %s", err)
+	}
+}
+
+// nodeVersion returns the version of the node software validating tipsets.
+func (syncer *DefaultSyncer) nodeVersion() string {
+	syncer.versionMu.Lock()
+	defer syncer.versionMu.Unlock()
+	return syncer.version
+}
+
+// quarantine adds the tipsets identified by links to the cache as
+// quarantined by version for reason.  Tipsets already cached as hard invalid
+// stay so.
+func (cache *badTipSetCache) quarantine(links []tipSetLink, reason, version string) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	for _, link := range links {
+		tsKey := link.key.String()
+		existing, cached := cache.getLocked(tsKey)
+		hard := cached && existing.quarantine == nil
+
+		bts := cache.addAtHeightLocked(tsKey, link.height)
+		if !hard {
+			bts.quarantine = &quarantineInfo{reason: reason, version: version}
+		}
+	}
+}
+
+// releaseQuarantined removes the keys quarantined by versions other than
+// version and returns the number removed.
+func (cache *badTipSetCache) releaseQuarantined(version string) int {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	released := 0
+	for _, tsKey := range cache.bad.Keys() {
+		bts, _ := cache.getLocked(tsKey)
+		if bts.quarantine != nil && bts.quarantine.version != version {
+			cache.bad.Remove(tsKey)
+			released++
+		}
+	}
+	return released
+}
+
+// restoreQuarantined adds the tipset of entry to the cache as quarantined,
+// unless it is already cached as hard invalid.
+func (cache *badTipSetCache) restoreQuarantined(entry QuarantineEntry) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if _, cached := cache.getLocked(entry.Key); cached {
+		return
+	}
+	bts := cache.addAtHeightLocked(entry.Key, entry.Height)
+	bts.quarantine = &quarantineInfo{reason: entry.Reason, version: entry.Version}
+}
+
+// quarantinedEntries returns the quarantined keys in their persisted form.
+func (cache *badTipSetCache) quarantinedEntries() []QuarantineEntry {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	entries := []QuarantineEntry{}
+	for _, tsKey := range cache.bad.Keys() {
+		bts, _ := cache.getLocked(tsKey)
+		if bts.quarantine == nil {
+			continue
+		}
+		entries = append(entries, QuarantineEntry{
+			Key:     tsKey,
+			Height:  bts.height,
+			Reason:  bts.quarantine.reason,
+			Version: bts.quarantine.version,
+		})
+	}
+	return entries
+}
@@ -0,0 +1,118 @@
+package chain_test
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/chain/synctest"
+	"github.com/filecoin-project/go-filecoin/consensus"
+	"github.com/filecoin-project/go-filecoin/repo"
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+)
+
+func TestQuarantine(t *testing.T) {
+	tf.UnitTest(t)
+
+	h := synctest.NewHarness(t, chain.NodeVersion("v1"))
+	h.Build(
+		synctest.Spec{Name: "approved"},
+		synctest.Spec{Name: "other"},
+		synctest.Spec{Name: "bad", Parent: "approved", Bad: true},
+	)
+	h.Build(synctest.Linear("tail", "bad", 2)...)
+	var allowed []address.Address
+	for _, name := range []string{"approved", "bad", "tail1", "tail2"} {
+		allowed = append(allowed, h.TipSet(name).ToSlice()[0].Miner)
+	}
+	syncer := chain.NewDefaultSyncer(h.StateStore, h.Consensus, h.Store, h.Fetcher,
+		chain.NodeVersion("v1"),
+		chain.ValidateBlocks(chain.MinerAllowlist(allowed)),
+	)
+	h.Syncer = syncer
+
+	// A state root mismatch may be a bug of v1, so the chain is quarantined.
+	h.RequireSync("approved")
+	err := h.Sync("tail2")
+	require.Error(t, err)
+	assert.NotEqual(t, chain.ErrChainHasBadTipSet, errors.Cause(err))
+	assert.Equal(t, chain.ErrChainHasBadTipSet, errors.Cause(h.Sync("tail2")))
+
+	// A block of a miner off the allowlist is invalid in any version.
+	assert.Equal(t, chain.ErrMinerNotAllowed, errors.Cause(h.Sync("other")))
+
+	report, err := syncer.InspectState()
+	require.NoError(t, err)
+	quarantined := make(map[string]chain.BadTipSetEntry)
+	for _, entry := range report.BadTipSets {
+		if entry.Quarantined {
+			quarantined[entry.Key] = entry
+		}
+	}
+	require.Len(t, quarantined, 3)
+	entry := quarantined[h.TipSet("bad").ToSortedCidSet().String()]
+	assert.Equal(t, "v1", entry.Version)
+	assert.NotEmpty(t, entry.Reason)
+
+	t.Run("the same version releases nothing", func(t *testing.T) {
+		assert.Equal(t, 0, syncer.SetNodeVersion("v1"))
+		assert.Equal(t, chain.ErrChainHasBadTipSet, errors.Cause(h.Sync("tail2")))
+	})
+
+	t.Run("an upgrade releases quarantined tipsets for revalidation", func(t *testing.T) {
+		assert.Equal(t, 3, syncer.SetNodeVersion("v2"))
+
+		// The chain is validated again, and still fails.
+		err := h.Sync("tail2")
+		require.Error(t, err)
+		assert.NotEqual(t, chain.ErrChainHasBadTipSet, errors.Cause(err))
+
+		// The hard invalid tipset stays bad.
+		assert.Equal(t, chain.ErrChainHasBadTipSet, errors.Cause(h.Sync("other")))
+	})
+}
+
+func TestQuarantinePersists(t *testing.T) {
+	tf.UnitTest(t)
+
+	h := synctest.NewHarness(t)
+	h.Build(synctest.Spec{Name: "bad", Bad: true})
+	store := chain.NewDatastoreQuarantineStore(repo.NewInMemoryRepo().ChainDatastore())
+	restart := func(version string) {
+		h.Syncer = chain.NewDefaultSyncer(h.StateStore, h.Consensus, h.Store, h.Fetcher,
+			chain.NodeVersion(version),
+			chain.QuarantineTo(store),
+		)
+	}
+
+	restart("v1")
+	err := h.Sync("bad")
+	require.Error(t, err)
+	assert.NotEqual(t, chain.ErrChainHasBadTipSet, errors.Cause(err))
+
+	// The same version keeps the tipset quarantined across a restart.
+	restart("v1")
+	assert.Equal(t, chain.ErrChainHasBadTipSet, errors.Cause(h.Sync("bad")))
+
+	// A new version releases it for revalidation.
+	restart("v2")
+	err = h.Sync("bad")
+	require.Error(t, err)
+	assert.NotEqual(t, chain.ErrChainHasBadTipSet, errors.Cause(err))
+	entries, err := store.Load()
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "v2", entries[0].Version)
+}
+
+func TestIsHardInvalid(t *testing.T) {
+	tf.UnitTest(t)
+
+	assert.True(t, chain.IsHardInvalid(errors.Wrap(consensus.ErrLosingTicket, "block")))
+	assert.True(t, chain.IsHardInvalid(errors.Wrap(consensus.ErrInvalidSignature, "block")))
+	assert.False(t, chain.IsHardInvalid(errors.Wrap(consensus.ErrStateRootMismatch, "block")))
+}
@@ -0,0 +1,116 @@
+package chain
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/state"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// reorgHistorySize bounds the number of reorgs the syncer remembers.
+const reorgHistorySize = 64
+
+// ReorgInfo describes a reorg of the syncer's head.
+type ReorgInfo struct {
+	// Time is when the syncer switched heads.
+	Time time.Time
+	// Depth is the number of tipsets of the old head's chain, from the old
+	// head back to the common ancestor of the two chains, that left the
+	// chain.
+	Depth int
+	// OldHead is the key of the head the syncer switched from.
+	OldHead types.SortedCidSet
+	// NewHead is the key of the head the syncer switched to.
+	NewHead types.SortedCidSet
+	// WeightGap is the weight by which the new head outweighed the old.
+	WeightGap uint64
+}
+
+// ReorgHistory returns the most recent reorgs of the syncer's head, newest
+// first, at most limit of them.  A limit of zero or less returns every reorg
+// the syncer remembers, which is the last 64.
+func (syncer *DefaultSyncer) ReorgHistory(limit int) []ReorgInfo {
+	syncer.reorgHistoryMu.Lock()
+	defer syncer.reorgHistoryMu.Unlock()
+
+	n := len(syncer.reorgHistory)
+	if limit > 0 && limit < n {
+		n = limit
+	}
+	history := make([]ReorgInfo, n)
+	for i := range history {
+		history[i] = syncer.reorgHistory[len(syncer.reorgHistory)-1-i]
+	}
+	return history
+}
+
+// recordReorgHistory adds the reorg from head to next, the last tipset of
+// newChain, to the syncer's reorg history and returns its description.
+// newChain holds next and its ancestors, oldest first.  A reorg that cannot
+// be described is logged and left out of the history rather than failing
+// the sync, and recordReorgHistory returns false.
+func (syncer *DefaultSyncer) recordReorgHistory(ctx context.Context, next, head types.TipSet, newChain []types.TipSet, nextParentSt, headParentSt state.Tree) (ReorgInfo, bool) {
+	info, err := syncer.describeReorg(ctx, next, head, newChain, nextParentSt, headParentSt)
+	if err != nil {
+		logSyncer.Warningf("failed to record reorg from %s to %s: %s", head.String(), next.String(), err)
+		return ReorgInfo{}, false
+	}
+
+	syncer.reorgHistoryMu.Lock()
+	defer syncer.reorgHistoryMu.Unlock()
+	syncer.reorgHistory = append(syncer.reorgHistory, info)
+	if len(syncer.reorgHistory) > reorgHistorySize {
+		syncer.reorgHistory = syncer.reorgHistory[len(syncer.reorgHistory)-reorgHistorySize:]
+	}
+	return info, true
+}
+
+// describeReorg returns the ReorgInfo of the reorg from head to next.
+func (syncer *DefaultSyncer) describeReorg(ctx context.Context, next, head types.TipSet, newChain []types.TipSet, nextParentSt, headParentSt state.Tree) (ReorgInfo, error) {
+	nextW, err := syncer.consensus.Weight(ctx, next, nextParentSt)
+	if err != nil {
+		return ReorgInfo{}, err
+	}
+	headW, err := syncer.consensus.Weight(ctx, head, headParentSt)
+	if err != nil {
+		return ReorgInfo{}, err
+	}
+	var gap uint64
+	if nextW > headW {
+		gap = nextW - headW
+	}
+
+	onNewChain := make(map[string]struct{}, len(newChain))
+	for _, ts := range newChain {
+		onNewChain[ts.String()] = struct{}{}
+	}
+	depth := 0
+	found := false
+	for it := IterAncestors(ctx, syncer.chainStore, head); !it.Complete(); err = it.Next() {
+		if err != nil {
+			return ReorgInfo{}, err
+		}
+		if _, ok := onNewChain[it.Value().String()]; ok {
+			found = true
+			break
+		}
+		depth++
+	}
+	if err != nil {
+		return ReorgInfo{}, err
+	}
+	if !found {
+		return ReorgInfo{}, errors.New("chains share no ancestor")
+	}
+
+	return ReorgInfo{
+		Time:      syncer.clock.Now(),
+		Depth:     depth,
+		OldHead:   head.ToSortedCidSet(),
+		NewHead:   next.ToSortedCidSet(),
+		WeightGap: gap,
+	}, nil
+}
@@ -0,0 +1,83 @@
+package chain_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/chain/synctest"
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestReorgHistory(t *testing.T) {
+	tf.UnitTest(t)
+	h := synctest.NewHarness(t)
+	// Wide tipsets outweigh the head outright, so that no switch between
+	// forks rests on a weight tie.
+	h.Build(synctest.Linear("a", "", 2)...)
+	h.Build(
+		synctest.Spec{Name: "b", Blocks: 3},
+		synctest.Spec{Name: "c1", Parent: "a1", Blocks: 3},
+		synctest.Spec{Name: "c2", Parent: "c1"},
+	)
+
+	// Extending the head is not a reorg.
+	h.RequireSync("a2")
+	assert.Empty(t, h.Syncer.ReorgHistory(0))
+
+	h.RequireSync("b")
+	h.RequireSync("c2")
+	h.RequireHead("c2")
+
+	history := h.Syncer.ReorgHistory(0)
+	require.Equal(t, 2, len(history))
+
+	assert.Equal(t, h.TipSet("b").ToSortedCidSet(), history[0].OldHead)
+	assert.Equal(t, h.TipSet("c1").ToSortedCidSet(), history[0].NewHead)
+	assert.Equal(t, 1, history[0].Depth)
+	assert.Equal(t, h.Weight("c1")-h.Weight("b"), history[0].WeightGap)
+
+	assert.Equal(t, h.TipSet("a2").ToSortedCidSet(), history[1].OldHead)
+	assert.Equal(t, h.TipSet("b").ToSortedCidSet(), history[1].NewHead)
+	assert.Equal(t, 2, history[1].Depth)
+	assert.Equal(t, h.Weight("b")-h.Weight("a2"), history[1].WeightGap)
+	assert.False(t, history[0].Time.Before(history[1].Time))
+
+	assert.Equal(t, history[:1], h.Syncer.ReorgHistory(1))
+}
+
+// failingHeadStore is a DefaultStore whose head cannot be set while fail is
+// true.
+type failingHeadStore struct {
+	*chain.DefaultStore
+	fail bool
+}
+
+func (s *failingHeadStore) SetHead(ctx context.Context, ts types.TipSet) error {
+	if s.fail {
+		return errors.New("injected failure")
+	}
+	return s.DefaultStore.SetHead(ctx, ts)
+}
+
+func TestReorgHistoryOmitsFailedHeadSwitch(t *testing.T) {
+	tf.UnitTest(t)
+	ctx := context.Background()
+	h := synctest.NewHarness(t)
+	h.Build(synctest.Linear("a", "", 2)...)
+	h.Build(synctest.Spec{Name: "b", Blocks: 3})
+
+	store := &failingHeadStore{DefaultStore: h.Store}
+	syncer := chain.NewDefaultSyncer(h.StateStore, h.Consensus, store, h.Fetcher)
+	require.NoError(t, syncer.HandleNewTipset(ctx, h.TipSet("a2").ToSortedCidSet()))
+
+	store.fail = true
+	assert.Error(t, syncer.HandleNewTipset(ctx, h.TipSet("b").ToSortedCidSet()))
+	h.RequireHead("a2")
+	assert.Empty(t, syncer.ReorgHistory(0))
+}
@@ -0,0 +1,107 @@
+package chain
+
+import (
+	"context"
+	"time"
+
+	"github.com/filecoin-project/go-filecoin/state"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// DetectReorgThrashing configures the syncer to treat more than maxReorgs
+// reorgs within window as its head thrashing between competing forks, as may
+// happen under attack or during a network partition.  When thrashing starts
+// the syncer logs an alert and calls onThrash, if it is not nil, with the
+// number of reorgs in the window.  While thrashing, the syncer only reorgs to
+// a tipset outweighing its head by at least margin, which dampens oscillation
+// between forks of similar weight.  The margin is a weight, in the fixed
+// point encoding consensus weighs tipsets in.  A margin of zero leaves fork
+// choice unchanged.
+func DetectReorgThrashing(maxReorgs int, window time.Duration, margin uint64, onThrash func(reorgs int)) SyncerOpt {
+	return func(syncer *DefaultSyncer) {
+		syncer.maxReorgs = maxReorgs
+		syncer.reorgWindow = window
+		syncer.reorgMargin = margin
+		syncer.onThrash = onThrash
+	}
+}
+
+// IsThrashing returns true if the syncer's head has reorged more than the
+// configured number of times within the configured window.
+func (syncer *DefaultSyncer) IsThrashing() bool {
+	syncer.thrashMu.Lock()
+	defer syncer.thrashMu.Unlock()
+	return syncer.recentReorgs() > syncer.maxReorgs
+}
+
+// recentReorgs drops reorgs older than the window and returns the number
+// remaining.  It returns zero if thrash detection is disabled.  The caller
+// must hold thrashMu.
+func (syncer *DefaultSyncer) recentReorgs() int {
+	if syncer.maxReorgs <= 0 {
+		return 0
+	}
+	cutoff := syncer.clock.Now().Add(-syncer.reorgWindow)
+	i := 0
+	for i < len(syncer.reorgTimes) && !syncer.reorgTimes[i].After(cutoff) {
+		i++
+	}
+	syncer.reorgTimes = syncer.reorgTimes[i:]
+	return len(syncer.reorgTimes)
+}
+
+// recordReorg records a reorg of the syncer's head and raises the thrashing
+// alert if it starts thrashing.
+func (syncer *DefaultSyncer) recordReorg(ctx context.Context) {
+	if syncer.maxReorgs <= 0 {
+		return
+	}
+	syncer.thrashMu.Lock()
+	wasThrashing := syncer.recentReorgs() > syncer.maxReorgs
+	syncer.reorgTimes = append(syncer.reorgTimes, syncer.clock.Now())
+	reorgs := len(syncer.reorgTimes)
+	syncer.thrashMu.Unlock()
+
+	if wasThrashing || reorgs <= syncer.maxReorgs {
+		return
+	}
+	logSyncer.Errorf("reorg thrashing detected, %d reorgs within %s", reorgs, syncer.reorgWindow)
+	reorgThrashCt.Inc(ctx, 1)
+	if syncer.onThrash != nil {
+		syncer.onThrash(reorgs)
+	}
+}
+
+// dampenReorg returns true if the syncer is thrashing and next, a tipset
+// heavier than head that would reorg the chain, does not outweigh head by the
+// configured margin.
+func (syncer *DefaultSyncer) dampenReorg(ctx context.Context, next, head types.TipSet, nextParentSt, headParentSt state.Tree) (bool, error) {
+	if syncer.reorgMargin == 0 || !syncer.IsThrashing() {
+		return false, nil
+	}
+	nextW, err := syncer.consensus.Weight(ctx, next, nextParentSt)
+	if err != nil {
+		return false, err
+	}
+	headW, err := syncer.consensus.Weight(ctx, head, headParentSt)
+	if err != nil {
+		return false, err
+	}
+	nextBig, err := types.FixedToBig(nextW)
+	if err != nil {
+		return false, err
+	}
+	headBig, err := types.FixedToBig(headW)
+	if err != nil {
+		return false, err
+	}
+	marginBig, err := types.FixedToBig(syncer.reorgMargin)
+	if err != nil {
+		return false, err
+	}
+	if nextBig.Cmp(headBig.Add(headBig, marginBig)) >= 0 {
+		return false, nil
+	}
+	logSyncer.Warningf("dampening reorg to %s while thrashing, weight %d is within margin of head weight %d", next.String(), nextW, headW)
+	return true, nil
+}
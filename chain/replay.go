@@ -0,0 +1,108 @@
+package chain
+
+import (
+	"context"
+
+	"github.com/ipfs/go-cid"
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/consensus"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// ErrReplayDiverged is returned by Replay when the state root it recomputes
+// for a tipset differs from the state root the store holds for it.
+var ErrReplayDiverged = errors.New("recomputed state root differs from stored state root")
+
+// Replay audits the store by recomputing the state of its head chain from
+// genesis.  It runs the state transition of every tipset afresh with con, on
+// the state recomputed for the tipset's parent, and returns the recomputed
+// state root of the highest tipset of the chain at or below toHeight, which a
+// caller can compare against the stored root.  Only the genesis state is
+// trusted.  The recomputed root of every tipset on the way is also checked
+// against the stored root, and Replay stops at the first divergence with
+// ErrReplayDiverged naming the tipset.
+//
+// Replay writes the state it recomputes through stateStore, which must write
+// to the store con reads state from.  It needs the message bodies of every
+// block it replays, so it fails with ErrMessagesPruned on a chain holding
+// blocks whose messages were pruned.
+// lookback is the number of tipsets preceding the live proving periods
+// gathered for consensus to sample randomness from, as configured on the
+// syncer that validated the chain.
+func Replay(ctx context.Context, store ReadStore, stateStore StateStore, con consensus.Protocol, toHeight uint64, lookback uint) (cid.Cid, error) {
+	headTs, err := store.GetTipSet(store.GetHead())
+	if err != nil {
+		return cid.Undef, errors.Wrap(err, "failed to load head")
+	}
+
+	// Collect the chain up to toHeight, newest first.
+	var tipsets []types.TipSet
+	for it := IterAncestors(ctx, store, *headTs); !it.Complete(); err = it.Next() {
+		if err != nil {
+			return cid.Undef, err
+		}
+		h, err := it.Value().Height()
+		if err != nil {
+			return cid.Undef, err
+		}
+		if h <= toHeight {
+			tipsets = append(tipsets, it.Value())
+		}
+	}
+	if err != nil {
+		return cid.Undef, err
+	}
+	genesis := tipsets[len(tipsets)-1]
+	if len(genesis) != 1 || !genesis.ToSlice()[0].Cid().Equals(store.GenesisCid()) {
+		return cid.Undef, errors.Errorf("chain does not link to genesis %s", store.GenesisCid())
+	}
+
+	root, err := store.GetTipSetStateRoot(genesis.ToSortedCidSet())
+	if err != nil {
+		return cid.Undef, errors.Wrap(err, "failed to load genesis state root")
+	}
+	for i := len(tipsets) - 2; i >= 0; i-- {
+		parent, ts := tipsets[i+1], tipsets[i]
+		h, err := ts.Height()
+		if err != nil {
+			return cid.Undef, err
+		}
+		root, err = replayTipSet(ctx, store, stateStore, con, parent, ts, root, lookback)
+		if err != nil {
+			return cid.Undef, errors.Wrapf(err, "failed to replay tipset %s at height %d", ts.String(), h)
+		}
+		stored, err := store.GetTipSetStateRoot(ts.ToSortedCidSet())
+		if err != nil {
+			return cid.Undef, err
+		}
+		if !root.Equals(stored) {
+			return cid.Undef, errors.Wrapf(ErrReplayDiverged, "tipset %s at height %d: recomputed %s, stored %s", ts.String(), h, root.String(), stored.String())
+		}
+	}
+	return root, nil
+}
+
+// replayTipSet runs the state transition of ts on the state with root
+// parentRoot, the recomputed state of parent, and returns the root of the
+// resulting state.
+func replayTipSet(ctx context.Context, store ReadStore, stateStore StateStore, con consensus.Protocol, parent, ts types.TipSet, parentRoot cid.Cid, lookback uint) (cid.Cid, error) {
+	st, err := stateStore.LoadStateTree(ctx, parentRoot)
+	if err != nil {
+		return cid.Undef, err
+	}
+	h, err := ts.Height()
+	if err != nil {
+		return cid.Undef, err
+	}
+	ancestorHeight := types.NewBlockHeight(consensus.AncestorRoundsNeeded)
+	ancestors, err := GetRecentAncestors(ctx, parent, store, types.NewBlockHeight(h), ancestorHeight, lookback)
+	if err != nil {
+		return cid.Undef, err
+	}
+	st, _, err = con.RunStateTransition(ctx, ts, ancestors, st)
+	if err != nil {
+		return cid.Undef, err
+	}
+	return st.Flush(ctx)
+}
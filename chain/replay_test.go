@@ -0,0 +1,58 @@
+package chain_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/chain/synctest"
+	"github.com/filecoin-project/go-filecoin/sampling"
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestReplay(t *testing.T) {
+	tf.UnitTest(t)
+	ctx := context.Background()
+
+	h := synctest.NewHarness(t)
+	h.Build(synctest.Linear("link", "", 5)...)
+	h.RequireSync("link5")
+
+	t.Run("matches stored roots", func(t *testing.T) {
+		for height := uint64(0); height <= 5; height++ {
+			tsKey := h.TipSet(synctest.GenesisName).ToSortedCidSet()
+			if height > 0 {
+				tsKey = h.TipSet(fmt.Sprintf("link%d", height)).ToSortedCidSet()
+			}
+			stored, err := h.Store.GetTipSetStateRoot(tsKey)
+			require.NoError(t, err)
+
+			replayed, err := chain.Replay(ctx, h.Store, h.StateStore, h.Consensus, height, sampling.LookbackParameter)
+			require.NoError(t, err)
+			assert.Equal(t, stored, replayed, "height %d", height)
+		}
+	})
+
+	t.Run("pinpoints a tampered root", func(t *testing.T) {
+		tampered := h.TipSet("link3")
+		require.NoError(t, h.Store.PutTipSetAndState(ctx, &chain.TipSetAndState{
+			TipSet:          tampered,
+			TipSetStateRoot: types.SomeCid(),
+		}))
+
+		// Replay below the tampered tipset still succeeds.
+		_, err := chain.Replay(ctx, h.Store, h.StateStore, h.Consensus, 2, sampling.LookbackParameter)
+		assert.NoError(t, err)
+
+		_, err = chain.Replay(ctx, h.Store, h.StateStore, h.Consensus, 5, sampling.LookbackParameter)
+		require.Error(t, err)
+		assert.Equal(t, chain.ErrReplayDiverged, errors.Cause(err))
+		assert.Contains(t, err.Error(), tampered.String())
+	})
+}
@@ -0,0 +1,61 @@
+package chain_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/chain/synctest"
+	"github.com/filecoin-project/go-filecoin/consensus"
+	"github.com/filecoin-project/go-filecoin/sampling"
+	"github.com/filecoin-project/go-filecoin/state"
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// ancestorProtocol records the ancestors passed with each state transition
+// it runs, by tipset key.
+type ancestorProtocol struct {
+	consensus.Protocol
+	ancestors map[string][]types.TipSet
+}
+
+func (p *ancestorProtocol) RunStateTransition(ctx context.Context, ts types.TipSet, ancestors []types.TipSet, pSt state.Tree) (state.Tree, types.GasUnits, error) {
+	p.ancestors[ts.String()] = ancestors
+	return p.Protocol.RunStateTransition(ctx, ts, ancestors, pSt)
+}
+
+func TestSamplingLookback(t *testing.T) {
+	tf.UnitTest(t)
+
+	// The tipset after the null rounds is so far above the chain below it
+	// that no ancestor falls within a live proving period, so only the
+	// lookback tipsets are gathered.
+	specs := append(synctest.Linear("link", "", 5), synctest.Spec{
+		Name:       "late",
+		Parent:     "link5",
+		NullRounds: consensus.AncestorRoundsNeeded,
+	})
+	gather := func(opts ...chain.SyncerOpt) []types.TipSet {
+		con := &ancestorProtocol{ancestors: make(map[string][]types.TipSet)}
+		h := synctest.NewHarnessWithConsensus(t, func(p consensus.Protocol) consensus.Protocol {
+			con.Protocol = p
+			return con
+		}, opts...)
+		h.Build(specs...)
+		h.RequireSync("late")
+		h.RequireHead("late")
+		return con.ancestors[h.TipSet("late").String()]
+	}
+
+	assert.Len(t, gather(), sampling.LookbackParameter)
+	ancestors := gather(chain.SamplingLookback(2))
+	assert.Len(t, ancestors, 2)
+	for i, ts := range ancestors {
+		h, err := ts.Height()
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(5-i), h)
+	}
+}
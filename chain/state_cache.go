@@ -0,0 +1,133 @@
+package chain
+
+import (
+	"context"
+	"sync"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+
+	"github.com/filecoin-project/go-filecoin/util/lru"
+)
+
+// StateCache is a blockstore that keeps the state objects read from the
+// blockstore it wraps in memory, so that the hamt nodes and actors of recent
+// state trees, which validation reads repeatedly, are not decoded from disk
+// every time.  Objects are immutable given their cids, so the cache never
+// serves stale data.
+//
+// The cache is bounded by an approximate budget of the bytes of the objects
+// it holds rather than by their number, as state objects vary widely in size.
+// The least recently used objects are evicted to stay within the budget, and
+// Shrink evicts more under memory pressure.  Objects larger than the budget
+// are not cached.  Caching objects rather than state trees keeps it safe to
+// mutate the trees loaded through the cache.
+type StateCache struct {
+	bstore.Blockstore
+
+	mu       sync.Mutex
+	maxBytes int
+	// blocks holds the cached blocks by cid, each costing its size.
+	blocks *lru.Cache
+}
+
+var _ bstore.Blockstore = (*StateCache)(nil)
+
+// NewStateCache returns a StateCache in front of bs holding at most about
+// maxBytes bytes of objects.
+func NewStateCache(bs bstore.Blockstore, maxBytes int) *StateCache {
+	return &StateCache{
+		Blockstore: bs,
+		maxBytes:   maxBytes,
+		blocks:     lru.New(maxBytes),
+	}
+}
+
+// Get returns the object with cid k, reading through to the underlying
+// blockstore on a miss.
+func (c *StateCache) Get(k cid.Cid) (blocks.Block, error) {
+	c.mu.Lock()
+	cached, ok := c.blocks.Get(k.KeyString())
+	c.mu.Unlock()
+	if ok {
+		return cached.(blocks.Block), nil
+	}
+
+	blk, err := c.Blockstore.Get(k)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.blocks.AddWithCost(k.KeyString(), blk, len(blk.RawData()))
+	c.mu.Unlock()
+	return blk, nil
+}
+
+// Has returns true if the object with cid k is cached or in the underlying
+// blockstore.
+func (c *StateCache) Has(k cid.Cid) (bool, error) {
+	c.mu.Lock()
+	_, ok := c.blocks.Peek(k.KeyString())
+	c.mu.Unlock()
+	if ok {
+		return true, nil
+	}
+	return c.Blockstore.Has(k)
+}
+
+// GetSize returns the size of the object with cid k.
+func (c *StateCache) GetSize(k cid.Cid) (int, error) {
+	c.mu.Lock()
+	cached, ok := c.blocks.Peek(k.KeyString())
+	c.mu.Unlock()
+	if ok {
+		return len(cached.(blocks.Block).RawData()), nil
+	}
+	return c.Blockstore.GetSize(k)
+}
+
+// DeleteBlock removes the object with cid k from the cache and the
+// underlying blockstore.
+func (c *StateCache) DeleteBlock(k cid.Cid) error {
+	c.mu.Lock()
+	c.blocks.Remove(k.KeyString())
+	c.mu.Unlock()
+	return c.Blockstore.DeleteBlock(k)
+}
+
+// Size returns the number of bytes of objects cached.
+func (c *StateCache) Size() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.blocks.Cost()
+}
+
+// Shrink evicts the least recently used objects until the cache holds at
+// most maxBytes bytes.  The budget is unchanged, so the cache grows back as
+// objects are read.
+func (c *StateCache) Shrink(maxBytes int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.blocks.Shrink(maxBytes)
+}
+
+// ShrinkOnPressure shrinks the cache to half its budget each time pressure
+// is signalled, until ctx is done or pressure is closed, so that a process
+// wide memory pressure signal can reclaim the cache's memory.
+func (c *StateCache) ShrinkOnPressure(ctx context.Context, pressure <-chan struct{}) {
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case _, ok := <-pressure:
+				if !ok {
+					return
+				}
+				c.Shrink(c.maxBytes / 2)
+				logStore.Infof("state cache shrunk to %d bytes under memory pressure", c.Size())
+			}
+		}
+	}()
+}
@@ -0,0 +1,119 @@
+package chain_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/repo"
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+)
+
+func TestStateCache(t *testing.T) {
+	tf.UnitTest(t)
+
+	// newObjects returns n objects of 100 bytes each, stored in bs.
+	newObjects := func(t *testing.T, bs bstore.Blockstore, n int) []blocks.Block {
+		var objs []blocks.Block
+		for i := 0; i < n; i++ {
+			obj := blocks.NewBlock(bytes.Repeat([]byte{byte(i)}, 100))
+			require.NoError(t, bs.Put(obj))
+			objs = append(objs, obj)
+		}
+		return objs
+	}
+	// cached returns true if obj is served by the cache alone: it is
+	// deleted from base, so only the cache can still return it.
+	cached := func(t *testing.T, cache *chain.StateCache, base bstore.Blockstore, obj blocks.Block) bool {
+		require.NoError(t, base.DeleteBlock(obj.Cid()))
+		got, err := cache.Get(obj.Cid())
+		require.NoError(t, base.Put(obj))
+		if err != nil {
+			return false
+		}
+		assert.Equal(t, obj.RawData(), got.RawData())
+		return true
+	}
+
+	t.Run("eviction keeps the cache within its budget", func(t *testing.T) {
+		base := bstore.NewBlockstore(repo.NewInMemoryRepo().Datastore())
+		objs := newObjects(t, base, 10)
+		cache := chain.NewStateCache(base, 350)
+
+		for _, obj := range objs {
+			got, err := cache.Get(obj.Cid())
+			require.NoError(t, err)
+			assert.Equal(t, obj.RawData(), got.RawData())
+			assert.True(t, cache.Size() <= 350)
+		}
+		assert.Equal(t, 300, cache.Size())
+
+		// The three most recently read objects remain, and the evicted
+		// ones are still read through correctly.
+		for i, obj := range objs {
+			assert.Equal(t, i >= 7, cached(t, cache, base, obj), "object %d", i)
+		}
+		for _, obj := range objs {
+			got, err := cache.Get(obj.Cid())
+			require.NoError(t, err)
+			assert.Equal(t, obj.RawData(), got.RawData())
+		}
+	})
+
+	t.Run("recently read objects survive eviction", func(t *testing.T) {
+		base := bstore.NewBlockstore(repo.NewInMemoryRepo().Datastore())
+		objs := newObjects(t, base, 4)
+		cache := chain.NewStateCache(base, 300)
+
+		for _, obj := range objs[:3] {
+			_, err := cache.Get(obj.Cid())
+			require.NoError(t, err)
+		}
+		_, err := cache.Get(objs[0].Cid())
+		require.NoError(t, err)
+		_, err = cache.Get(objs[3].Cid())
+		require.NoError(t, err)
+
+		assert.True(t, cached(t, cache, base, objs[0]))
+		assert.False(t, cached(t, cache, base, objs[1]))
+	})
+
+	t.Run("objects larger than the budget are not cached", func(t *testing.T) {
+		base := bstore.NewBlockstore(repo.NewInMemoryRepo().Datastore())
+		obj := newObjects(t, base, 1)[0]
+		cache := chain.NewStateCache(base, 50)
+
+		_, err := cache.Get(obj.Cid())
+		require.NoError(t, err)
+		assert.Equal(t, 0, cache.Size())
+	})
+
+	t.Run("memory pressure shrinks the cache", func(t *testing.T) {
+		base := bstore.NewBlockstore(repo.NewInMemoryRepo().Datastore())
+		objs := newObjects(t, base, 4)
+		cache := chain.NewStateCache(base, 400)
+		for _, obj := range objs {
+			_, err := cache.Get(obj.Cid())
+			require.NoError(t, err)
+		}
+		require.Equal(t, 400, cache.Size())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		pressure := make(chan struct{})
+		cache.ShrinkOnPressure(ctx, pressure)
+		// The second signal is only received once the first has been
+		// handled.
+		pressure <- struct{}{}
+		pressure <- struct{}{}
+		assert.Equal(t, 200, cache.Size())
+		assert.True(t, cached(t, cache, base, objs[3]))
+		assert.False(t, cached(t, cache, base, objs[0]))
+	})
+}
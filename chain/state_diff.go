@@ -0,0 +1,36 @@
+package chain
+
+import (
+	"context"
+
+	"github.com/ipfs/go-hamt-ipld"
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/actor"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/state"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// StateDiff returns the actors added or modified by the state of the tipset
+// with key toKey relative to the state of the tipset with key fromKey, and
+// the addresses of the actors it removed.  An empty key resolves to the
+// store's head.  Subtrees the two states share are not walked, so diffing the
+// states of adjacent tipsets is cheap.  See state.DiffStateRoots.
+func StateDiff(ctx context.Context, store latestStateChainReader, stateStore *hamt.CborIpldStore, fromKey, toKey types.SortedCidSet) (changed map[address.Address]*actor.Actor, removed []address.Address, err error) {
+	if fromKey.Len() == 0 {
+		fromKey = store.GetHead()
+	}
+	if toKey.Len() == 0 {
+		toKey = store.GetHead()
+	}
+	fromRoot, err := store.GetTipSetStateRoot(fromKey)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to load state root of tipset %s", fromKey.String())
+	}
+	toRoot, err := store.GetTipSetStateRoot(toKey)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to load state root of tipset %s", toKey.String())
+	}
+	return state.DiffStateRoots(ctx, stateStore, fromRoot, toRoot)
+}
@@ -0,0 +1,102 @@
+package chain_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-hamt-ipld"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/actor"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/repo"
+	th "github.com/filecoin-project/go-filecoin/testhelpers"
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestStateDiff(t *testing.T) {
+	tf.UnitTest(t)
+	ctx := context.Background()
+
+	// Enough actors that the state tree has subtrees to skip.
+	addrGetter := address.NewForTestGetter()
+	acts := make(map[address.Address]*actor.Actor)
+	var addrs []address.Address
+	for i := 0; i < 50; i++ {
+		addr := addrGetter()
+		addrs = append(addrs, addr)
+		acts[addr] = th.RequireNewAccountActor(t, types.NewAttoFILFromFIL(100))
+	}
+
+	// mkStore returns a store holding a genesis tipset whose state holds
+	// acts and its child, whose state is the result of applying msg.
+	mkStore := func(t *testing.T, msg *types.Message) (*chain.DefaultStore, *hamt.CborIpldStore, types.TipSet, types.TipSet) {
+		cst := hamt.NewCborStore()
+		genRoot, st := th.RequireMakeStateTree(t, cst, acts)
+		_, err := th.ApplyTestMessage(st, th.VMStorage(), msg, types.NewBlockHeight(1))
+		require.NoError(t, err)
+		childRoot, err := st.Flush(ctx)
+		require.NoError(t, err)
+
+		genesis := types.NewBlockForTest(nil, 0)
+		genesis.StateRoot = genRoot
+		genTS := th.MustNewTipSet(genesis)
+		child := types.NewBlockForTest(genesis, 1)
+		child.StateRoot = childRoot
+		childTS := th.MustNewTipSet(child)
+
+		store := chain.NewDefaultStore(repo.NewInMemoryRepo().ChainDatastore(), genesis.Cid())
+		for _, tsas := range []struct {
+			ts   types.TipSet
+			root cid.Cid
+		}{{genTS, genRoot}, {childTS, childRoot}} {
+			th.RequirePutTsas(ctx, t, store, &chain.TipSetAndState{TipSet: tsas.ts, TipSetStateRoot: tsas.root})
+		}
+		require.NoError(t, store.SetHead(ctx, childTS))
+		return store, cst, genTS, childTS
+	}
+
+	t.Run("a message changes only its sender", func(t *testing.T) {
+		sender, recipient := addrs[0], addrs[1]
+		store, cst, genTS, childTS := mkStore(t, types.NewMessage(sender, recipient, 0, types.ZeroAttoFIL, "", nil))
+
+		changed, removed, err := chain.StateDiff(ctx, store, cst, genTS.ToSortedCidSet(), childTS.ToSortedCidSet())
+		require.NoError(t, err)
+		assert.Empty(t, removed)
+		require.Len(t, changed, 1)
+		require.Contains(t, changed, sender)
+		assert.Equal(t, types.Uint64(1), changed[sender].Nonce)
+	})
+
+	t.Run("new actors are added and removed", func(t *testing.T) {
+		sender, newAddr := addrs[0], addrGetter()
+		store, cst, genTS, childTS := mkStore(t, types.NewMessage(sender, newAddr, 0, types.NewAttoFILFromFIL(1), "", nil))
+
+		changed, removed, err := chain.StateDiff(ctx, store, cst, genTS.ToSortedCidSet(), types.SortedCidSet{})
+		require.NoError(t, err)
+		assert.Empty(t, removed)
+		assert.Len(t, changed, 2)
+		assert.Contains(t, changed, sender)
+		require.Contains(t, changed, newAddr)
+		assert.Equal(t, types.NewAttoFILFromFIL(1), changed[newAddr].Balance)
+
+		changed, removed, err = chain.StateDiff(ctx, store, cst, childTS.ToSortedCidSet(), genTS.ToSortedCidSet())
+		require.NoError(t, err)
+		assert.Equal(t, []address.Address{newAddr}, removed)
+		assert.Len(t, changed, 1)
+		assert.Contains(t, changed, sender)
+	})
+
+	t.Run("identical states do not differ", func(t *testing.T) {
+		store, cst, _, childTS := mkStore(t, types.NewMessage(addrs[0], addrs[1], 0, types.ZeroAttoFIL, "", nil))
+
+		changed, removed, err := chain.StateDiff(ctx, store, cst, childTS.ToSortedCidSet(), childTS.ToSortedCidSet())
+		require.NoError(t, err)
+		assert.Empty(t, changed)
+		assert.Empty(t, removed)
+	})
+}
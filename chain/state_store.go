@@ -0,0 +1,36 @@
+package chain
+
+import (
+	"context"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-hamt-ipld"
+
+	"github.com/filecoin-project/go-filecoin/actor/builtin"
+	"github.com/filecoin-project/go-filecoin/state"
+)
+
+// StateStore provides the state trees the syncer validates tipsets against.
+// It is independent of where blocks are stored so that state, which can be
+// pruned, may live on different storage than the chain.  The state trees it
+// returns must write to the same store that consensus reads state from.
+type StateStore interface {
+	LoadStateTree(ctx context.Context, root cid.Cid) (state.Tree, error)
+}
+
+// CborStateStore is a StateStore backed by a cbor ipld store.
+type CborStateStore struct {
+	cst *hamt.CborIpldStore
+}
+
+var _ StateStore = (*CborStateStore)(nil)
+
+// NewCborStateStore returns a StateStore reading and writing state in cst.
+func NewCborStateStore(cst *hamt.CborIpldStore) *CborStateStore {
+	return &CborStateStore{cst: cst}
+}
+
+// LoadStateTree loads the state tree with the given root.
+func (s *CborStateStore) LoadStateTree(ctx context.Context, root cid.Cid) (state.Tree, error) {
+	return state.LoadStateTree(ctx, s.cst, root, builtin.Actors)
+}
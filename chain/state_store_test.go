@@ -0,0 +1,74 @@
+package chain_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-hamt-ipld"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/consensus"
+	"github.com/filecoin-project/go-filecoin/proofs"
+	"github.com/filecoin-project/go-filecoin/repo"
+	"github.com/filecoin-project/go-filecoin/state"
+	th "github.com/filecoin-project/go-filecoin/testhelpers"
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// recordingStateStore records the roots of the state trees loaded from it.
+type recordingStateStore struct {
+	chain.StateStore
+	roots []cid.Cid
+}
+
+func (s *recordingStateStore) LoadStateTree(ctx context.Context, root cid.Cid) (state.Tree, error) {
+	s.roots = append(s.roots, root)
+	return s.StateStore.LoadStateTree(ctx, root)
+}
+
+func TestSyncerStateStoreRouting(t *testing.T) {
+	tf.UnitTest(t)
+	ctx := context.Background()
+	dstP := initDSTParams()
+
+	// State lives in its own in-memory store, blocks in the repo.
+	r := repo.NewInMemoryRepo()
+	bs := bstore.NewBlockstore(r.Datastore())
+	stateCst := hamt.NewCborStore()
+	con := consensus.NewExpected(stateCst, bs, th.NewTestProcessor(), &th.TestView{}, dstP.genCid, proofs.NewFakeVerifier(true, nil))
+	requireSetTestChain(t, con, false, dstP)
+	_, err := initGenesis(dstP.minerAddress, dstP.minerOwnerAddress, dstP.minerPeerID, stateCst, bs)
+	require.NoError(t, err)
+
+	chainStore := chain.NewDefaultStore(r.ChainDatastore(), dstP.genCid)
+	th.RequirePutTsas(ctx, t, chainStore, &chain.TipSetAndState{TipSet: dstP.genTS, TipSetStateRoot: dstP.genStateRoot})
+	require.NoError(t, chainStore.SetHead(ctx, dstP.genTS))
+
+	stateStore := &recordingStateStore{StateStore: chain.NewCborStateStore(stateCst)}
+	blockSource := th.NewTestFetcher()
+	syncer := chain.NewDefaultSyncer(stateStore, con, chainStore, blockSource)
+
+	cids1 := requirePutBlocks(t, blockSource, dstP.link1.ToSlice()...)
+	require.NoError(t, syncer.HandleNewTipset(ctx, cids1))
+	assertHead(t, chainStore, dstP.link1)
+
+	// Parent state was read from the state store.
+	assert.Contains(t, stateStore.roots, dstP.genStateRoot)
+
+	// Blocks went to the chain store and not the state store.
+	for _, blk := range dstP.link1.ToSlice() {
+		assert.True(t, chainStore.HasBlock(ctx, blk.Cid()))
+		var out types.Block
+		assert.Error(t, stateCst.Get(ctx, blk.Cid(), &out))
+	}
+
+	// State did not go to the chain store.
+	has, err := bstore.NewBlockstore(r.ChainDatastore()).Has(dstP.genStateRoot)
+	require.NoError(t, err)
+	assert.False(t, has)
+}
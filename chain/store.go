@@ -3,16 +3,12 @@ package chain
 import (
 	"context"
 
-	"github.com/cskr/pubsub"
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-datastore"
 
 	"github.com/filecoin-project/go-filecoin/types"
 )
 
-// NewHeadTopic is the topic used to publish new heads.
-const NewHeadTopic = "new-head"
-
 // GenesisKey is the key at which the genesis Cid is written in the datastore.
 var GenesisKey = datastore.NewKey("/consensus/genesisCid")
 
@@ -39,7 +35,6 @@ type ReadStore interface {
 	// GetBlock gets a block by cid.
 	GetBlock(ctx context.Context, id cid.Cid) (*types.Block, error)
 
-	HeadEvents() *pubsub.PubSub
 	// GetHead returns the head of the chain tracked by the store.
 	GetHead() types.SortedCidSet
 
@@ -63,12 +58,17 @@ type Store interface {
 	// PutTipSet adds a tipset to the store.  This persists blocks to disk and
 	// updates the tips index.
 	PutTipSetAndState(ctx context.Context, tsas *TipSetAndState) error
+	// PutTipSetAndStates adds many tipsets to the store at once.  Either all
+	// or none of the tipsets are added to the tips index.
+	PutTipSetAndStates(ctx context.Context, tsass []*TipSetAndState) error
 	// HasTipSet indicates whether the tipset is in the store.
 	HasTipSetAndState(ctx context.Context, tsKey string) bool
 	// GetTipSetsByParentsAndHeight returns all tipsets with the given parent set and the given height
 	GetTipSetAndStatesByParentsAndHeight(pTsKey string, h uint64) ([]*TipSetAndState, error)
 	// HasTipSetsWithParentsAndHeight indicates whether tipsets with these parents and this height are in the store.
 	HasTipSetAndStatesWithParentsAndHeight(pTsKey string, h uint64) bool
+	// GetTipSetsByHeight returns all tipsets at the given height, on any fork.
+	GetTipSetsByHeight(h uint64) ([]*types.TipSet, error)
 
 	// GetBlocks gets several blocks by cid. In the future there is caching here
 	GetBlocks(ctx context.Context, cids types.SortedCidSet) ([]*types.Block, error)
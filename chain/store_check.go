@@ -0,0 +1,204 @@
+package chain
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// StoreCheckResult reports the outcome of checking a DefaultStore's
+// persisted chain.
+type StoreCheckResult struct {
+	// Head is the persisted head that was checked.  It is empty if the
+	// head could not be read.
+	Head types.SortedCidSet
+	// TipSetsChecked is the number of tipsets verified walking back from
+	// the head.
+	TipSetsChecked int
+	// Err is the first inconsistency found, nil if the store is consistent.
+	Err error
+	// RepairedHead is the head the store was reset to by a repair.  It is
+	// empty if no repair was made.
+	RepairedHead types.SortedCidSet
+}
+
+// Consistent returns true if the check found no inconsistency.
+func (r *StoreCheckResult) Consistent() bool {
+	return r.Err == nil
+}
+
+// Check verifies that the persisted head links back to the genesis block
+// through tipsets whose blocks and state roots are all present, as Load
+// requires.  Check does not modify the store unless repair is true and the
+// chain is broken, in which case the persisted head is reset to the highest
+// stored tipset with an intact chain to genesis.  Check must be called before
+// Load.  It returns an error only if the check itself fails, including when a
+// requested repair finds no intact tipset.
+func (store *DefaultStore) Check(ctx context.Context, repair bool) (*StoreCheckResult, error) {
+	result := &StoreCheckResult{}
+	head, err := store.loadHead()
+	if err != nil {
+		result.Err = err
+	} else {
+		result.Head = head
+		result.TipSetsChecked, result.Err = store.checkChain(ctx, head)
+	}
+	if result.Consistent() || !repair {
+		return result, nil
+	}
+
+	repaired, err := store.findIntactHead(ctx)
+	if err != nil {
+		return result, errors.Wrap(err, "failed to repair store")
+	}
+	if err := store.writeHead(ctx, repaired); err != nil {
+		return result, errors.Wrap(err, "failed to write repaired head")
+	}
+	result.RepairedHead = repaired
+	return result, nil
+}
+
+// checkChain verifies the chain from the tipset with key head back to
+// genesis.  It returns the number of tipsets verified.
+func (store *DefaultStore) checkChain(ctx context.Context, head types.SortedCidSet) (int, error) {
+	blks, err := store.GetBlocks(ctx, head)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to load head %s", head.String())
+	}
+	headTs, err := types.NewTipSet(blks...)
+	if err != nil {
+		return 0, err
+	}
+
+	var checked int
+	var genesii types.TipSet
+	for it := IterAncestors(ctx, store, headTs); !it.Complete(); err = it.Next() {
+		if err != nil {
+			return checked, err
+		}
+		if _, _, err := store.loadTipSetState(it.Value()); err != nil {
+			return checked, err
+		}
+		checked++
+		genesii = it.Value()
+	}
+	if err != nil {
+		return checked, err
+	}
+
+	if len(genesii) != 1 || !genesii.ToSlice()[0].Cid().Equals(store.genesis) {
+		return checked, errors.Errorf("chain does not link to genesis %s", store.genesis)
+	}
+	return checked, nil
+}
+
+// findIntactHead returns the key of the highest tipset with a stored state
+// root whose chain to genesis is intact.  It checks each stored tipset once,
+// lowest first, so that a tipset's chain is intact if the tipset is and its
+// parent's chain is.
+func (store *DefaultStore) findIntactHead(ctx context.Context) (types.SortedCidSet, error) {
+	results, err := store.ds.Query(query.Query{Prefix: "/p-", KeysOnly: true})
+	if err != nil {
+		return types.SortedCidSet{}, errors.Wrap(err, "failed to query stored tipsets")
+	}
+	entries, err := results.Rest()
+	if err != nil {
+		return types.SortedCidSet{}, errors.Wrap(err, "failed to query stored tipsets")
+	}
+
+	type candidate struct {
+		key    types.SortedCidSet
+		height uint64
+	}
+	var candidates []candidate
+	for _, e := range entries {
+		key, h, err := parseTipSetAndStateKey(e.Key)
+		if err != nil {
+			logStore.Warningf("skipping unparseable tipset entry %s: %s", e.Key, err)
+			continue
+		}
+		candidates = append(candidates, candidate{key: key, height: h})
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].height != candidates[j].height {
+			return candidates[i].height < candidates[j].height
+		}
+		return candidates[i].key.String() > candidates[j].key.String()
+	})
+
+	intact := make(map[string]bool, len(candidates))
+	var best types.SortedCidSet
+	for _, c := range candidates {
+		ok, err := store.isIntact(ctx, c.key, intact)
+		if err != nil {
+			logStore.Debugf("stored tipset %s is broken: %s", c.key.String(), err)
+		}
+		if ok {
+			intact[c.key.String()] = true
+			best = c.key
+		}
+	}
+	if best.Len() == 0 {
+		return types.SortedCidSet{}, errors.New("no stored tipset links to genesis")
+	}
+	return best, nil
+}
+
+// isIntact returns true if the tipset with key tsKey has its blocks and state
+// root stored and is either the genesis tipset or a child of a tipset in
+// intact, which holds the keys of the tipsets already found intact.
+func (store *DefaultStore) isIntact(ctx context.Context, tsKey types.SortedCidSet, intact map[string]bool) (bool, error) {
+	blks, err := store.GetBlocks(ctx, tsKey)
+	if err != nil {
+		return false, err
+	}
+	ts, err := types.NewTipSet(blks...)
+	if err != nil {
+		return false, err
+	}
+	if _, _, err := store.loadTipSetState(ts); err != nil {
+		return false, err
+	}
+	parents, err := ts.Parents()
+	if err != nil {
+		return false, err
+	}
+	if parents.Len() == 0 {
+		return len(blks) == 1 && blks[0].Cid().Equals(store.genesis), nil
+	}
+	return intact[parents.String()], nil
+}
+
+// parseTipSetAndStateKey parses a datastore key written by
+// tipSetAndStateEntry into the tipset key and height.
+func parseTipSetAndStateKey(k string) (types.SortedCidSet, uint64, error) {
+	k = strings.TrimPrefix(k, "/p-")
+	i := strings.LastIndex(k, " h-")
+	if i < 0 {
+		return types.SortedCidSet{}, 0, errors.New("missing height")
+	}
+	h, err := strconv.ParseUint(k[i+len(" h-"):], 10, 64)
+	if err != nil {
+		return types.SortedCidSet{}, 0, err
+	}
+
+	var key types.SortedCidSet
+	for _, f := range strings.Fields(strings.Trim(k[:i], "{}")) {
+		c, err := cid.Decode(f)
+		if err != nil {
+			return types.SortedCidSet{}, 0, err
+		}
+		key.Add(c)
+	}
+	if key.Len() == 0 {
+		return types.SortedCidSet{}, 0, errors.New("empty tipset key")
+	}
+	return key, h, nil
+}
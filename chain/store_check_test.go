@@ -0,0 +1,78 @@
+package chain_test
+
+import (
+	"context"
+	"testing"
+
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/repo"
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+)
+
+func TestStoreCheck(t *testing.T) {
+	tf.UnitTest(t)
+	dstP := initDSTParams()
+
+	ctx := context.Background()
+	initStoreTest(ctx, t, dstP)
+
+	// newStoredChain returns a datastore holding the test chain with head
+	// link4.
+	newStoredChain := func(t *testing.T) repo.Datastore {
+		ds := repo.NewInMemoryRepo().Datastore()
+		chainStore := chain.NewDefaultStore(ds, dstP.genCid)
+		requirePutTestChain(t, chainStore, dstP)
+		assertSetHead(t, chainStore, dstP.link4)
+		chainStore.Stop()
+		return ds
+	}
+
+	t.Run("consistent store passes", func(t *testing.T) {
+		ds := newStoredChain(t)
+
+		result, err := chain.NewDefaultStore(ds, dstP.genCid).Check(ctx, false)
+		require.NoError(t, err)
+		assert.True(t, result.Consistent())
+		assert.Equal(t, dstP.link4.ToSortedCidSet(), result.Head)
+		assert.Equal(t, 5, result.TipSetsChecked)
+		assert.Equal(t, 0, result.RepairedHead.Len())
+	})
+
+	t.Run("check without repair reports corruption", func(t *testing.T) {
+		ds := newStoredChain(t)
+		require.NoError(t, bstore.NewBlockstore(ds).DeleteBlock(dstP.link3blk1.Cid()))
+
+		result, err := chain.NewDefaultStore(ds, dstP.genCid).Check(ctx, false)
+		require.NoError(t, err)
+		assert.False(t, result.Consistent())
+		assert.Equal(t, 0, result.RepairedHead.Len())
+
+		assert.Error(t, chain.NewDefaultStore(ds, dstP.genCid).Load(ctx))
+	})
+
+	t.Run("repair resets head to highest intact tipset", func(t *testing.T) {
+		ds := newStoredChain(t)
+		require.NoError(t, bstore.NewBlockstore(ds).DeleteBlock(dstP.link3blk1.Cid()))
+
+		result, err := chain.NewDefaultStore(ds, dstP.genCid).Check(ctx, true)
+		require.NoError(t, err)
+		assert.False(t, result.Consistent())
+		assert.Equal(t, dstP.link2.ToSortedCidSet(), result.RepairedHead)
+
+		rebooted := chain.NewDefaultStore(ds, dstP.genCid)
+		require.NoError(t, rebooted.Load(ctx))
+		assert.Equal(t, dstP.link2.ToSortedCidSet(), rebooted.GetHead())
+	})
+
+	t.Run("repair fails without an intact chain", func(t *testing.T) {
+		ds := newStoredChain(t)
+		require.NoError(t, bstore.NewBlockstore(ds).DeleteBlock(dstP.genesis.Cid()))
+
+		_, err := chain.NewDefaultStore(ds, dstP.genCid).Check(ctx, true)
+		assert.Error(t, err)
+	})
+}
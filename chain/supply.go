@@ -0,0 +1,58 @@
+package chain
+
+import (
+	"context"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-hamt-ipld"
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/actor"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// supplyCacheSize bounds the number of state roots whose total supply a
+// store caches.
+const supplyCacheSize = 256
+
+// TotalSupply returns the sum of the balances of every actor in the state of
+// the tipset with the input key, or in the head state if the key is empty.
+// Summing walks the whole state tree, so the store caches totals by state
+// root and tipsets sharing a state root are summed once.  The returned value
+// is the caller's to modify.
+func (store *DefaultStore) TotalSupply(ctx context.Context, stateStore *hamt.CborIpldStore, tsKey types.SortedCidSet) (*types.AttoFIL, error) {
+	if tsKey.Len() == 0 {
+		tsKey = store.GetHead()
+	}
+	root, err := store.GetTipSetStateRoot(tsKey)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load state root of tipset %s", tsKey.String())
+	}
+
+	store.supplyMu.Lock()
+	total, ok := store.supplyTotals[root]
+	store.supplyMu.Unlock()
+	if ok {
+		return types.NewZeroAttoFIL().Add(total), nil
+	}
+
+	total = types.NewZeroAttoFIL()
+	err = ForEachActor(ctx, store, stateStore, tsKey, func(_ address.Address, act *actor.Actor) error {
+		total = total.Add(act.Balance)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	store.supplyMu.Lock()
+	defer store.supplyMu.Unlock()
+	if store.supplyTotals == nil || len(store.supplyTotals) >= supplyCacheSize {
+		// Totals are cheap to recompute relative to the cost of tracking
+		// recency, so start afresh.
+		store.supplyTotals = make(map[cid.Cid]*types.AttoFIL)
+	}
+	store.supplyTotals[root] = total
+	return types.NewZeroAttoFIL().Add(total), nil
+}
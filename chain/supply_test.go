@@ -0,0 +1,59 @@
+package chain_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipfs/go-hamt-ipld"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/consensus"
+	"github.com/filecoin-project/go-filecoin/repo"
+	th "github.com/filecoin-project/go-filecoin/testhelpers"
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestTotalSupply(t *testing.T) {
+	tf.UnitTest(t)
+
+	ctx := context.Background()
+	r := repo.NewInMemoryRepo()
+	bs := bstore.NewBlockstore(r.Datastore())
+	cst := hamt.NewCborStore()
+	addrGetter := address.NewForTestGetter()
+	genesis, err := consensus.MakeGenesisFunc(
+		consensus.ActorAccount(addrGetter(), types.NewAttoFILFromFIL(1234)),
+	)(cst, bs)
+	require.NoError(t, err)
+	genTS := th.RequireNewTipSet(t, genesis)
+	store := chain.NewDefaultStore(r.ChainDatastore(), genesis.Cid())
+	th.RequirePutTsas(ctx, t, store, &chain.TipSetAndState{TipSet: genTS, TipSetStateRoot: genesis.StateRoot})
+	require.NoError(t, store.SetHead(ctx, genTS))
+
+	// The funded account plus the network, test and builtin actors.
+	expected := types.NewAttoFILFromFIL(10000000000 + 50000 + 60000 + 1234)
+
+	supply, err := store.TotalSupply(ctx, cst, types.SortedCidSet{})
+	require.NoError(t, err)
+	assert.True(t, expected.Equal(supply), "supply %s", supply)
+
+	// A repeat call is served from the cache without reading state, so it
+	// succeeds even against a store holding no state at all.
+	cached, err := store.TotalSupply(ctx, hamt.NewCborStore(), genTS.ToSortedCidSet())
+	require.NoError(t, err)
+	assert.True(t, expected.Equal(cached), "supply %s", cached)
+
+	// Callers get their own copy of a cached total.
+	*cached = *cached.Add(types.NewAttoFILFromFIL(1))
+	again, err := store.TotalSupply(ctx, hamt.NewCborStore(), genTS.ToSortedCidSet())
+	require.NoError(t, err)
+	assert.True(t, expected.Equal(again), "supply %s", again)
+
+	_, err = store.TotalSupply(ctx, cst, types.NewSortedCidSet(types.SomeCid()))
+	assert.Error(t, err)
+}
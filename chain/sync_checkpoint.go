@@ -0,0 +1,205 @@
+package chain
+
+import (
+	"encoding/json"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/repo"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// ErrSyncIncomplete is returned by HandleNewTipset when it stops walking a
+// chain at the syncer's per call block cap.  The walk is checkpointed, so
+// syncing the same head again, or a head descending from it, resumes where
+// the walk stopped.
+var ErrSyncIncomplete = errors.New("sync stopped at the block cap, sync again to resume")
+
+// MaxBlocksPerSync configures the syncer to fetch at most maxBlocks blocks in
+// one call to HandleNewTipset, so that syncing a long chain does not hold the
+// syncer for the whole chain at once.  A call that reaches the cap records
+// the key and height of each tipset it walked in a checkpoint and returns
+// ErrSyncIncomplete, and the next call walking into the checkpointed tipsets
+// continues from the oldest of them rather than fetching them again.  The
+// tipsets of a chain are validated once the walk reaches the store, streamed
+// as by StreamChain.  Only the latest checkpoint is kept, in memory unless
+// persisted with CheckpointTo.  A tipset with more blocks than the cap is
+// still fetched, alone.  A maxBlocks of zero or less disables the cap.
+func MaxBlocksPerSync(maxBlocks int) SyncerOpt {
+	return func(syncer *DefaultSyncer) {
+		syncer.maxBlocksPerSync = maxBlocks
+	}
+}
+
+// checkpointKey is the datastore key under which a DatastoreCheckpointStore
+// keeps the checkpoint.
+var checkpointKey = datastore.NewKey("/chain/syncCheckpoint")
+
+// SyncCheckpoint is the persisted form of a walk stopped at the block cap.
+type SyncCheckpoint struct {
+	// Links identifies the tipsets walked, head first.
+	Links []CheckpointLink `json:"links"`
+	// Frontier is the key of the next tipset to fetch.
+	Frontier types.SortedCidSet `json:"frontier"`
+}
+
+// CheckpointLink identifies a tipset walked by a checkpointed walk.
+type CheckpointLink struct {
+	Key    types.SortedCidSet `json:"key"`
+	Height uint64             `json:"height"`
+}
+
+// CheckpointStore persists the syncer's checkpoint so that a capped walk
+// resumes after a restart.
+type CheckpointStore interface {
+	// Save replaces the stored checkpoint with cp.
+	Save(cp SyncCheckpoint) error
+	// Load returns the stored checkpoint, and false if there is none.
+	Load() (SyncCheckpoint, bool, error)
+	// Clear removes the stored checkpoint, if any.
+	Clear() error
+}
+
+// CheckpointTo configures the syncer to persist its checkpoint with store,
+// and resumes from the checkpoint store holds, if any.  Failures to persist a
+// checkpoint are logged and otherwise ignored, as a lost checkpoint only costs
+// fetching the walked tipsets again.  It only has an effect with
+// MaxBlocksPerSync.
+func CheckpointTo(store CheckpointStore) SyncerOpt {
+	return func(syncer *DefaultSyncer) {
+		syncer.checkpointStore = store
+		cp, ok, err := store.Load()
+		if err != nil {
+			logSyncer.Warningf("failed to load sync checkpoint: %s", err)
+			return
+		}
+		if ok {
+			syncer.checkpoint = importCheckpoint(cp)
+		}
+	}
+}
+
+// DatastoreCheckpointStore is a CheckpointStore keeping the checkpoint in a
+// datastore under a reserved key.
+type DatastoreCheckpointStore struct {
+	ds repo.Datastore
+}
+
+var _ CheckpointStore = (*DatastoreCheckpointStore)(nil)
+
+// NewDatastoreCheckpointStore returns a DatastoreCheckpointStore keeping the
+// checkpoint in ds.
+func NewDatastoreCheckpointStore(ds repo.Datastore) *DatastoreCheckpointStore {
+	return &DatastoreCheckpointStore{ds: ds}
+}
+
+// Save replaces the stored checkpoint with cp.
+func (s *DatastoreCheckpointStore) Save(cp SyncCheckpoint) error {
+	val, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	return s.ds.Put(checkpointKey, val)
+}
+
+// Load returns the stored checkpoint, and false if there is none.
+func (s *DatastoreCheckpointStore) Load() (SyncCheckpoint, bool, error) {
+	val, err := s.ds.Get(checkpointKey)
+	if err == datastore.ErrNotFound {
+		return SyncCheckpoint{}, false, nil
+	}
+	if err != nil {
+		return SyncCheckpoint{}, false, err
+	}
+	var cp SyncCheckpoint
+	if err := json.Unmarshal(val, &cp); err != nil {
+		return SyncCheckpoint{}, false, errors.Wrap(err, "failed to decode sync checkpoint")
+	}
+	return cp, true, nil
+}
+
+// Clear removes the stored checkpoint, if any.
+func (s *DatastoreCheckpointStore) Clear() error {
+	err := s.ds.Delete(checkpointKey)
+	if err == datastore.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+// syncCheckpoint records a walk stopped at the block cap.
+type syncCheckpoint struct {
+	// links identifies the tipsets walked, head first.
+	links []tipSetLink
+	// index maps the key of each tipset walked to its position in links.
+	index map[string]int
+	// frontier is the key of the parent of the last tipset walked, the next
+	// tipset to fetch.
+	frontier types.SortedCidSet
+}
+
+// newSyncCheckpoint returns a checkpoint of the walk that fetched the tipsets
+// identified by links, head first, and would fetch frontier next.
+func newSyncCheckpoint(links []tipSetLink, frontier types.SortedCidSet) *syncCheckpoint {
+	index := make(map[string]int, len(links))
+	for i, link := range links {
+		index[link.key.String()] = i
+	}
+	return &syncCheckpoint{
+		links:    links,
+		index:    index,
+		frontier: frontier,
+	}
+}
+
+// importCheckpoint returns the checkpoint persisted as cp.
+func importCheckpoint(cp SyncCheckpoint) *syncCheckpoint {
+	links := make([]tipSetLink, len(cp.Links))
+	for i, link := range cp.Links {
+		links[i] = tipSetLink{key: link.Key, height: link.Height}
+	}
+	return newSyncCheckpoint(links, cp.Frontier)
+}
+
+// export returns the persisted form of cp.
+func (cp *syncCheckpoint) export() SyncCheckpoint {
+	links := make([]CheckpointLink, len(cp.links))
+	for i, link := range cp.links {
+		links[i] = CheckpointLink{Key: link.key, Height: link.height}
+	}
+	return SyncCheckpoint{Links: links, Frontier: cp.frontier}
+}
+
+// setCheckpoint replaces the syncer's checkpoint with cp, which may be nil,
+// and persists it if the syncer has a checkpoint store.  The caller must hold
+// syncer.mu.
+func (syncer *DefaultSyncer) setCheckpoint(cp *syncCheckpoint) {
+	syncer.checkpoint = cp
+	if syncer.checkpointStore == nil {
+		return
+	}
+	var err error
+	if cp == nil {
+		err = syncer.checkpointStore.Clear()
+	} else {
+		err = syncer.checkpointStore.Save(cp.export())
+	}
+	if err != nil {
+		logSyncer.Warningf("failed to persist sync checkpoint: %s", err)
+	}
+}
+
+// resume returns the links of the checkpointed walk from the tipset with key
+// tsKey on, and the key of the tipset to fetch after them, if the checkpoint
+// walked that tipset.  A nil checkpoint walked nothing.
+func (cp *syncCheckpoint) resume(tsKey string) ([]tipSetLink, types.SortedCidSet, bool) {
+	if cp == nil {
+		return nil, types.SortedCidSet{}, false
+	}
+	i, ok := cp.index[tsKey]
+	if !ok {
+		return nil, types.SortedCidSet{}, false
+	}
+	return cp.links[i:], cp.frontier, true
+}
@@ -0,0 +1,172 @@
+package chain_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/chain/synctest"
+	"github.com/filecoin-project/go-filecoin/repo"
+	th "github.com/filecoin-project/go-filecoin/testhelpers"
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestMaxBlocksPerSync(t *testing.T) {
+	tf.UnitTest(t)
+
+	t.Run("syncs a long chain across calls", func(t *testing.T) {
+		fetched := 0
+		h := synctest.NewHarness(t,
+			chain.MaxBlocksPerSync(3),
+			chain.ObserveBlocks(func(cid.Cid, int, bool) { fetched++ }),
+		)
+		h.Build(synctest.Linear("link", "", 10)...)
+
+		calls := 0
+		for {
+			fetched = 0
+			calls++
+			require.True(t, calls <= 4, "sync did not finish")
+			err := h.Sync("link10")
+			assert.True(t, fetched <= 3, "call %d fetched %d blocks", calls, fetched)
+			if err == nil {
+				break
+			}
+			require.Equal(t, chain.ErrSyncIncomplete, errors.Cause(err))
+			h.RequireHead(synctest.GenesisName)
+		}
+		// Each block is fetched once: 3 + 3 + 3 + 1.
+		assert.Equal(t, 4, calls)
+		h.RequireHead("link10")
+	})
+
+	t.Run("a new head resumes the checkpoint", func(t *testing.T) {
+		fetched := 0
+		h := synctest.NewHarness(t,
+			chain.MaxBlocksPerSync(4),
+			chain.ObserveBlocks(func(cid.Cid, int, bool) { fetched++ }),
+		)
+		h.Build(synctest.Linear("link", "", 7)...)
+
+		err := h.Sync("link5")
+		require.Equal(t, chain.ErrSyncIncomplete, errors.Cause(err))
+		assert.Equal(t, 4, fetched)
+
+		// The walk from link7 fetches link7 and link6, then picks up the
+		// checkpoint and fetches only link1 below it.
+		fetched = 0
+		h.RequireSync("link7")
+		assert.Equal(t, 3, fetched)
+		h.RequireHead("link7")
+	})
+}
+
+// memCheckpointStore is a CheckpointStore holding the checkpoint in memory.
+type memCheckpointStore struct {
+	cp *chain.SyncCheckpoint
+}
+
+func (s *memCheckpointStore) Save(cp chain.SyncCheckpoint) error {
+	s.cp = &cp
+	return nil
+}
+
+func (s *memCheckpointStore) Load() (chain.SyncCheckpoint, bool, error) {
+	if s.cp == nil {
+		return chain.SyncCheckpoint{}, false, nil
+	}
+	return *s.cp, true, nil
+}
+
+func (s *memCheckpointStore) Clear() error {
+	s.cp = nil
+	return nil
+}
+
+func TestCheckpointStore(t *testing.T) {
+	tf.UnitTest(t)
+
+	t.Run("a restarted syncer resumes from the stored checkpoint", func(t *testing.T) {
+		store := &memCheckpointStore{}
+		h := synctest.NewHarness(t, chain.MaxBlocksPerSync(3), chain.CheckpointTo(store))
+		h.Build(synctest.Linear("link", "", 7)...)
+
+		err := h.Sync("link7")
+		require.Equal(t, chain.ErrSyncIncomplete, errors.Cause(err))
+		require.NotNil(t, store.cp)
+		assert.Len(t, store.cp.Links, 3)
+		assert.Equal(t, h.TipSet("link4").ToSortedCidSet(), store.cp.Frontier)
+
+		// A new syncer over the same chain store picks up the walk: it
+		// fetches only the tipsets below the checkpoint.
+		fetched := 0
+		syncer := chain.NewDefaultSyncer(h.StateStore, h.Consensus, h.Store, h.Fetcher,
+			chain.MaxBlocksPerSync(10),
+			chain.CheckpointTo(store),
+			chain.ObserveBlocks(func(cid.Cid, int, bool) { fetched++ }),
+		)
+		require.NoError(t, syncer.HandleNewTipset(context.Background(), h.TipSet("link7").ToSortedCidSet()))
+		assert.Equal(t, 4, fetched)
+		h.RequireHead("link7")
+		assert.Nil(t, store.cp)
+	})
+
+	t.Run("a failed walk clears the checkpoint", func(t *testing.T) {
+		store := &memCheckpointStore{}
+		h := synctest.NewHarness(t)
+		h.Build(synctest.Linear("link", "", 6)...)
+
+		// The fetcher cannot serve the blocks below link4.
+		fetcher := th.NewTestFetcher()
+		for _, name := range []string{"link4", "link5", "link6"} {
+			fetcher.AddSourceBlocks(h.TipSet(name).ToSlice()...)
+		}
+		syncer := chain.NewDefaultSyncer(h.StateStore, h.Consensus, h.Store, fetcher,
+			chain.MaxBlocksPerSync(2),
+			chain.CheckpointTo(store),
+		)
+		ctx := context.Background()
+		head := h.TipSet("link6").ToSortedCidSet()
+
+		err := syncer.HandleNewTipset(ctx, head)
+		require.Equal(t, chain.ErrSyncIncomplete, errors.Cause(err))
+		require.NotNil(t, store.cp)
+
+		err = syncer.HandleNewTipset(ctx, head)
+		require.Error(t, err)
+		assert.NotEqual(t, chain.ErrSyncIncomplete, errors.Cause(err))
+		assert.Nil(t, store.cp)
+	})
+
+	t.Run("the datastore store round trips a checkpoint", func(t *testing.T) {
+		store := chain.NewDatastoreCheckpointStore(repo.NewInMemoryRepo().ChainDatastore())
+		_, ok, err := store.Load()
+		require.NoError(t, err)
+		assert.False(t, ok)
+
+		cp := chain.SyncCheckpoint{
+			Links: []chain.CheckpointLink{
+				{Key: types.NewSortedCidSet(types.SomeCid()), Height: 7},
+				{Key: types.NewSortedCidSet(types.SomeCid()), Height: 6},
+			},
+			Frontier: types.NewSortedCidSet(types.SomeCid()),
+		}
+		require.NoError(t, store.Save(cp))
+		loaded, ok, err := store.Load()
+		require.NoError(t, err)
+		require.True(t, ok)
+		assert.Equal(t, cp, loaded)
+
+		require.NoError(t, store.Clear())
+		_, ok, err = store.Load()
+		require.NoError(t, err)
+		assert.False(t, ok)
+		assert.NoError(t, store.Clear())
+	})
+}
@@ -0,0 +1,99 @@
+package chain
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ipfs/go-cid"
+
+	"github.com/filecoin-project/go-filecoin/metrics"
+	"github.com/filecoin-project/go-filecoin/types"
+	"github.com/filecoin-project/go-filecoin/util/lru"
+)
+
+// syncDedupHistorySize is the number of block cids the syncer remembers
+// having fetched and validated when counting repeated work.
+const syncDedupHistorySize = 8192
+
+var (
+	blocksFetchedCt      = metrics.NewInt64Counter("chain/sync_blocks_fetched", "Number of blocks fetched for the first time during sync")
+	blocksRefetchedCt    = metrics.NewInt64Counter("chain/sync_blocks_refetched", "Number of blocks fetched again during sync")
+	tipSetsValidatedCt   = metrics.NewInt64Counter("chain/sync_tipsets_validated", "Number of tipsets of only new blocks validated during sync")
+	tipSetsRevalidatedCt = metrics.NewInt64Counter("chain/sync_tipsets_revalidated", "Number of tipsets validated during sync that contain already validated blocks")
+)
+
+// SyncDedupStats counts work the syncer did more than once, as happens when
+// widen or a reorg leads it to fetch or validate blocks it already handled.
+type SyncDedupStats struct {
+	// BlocksFetched is the number of blocks fetched for the first time.
+	BlocksFetched uint64
+	// BlocksRefetched is the number of blocks fetched again.
+	BlocksRefetched uint64
+	// TipSetsValidated is the number of tipsets validated whose blocks were
+	// all new.
+	TipSetsValidated uint64
+	// TipSetsRevalidated is the number of tipsets validated that contained
+	// at least one already validated block.
+	TipSetsRevalidated uint64
+}
+
+// syncDedupTracker records which blocks the syncer has fetched and validated
+// to count repeated work.  It remembers a bounded number of recent blocks so
+// counts are a lower bound over long syncs.
+type syncDedupTracker struct {
+	mu        sync.Mutex
+	fetched   *lru.Cache
+	validated *lru.Cache
+	stats     SyncDedupStats
+}
+
+func newSyncDedupTracker(size int) *syncDedupTracker {
+	return &syncDedupTracker{
+		fetched:   lru.New(size),
+		validated: lru.New(size),
+	}
+}
+
+// recordFetch records that the blocks with cids were fetched.
+func (d *syncDedupTracker) recordFetch(ctx context.Context, cids []cid.Cid) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, c := range cids {
+		if _, ok := d.fetched.Get(c.KeyString()); ok {
+			d.stats.BlocksRefetched++
+			blocksRefetchedCt.Inc(ctx, 1)
+			continue
+		}
+		d.fetched.Add(c.KeyString(), struct{}{})
+		d.stats.BlocksFetched++
+		blocksFetchedCt.Inc(ctx, 1)
+	}
+}
+
+// recordValidation records that ts is being validated.
+func (d *syncDedupTracker) recordValidation(ctx context.Context, ts types.TipSet) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	seen := false
+	for c := range ts {
+		if _, ok := d.validated.Get(c.KeyString()); ok {
+			seen = true
+			continue
+		}
+		d.validated.Add(c.KeyString(), struct{}{})
+	}
+	if seen {
+		d.stats.TipSetsRevalidated++
+		tipSetsRevalidatedCt.Inc(ctx, 1)
+		return
+	}
+	d.stats.TipSetsValidated++
+	tipSetsValidatedCt.Inc(ctx, 1)
+}
+
+// Stats returns the counts recorded so far.
+func (d *syncDedupTracker) Stats() SyncDedupStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.stats
+}
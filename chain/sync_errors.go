@@ -0,0 +1,84 @@
+package chain
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// syncErrorHistorySize is the number of recent sync errors the DefaultSyncer
+// retains.
+const syncErrorHistorySize = 16
+
+// SyncError records a failed attempt to sync a tipset.
+type SyncError struct {
+	// Time is when the sync attempt failed.
+	Time time.Time
+	// TipSetKey is the key of the tipset the syncer was asked to sync.
+	TipSetKey string
+	// Err is the error the sync attempt failed with.
+	Err error
+}
+
+// IsTransient returns true if err is a sync failure caused by the
+// infrastructure rather than by the chain being synced, so that the same sync
+// may succeed if tried again: a fetch timeout, a fetch response holding the
+// wrong blocks, a failed chain store write or a failed commit hook.  Such
+// failures do not mark tipsets bad.
+func IsTransient(err error) bool {
+	switch errors.Cause(err) {
+	case ErrFetchTimeout, ErrUnexpectedBlocks, ErrChainStoreWrite, ErrCommitHookFailed:
+		return true
+	default:
+		return false
+	}
+}
+
+// syncErrorRing is a bounded, threadsafe history of sync errors.  Once full,
+// each new error overwrites the oldest.  A ring of size zero records
+// nothing.
+type syncErrorRing struct {
+	mu    sync.Mutex
+	errs  []SyncError
+	next  int
+	count int
+}
+
+func newSyncErrorRing(size int) *syncErrorRing {
+	if size < 0 {
+		size = 0
+	}
+	return &syncErrorRing{
+		errs: make([]SyncError, size),
+	}
+}
+
+// Add records a sync error.
+func (r *syncErrorRing) Add(se SyncError) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.errs) == 0 {
+		return
+	}
+	r.errs[r.next] = se
+	r.next = (r.next + 1) % len(r.errs)
+	if r.count < len(r.errs) {
+		r.count++
+	}
+}
+
+// List returns the recorded errors, oldest first.
+func (r *syncErrorRing) List() []SyncError {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.errs) == 0 {
+		return nil
+	}
+	out := make([]SyncError, 0, r.count)
+	start := (r.next - r.count + len(r.errs)) % len(r.errs)
+	for i := 0; i < r.count; i++ {
+		out = append(out, r.errs[(start+i)%len(r.errs)])
+	}
+	return out
+}
@@ -0,0 +1,38 @@
+package chain
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+)
+
+func TestSyncErrorRingBounded(t *testing.T) {
+	tf.UnitTest(t)
+
+	ring := newSyncErrorRing(3)
+	assert.Empty(t, ring.List())
+
+	for i := 0; i < 5; i++ {
+		ring.Add(SyncError{TipSetKey: fmt.Sprintf("ts%d", i)})
+	}
+
+	got := ring.List()
+	require.Equal(t, 3, len(got))
+	assert.Equal(t, "ts2", got[0].TipSetKey)
+	assert.Equal(t, "ts3", got[1].TipSetKey)
+	assert.Equal(t, "ts4", got[2].TipSetKey)
+}
+
+func TestSyncErrorRingEmpty(t *testing.T) {
+	tf.UnitTest(t)
+
+	for _, size := range []int{0, -1} {
+		ring := newSyncErrorRing(size)
+		ring.Add(SyncError{TipSetKey: "ts"})
+		assert.Empty(t, ring.List())
+	}
+}
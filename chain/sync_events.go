@@ -0,0 +1,113 @@
+package chain
+
+import (
+	"context"
+	"sync"
+
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// SyncEventBufferSize is the number of events buffered for each subscriber
+// of SubscribeEvents.
+const SyncEventBufferSize = 64
+
+// SyncEventKind identifies what a SyncEvent reports.
+type SyncEventKind int
+
+const (
+	// EventPhase reports a change of the syncer's phase.
+	EventPhase SyncEventKind = iota
+	// EventMode reports a change of the syncer's mode.
+	EventMode
+	// EventHead reports a new head.
+	EventHead
+	// EventReorg reports a reorg of the head onto another fork.  It
+	// precedes the EventHead of the new head.
+	EventReorg
+	// EventError reports a failed call to HandleNewTipset.
+	EventError
+)
+
+func (k SyncEventKind) String() string {
+	switch k {
+	case EventPhase:
+		return "phase"
+	case EventMode:
+		return "mode"
+	case EventHead:
+		return "head"
+	case EventReorg:
+		return "reorg"
+	case EventError:
+		return "error"
+	default:
+		return "unknown"
+	}
+}
+
+// SyncEvent is an event of the syncer delivered to subscribers.  Only the
+// fields of its kind are set.
+type SyncEvent struct {
+	Kind SyncEventKind
+	// Phase is the phase entered, for EventPhase.
+	Phase SyncPhase
+	// Mode is the mode entered, for EventMode.
+	Mode SyncMode
+	// Head is the new head, for EventHead.
+	Head types.TipSet
+	// Reorg describes the reorg, for EventReorg.
+	Reorg ReorgInfo
+	// Target is the key of the tipset whose sync failed, for EventError.
+	Target types.SortedCidSet
+	// Err is the error the sync failed with, for EventError.
+	Err error
+}
+
+// SubscribeEvents returns a channel delivering the syncer's events, in
+// order, from now on, and a function that ends the subscription and closes
+// the channel.  Each subscriber has its own buffer of SyncEventBufferSize
+// events.  Events that arrive while the buffer is full are dropped rather
+// than holding up the syncer, so a slow subscriber may miss events.
+func (syncer *DefaultSyncer) SubscribeEvents() (<-chan SyncEvent, func()) {
+	return syncer.events.subscribe()
+}
+
+// syncEventHub fans out sync events to subscribers.  Its zero value has no
+// subscribers.
+type syncEventHub struct {
+	mu   sync.Mutex
+	subs map[chan SyncEvent]struct{}
+}
+
+func (h *syncEventHub) subscribe() (<-chan SyncEvent, func()) {
+	ch := make(chan SyncEvent, SyncEventBufferSize)
+	h.mu.Lock()
+	if h.subs == nil {
+		h.subs = make(map[chan SyncEvent]struct{})
+	}
+	h.subs[ch] = struct{}{}
+	h.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			delete(h.subs, ch)
+			close(ch)
+		})
+	}
+}
+
+// emit delivers ev to every subscriber with room in its buffer.
+func (h *syncEventHub) emit(ev SyncEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs {
+		select {
+		case ch <- ev:
+		default:
+			syncEventsDroppedCt.Inc(context.Background(), 1)
+		}
+	}
+}
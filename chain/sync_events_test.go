@@ -0,0 +1,149 @@
+package chain_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/chain/synctest"
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// drainEvents returns the events buffered in ch.
+func drainEvents(ch <-chan chain.SyncEvent) []chain.SyncEvent {
+	var evs []chain.SyncEvent
+	for {
+		select {
+		case ev, ok := <-ch:
+			if !ok {
+				return evs
+			}
+			evs = append(evs, ev)
+		default:
+			return evs
+		}
+	}
+}
+
+// withoutModes returns evs without mode events, whose timing depends on
+// when the syncer observes heights.
+func withoutModes(evs []chain.SyncEvent) []chain.SyncEvent {
+	var kept []chain.SyncEvent
+	for _, ev := range evs {
+		if ev.Kind != chain.EventMode {
+			kept = append(kept, ev)
+		}
+	}
+	return kept
+}
+
+func TestSubscribeEvents(t *testing.T) {
+	tf.UnitTest(t)
+
+	h := synctest.NewHarness(t)
+	h.Build(synctest.Linear("a", "", 2)...)
+	h.Build(synctest.Linear("b", "", 3)...)
+	events, unsubscribe := h.Syncer.SubscribeEvents()
+	defer unsubscribe()
+
+	t.Run("a sync reports its phases and heads", func(t *testing.T) {
+		h.RequireSync("a2")
+		evs := drainEvents(events)
+		assert.Equal(t, []chain.SyncEvent{
+			{Kind: chain.EventPhase, Phase: chain.PhaseCollecting},
+			{Kind: chain.EventPhase, Phase: chain.PhaseValidating},
+			{Kind: chain.EventHead, Head: h.TipSet("a1")},
+			{Kind: chain.EventHead, Head: h.TipSet("a2")},
+			{Kind: chain.EventPhase, Phase: chain.PhaseIdle},
+		}, withoutModes(evs))
+
+		// The syncer falls behind once it sees a2's height and catches up
+		// when a2 becomes head.
+		var modes []chain.SyncMode
+		for _, ev := range evs {
+			if ev.Kind == chain.EventMode {
+				modes = append(modes, ev.Mode)
+			}
+		}
+		assert.Equal(t, []chain.SyncMode{chain.Syncing, chain.CaughtUp}, modes)
+	})
+
+	t.Run("a reorg precedes the head it switches to", func(t *testing.T) {
+		h.RequireSync("b3")
+		evs := withoutModes(drainEvents(events))
+
+		var reorgs []int
+		for i, ev := range evs {
+			if ev.Kind == chain.EventReorg {
+				reorgs = append(reorgs, i)
+			}
+		}
+		require.Len(t, reorgs, 1)
+		reorg := evs[reorgs[0]].Reorg
+		assert.Equal(t, h.TipSet("a2").ToSortedCidSet(), reorg.OldHead)
+
+		// The reorg is reported once the new head is set, between the
+		// reorg phase and the new head.
+		require.True(t, reorgs[0] > 0 && len(evs) > reorgs[0]+1)
+		assert.Equal(t, chain.SyncEvent{Kind: chain.EventPhase, Phase: chain.PhaseReorg}, evs[reorgs[0]-1])
+		assert.Equal(t, chain.EventHead, evs[reorgs[0]+1].Kind)
+		assert.Equal(t, reorg.NewHead, evs[reorgs[0]+1].Head.ToSortedCidSet())
+
+		var lastHead types.TipSet
+		for _, ev := range evs {
+			if ev.Kind == chain.EventHead {
+				lastHead = ev.Head
+			}
+		}
+		assert.Equal(t, h.TipSet("b3"), lastHead)
+		assert.Equal(t, chain.SyncEvent{Kind: chain.EventPhase, Phase: chain.PhaseIdle}, evs[len(evs)-1])
+	})
+
+	t.Run("a failed sync reports its error", func(t *testing.T) {
+		h.Build(synctest.Spec{Name: "bad", Parent: "b3", Bad: true})
+		require.Error(t, h.Sync("bad"))
+		evs := drainEvents(events)
+		require.NotEmpty(t, evs)
+		last := evs[len(evs)-1]
+		assert.Equal(t, chain.EventError, last.Kind)
+		assert.Equal(t, h.TipSet("bad").ToSortedCidSet(), last.Target)
+		assert.Error(t, last.Err)
+	})
+
+	t.Run("a slow subscriber misses events rather than blocking", func(t *testing.T) {
+		slow, unsubscribeSlow := h.Syncer.SubscribeEvents()
+		h.Build(synctest.Linear("c", "b3", chain.SyncEventBufferSize)...)
+		h.RequireSync(fmt.Sprintf("c%d", chain.SyncEventBufferSize))
+		assert.Equal(t, chain.SyncEventBufferSize, len(slow))
+
+		unsubscribeSlow()
+		assert.Len(t, drainEvents(slow), chain.SyncEventBufferSize)
+		_, ok := <-slow
+		assert.False(t, ok)
+		unsubscribeSlow()
+	})
+}
+
+func TestModeEventsFollowObservedHeights(t *testing.T) {
+	tf.UnitTest(t)
+
+	h := synctest.NewHarness(t)
+	h.Build(synctest.Spec{Name: "bad", Bad: true})
+	events, unsubscribe := h.Syncer.SubscribeEvents()
+	defer unsubscribe()
+
+	// Seeing the bad tipset's height puts the syncer behind, and finding it
+	// invalid catches it up again, though its head never moved.
+	require.Error(t, h.Sync("bad"))
+	var modes []chain.SyncMode
+	for _, ev := range drainEvents(events) {
+		if ev.Kind == chain.EventMode {
+			modes = append(modes, ev.Mode)
+		}
+	}
+	assert.Equal(t, []chain.SyncMode{chain.Syncing, chain.CaughtUp}, modes)
+}
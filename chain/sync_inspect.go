@@ -0,0 +1,77 @@
+package chain
+
+import (
+	"time"
+
+	"github.com/ipfs/go-cid"
+
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// BadTipSetEntry is a tipset the syncer holds in its bad tipset cache.
+type BadTipSetEntry struct {
+	// Key is the key of the tipset.
+	Key string `json:"key"`
+	// Height is the height of the tipset if HeightKnown is true.
+	Height      uint64 `json:"height"`
+	HeightKnown bool   `json:"heightKnown"`
+	// Added is when the tipset was cached as bad.
+	Added time.Time `json:"added"`
+	// Quarantined is true if the tipset failed validation in a way that a
+	// later node version may not, in which case Reason is the error it
+	// failed with and Version the version that validated it.
+	Quarantined bool   `json:"quarantined"`
+	Reason      string `json:"reason,omitempty"`
+	Version     string `json:"version,omitempty"`
+}
+
+// SyncerStateReport is what the syncer believes about the chain, for
+// operators diagnosing sync.
+type SyncerStateReport struct {
+	// Mode is whether the syncer is catching up with the network.
+	Mode SyncMode `json:"mode"`
+	// Head is the key of the head tipset and HeadHeight its height.
+	Head       types.SortedCidSet `json:"head"`
+	HeadHeight uint64             `json:"headHeight"`
+	// FinalizedHeight is the height at and below which the syncer
+	// considers the chain final, zero if no finality depth is configured.
+	FinalizedHeight uint64 `json:"finalizedHeight"`
+	// ExpectedStateRoots are the trusted state roots the syncer requires at
+	// checkpoint heights.
+	ExpectedStateRoots map[uint64]cid.Cid `json:"expectedStateRoots"`
+	// BadTipSets are the tipsets cached as bad, most recently used first.
+	BadTipSets []BadTipSetEntry `json:"badTipSets"`
+}
+
+// InspectState returns a report of what the syncer believes right now: its
+// mode, head and finalized height, the trusted state roots it checks and the
+// tipsets it holds as bad.  It does not wait on a running HandleNewTipset, so
+// the parts of the report may be read at slightly different times.
+func (syncer *DefaultSyncer) InspectState() (SyncerStateReport, error) {
+	head := syncer.chainStore.GetHead()
+	headTs, err := syncer.chainStore.GetTipSet(head)
+	if err != nil {
+		return SyncerStateReport{}, err
+	}
+	headHeight, err := headTs.Height()
+	if err != nil {
+		return SyncerStateReport{}, err
+	}
+	finalized, err := syncer.FinalizedHeight()
+	if err != nil {
+		return SyncerStateReport{}, err
+	}
+
+	roots := make(map[uint64]cid.Cid, len(syncer.expectedRoots))
+	for h, root := range syncer.expectedRoots {
+		roots[h] = root
+	}
+	return SyncerStateReport{
+		Mode:               syncer.Mode(),
+		Head:               head,
+		HeadHeight:         headHeight,
+		FinalizedHeight:    finalized,
+		ExpectedStateRoots: roots,
+		BadTipSets:         syncer.badTipSets.Entries(),
+	}, nil
+}
@@ -0,0 +1,61 @@
+package chain_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/chain/synctest"
+	th "github.com/filecoin-project/go-filecoin/testhelpers"
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestInspectState(t *testing.T) {
+	tf.UnitTest(t)
+
+	// Checkpoints above the synced chain leave it valid.
+	roots := map[uint64]cid.Cid{100: types.SomeCid(), 200: types.SomeCid()}
+	now := time.Unix(1234567890, 0)
+	h := synctest.NewHarness(t,
+		chain.SyncerClock(th.NewFakeClock(now)),
+		chain.ExpectedStateRoots(roots),
+		chain.FinalityDepth(1, time.Hour),
+	)
+	h.Build(synctest.Linear("good", "", 2)...)
+	h.Build(synctest.Spec{Name: "bad", Parent: "good1", Bad: true})
+	h.Build(synctest.Linear("tail", "bad", 2)...)
+
+	h.RequireSync("good2")
+	assert.Error(t, h.Sync("tail2"))
+
+	report, err := h.Syncer.InspectState()
+	require.NoError(t, err)
+	assert.Equal(t, h.Syncer.Mode(), report.Mode)
+	assert.Equal(t, h.TipSet("good2").ToSortedCidSet(), report.Head)
+	assert.Equal(t, uint64(2), report.HeadHeight)
+	assert.Equal(t, uint64(1), report.FinalizedHeight)
+	assert.Equal(t, roots, report.ExpectedStateRoots)
+
+	heights := make(map[string]uint64)
+	for _, entry := range report.BadTipSets {
+		assert.True(t, entry.HeightKnown, entry.Key)
+		assert.Equal(t, now, entry.Added, entry.Key)
+		heights[entry.Key] = entry.Height
+	}
+	assert.Equal(t, map[string]uint64{
+		h.TipSet("bad").String():   2,
+		h.TipSet("tail1").String(): 3,
+		h.TipSet("tail2").String(): 4,
+	}, heights)
+
+	// The report serializes for operator tooling.
+	encoded, err := json.Marshal(report)
+	require.NoError(t, err)
+	assert.Contains(t, string(encoded), `"mode":"`+report.Mode.String()+`"`)
+}
@@ -0,0 +1,129 @@
+package chain
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ipfs/go-cid"
+
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// SyncMode is whether the syncer is catching up with the network or
+// following it.
+type SyncMode int
+
+const (
+	// Syncing is the mode of a syncer whose head is behind the greatest
+	// height it has seen on the network.
+	Syncing SyncMode = iota
+	// CaughtUp is the mode of a syncer whose head is at the greatest height
+	// it has seen on the network.
+	CaughtUp
+)
+
+func (m SyncMode) String() string {
+	switch m {
+	case Syncing:
+		return "syncing"
+	case CaughtUp:
+		return "caught up"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText encodes the mode as its name.
+func (m SyncMode) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// FetchProfile tunes how the syncer fetches the blocks of a tipset.
+type FetchProfile struct {
+	// Concurrency is the maximum number of concurrent fetch requests the
+	// blocks of a tipset are split across.
+	Concurrency int
+}
+
+var (
+	// DefaultSyncingProfile fetches aggressively to catch up quickly.
+	DefaultSyncingProfile = FetchProfile{Concurrency: 8}
+	// DefaultCaughtUpProfile fetches with minimal overhead while following
+	// the network.
+	DefaultCaughtUpProfile = FetchProfile{Concurrency: 1}
+)
+
+// FetchProfiles configures the fetch profiles the syncer applies while
+// Syncing and while CaughtUp.
+func FetchProfiles(syncing, caughtUp FetchProfile) SyncerOpt {
+	return func(syncer *DefaultSyncer) {
+		syncer.profiles[Syncing] = syncing
+		syncer.profiles[CaughtUp] = caughtUp
+	}
+}
+
+// Mode returns the syncer's current mode.  The mode transitions
+// automatically as the syncer observes heights on the network and advances
+// its head, and each transition is reported with an EventMode as it happens.
+func (syncer *DefaultSyncer) Mode() SyncMode {
+	mode := Syncing
+	if syncer.IsCaughtUpForMining(0) {
+		mode = CaughtUp
+	}
+
+	syncer.modeMu.Lock()
+	defer syncer.modeMu.Unlock()
+	if mode != syncer.mode {
+		logSyncer.Infof("sync mode changed from %s to %s", syncer.mode, mode)
+		syncer.mode = mode
+		syncer.events.emit(SyncEvent{Kind: EventMode, Mode: mode})
+	}
+	return mode
+}
+
+// ActiveFetchProfile returns the fetch profile for the syncer's current mode.
+func (syncer *DefaultSyncer) ActiveFetchProfile() FetchProfile {
+	return syncer.profiles[syncer.Mode()]
+}
+
+// fetchConcurrently splits cids into at most concurrency requests to the
+// syncer's fetcher made concurrently.  It returns the blocks in cid order and
+// errors if any request fails.
+func (syncer *DefaultSyncer) fetchConcurrently(ctx context.Context, cids []cid.Cid, concurrency int) ([]*types.Block, error) {
+	if concurrency <= 1 || len(cids) <= 1 {
+		return syncer.fetcher.GetBlocks(ctx, cids)
+	}
+	if concurrency > len(cids) {
+		concurrency = len(cids)
+	}
+
+	chunkSize := (len(cids) + concurrency - 1) / concurrency
+	results := make([][]*types.Block, concurrency)
+	errs := make([]error, concurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		start := i * chunkSize
+		if start >= len(cids) {
+			break
+		}
+		end := start + chunkSize
+		if end > len(cids) {
+			end = len(cids)
+		}
+		wg.Add(1)
+		go func(i int, chunk []cid.Cid) {
+			defer wg.Done()
+			results[i], errs[i] = syncer.fetcher.GetBlocks(ctx, chunk)
+		}(i, cids[start:end])
+	}
+	wg.Wait()
+
+	var blks []*types.Block
+	for i := range results {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		blks = append(blks, results[i]...)
+	}
+	return blks, nil
+}
@@ -0,0 +1,76 @@
+package chain
+
+// SyncPhase is the step of HandleNewTipset the syncer is executing.
+type SyncPhase int
+
+const (
+	// PhaseIdle is the phase of a syncer not handling a tipset.
+	PhaseIdle SyncPhase = iota
+	// PhaseCollecting is the phase of a syncer fetching the chain of a new
+	// tipset back to a tipset in its store.
+	PhaseCollecting
+	// PhaseValidating is the phase of a syncer running state transitions
+	// over a collected chain.
+	PhaseValidating
+	// PhaseReorg is the phase of a syncer switching its head to a heavier
+	// fork.
+	PhaseReorg
+)
+
+func (p SyncPhase) String() string {
+	switch p {
+	case PhaseIdle:
+		return "idle"
+	case PhaseCollecting:
+		return "collecting"
+	case PhaseValidating:
+		return "validating"
+	case PhaseReorg:
+		return "reorg"
+	default:
+		return "unknown"
+	}
+}
+
+// SyncStatus is a snapshot of the syncer's progress.
+type SyncStatus struct {
+	// Phase is the step of HandleNewTipset the syncer is executing.
+	Phase SyncPhase
+	// Mode is whether the syncer is catching up with the network.
+	Mode SyncMode
+	// TargetHeight is the greatest height the syncer has seen on the
+	// network.
+	TargetHeight uint64
+	// Progress is the height of the syncer's head as a fraction of
+	// TargetHeight, or SyncProgressUnknown.
+	Progress float64
+}
+
+// CurrentPhase returns the step of HandleNewTipset the syncer is executing.
+// It does not wait on a running HandleNewTipset.
+func (syncer *DefaultSyncer) CurrentPhase() SyncPhase {
+	syncer.phaseMu.Lock()
+	defer syncer.phaseMu.Unlock()
+	return syncer.phase
+}
+
+// Status returns a snapshot of the syncer's progress.
+func (syncer *DefaultSyncer) Status() SyncStatus {
+	return SyncStatus{
+		Phase:        syncer.CurrentPhase(),
+		Mode:         syncer.Mode(),
+		TargetHeight: syncer.currentTarget(),
+		Progress:     syncer.SyncProgress(),
+	}
+}
+
+// setPhase records the step of HandleNewTipset the syncer is executing.
+func (syncer *DefaultSyncer) setPhase(p SyncPhase) {
+	syncer.phaseMu.Lock()
+	defer syncer.phaseMu.Unlock()
+	if p != syncer.phase {
+		logSyncer.Debugf("sync phase changed from %s to %s", syncer.phase, p)
+		syncer.events.emit(SyncEvent{Kind: EventPhase, Phase: p})
+	}
+	syncer.phase = p
+}
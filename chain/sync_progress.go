@@ -0,0 +1,145 @@
+package chain
+
+import "time"
+
+// SyncProgressUnknown is the progress reported while the syncer has no
+// estimate of the network's head height.
+const SyncProgressUnknown = -1.0
+
+// DefaultSyncTargetTTL is how long the syncer trusts its estimate of the
+// network's head height without renewal.
+const DefaultSyncTargetTTL = 10 * time.Minute
+
+// SyncTargetHeight configures the syncer's initial estimate of the network's
+// head height, for example from a published checkpoint.  The estimate is
+// still raised as higher tipsets are seen, and ages out as any other, see
+// SyncTargetTTL.
+func SyncTargetHeight(h uint64) SyncerOpt {
+	return func(syncer *DefaultSyncer) {
+		syncer.targetHeight = h
+	}
+}
+
+// SyncTargetTTL configures how long the syncer trusts its estimate of the
+// network's head height without renewal.  The estimate is renewed whenever
+// the syncer sees a tipset at least as high or advances its head toward it.
+// Once it ages out the syncer forgets it, and counts as caught up until it
+// sees another tipset, so that a height no peer follows up on cannot hold
+// the syncer in Syncing, or pause mining, forever.  It defaults to
+// DefaultSyncTargetTTL; zero trusts the estimate indefinitely.
+func SyncTargetTTL(ttl time.Duration) SyncerOpt {
+	return func(syncer *DefaultSyncer) {
+		syncer.targetTTL = ttl
+	}
+}
+
+// currentTarget returns the syncer's estimate of the network's head height,
+// or zero if it has none or it aged out.
+func (syncer *DefaultSyncer) currentTarget() uint64 {
+	syncer.targetMu.Lock()
+	defer syncer.targetMu.Unlock()
+	if syncer.targetHeight == 0 || syncer.targetTTL <= 0 {
+		return syncer.targetHeight
+	}
+	if age := syncer.clock.Now().Sub(syncer.targetRenewedAt); age > syncer.targetTTL {
+		logSyncer.Infof("sync target height %d aged out, not renewed for %s", syncer.targetHeight, age)
+		syncer.targetHeight = 0
+	}
+	return syncer.targetHeight
+}
+
+// renewTarget records that the syncer made progress toward its estimate of
+// the network's head height.
+func (syncer *DefaultSyncer) renewTarget() {
+	syncer.targetMu.Lock()
+	defer syncer.targetMu.Unlock()
+	syncer.targetRenewedAt = syncer.clock.Now()
+}
+
+// withdrawTarget lowers the syncer's estimate of the network's head height,
+// and the confirmed height, to h, dropping the heights observed walking a
+// chain since found invalid.
+func (syncer *DefaultSyncer) withdrawTarget(h uint64) {
+	syncer.targetMu.Lock()
+	defer syncer.targetMu.Unlock()
+	if h < syncer.targetHeight {
+		logSyncer.Infof("withdrawing sync target height %d claimed by an invalid chain", syncer.targetHeight)
+		syncer.targetHeight = h
+	}
+	if h < syncer.confirmedHeight {
+		syncer.confirmedHeight = h
+	}
+}
+
+// confirmTarget records that a chain with its head at height h was fetched
+// back to the store, so that h is backed by a chain rather than only
+// claimed.
+func (syncer *DefaultSyncer) confirmTarget(h uint64) {
+	syncer.targetMu.Lock()
+	defer syncer.targetMu.Unlock()
+	if h > syncer.confirmedHeight {
+		syncer.confirmedHeight = h
+	}
+}
+
+// settleConfirmed lowers the confirmed height to the height of the store's
+// head, after a chain was synced, so that a valid chain that did not become
+// the head does not leave the syncer behind.
+func (syncer *DefaultSyncer) settleConfirmed() {
+	headTs, err := syncer.chainStore.GetTipSet(syncer.chainStore.GetHead())
+	if err != nil {
+		return
+	}
+	headHeight, err := headTs.Height()
+	if err != nil {
+		return
+	}
+	syncer.targetMu.Lock()
+	defer syncer.targetMu.Unlock()
+	if headHeight < syncer.confirmedHeight {
+		syncer.confirmedHeight = headHeight
+	}
+}
+
+// IsBehindConfirmed returns true if the height of the store's head is below
+// the greatest height of a chain the syncer fetched back to its store and
+// has not found invalid.  Unlike Mode it ignores heights that are only
+// claimed, so a peer cannot hold it true by announcing a height it never
+// backs with a chain.
+func (syncer *DefaultSyncer) IsBehindConfirmed() bool {
+	headTs, err := syncer.chainStore.GetTipSet(syncer.chainStore.GetHead())
+	if err != nil {
+		return false
+	}
+	headHeight, err := headTs.Height()
+	if err != nil {
+		return false
+	}
+	syncer.targetMu.Lock()
+	defer syncer.targetMu.Unlock()
+	return headHeight < syncer.confirmedHeight
+}
+
+// SyncProgress returns the height of the store's head as a fraction of the
+// greatest height the syncer has seen on the network or was configured with,
+// between 0 and 1.  It returns SyncProgressUnknown if the syncer has no
+// estimate of the network's head height.
+func (syncer *DefaultSyncer) SyncProgress() float64 {
+	target := syncer.currentTarget()
+	if target == 0 {
+		return SyncProgressUnknown
+	}
+
+	headTs, err := syncer.chainStore.GetTipSet(syncer.chainStore.GetHead())
+	if err != nil {
+		return SyncProgressUnknown
+	}
+	headHeight, err := headTs.Height()
+	if err != nil {
+		return SyncProgressUnknown
+	}
+	if headHeight >= target {
+		return 1
+	}
+	return float64(headHeight) / float64(target)
+}
@@ -0,0 +1,84 @@
+package chain_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/chain/synctest"
+	th "github.com/filecoin-project/go-filecoin/testhelpers"
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// Heights claimed by a chain found invalid do not hold back mining.
+func TestSyncTargetWithdrawnForInvalidChain(t *testing.T) {
+	tf.UnitTest(t)
+
+	h := synctest.NewHarness(t)
+	h.Build(synctest.Spec{Name: "good"})
+	bogus := synctest.Linear("bogus", "good", 5)
+	bogus[0].Bad = true
+	h.Build(bogus...)
+	h.RequireSync("good")
+
+	require.Error(t, h.Sync("bogus5"))
+	h.RequireHead("good")
+	assert.True(t, h.Syncer.IsCaughtUpForMining(0))
+	assert.Equal(t, uint64(1), h.Syncer.Status().TargetHeight)
+
+	// Announcing the chain again is rejected from the bad tipset cache and
+	// still does not count.
+	require.Error(t, h.Sync("bogus5"))
+	assert.True(t, h.Syncer.IsCaughtUpForMining(0))
+}
+
+// A target height that is not renewed ages out.
+func TestSyncTargetAgesOut(t *testing.T) {
+	tf.UnitTest(t)
+
+	clk := th.NewFakeClock(time.Unix(1234567890, 0))
+	h := synctest.NewHarness(t, chain.SyncerClock(clk), chain.SyncTargetHeight(100), chain.SyncTargetTTL(time.Minute))
+	h.Build(synctest.Linear("link", "", 1)...)
+	assert.Equal(t, chain.Syncing, h.Syncer.Mode())
+
+	// Advancing the head renews the target.
+	clk.Advance(50 * time.Second)
+	h.RequireSync("link1")
+	clk.Advance(50 * time.Second)
+	assert.Equal(t, chain.Syncing, h.Syncer.Mode())
+	assert.False(t, h.Syncer.IsCaughtUpForMining(0))
+
+	clk.Advance(20 * time.Second)
+	assert.Equal(t, chain.CaughtUp, h.Syncer.Mode())
+	assert.True(t, h.Syncer.IsCaughtUpForMining(0))
+	assert.Equal(t, chain.SyncProgressUnknown, h.Syncer.SyncProgress())
+}
+
+// Only a chain fetched back to the store puts the syncer behind it.
+func TestIsBehindConfirmed(t *testing.T) {
+	tf.UnitTest(t)
+
+	var h *synctest.Harness
+	var behind []bool
+	hook := func(ctx context.Context, ts types.TipSet, stateRoot cid.Cid) error {
+		behind = append(behind, h.Syncer.IsBehindConfirmed())
+		return nil
+	}
+	h = synctest.NewHarness(t, chain.SyncTargetHeight(100), chain.WithCommitHook(hook))
+	h.Build(synctest.Linear("link", "", 3)...)
+
+	// A claimed height is not confirmed.
+	assert.Equal(t, chain.Syncing, h.Syncer.Mode())
+	assert.False(t, h.Syncer.IsBehindConfirmed())
+
+	// The syncer is behind the chain while applying it.
+	h.RequireSync("link3")
+	assert.Equal(t, []bool{true, true, true}, behind)
+	assert.False(t, h.Syncer.IsBehindConfirmed())
+}
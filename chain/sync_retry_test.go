@@ -0,0 +1,85 @@
+package chain_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/chain/synctest"
+	th "github.com/filecoin-project/go-filecoin/testhelpers"
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+)
+
+// flakyStore is a chain store whose next failures tipset writes fail.
+type flakyStore struct {
+	*chain.DefaultStore
+	failures int
+}
+
+func (s *flakyStore) PutTipSetAndState(ctx context.Context, tsas *chain.TipSetAndState) error {
+	if s.failures > 0 {
+		s.failures--
+		return errors.New("datastore hiccup")
+	}
+	return s.DefaultStore.PutTipSetAndState(ctx, tsas)
+}
+
+func TestRetryTransient(t *testing.T) {
+	tf.UnitTest(t)
+	ctx := context.Background()
+
+	t.Run("a transient store failure is retried", func(t *testing.T) {
+		h := synctest.NewHarness(t)
+		h.Build(synctest.Linear("link", "", 2)...)
+		store := &flakyStore{DefaultStore: h.Store, failures: 1}
+		syncer := chain.NewDefaultSyncer(h.StateStore, h.Consensus, store, h.Fetcher, chain.RetryTransient(2, time.Millisecond))
+
+		require.NoError(t, syncer.HandleNewTipset(ctx, h.TipSet("link2").ToSortedCidSet()))
+		assert.Equal(t, 0, store.failures)
+		h.RequireHead("link2")
+	})
+
+	t.Run("retries wait on the syncer's clock", func(t *testing.T) {
+		h := synctest.NewHarness(t)
+		h.Build(synctest.Linear("link", "", 2)...)
+		store := &flakyStore{DefaultStore: h.Store, failures: 1}
+		clk := th.NewFakeClock(time.Unix(1234567890, 0))
+		syncer := chain.NewDefaultSyncer(h.StateStore, h.Consensus, store, h.Fetcher, chain.SyncerClock(clk), chain.RetryTransient(2, time.Hour))
+
+		done := make(chan error, 1)
+		go func() {
+			done <- syncer.HandleNewTipset(ctx, h.TipSet("link2").ToSortedCidSet())
+		}()
+		for {
+			select {
+			case err := <-done:
+				require.NoError(t, err)
+				h.RequireHead("link2")
+				return
+			case <-time.After(10 * time.Millisecond):
+				clk.Advance(time.Hour)
+			}
+		}
+	})
+
+	t.Run("without retries a transient failure marks nothing bad", func(t *testing.T) {
+		h := synctest.NewHarness(t)
+		h.Build(synctest.Linear("link", "", 2)...)
+		store := &flakyStore{DefaultStore: h.Store, failures: 1}
+		syncer := chain.NewDefaultSyncer(h.StateStore, h.Consensus, store, h.Fetcher)
+
+		err := syncer.HandleNewTipset(ctx, h.TipSet("link2").ToSortedCidSet())
+		require.Error(t, err)
+		assert.Equal(t, chain.ErrChainStoreWrite, errors.Cause(err))
+		assert.True(t, chain.IsTransient(err))
+		h.RequireHead(synctest.GenesisName)
+
+		require.NoError(t, syncer.HandleNewTipset(ctx, h.TipSet("link2").ToSortedCidSet()))
+		h.RequireHead("link2")
+	})
+}
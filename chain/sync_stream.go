@@ -0,0 +1,94 @@
+package chain
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// StreamChain configures the syncer to stream long chains into the store
+// rather than holding every tipset of a new chain in memory until it is
+// collected.  The syncer first walks the chain back to the store retaining
+// only the key and height of each tipset, then fetches the tipsets again in
+// order, at most bufferSize ahead of validation.  The blocks of a chain
+// being synced then take memory bounded by bufferSize regardless of the
+// chain's length, at the cost of resolving each tipset twice.  Resolving
+// again is cheap in production, where the first fetch leaves blocks in the
+// node's blockstore.  A bufferSize of zero or less disables streaming.
+func StreamChain(bufferSize int) SyncerOpt {
+	return func(syncer *DefaultSyncer) {
+		syncer.streamBuffer = bufferSize
+	}
+}
+
+// streamedTipSet is a tipset fetched for streaming into the store, or the
+// error fetching it.
+type streamedTipSet struct {
+	ts  types.TipSet
+	err error
+}
+
+// syncStreamed syncs the chain with head tipsetCids by streaming its tipsets
+// into the store.  The caller must hold syncer.mu.
+func (syncer *DefaultSyncer) syncStreamed(ctx context.Context, tipsetCids types.SortedCidSet) error {
+	syncer.setPhase(PhaseCollecting)
+	links, err := syncer.collectChainLinks(ctx, tipsetCids)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	tipsets := syncer.streamTipSets(ctx, links)
+	return syncer.applyChain(ctx, links, func() (types.TipSet, error) {
+		next, ok := <-tipsets
+		if !ok {
+			return nil, ctx.Err()
+		}
+		return next.ts, next.err
+	})
+}
+
+// streamTipSets fetches the tipsets identified by links in order and sends
+// them on the returned channel, buffering at most the syncer's stream buffer
+// ahead of the receiver.  It stops after the first error and when ctx is
+// done.
+func (syncer *DefaultSyncer) streamTipSets(ctx context.Context, links []tipSetLink) <-chan streamedTipSet {
+	out := make(chan streamedTipSet, syncer.streamBuffer)
+	go func() {
+		defer close(out)
+		for _, link := range links {
+			ts, err := syncer.resolveTipSet(ctx, link.key)
+			select {
+			case out <- streamedTipSet{ts: ts, err: err}:
+			case <-ctx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// resolveTipSet fetches the blocks of the tipset with key tsKey, which was
+// walked before, within the syncer's block wait time.
+func (syncer *DefaultSyncer) resolveTipSet(ctx context.Context, tsKey types.SortedCidSet) (types.TipSet, error) {
+	ctx, cancel := context.WithTimeout(ctx, syncer.blkWaitTime)
+	defer cancel()
+	blks, err := syncer.fetcher.GetBlocks(ctx, tsKey.ToSlice())
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to resolve tipset %s", tsKey.String())
+	}
+	ts, err := types.NewTipSet(blks...)
+	if err != nil {
+		return nil, err
+	}
+	if !ts.ToSortedCidSet().Equals(tsKey) {
+		return nil, errors.Errorf("resolved tipset %s for key %s", ts.String(), tsKey.String())
+	}
+	return ts, nil
+}
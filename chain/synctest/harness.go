@@ -0,0 +1,237 @@
+// Package synctest provides a deterministic harness for testing the syncer
+// against chains declared by the test.
+package synctest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-hamt-ipld"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	"github.com/libp2p/go-libp2p-peer"
+	"github.com/minio/blake2b-simd"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/consensus"
+	"github.com/filecoin-project/go-filecoin/proofs"
+	"github.com/filecoin-project/go-filecoin/repo"
+	th "github.com/filecoin-project/go-filecoin/testhelpers"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// GenesisName names the genesis tipset of every harness.
+const GenesisName = "genesis"
+
+// Spec declares a tipset of the chain DAG a harness builds.
+type Spec struct {
+	// Name identifies the tipset to the harness.  It must be unique.
+	Name string
+	// Parent names the parent tipset, which must be declared before this
+	// one.  The empty string names genesis.
+	Parent string
+	// Blocks is the number of blocks in the tipset.  Zero means one.
+	Blocks int
+	// NullRounds is the number of null rounds between the parent and this
+	// tipset.
+	NullRounds uint64
+	// Bad marks the tipset invalid: its blocks claim a state root that
+	// processing the parent does not produce, so consensus rejects it.
+	Bad bool
+}
+
+// Harness drives a DefaultSyncer wired to in-memory mocks through a chain
+// DAG declared by the test.  Blocks are built deterministically, so the same
+// specs always produce the same cids, and are served by the harness's
+// fetcher rather than the network.  Consensus uses a power table in which
+// every miner holds all the power, so every block carries a winning ticket
+// and every block adds the same weight to its tipset.
+type Harness struct {
+	t *testing.T
+
+	// Syncer is the syncer under test.
+	Syncer *chain.DefaultSyncer
+	// Store is the chain store the syncer syncs to.
+	Store *chain.DefaultStore
+	// Fetcher serves the blocks of every tipset built by the harness.
+	Fetcher *th.TestFetcher
+	// Consensus is the consensus protocol the syncer validates tipsets with.
+	Consensus consensus.Protocol
+	// StateStore holds the state the syncer computes.
+	StateStore chain.StateStore
+
+	stateRoot cid.Cid
+	tipsets   map[string]types.TipSet
+}
+
+// NewHarness returns a harness whose syncer is built with opts and whose
+// store holds only genesis.
+func NewHarness(t *testing.T, opts ...chain.SyncerOpt) *Harness {
+	return NewHarnessWithConsensus(t, nil, opts...)
+}
+
+// NewHarnessWithConsensus returns a harness like NewHarness whose syncer
+// validates tipsets with the protocol wrap returns for the harness's
+// consensus protocol, so that tests can observe or alter validation.  A nil
+// wrap uses the harness's protocol unchanged.
+func NewHarnessWithConsensus(t *testing.T, wrap func(consensus.Protocol) consensus.Protocol, opts ...chain.SyncerOpt) *Harness {
+	ctx := context.Background()
+	r := repo.NewInMemoryRepo()
+	bs := bstore.NewBlockstore(r.Datastore())
+	cst := hamt.NewCborStore()
+
+	minerAddr, err := address.NewActorAddress([]byte("miner"))
+	require.NoError(t, err)
+	ownerAddr, err := address.NewActorAddress([]byte("minerOwner"))
+	require.NoError(t, err)
+	genesis, err := consensus.MakeGenesisFunc(
+		consensus.MinerActor(minerAddr, ownerAddr, []byte{}, 1000, peer.ID("synctest"), types.ZeroAttoFIL, types.OneKiBSectorSize),
+	)(cst, bs)
+	require.NoError(t, err)
+	genTS := th.RequireNewTipSet(t, genesis)
+
+	var con consensus.Protocol = consensus.NewExpected(cst, bs, th.NewTestProcessor(), &th.TestView{}, genesis.Cid(), proofs.NewFakeVerifier(true, nil))
+	if wrap != nil {
+		con = wrap(con)
+	}
+	store := chain.NewDefaultStore(r.ChainDatastore(), genesis.Cid())
+	th.RequirePutTsas(ctx, t, store, &chain.TipSetAndState{
+		TipSet:          genTS,
+		TipSetStateRoot: genesis.StateRoot,
+	})
+	require.NoError(t, store.SetHead(ctx, genTS))
+
+	stateStore := chain.NewCborStateStore(cst)
+	fetcher := th.NewTestFetcher()
+	return &Harness{
+		t:          t,
+		Syncer:     chain.NewDefaultSyncer(stateStore, con, store, fetcher, opts...),
+		Store:      store,
+		Fetcher:    fetcher,
+		Consensus:  con,
+		StateStore: stateStore,
+		stateRoot:  genesis.StateRoot,
+		tipsets:    map[string]types.TipSet{GenesisName: genTS},
+	}
+}
+
+// Linear declares a chain of n single block tipsets on top of the tipset
+// named parent, named prefix followed by 1 through n.
+func Linear(prefix, parent string, n int) []Spec {
+	specs := make([]Spec, n)
+	for i := range specs {
+		specs[i] = Spec{Name: fmt.Sprintf("%s%d", prefix, i+1), Parent: parent}
+		parent = specs[i].Name
+	}
+	return specs
+}
+
+// Build builds the tipsets declared by specs, in order, and makes their
+// blocks available to the syncer's fetcher.  Nothing is synced.
+func (h *Harness) Build(specs ...Spec) {
+	for _, spec := range specs {
+		_, exists := h.tipsets[spec.Name]
+		require.False(h.t, exists, "tipset %q declared twice", spec.Name)
+		parentName := spec.Parent
+		if parentName == "" {
+			parentName = GenesisName
+		}
+		parent := h.TipSet(parentName)
+
+		h.tipsets[spec.Name] = h.mkTipSet(spec, parent)
+	}
+}
+
+// TipSet returns the tipset declared with name.
+func (h *Harness) TipSet(name string) types.TipSet {
+	ts, ok := h.tipsets[name]
+	require.True(h.t, ok, "no tipset %q", name)
+	return ts
+}
+
+// Sync hands the tipset declared with name to the syncer, as if a peer had
+// announced it as its head.
+func (h *Harness) Sync(name string) error {
+	return h.Syncer.HandleNewTipset(context.Background(), h.TipSet(name).ToSortedCidSet())
+}
+
+// RequireSync syncs the tipset declared with name and requires it to succeed.
+func (h *Harness) RequireSync(name string) {
+	require.NoError(h.t, h.Sync(name), "syncing %q", name)
+}
+
+// RequireHead requires the head of the store to be the tipset declared with
+// name.
+func (h *Harness) RequireHead(name string) {
+	require.Equal(h.t, h.TipSet(name).ToSortedCidSet(), h.Store.GetHead(), "head is not %q", name)
+}
+
+// Weight returns the weight consensus assigns the tipset declared with name.
+// The tipset's parent must be in the store.
+func (h *Harness) Weight(name string) uint64 {
+	ctx := context.Background()
+	ts := h.TipSet(name)
+	if name == GenesisName {
+		w, err := h.Consensus.Weight(ctx, ts, nil)
+		require.NoError(h.t, err)
+		return w
+	}
+	parents, err := ts.Parents()
+	require.NoError(h.t, err)
+	root, err := h.Store.GetTipSetStateRoot(parents)
+	require.NoError(h.t, err)
+	st, err := h.StateStore.LoadStateTree(ctx, root)
+	require.NoError(h.t, err)
+	w, err := h.Consensus.Weight(ctx, ts, st)
+	require.NoError(h.t, err)
+	return w
+}
+
+// mkTipSet builds the tipset declared by spec on top of parent.  Each block
+// is mined by a distinct miner so that multi block tipsets never look like
+// equivocation.
+func (h *Harness) mkTipSet(spec Spec, parent types.TipSet) types.TipSet {
+	parentHeight, err := parent.Height()
+	require.NoError(h.t, err)
+	// The power table view ignores state, so the parent's need not be loaded.
+	parentWeight, err := h.Consensus.Weight(context.Background(), parent, nil)
+	require.NoError(h.t, err)
+
+	stateRoot := h.stateRoot
+	if spec.Bad {
+		stateRoot = types.SomeCid()
+	}
+	n := spec.Blocks
+	if n == 0 {
+		n = 1
+	}
+
+	blks := make([]*types.Block, n)
+	for i := range blks {
+		minerAddr, err := address.NewActorAddress([]byte(fmt.Sprintf("%s/%d", spec.Name, i)))
+		require.NoError(h.t, err)
+		ticket := blake2b.Sum256([]byte(fmt.Sprintf("ticket %s/%d", spec.Name, i)))
+		blks[i] = &types.Block{
+			Miner:        minerAddr,
+			Ticket:       ticket[:],
+			Parents:      parent.ToSortedCidSet(),
+			ParentWeight: types.Uint64(parentWeight),
+			Height:       types.Uint64(parentHeight + spec.NullRounds + 1),
+			StateRoot:    stateRoot,
+			Proof:        testProof(),
+		}
+	}
+	h.Fetcher.AddSourceBlocks(blks...)
+	return th.RequireNewTipSet(h.t, blks...)
+}
+
+// testProof returns the fixed proof carried by every block the harness
+// builds.  The harness's verifier accepts any proof.
+func testProof() types.PoStProof {
+	proof := make([]byte, types.OnePoStProofPartition.ProofLen())
+	proof[0] = 42
+	return proof
+}
@@ -0,0 +1,85 @@
+package synctest_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/filecoin-project/go-filecoin/chain/synctest"
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+)
+
+func TestHarnessLongerForkWins(t *testing.T) {
+	tf.UnitTest(t)
+	h := synctest.NewHarness(t)
+	h.Build(synctest.Linear("short", "", 3)...)
+	h.Build(synctest.Linear("long", "short1", 4)...)
+
+	h.RequireSync("short3")
+	h.RequireHead("short3")
+
+	// The fork off short1 is heavier, so the syncer switches to it.
+	h.RequireSync("long4")
+	h.RequireHead("long4")
+	assert.True(t, h.Weight("long4") > h.Weight("short3"))
+
+	// Syncing the lighter fork again leaves the head alone.
+	h.RequireSync("short3")
+	h.RequireHead("long4")
+}
+
+func TestHarnessWiderTipSetWins(t *testing.T) {
+	tf.UnitTest(t)
+	h := synctest.NewHarness(t)
+	h.Build(
+		synctest.Spec{Name: "narrow"},
+		synctest.Spec{Name: "wide", Blocks: 3},
+	)
+
+	h.RequireSync("narrow")
+	h.RequireSync("wide")
+	h.RequireHead("wide")
+	assert.True(t, h.Weight("wide") > h.Weight("narrow"))
+}
+
+func TestHarnessNullRounds(t *testing.T) {
+	tf.UnitTest(t)
+	h := synctest.NewHarness(t)
+	h.Build(
+		synctest.Spec{Name: "a"},
+		synctest.Spec{Name: "b", Parent: "a", NullRounds: 2},
+	)
+
+	h.RequireSync("b")
+	h.RequireHead("b")
+	height, err := h.TipSet("b").Height()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(4), height)
+}
+
+func TestHarnessRejectsBadTipSet(t *testing.T) {
+	tf.UnitTest(t)
+	h := synctest.NewHarness(t)
+	h.Build(synctest.Linear("good", "", 2)...)
+	h.Build(synctest.Spec{Name: "bad", Parent: "good1", Bad: true})
+	h.Build(synctest.Linear("tail", "bad", 3)...)
+
+	h.RequireSync("good2")
+	assert.Error(t, h.Sync("tail3"))
+	h.RequireHead("good2")
+}
+
+func TestHarnessDeterministic(t *testing.T) {
+	tf.UnitTest(t)
+	build := func() *synctest.Harness {
+		h := synctest.NewHarness(t)
+		h.Build(synctest.Linear("a", "", 2)...)
+		h.Build(synctest.Spec{Name: "b", Parent: "a1", Blocks: 2})
+		return h
+	}
+	first, second := build(), build()
+
+	for _, name := range []string{synctest.GenesisName, "a1", "a2", "b"} {
+		assert.True(t, first.TipSet(name).Equals(second.TipSet(name)), name)
+	}
+}
@@ -2,6 +2,7 @@ package chain
 
 import (
 	"fmt"
+	"sort"
 	"sync"
 
 	"github.com/ipfs/go-cid"
@@ -22,6 +23,10 @@ type TipSetAndState struct {
 	// root of aggregate state after applying tipset
 	TipSetStateRoot cid.Cid
 	TipSet          types.TipSet
+	// GasUsed is the total gas used by the messages of the tipset.  It is
+	// zero for tipsets stored without running their state transition, such
+	// as genesis and tipsets imported without verification.
+	GasUsed types.GasUnits
 }
 
 type tsasByTipSetID map[string]*TipSetAndState
@@ -35,6 +40,9 @@ type TipIndex struct {
 	tsasByParentsAndHeight map[string]tsasByTipSetID
 	// tsasByID allows lookup of recorded TipSetAndStates by TipSet ID.
 	tsasByID tsasByTipSetID
+	// tsasByHeight allows lookup of all TipSetAndStates at a height,
+	// regardless of parents.
+	tsasByHeight map[uint64]tsasByTipSetID
 }
 
 // NewTipIndex is the TipIndex constructor.
@@ -42,12 +50,13 @@ func NewTipIndex() *TipIndex {
 	return &TipIndex{
 		tsasByParentsAndHeight: make(map[string]tsasByTipSetID),
 		tsasByID:               make(map[string]*TipSetAndState),
+		tsasByHeight:           make(map[uint64]tsasByTipSetID),
 	}
 }
 
-// Put adds an entry to both of TipIndex's internal indexes.
+// Put adds an entry to each of TipIndex's internal indexes.
 // After this call the input TipSetAndState can be looked up by the ID of
-// the tipset, or the tipset's parent.
+// the tipset, the tipset's parent, or the tipset's height.
 func (ti *TipIndex) Put(tsas *TipSetAndState) error {
 	ti.mu.Lock()
 	defer ti.mu.Unlock()
@@ -72,6 +81,14 @@ func (ti *TipIndex) Put(tsas *TipSetAndState) error {
 		ti.tsasByParentsAndHeight[key] = tsasByID
 	}
 	tsasByID[tsKey] = tsas
+
+	// Update tsasByHeight
+	atHeight, ok := ti.tsasByHeight[h]
+	if !ok {
+		atHeight = make(map[string]*TipSetAndState)
+		ti.tsasByHeight[h] = atHeight
+	}
+	atHeight[tsKey] = tsas
 	return nil
 }
 
@@ -114,7 +131,8 @@ func (ti *TipIndex) Has(tsKey string) bool {
 }
 
 // GetByParentsAndHeight returns the all tipsets and states stored in the TipIndex
-// such that the parent ID of these tipsets equals the input.
+// such that the parent ID of these tipsets equals the input, ordered by
+// tipset ID so that every node sees them in the same order.
 func (ti *TipIndex) GetByParentsAndHeight(pKey string, h uint64) ([]*TipSetAndState, error) {
 	key := makeKey(pKey, h)
 	ti.mu.Lock()
@@ -127,6 +145,28 @@ func (ti *TipIndex) GetByParentsAndHeight(pKey string, h uint64) ([]*TipSetAndSt
 	for _, tsas := range tsasByID {
 		ret = append(ret, tsas)
 	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].TipSet.String() < ret[j].TipSet.String()
+	})
+	return ret, nil
+}
+
+// GetByHeight returns all tipsets and states stored in the TipIndex at the
+// input height, across all forks, ordered by tipset ID.
+func (ti *TipIndex) GetByHeight(h uint64) ([]*TipSetAndState, error) {
+	ti.mu.Lock()
+	defer ti.mu.Unlock()
+	atHeight, ok := ti.tsasByHeight[h]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	var ret []*TipSetAndState
+	for _, tsas := range atHeight {
+		ret = append(ret, tsas)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].TipSet.String() < ret[j].TipSet.String()
+	})
 	return ret, nil
 }
 
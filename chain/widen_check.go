@@ -0,0 +1,76 @@
+package chain
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// StrictWiden configures the syncer to check every tipset produced by widen
+// with CheckWiden before syncing it.  A violation is a programming error in
+// widen: the syncer logs it loudly and aborts the sync with
+// ErrWidenInvariant, or panics if panicOnViolation is true, as tests should.
+func StrictWiden(panicOnViolation bool) SyncerOpt {
+	return func(syncer *DefaultSyncer) {
+		syncer.strictWiden = true
+		syncer.panicOnWidenViolation = panicOnViolation
+	}
+}
+
+// CheckWiden returns ErrWidenInvariant if widened, the tipset widen produced
+// from ts, is not a strict superset of ts whose blocks all share ts's height,
+// parents and parent weight.
+func CheckWiden(ts, widened types.TipSet) error {
+	if len(ts) == 0 {
+		return errors.Wrap(ErrWidenInvariant, "input tipset is empty")
+	}
+	if len(widened) <= len(ts) {
+		return errors.Wrapf(ErrWidenInvariant, "widened tipset %s does not add to %s", widened.String(), ts.String())
+	}
+	for c := range ts {
+		if _, ok := widened[c]; !ok {
+			return errors.Wrapf(ErrWidenInvariant, "widened tipset %s lacks input block %s", widened.String(), c.String())
+		}
+	}
+
+	h, err := ts.Height()
+	if err != nil {
+		return err
+	}
+	parents, err := ts.Parents()
+	if err != nil {
+		return err
+	}
+	weight, err := ts.ParentWeight()
+	if err != nil {
+		return err
+	}
+	for c, blk := range widened {
+		if uint64(blk.Height) != h {
+			return errors.Wrapf(ErrWidenInvariant, "block %s has height %d, input height %d", c.String(), blk.Height, h)
+		}
+		if !blk.Parents.Equals(parents) {
+			return errors.Wrapf(ErrWidenInvariant, "block %s has parents %s, input parents %s", c.String(), blk.Parents.String(), parents.String())
+		}
+		if uint64(blk.ParentWeight) != weight {
+			return errors.Wrapf(ErrWidenInvariant, "block %s has parent weight %d, input parent weight %d", c.String(), blk.ParentWeight, weight)
+		}
+	}
+	return nil
+}
+
+// checkWiden applies CheckWiden to the output of widen if the syncer is in
+// strict mode.
+func (syncer *DefaultSyncer) checkWiden(ts, widened types.TipSet) error {
+	if !syncer.strictWiden {
+		return nil
+	}
+	if err := CheckWiden(ts, widened); err != nil {
+		logSyncer.Errorf("BUG: widen produced an invalid tipset: %s", err)
+		if syncer.panicOnWidenViolation {
+			panic(err)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package chain_test
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/chain"
+	th "github.com/filecoin-project/go-filecoin/testhelpers"
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestCheckWiden(t *testing.T) {
+	tf.UnitTest(t)
+	dstP := initDSTParams()
+
+	input := th.RequireNewTipSet(t, dstP.link2blk1)
+
+	t.Run("valid widening passes", func(t *testing.T) {
+		assert.NoError(t, chain.CheckWiden(input, dstP.link2))
+	})
+
+	// A block at the input's height on other parents.
+	signer, ki := types.NewMockSignersAndKeyInfo(1)
+	otherParents := th.RequireMkFakeChild(t, th.FakeChildParams{
+		MinerAddr:      dstP.minerAddress,
+		Parent:         dstP.genTS,
+		GenesisCid:     dstP.genCid,
+		StateRoot:      dstP.genStateRoot,
+		Signer:         signer,
+		MinerPubKey:    ki[0].PublicKey(),
+		NullBlockCount: 1,
+	})
+	// A sibling of the input with another parent weight.
+	cpy := *dstP.link2blk2
+	cpy.ParentWeight++
+	otherWeight, err := types.DecodeBlock(cpy.ToNode().RawData())
+	require.NoError(t, err)
+
+	// The violating tipsets are built as maps as NewTipSet refuses them.
+	violations := map[string]types.TipSet{
+		"no added blocks": input.Clone(),
+		"missing input block": {
+			dstP.link2blk2.Cid(): dstP.link2blk2,
+			dstP.link2blk3.Cid(): dstP.link2blk3,
+		},
+		"different height": {
+			dstP.link2blk1.Cid(): dstP.link2blk1,
+			dstP.link3blk1.Cid(): dstP.link3blk1,
+		},
+		"different parents": {
+			dstP.link2blk1.Cid(): dstP.link2blk1,
+			otherParents.Cid():   otherParents,
+		},
+		"different parent weight": {
+			dstP.link2blk1.Cid(): dstP.link2blk1,
+			otherWeight.Cid():    otherWeight,
+		},
+	}
+	for name, widened := range violations {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, chain.ErrWidenInvariant, errors.Cause(chain.CheckWiden(input, widened)))
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package chain_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/chain/synctest"
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// Widening breaks ties between stored siblings of equal size the same way
+// whatever order they were stored in.
+func TestWidenTieBreakIsDeterministic(t *testing.T) {
+	tf.UnitTest(t)
+	ctx := context.Background()
+
+	widenWith := func(order ...string) *synctest.Harness {
+		h := synctest.NewHarness(t)
+		h.Build(
+			synctest.Spec{Name: "a", Blocks: 2},
+			synctest.Spec{Name: "b", Blocks: 2},
+			synctest.Spec{Name: "c"},
+		)
+		// Store the siblings directly so that they are not widened with
+		// each other.
+		root, err := h.Store.GetTipSetStateRoot(h.TipSet(synctest.GenesisName).ToSortedCidSet())
+		require.NoError(t, err)
+		for _, name := range order {
+			require.NoError(t, h.Store.PutTipSetAndState(ctx, &chain.TipSetAndState{
+				TipSet:          h.TipSet(name),
+				TipSetStateRoot: root,
+			}))
+		}
+
+		h.RequireSync("c")
+		return h
+	}
+
+	h := widenWith("a", "b")
+	assert.Equal(t, h.Store.GetHead(), widenWith("b", "a").Store.GetHead())
+
+	// The widened head holds c and the sibling with the lower tipset ID.
+	winner := h.TipSet("a")
+	if h.TipSet("b").String() < winner.String() {
+		winner = h.TipSet("b")
+	}
+	expected := h.TipSet("c").Clone()
+	for _, blk := range winner {
+		require.NoError(t, expected.AddBlock(blk))
+	}
+	assert.Equal(t, expected.ToSortedCidSet(), h.Store.GetHead())
+}
+
+// Widening leaves out a stored block that fails validation and keeps the
+// valid blocks of its tipset.
+func TestWidenSkipsInvalidBlocks(t *testing.T) {
+	tf.UnitTest(t)
+	ctx := context.Background()
+
+	var bad cid.Cid
+	h := synctest.NewHarness(t, chain.ValidateBlocks(func(ctx context.Context, blk *types.Block) error {
+		if blk.Cid().Equals(bad) {
+			return errors.New("bad block")
+		}
+		return nil
+	}))
+	h.Build(
+		synctest.Spec{Name: "a", Blocks: 3},
+		synctest.Spec{Name: "b"},
+	)
+	stored := h.TipSet("a").ToSlice()
+	bad = stored[0].Cid()
+
+	// Store the sibling directly, as if its bad block was only detected
+	// later.
+	root, err := h.Store.GetTipSetStateRoot(h.TipSet(synctest.GenesisName).ToSortedCidSet())
+	require.NoError(t, err)
+	require.NoError(t, h.Store.PutTipSetAndState(ctx, &chain.TipSetAndState{
+		TipSet:          h.TipSet("a"),
+		TipSetStateRoot: root,
+	}))
+
+	h.RequireSync("b")
+
+	expected := h.TipSet("b").Clone()
+	for _, blk := range stored[1:] {
+		require.NoError(t, expected.AddBlock(blk))
+	}
+	full := expected.Clone()
+	require.NoError(t, full.AddBlock(stored[0]))
+
+	assert.True(t, h.Store.HasTipSetAndState(ctx, expected.String()))
+	assert.False(t, h.Store.HasTipSetAndState(ctx, full.String()))
+}
@@ -0,0 +1,50 @@
+package clock
+
+import (
+	"time"
+)
+
+// Clock defines an interface for fetching time that may be used instead of
+// the time package so that time can be controlled in tests.
+type Clock interface {
+	Now() time.Time
+	// NewTimer returns a Timer that fires once d has passed on the clock.
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer delivers the clock's time on its channel once, when it fires.
+type Timer interface {
+	// Chan returns the channel the timer fires on.
+	Chan() <-chan time.Time
+	// Stop prevents the timer from firing, returning false if it already
+	// fired or was stopped.
+	Stop() bool
+}
+
+// systemClock implements Clock using the system time.
+type systemClock struct{}
+
+// NewSystemClock returns a Clock reading the system time.
+func NewSystemClock() Clock {
+	return &systemClock{}
+}
+
+// Now returns the current system time.
+func (sc *systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// NewTimer returns a Timer backed by a time.Timer.
+func (sc *systemClock) NewTimer(d time.Duration) Timer {
+	return &systemTimer{time.NewTimer(d)}
+}
+
+// systemTimer implements Timer using a time.Timer.
+type systemTimer struct {
+	*time.Timer
+}
+
+// Chan returns the channel the timer fires on.
+func (st *systemTimer) Chan() <-chan time.Time {
+	return st.C
+}
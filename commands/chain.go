@@ -10,6 +10,8 @@ import (
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-ipfs-cmdkit"
 	"github.com/ipfs/go-ipfs-cmds"
+	"github.com/ipfs/go-ipfs-files"
+	"github.com/pkg/errors"
 
 	"github.com/filecoin-project/go-filecoin/types"
 )
@@ -19,8 +21,10 @@ var chainCmd = &cmds.Command{
 		Tagline: "Inspect the filecoin blockchain",
 	},
 	Subcommands: map[string]*cmds.Command{
-		"head": chainHeadCmd,
-		"ls":   chainLsCmd,
+		"head":   chainHeadCmd,
+		"import": chainImportCmd,
+		"ls":     chainLsCmd,
+		"supply": chainSupplyCmd,
 	},
 }
 
@@ -49,6 +53,50 @@ var chainHeadCmd = &cmds.Command{
 	},
 }
 
+var chainImportCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Import a chain from a CAR file",
+		ShortDescription: `
+Imports the chain held in a CAR file, such as one written by an export, without
+validating it. The chain must link to a tipset the node already holds. Once
+imported, the node syncs from the imported head to the highest head announced by
+its peers. Prints the CIDs of the imported head.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.FileArg("file", true, false, "Path to the CAR file to import").EnableStdin(),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		iter := req.Files.Entries()
+		if !iter.Next() {
+			return fmt.Errorf("no file given: %s", iter.Err())
+		}
+
+		fi, ok := iter.Node().(files.File)
+		if !ok {
+			return fmt.Errorf("given file was not a files.File")
+		}
+
+		head, err := GetPorcelainAPI(env).ChainImport(req.Context, fi)
+		if err != nil {
+			return err
+		}
+		return re.Emit(head.ToSortedCidSet().ToSlice())
+	},
+	Type: []cid.Cid{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, res []cid.Cid) error {
+			for _, r := range res {
+				_, err := fmt.Fprintln(w, r.String())
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}),
+	},
+}
+
 var chainLsCmd = &cmds.Command{
 	Helptext: cmdkit.HelpText{
 		Tagline:          "List blocks in the blockchain",
@@ -108,3 +156,38 @@ var chainLsCmd = &cmds.Command{
 		}),
 	},
 }
+
+var chainSupplyCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Show the total supply of FIL",
+		ShortDescription: `
+Prints the sum of the balances of every actor in the state of the tipset made
+of the given block cids, or in the head state if none are given.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("tipset", false, true, "CIDs of the blocks of the tipset"),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		var tsKey types.SortedCidSet
+		for _, arg := range req.Arguments {
+			c, err := cid.Parse(arg)
+			if err != nil {
+				return errors.Wrap(err, "invalid block cid "+arg)
+			}
+			tsKey.Add(c)
+		}
+
+		supply, err := GetPorcelainAPI(env).ChainTotalSupply(req.Context, tsKey)
+		if err != nil {
+			return err
+		}
+		return re.Emit(supply)
+	},
+	Type: &types.AttoFIL{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, supply *types.AttoFIL) error {
+			return PrintString(w, supply)
+		}),
+	},
+}
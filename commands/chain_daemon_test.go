@@ -36,6 +36,25 @@ func TestChainHead(t *testing.T) {
 	assert.Equal(t, textCid, cidsFromJSON[0])
 }
 
+func TestChainSupply(t *testing.T) {
+	tf.IntegrationTest(t)
+
+	d := th.NewDaemon(t).Start()
+	defer d.ShutdownSuccess()
+
+	head := d.RunSuccess("chain", "head", "--enc", "text").ReadStdoutTrimNewlines()
+
+	atHead := d.RunSuccess("chain", "supply").ReadStdoutTrimNewlines()
+	supply, ok := types.NewAttoFILFromFILString(atHead)
+	require.True(t, ok, "supply %s", atHead)
+	assert.True(t, supply.GreaterThan(types.ZeroAttoFIL))
+
+	atTipSet := d.RunSuccess("chain", "supply", head).ReadStdoutTrimNewlines()
+	assert.Equal(t, atHead, atTipSet)
+
+	d.RunFail("invalid block cid", "chain", "supply", "notacid")
+}
+
 func TestChainLs(t *testing.T) {
 	tf.IntegrationTest(t)
 
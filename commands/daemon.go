@@ -38,6 +38,7 @@ var daemonCmd = &cmds.Command{
 		cmdkit.BoolOption(OfflineMode, "start the node without networking"),
 		cmdkit.BoolOption(ELStdout),
 		cmdkit.BoolOption(IsRelay, "advertise and allow filecoin network traffic to be relayed through this node"),
+		cmdkit.BoolOption(SafeBoot, "check the chain store for consistency and repair it before syncing"),
 		cmdkit.StringOption(BlockTime, "time a node waits before trying to mine the next block").WithDefault(mining.DefaultBlockTime.String()),
 	},
 	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
@@ -73,6 +74,10 @@ func daemonRun(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment)
 		rep.Config().Swarm.PublicRelayAddress = publicRelayAddress
 	}
 
+	if safeBoot, ok := req.Options[SafeBoot].(bool); ok && safeBoot {
+		rep.Config().Sync.SafeBoot = true
+	}
+
 	opts, err := node.OptionsFromRepo(rep)
 	if err != nil {
 		return err
@@ -81,6 +81,10 @@ const (
 	// IsRelay when set causes the the daemon to provide libp2p relay
 	// services allowing other filecoin nodes behind NATs to talk directly.
 	IsRelay = "is-relay"
+
+	// SafeBoot when set causes the daemon to check the chain store for
+	// consistency, repairing it if needed, before syncing.
+	SafeBoot = "safe-boot"
 )
 
 // command object for the local cli
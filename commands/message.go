@@ -25,6 +25,7 @@ var msgCmd = &cmds.Command{
 		Tagline: "Send and monitor messages",
 	},
 	Subcommands: map[string]*cmds.Command{
+		"find":   msgFindCmd,
 		"send":   msgSendCmd,
 		"status": msgStatusCmd,
 		"wait":   msgWaitCmd,
@@ -303,6 +304,62 @@ var msgStatusCmd = &cmds.Command{
 	},
 }
 
+// MessageFindResult is the location of a message in a tipset.
+type MessageFindResult struct {
+	Found bool
+	Block cid.Cid
+	Index int
+}
+
+var msgFindCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Find the block and index of a message in a tipset",
+		ShortDescription: `
+Locates the message in the tipset made of the given block cids, or in the head
+tipset if none are given, printing the block including it and the message's
+index in that block.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("cid", true, false, "CID of the message to find"),
+		cmdkit.StringArg("tipset", false, true, "CIDs of the blocks of the tipset to search"),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		msgCid, err := cid.Parse(req.Arguments[0])
+		if err != nil {
+			return errors.Wrap(err, "invalid cid "+req.Arguments[0])
+		}
+
+		var tsKey types.SortedCidSet
+		for _, arg := range req.Arguments[1:] {
+			c, err := cid.Parse(arg)
+			if err != nil {
+				return errors.Wrap(err, "invalid block cid "+arg)
+			}
+			tsKey.Add(c)
+		}
+
+		var result MessageFindResult
+		result.Block, result.Index, result.Found, err = GetPorcelainAPI(env).ChainMessageInclusion(req.Context, msgCid, tsKey)
+		if err != nil {
+			return err
+		}
+		return re.Emit(&result)
+	},
+	Type: &MessageFindResult{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, res *MessageFindResult) error {
+			sw := NewSilentWriter(w)
+			if !res.Found {
+				sw.Println("Message not found in tipset")
+			} else {
+				sw.Printf("In block %s at index %d\n", res.Block, res.Index)
+			}
+			return sw.Error()
+		}),
+	},
+}
+
 func appendJSON(val interface{}, out []byte) ([]byte, error) {
 	m, err := json.MarshalIndent(val, "", "\t")
 	if err != nil {
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"io"
 	"math/big"
+	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-ipfs-cmdkit"
@@ -420,9 +422,32 @@ var minerPowerCmd = &cmds.Command{
 	Helptext: cmdkit.HelpText{
 		Tagline: "Get the power of a miner versus the total storage market power",
 		ShortDescription: `Check the current power of a given miner and total power of the storage market.
-Values will be output as a ratio where the first number is the miner power and second is the total market power.`,
+Values will be output as a ratio where the first number is the miner power and second is the total market power.
+Without a miner, the power of every miner is listed, followed by the total market power.`,
 	},
 	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		if len(req.Arguments) == 0 {
+			powers, total, err := GetPorcelainAPI(env).MinerPowerTable(req.Context, types.SortedCidSet{})
+			if err != nil {
+				return err
+			}
+
+			miners := make([]address.Address, 0, len(powers))
+			for addr := range powers {
+				miners = append(miners, addr)
+			}
+			sort.Slice(miners, func(i, j int) bool {
+				return miners[i].String() < miners[j].String()
+			})
+
+			var sb strings.Builder
+			for _, addr := range miners {
+				fmt.Fprintf(&sb, "%s: %s\n", addr, powers[addr]) // nolint: govet
+			}
+			fmt.Fprintf(&sb, "total: %s", total) // nolint: govet
+			return re.Emit(sb.String())
+		}
+
 		minerAddr, err := optionalAddr(req.Arguments[0])
 		if err != nil {
 			return err
@@ -454,7 +479,7 @@ Values will be output as a ratio where the first number is the miner power and s
 		return re.Emit(str)
 	},
 	Arguments: []cmdkit.Argument{
-		cmdkit.StringArg("miner", true, false, "The address of the miner"),
+		cmdkit.StringArg("miner", false, false, "The address of the miner"),
 	},
 	Encoders: cmds.EncoderMap{
 		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, a string) error {
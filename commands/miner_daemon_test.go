@@ -444,6 +444,11 @@ func TestMinerPower(t *testing.T) {
 
 	assert.NoError(t, err)
 	assert.Equal(t, "3072 / 6144", power)
+
+	tableOutput := d.RunSuccess("miner", "power")
+	table := tableOutput.ReadStdoutTrimNewlines()
+	assert.Contains(t, table, addressStruct.Address+": 3072")
+	assert.True(t, strings.HasSuffix(table, "total: 6144"))
 }
 
 var testConfig = &gengen.GenesisCfg{
@@ -12,22 +12,26 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/sampling"
 	"github.com/filecoin-project/go-filecoin/types"
 )
 
 // Config is an in memory representation of the filecoin configuration file
 type Config struct {
-	API           *APIConfig           `json:"api"`
-	Bootstrap     *BootstrapConfig     `json:"bootstrap"`
-	Datastore     *DatastoreConfig     `json:"datastore"`
-	Heartbeat     *HeartbeatConfig     `json:"heartbeat"`
-	Mining        *MiningConfig        `json:"mining"`
-	Mpool         *MessagePoolConfig   `json:"mpool"`
-	Net           string               `json:"net"`
-	Observability *ObservabilityConfig `json:"observability"`
-	SectorBase    *SectorBaseConfig    `json:"sectorbase"`
-	Swarm         *SwarmConfig         `json:"swarm"`
-	Wallet        *WalletConfig        `json:"wallet"`
+	API            *APIConfig           `json:"api"`
+	Bootstrap      *BootstrapConfig     `json:"bootstrap"`
+	Datastore      *DatastoreConfig     `json:"datastore"`
+	Heartbeat      *HeartbeatConfig     `json:"heartbeat"`
+	MinerAllowlist []address.Address    `json:"minerAllowlist"`
+	Mining         *MiningConfig        `json:"mining"`
+	Mpool          *MessagePoolConfig   `json:"mpool"`
+	Net            string               `json:"net"`
+	NetworkName    string               `json:"networkName"`
+	Observability  *ObservabilityConfig `json:"observability"`
+	SectorBase     *SectorBaseConfig    `json:"sectorbase"`
+	Swarm          *SwarmConfig         `json:"swarm"`
+	Sync           *SyncConfig          `json:"sync"`
+	Wallet         *WalletConfig        `json:"wallet"`
 }
 
 // APIConfig holds all configuration options related to the api.
@@ -56,6 +60,13 @@ func newDefaultAPIConfig() *APIConfig {
 type DatastoreConfig struct {
 	Type string `json:"type"`
 	Path string `json:"path"`
+	// CompactOnClose runs a compaction pass over the datastores when the
+	// repo is closed.  It reclaims space after heavy writes, such as a long
+	// sync, at the cost of shutdown latency.
+	CompactOnClose bool `json:"compactOnClose"`
+	// Instrument records the latency of the operations on the datastores as
+	// metrics.  It helps tell whether a slow sync is bound by storage.
+	Instrument bool `json:"instrument"`
 }
 
 // Validators hold the list of validation functions for each configuration
@@ -107,6 +118,10 @@ type MiningConfig struct {
 	MinerAddress            address.Address `json:"minerAddress"`
 	AutoSealIntervalSeconds uint            `json:"autoSealIntervalSeconds"`
 	StoragePrice            *types.AttoFIL  `json:"storagePrice"`
+	// StaleHeadTolerance is the number of rounds the node's head may lag
+	// the highest height seen on the network before mining pauses.  Zero
+	// disables the check.
+	StaleHeadTolerance uint64 `json:"staleHeadTolerance"`
 }
 
 func newDefaultMiningConfig() *MiningConfig {
@@ -114,6 +129,138 @@ func newDefaultMiningConfig() *MiningConfig {
 		MinerAddress:            address.Undef,
 		AutoSealIntervalSeconds: 120,
 		StoragePrice:            types.NewZeroAttoFIL(),
+		StaleHeadTolerance:      0,
+	}
+}
+
+// SyncConfig holds all configuration options related to the chain syncer.
+type SyncConfig struct {
+	// BlockMirrorURL is the base URL of an optional HTTP(S) block mirror
+	// serving blocks at <url>/block/<cid>.  When set, the syncer fetches
+	// blocks from the local store, then the mirror, then bitswap.
+	BlockMirrorURL string `json:"blockMirrorURL"`
+	// DisableWiden turns off the syncer's widen step, which looks for a
+	// heavier tipset by merging an incoming tipset with stored tipsets of
+	// the same parents.  Sync remains correct without it.
+	DisableWiden bool `json:"disableWiden"`
+	// EagerDialPeers makes the syncer dial bootstrap peers when it starts
+	// fetching a chain while the node has fewer than
+	// Bootstrap.MinPeerThreshold peers, rather than wait for the next
+	// bootstrap period.
+	EagerDialPeers bool `json:"eagerDialPeers"`
+	// ExpectedStateRoots maps block heights (decimal strings) to the state
+	// root cids that syncing a tipset at that height must compute.  A tipset
+	// computing a different root is rejected.
+	ExpectedStateRoots map[string]string `json:"expectedStateRoots"`
+	// FinalityDepth is the number of rounds below the head after which the
+	// chain is considered final.  Invalid tipsets remembered below finality
+	// are periodically forgotten.  Zero remembers them until evicted by
+	// newer invalid tipsets.
+	FinalityDepth uint64 `json:"finalityDepth"`
+	// HeadStallThreshold is how long a caught up node may go without a new
+	// head before it raises an alert that its head has stalled, which
+	// usually means it is isolated from the network.  Zero disables the
+	// alert.  Golang duration units are accepted.
+	HeadStallThreshold string `json:"headStallThreshold"`
+	// LateBlockGracePeriod is how long after its head advances that a caught
+	// up node still accepts blocks for the current or prior round.  Zero
+	// accepts late blocks for any round.  Golang duration units are accepted.
+	LateBlockGracePeriod string `json:"lateBlockGracePeriod"`
+	// LocalOnly syncs only from blocks already in the local blockstore and
+	// never fetches from the network.  A missing block fails the sync at
+	// once instead of waiting for peers.  Useful to validate an imported
+	// chain offline.
+	LocalOnly bool `json:"localOnly"`
+	// MaxActorGrowth is the most actors the messages of a tipset may add to
+	// the state.  Tipsets adding more are invalid.  It is a network
+	// parameter: every node of a network must use the same value.  Zero
+	// means no limit.
+	MaxActorGrowth uint64 `json:"maxActorGrowth"`
+	// MaxBlocksPerSync caps the number of blocks a single request to sync a
+	// new tipset fetches.  A request that reaches the cap remembers how far
+	// it walked and stops, and the next request for the chain resumes the
+	// walk.  Zero means no cap.
+	MaxBlocksPerSync int `json:"maxBlocksPerSync"`
+	// MaxPendingSyncs limits how many requests to sync a new tipset may be
+	// in progress or queued at once.  Requests over the limit are dropped.
+	// Zero means no limit.
+	MaxPendingSyncs int `json:"maxPendingSyncs"`
+	// MinBlocksPerTipSet is the number of blocks below which a synced
+	// tipset is reported as a sign of low participation in the network.
+	// Such tipsets are still synced.  Zero disables the warning.
+	MinBlocksPerTipSet int `json:"minBlocksPerTipSet"`
+	// OrphanWindow is how long a caught up node holds a block that arrives
+	// before its parent, waiting for the parent, before fetching the
+	// block's chain.  Zero fetches the chain immediately.  Golang duration
+	// units are accepted.
+	OrphanWindow string `json:"orphanWindow"`
+	// PruneFinalizedMessages drops the message bodies of blocks more than
+	// FinalityDepth rounds below the head to bound disk usage.  Block
+	// headers and state roots are kept.  It has no effect if FinalityDepth
+	// is zero.
+	PruneFinalizedMessages bool `json:"pruneFinalizedMessages"`
+	// RestoreGenesis restores the genesis tipset from the blockstore when the
+	// chain store lacks it at startup, as when the chain datastore was wiped.
+	// Otherwise the node refuses to start until the repo is initialized
+	// again.
+	RestoreGenesis bool `json:"restoreGenesis"`
+	// SafeBoot checks the chain store for consistency on startup, repairing
+	// the head if the stored chain is broken, before any sync begins.  It is
+	// off by default as the check walks the whole chain.
+	SafeBoot bool `json:"safeBoot"`
+	// SamplingLookback is the number of tipsets preceding the live proving
+	// periods that are gathered for consensus to sample randomness from.  It
+	// must cover the tipsets the protocol samples, so only networks whose
+	// protocol samples with a different lookback should change it.
+	SamplingLookback uint `json:"samplingLookback"`
+	// SignatureWorkers is the number of goroutines verifying the message
+	// signatures of a tipset in parallel before its messages are applied.
+	// Zero uses GOMAXPROCS.
+	SignatureWorkers int `json:"signatureWorkers"`
+	// StallThreshold is the number of consecutive timeouts fetching the same
+	// tipset after which sync is reported as stalled.  Zero disables stall
+	// detection.
+	StallThreshold int `json:"stallThreshold"`
+	// StateCacheBytes is the approximate number of bytes of state objects
+	// kept in memory to speed up validation.  The least recently used
+	// objects are evicted beyond it.  Zero disables the cache.
+	StateCacheBytes int `json:"stateCacheBytes"`
+	// StrictWiden checks that every tipset the syncer forms by merging an
+	// incoming tipset with stored tipsets of the same parents is a valid
+	// widening, and fails the sync loudly if not.  It guards against bugs
+	// in widen at a small cost.
+	StrictWiden bool `json:"strictWiden"`
+	// TransientRetries is the number of times a sync that fails for a
+	// transient reason, such as a fetch timeout or a failed datastore
+	// write, is retried with exponential backoff before it is given up.
+	// Zero disables retries.
+	TransientRetries int `json:"transientRetries"`
+}
+
+func newDefaultSyncConfig() *SyncConfig {
+	return &SyncConfig{
+		BlockMirrorURL:         "",
+		DisableWiden:           false,
+		EagerDialPeers:         false,
+		ExpectedStateRoots:     map[string]string{},
+		FinalityDepth:          900,
+		HeadStallThreshold:     "0s",
+		LateBlockGracePeriod:   "0s",
+		LocalOnly:              false,
+		MaxActorGrowth:         0,
+		MaxBlocksPerSync:       0,
+		MaxPendingSyncs:        0,
+		MinBlocksPerTipSet:     0,
+		OrphanWindow:           "0s",
+		PruneFinalizedMessages: false,
+		RestoreGenesis:         false,
+		SafeBoot:               false,
+		SamplingLookback:       sampling.LookbackParameter,
+		SignatureWorkers:       0,
+		StallThreshold:         3,
+		StateCacheBytes:        0,
+		StrictWiden:            false,
+		TransientRetries:       0,
 	}
 }
 
@@ -234,17 +381,20 @@ func newDefaultSectorbaseConfig() *SectorBaseConfig {
 // their default values
 func NewDefaultConfig() *Config {
 	return &Config{
-		API:           newDefaultAPIConfig(),
-		Bootstrap:     newDefaultBootstrapConfig(),
-		Datastore:     newDefaultDatastoreConfig(),
-		Swarm:         newDefaultSwarmConfig(),
-		Mining:        newDefaultMiningConfig(),
-		Wallet:        newDefaultWalletConfig(),
-		Heartbeat:     newDefaultHeartbeatConfig(),
-		Net:           "",
-		Mpool:         newDefaultMessagePoolConfig(),
-		SectorBase:    newDefaultSectorbaseConfig(),
-		Observability: newDefaultObservabilityConfig(),
+		API:            newDefaultAPIConfig(),
+		Bootstrap:      newDefaultBootstrapConfig(),
+		Datastore:      newDefaultDatastoreConfig(),
+		Swarm:          newDefaultSwarmConfig(),
+		Sync:           newDefaultSyncConfig(),
+		Mining:         newDefaultMiningConfig(),
+		Wallet:         newDefaultWalletConfig(),
+		Heartbeat:      newDefaultHeartbeatConfig(),
+		MinerAllowlist: []address.Address{},
+		Net:            "",
+		NetworkName:    "",
+		Mpool:          newDefaultMessagePoolConfig(),
+		SectorBase:     newDefaultSectorbaseConfig(),
+		Observability:  newDefaultObservabilityConfig(),
 	}
 }
 
@@ -289,6 +439,20 @@ func ReadFile(file string) (*Config, error) {
 	return cfg, nil
 }
 
+// Copy returns a deep copy of cfg, so that changes to the copy do not
+// affect cfg.
+func (cfg *Config) Copy() (*Config, error) {
+	cfgBytes, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	cpy := NewDefaultConfig()
+	if err := json.Unmarshal(cfgBytes, cpy); err != nil {
+		return nil, err
+	}
+	return cpy, nil
+}
+
 // Set sets the config sub-struct referenced by `key`, e.g. 'api.address'
 // or 'datastore' to the json key value pair encoded in jsonVal.
 func (cfg *Config) Set(dottedKey string, jsonString string) error {
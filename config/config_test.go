@@ -64,7 +64,9 @@ func TestWriteFile(t *testing.T) {
 	},
 	"datastore": {
 		"type": "badgerds",
-		"path": "badger"
+		"path": "badger",
+		"compactOnClose": false,
+		"instrument": false
 	},
 	"heartbeat": {
 		"beatTarget": "",
@@ -72,16 +74,19 @@ func TestWriteFile(t *testing.T) {
 		"reconnectPeriod": "10s",
 		"nickname": ""
 	},
+	"minerAllowlist": [],
 	"mining": {
 		"minerAddress": "empty",
 		"autoSealIntervalSeconds": 120,
-		"storagePrice": "0"
+		"storagePrice": "0",
+		"staleHeadTolerance": 0
 	},
 	"mpool": {
 		"maxPoolSize": 10000,
 		"maxNonceGap": "100"
 	},
 	"net": "",
+	"networkName": "",
 	"observability": {
 		"metrics": {
 			"prometheusEnabled": false,
@@ -100,6 +105,30 @@ func TestWriteFile(t *testing.T) {
 	"swarm": {
 		"address": "/ip4/0.0.0.0/tcp/6000"
 	},
+	"sync": {
+		"blockMirrorURL": "",
+		"disableWiden": false,
+		"eagerDialPeers": false,
+		"expectedStateRoots": {},
+		"finalityDepth": 900,
+		"headStallThreshold": "0s",
+		"lateBlockGracePeriod": "0s",
+		"localOnly": false,
+		"maxActorGrowth": null,
+		"maxBlocksPerSync": 0,
+		"maxPendingSyncs": 0,
+		"minBlocksPerTipSet": 0,
+		"orphanWindow": "0s",
+		"pruneFinalizedMessages": false,
+		"restoreGenesis": false,
+		"safeBoot": false,
+		"samplingLookback": null,
+		"signatureWorkers": 0,
+		"stallThreshold": 3,
+		"stateCacheBytes": 0,
+		"strictWiden": false,
+		"transientRetries": 0
+	},
 	"wallet": {
 		"defaultAddress": "empty"
 	}
@@ -144,6 +173,22 @@ func TestConfigRoundtrip(t *testing.T) {
 	assert.Equal(t, cfg, cfgout)
 }
 
+func TestConfigCopy(t *testing.T) {
+	tf.UnitTest(t)
+
+	cfg := NewDefaultConfig()
+	cfg.NetworkName = "original"
+
+	cpy, err := cfg.Copy()
+	require.NoError(t, err)
+	assert.Equal(t, cfg, cpy)
+
+	cpy.NetworkName = "copy"
+	cpy.Sync.FinalityDepth++
+	assert.Equal(t, "original", cfg.NetworkName)
+	assert.Equal(t, NewDefaultConfig().Sync.FinalityDepth, cfg.Sync.FinalityDepth)
+}
+
 func TestConfigReadFileDefaults(t *testing.T) {
 	tf.UnitTest(t)
 
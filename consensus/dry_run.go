@@ -0,0 +1,69 @@
+package consensus
+
+import (
+	blocks "github.com/ipfs/go-block-format"
+	bserv "github.com/ipfs/go-blockservice"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dss "github.com/ipfs/go-datastore/sync"
+	"github.com/ipfs/go-hamt-ipld"
+	"github.com/ipfs/go-ipfs-blockstore"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+)
+
+// NewDryRunStores returns a blockstore and a cbor store over it that read
+// through to bs but write only to memory.  State computed with them can be
+// flushed to obtain its root without writing anything to bs, so validation
+// passes run on them have no storage side effects.  Objects written are
+// discarded with the stores.
+func NewDryRunStores(bs blockstore.Blockstore) (*hamt.CborIpldStore, blockstore.Blockstore) {
+	overlay := &dryRunBlockstore{
+		Blockstore: blockstore.NewBlockstore(dss.MutexWrap(datastore.NewMapDatastore())),
+		base:       bs,
+	}
+	return &hamt.CborIpldStore{Blocks: bserv.New(overlay, offline.Exchange(overlay))}, overlay
+}
+
+// dryRun returns a copy of c that reads state from c's stores but writes it
+// only to memory.
+func (c *Expected) dryRun() *Expected {
+	cpy := *c
+	cpy.cstore, cpy.bstore = NewDryRunStores(c.bstore)
+	return &cpy
+}
+
+// dryRunBlockstore is a blockstore whose writes go to an in-memory blockstore
+// and whose reads fall through to base for blocks not written.  Deletes only
+// remove written blocks.
+type dryRunBlockstore struct {
+	blockstore.Blockstore
+	base blockstore.Blockstore
+}
+
+// Has returns true if the block with cid c was written or is in base.
+func (bs *dryRunBlockstore) Has(c cid.Cid) (bool, error) {
+	has, err := bs.Blockstore.Has(c)
+	if err != nil || has {
+		return has, err
+	}
+	return bs.base.Has(c)
+}
+
+// Get returns the written block with cid c, or the one in base.
+func (bs *dryRunBlockstore) Get(c cid.Cid) (blocks.Block, error) {
+	blk, err := bs.Blockstore.Get(c)
+	if err == blockstore.ErrNotFound {
+		return bs.base.Get(c)
+	}
+	return blk, err
+}
+
+// GetSize returns the size of the written block with cid c, or of the one in
+// base.
+func (bs *dryRunBlockstore) GetSize(c cid.Cid) (int, error) {
+	size, err := bs.Blockstore.GetSize(c)
+	if err == blockstore.ErrNotFound {
+		return bs.base.GetSize(c)
+	}
+	return size, err
+}
@@ -4,12 +4,12 @@ package consensus
 // See: https://github.com/filecoin-project/specs/blob/master/expected-consensus.md
 
 import (
-	"bytes"
 	"context"
 	"encoding/binary"
 	"fmt"
 	"math/big"
 	"strings"
+	"time"
 
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-hamt-ipld"
@@ -49,6 +49,12 @@ var (
 	ErrInvalidBase = errors.New("block does not connect to a known good chain")
 	// ErrUnorderedTipSets is returned when weight and minticket are the same between two tipsets.
 	ErrUnorderedTipSets = errors.New("trying to order two identical tipsets")
+	// ErrStateGrowthExceeded is returned when a tipset adds more actors to the state than allowed.
+	ErrStateGrowthExceeded = errors.New("tipset exceeds the maximum state growth")
+	// ErrLosingTicket is returned when a block's ticket does not win the block's miner the right to mine.
+	ErrLosingTicket = errors.New("not a winning ticket")
+	// ErrOffGridTimestamp is returned when a block's timestamp is not the start of the round at its height.
+	ErrOffGridTimestamp = errors.New("block timestamp is not on the block time grid")
 )
 
 // TicketSigner is an interface for a test signer that can create tickets.
@@ -73,11 +79,13 @@ const AncestorRoundsNeeded = miner.ProvingPeriodBlocks + miner.GracePeriodBlocks
 
 // A Processor processes all the messages in a block or tip set.
 type Processor interface {
-	// ProcessBlock processes all messages in a block.
-	ProcessBlock(ctx context.Context, st state.Tree, vms vm.StorageMap, blk *types.Block, ancestors []types.TipSet) ([]*ApplicationResult, error)
+	// ProcessBlock processes all messages in a block.  The signatures in
+	// sigs are taken as verified; others are verified while processing.
+	ProcessBlock(ctx context.Context, st state.Tree, vms vm.StorageMap, blk *types.Block, ancestors []types.TipSet, sigs VerifiedSignatures) ([]*ApplicationResult, error)
 
-	// ProcessTipSet processes all messages in a tip set.
-	ProcessTipSet(ctx context.Context, st state.Tree, vms vm.StorageMap, ts types.TipSet, ancestors []types.TipSet) (*ProcessTipSetResponse, error)
+	// ProcessTipSet processes all messages in a tip set.  The signatures in
+	// sigs are taken as verified; others are verified while processing.
+	ProcessTipSet(ctx context.Context, st state.Tree, vms vm.StorageMap, ts types.TipSet, ancestors []types.TipSet, sigs VerifiedSignatures) (*ProcessTipSetResponse, error)
 }
 
 // Expected implements expected consensus.
@@ -100,14 +108,70 @@ type Expected struct {
 	genesisCid cid.Cid
 
 	verifier proofs.Verifier
+
+	// weight computes tipset weights for fork choice.  It defaults to the
+	// EC weight.
+	weight WeightFunc
+
+	// maxActorGrowth is the most actors a tipset may add to the state.
+	// Zero means no limit.
+	maxActorGrowth uint64
+
+	// sigWorkers is the number of goroutines verifying message signatures.
+	// Zero or less uses GOMAXPROCS.
+	sigWorkers int
+
+	// genesisTime and blockTime place the rounds blocks are timestamped
+	// with.  A zero blockTime leaves timestamps unchecked.
+	genesisTime time.Time
+	blockTime   time.Duration
+}
+
+// WeightFunc returns the weight of the tipset ts with parent state pSt in
+// uint64 encoded fixed point representation.  Fork choice prefers heavier
+// tipsets.
+type WeightFunc func(ctx context.Context, ts types.TipSet, pSt state.Tree) (uint64, error)
+
+// ExpectedOpt configures optional behavior of Expected.
+type ExpectedOpt func(*Expected)
+
+// WithWeightFunc replaces the EC weight with weight so that alternative fork
+// choice rules can be tried without changing the rest of consensus.
+func WithWeightFunc(weight WeightFunc) ExpectedOpt {
+	return func(c *Expected) {
+		c.weight = weight
+	}
+}
+
+// WithMaxActorGrowth bounds the number of actors the messages of a tipset may
+// add to the state, so that messages cannot exhaust disk by growing the state
+// without limit.  Tipsets over the bound are invalid.  The bound is a network
+// parameter: all nodes of a network must agree on it.  Checking it diffs the
+// parent and resulting state trees of each tipset, walking only the parts of
+// the trees that differ.
+func WithMaxActorGrowth(max uint64) ExpectedOpt {
+	return func(c *Expected) {
+		c.maxActorGrowth = max
+	}
+}
+
+// WithBlockTimeGrid requires each block's timestamp to be the start of the
+// round at its height: genesisTime plus height times blockTime.  Blocks off
+// the grid are invalid.  Both values are network parameters, so every node
+// on a network must agree on them.
+func WithBlockTimeGrid(genesisTime time.Time, blockTime time.Duration) ExpectedOpt {
+	return func(c *Expected) {
+		c.genesisTime = genesisTime
+		c.blockTime = blockTime
+	}
 }
 
 // Ensure Expected satisfies the Protocol interface at compile time.
 var _ Protocol = (*Expected)(nil)
 
 // NewExpected is the constructor for the Expected consenus.Protocol module.
-func NewExpected(cs *hamt.CborIpldStore, bs blockstore.Blockstore, processor Processor, pt PowerTableView, gCid cid.Cid, verifier proofs.Verifier) Protocol {
-	return &Expected{
+func NewExpected(cs *hamt.CborIpldStore, bs blockstore.Blockstore, processor Processor, pt PowerTableView, gCid cid.Cid, verifier proofs.Verifier, opts ...ExpectedOpt) Protocol {
+	c := &Expected{
 		cstore:       cs,
 		bstore:       bs,
 		processor:    processor,
@@ -115,12 +179,19 @@ func NewExpected(cs *hamt.CborIpldStore, bs blockstore.Blockstore, processor Pro
 		genesisCid:   gCid,
 		verifier:     verifier,
 	}
+	c.weight = c.ecWeight
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
 // NewValidTipSet creates a new tipset from the input blocks that is guaranteed
 // to be valid. It operates by validating each block and further checking that
 // this tipset contains only blocks with the same heights, parent weights,
-// and parent sets.
+// and parent sets.  Blocks carry no commitment to the parent state root, only
+// to the state after their own messages, so agreement on parent state follows
+// from agreement on the parent set: the parent state is computed from it.
 func (c *Expected) NewValidTipSet(ctx context.Context, blks []*types.Block) (types.TipSet, error) {
 	for _, blk := range blks {
 		if err := c.validateBlockStructure(ctx, blk); err != nil {
@@ -141,12 +212,26 @@ func (c *Expected) validateBlockStructure(ctx context.Context, b *types.Block) e
 		return fmt.Errorf("block has nil StateRoot")
 	}
 
+	if c.blockTime > 0 {
+		expected := c.genesisTime.Add(time.Duration(b.Height) * c.blockTime).Unix()
+		if int64(b.Timestamp) != expected {
+			return errors.Wrapf(ErrOffGridTimestamp, "block %s at height %d has timestamp %d, expected %d", b.Cid().String(), b.Height, b.Timestamp, expected)
+		}
+	}
+
 	return nil
 }
 
-// Weight returns the EC weight of this TipSet in uint64 encoded fixed point
-// representation.
+// Weight returns the weight of this TipSet in uint64 encoded fixed point
+// representation as computed by the configured WeightFunc, by default the EC
+// weight.
 func (c *Expected) Weight(ctx context.Context, ts types.TipSet, pSt state.Tree) (uint64, error) {
+	return c.weight(ctx, ts, pSt)
+}
+
+// ecWeight returns the EC weight of this TipSet in uint64 encoded fixed point
+// representation.
+func (c *Expected) ecWeight(ctx context.Context, ts types.TipSet, pSt state.Tree) (uint64, error) {
 	ctx = log.Start(ctx, "Expected.Weight")
 	log.LogKV(ctx, "Weight", ts.String())
 	if len(ts) == 1 && ts.ToSlice()[0].Cid().Equals(c.genesisCid) {
@@ -217,16 +302,16 @@ func (c *Expected) IsHeavier(ctx context.Context, a, b types.TipSet, aSt, bSt st
 		return false, err
 	}
 
-	cmp := bytes.Compare(bTicket, aTicket)
-	if cmp != 0 {
-		// a is heavier if b's ticket is greater than a's ticket.
-		return cmp == 1, nil
+	if !aTicket.Equals(bTicket) {
+		// a is heavier if a's ticket is smaller than b's ticket.
+		log.Debugf("breaking weight tie between %s and %s on min tickets %s and %s", a.String(), b.String(), aTicket, bTicket)
+		return aTicket.Less(bTicket), nil
 	}
 
 	// Tie break on cid ids.
 	// TODO: I think this is drastically impacted by number of blocks in tipset
 	// i.e. bigger tipset is always heavier.  Not sure if this is ok, need to revist.
-	cmp = strings.Compare(a.String(), b.String())
+	cmp := strings.Compare(a.String(), b.String())
 	if cmp == 0 {
 		// Caller is mistakenly calling on two identical tipsets.
 		return false, ErrUnorderedTipSets
@@ -235,16 +320,17 @@ func (c *Expected) IsHeavier(ctx context.Context, a, b types.TipSet, aSt, bSt st
 }
 
 // RunStateTransition is the chain transition function that goes from a
-// starting state and a tipset to a new state.  It errors if the tipset was not
-// mined according to the EC rules, or if running the messages in the tipset
-// results in an error.
-func (c *Expected) RunStateTransition(ctx context.Context, ts types.TipSet, ancestors []types.TipSet, pSt state.Tree) (st state.Tree, err error) {
+// starting state and a tipset to a new state.  It also returns the total gas
+// used by the messages of the tipset.  It errors if the tipset was not mined
+// according to the EC rules, or if running the messages in the tipset results
+// in an error.
+func (c *Expected) RunStateTransition(ctx context.Context, ts types.TipSet, ancestors []types.TipSet, pSt state.Tree) (st state.Tree, gasUsed types.GasUnits, err error) {
 	ctx, span := trace.StartSpan(ctx, "Expected.RunStateTransition")
 	span.AddAttributes(trace.StringAttribute("tipset", ts.String()))
 	defer tracing.AddErrorEndSpan(ctx, span, &err)
 
 	if err := c.validateMining(ctx, pSt, ts, ancestors[0]); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
 	sl := ts.ToSlice()
@@ -260,16 +346,87 @@ func (c *Expected) RunStateTransition(ctx context.Context, ts types.TipSet, ance
 		}
 	}
 
+	// Flush before running messages, which may modify pSt.
+	var parentRoot cid.Cid
+	if c.maxActorGrowth > 0 {
+		if parentRoot, err = pSt.Flush(ctx); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	// Verify signatures in parallel up front, since applying messages is
+	// sequential.
+	sigs, err := verifyTipSetSignatures(ts, c.sigWorkers)
+	if err != nil {
+		return nil, 0, err
+	}
+
 	vms := vm.NewStorageMap(c.bstore)
-	st, err = c.runMessages(ctx, pSt, vms, ts, ancestors)
+	st, gasUsed, err = c.runMessages(ctx, pSt, vms, ts, ancestors, sigs)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
+	}
+	if c.maxActorGrowth > 0 {
+		root, err := st.Flush(ctx)
+		if err != nil {
+			return nil, 0, err
+		}
+		growth, err := actorGrowth(ctx, c.cstore, parentRoot, root)
+		if err != nil {
+			return nil, 0, err
+		}
+		if growth > 0 && uint64(growth) > c.maxActorGrowth {
+			return nil, 0, errors.Wrapf(ErrStateGrowthExceeded, "tipset adds %d actors, maximum is %d", growth, c.maxActorGrowth)
+		}
 	}
 	err = vms.Flush()
+	if err != nil {
+		return nil, 0, err
+	}
+	return st, gasUsed, nil
+}
+
+// ValidateAgainstParent checks that candidate is a valid successor of the
+// tipset ancestors[0] whose state is parentState, and returns the resulting
+// state.  Unlike the syncer, it does not require the parent to be in the chain
+// store, so it can be used to check a tipset before it is stored (e.g. a block
+// the node just mined).  parentState is not modified.  The returned state is
+// held in memory over c's stores: flushing it yields its root without writing
+// to them, so validation has no storage side effects beyond flushing
+// parentState to its own store.
+func (c *Expected) ValidateAgainstParent(ctx context.Context, candidate types.TipSet, parentState state.Tree, ancestors []types.TipSet) (state.Tree, error) {
+	if len(candidate) == 0 {
+		return nil, errors.New("cannot validate empty tipset")
+	}
+	if len(ancestors) == 0 {
+		return nil, errors.New("cannot validate tipset without ancestors")
+	}
+	for _, blk := range candidate.ToSlice() {
+		if err := c.validateBlockStructure(ctx, blk); err != nil {
+			return nil, err
+		}
+	}
+	parents, err := candidate.Parents()
 	if err != nil {
 		return nil, err
 	}
-	return st, nil
+	if !parents.Equals(ancestors[0].ToSortedCidSet()) {
+		return nil, ErrInvalidBase
+	}
+
+	// Validate against a copy so the caller's parent state is left untouched,
+	// and in memory so that nothing computed is written to the store.
+	root, err := parentState.Flush(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "error flushing parent state")
+	}
+	dry := c.dryRun()
+	pSt, err := state.LoadStateTree(ctx, dry.cstore, root, builtin.Actors)
+	if err != nil {
+		return nil, errors.Wrap(err, "error copying parent state")
+	}
+	st, _, err := dry.RunStateTransition(ctx, candidate, ancestors, pSt)
+	return st, err
 }
 
 // validateMining checks validity of the block ticket, proof, and miner address.
@@ -294,7 +451,7 @@ func (c *Expected) validateMining(ctx context.Context, st state.Tree, ts types.T
 		}
 
 		if !result {
-			return errors.New("not a winning ticket")
+			return ErrLosingTicket
 		}
 	}
 	return nil
@@ -353,55 +510,85 @@ func CreateChallengeSeed(parents types.TipSet, nullBlkCount uint64) (types.PoStC
 // tipset to the input base state.  Messages are applied block by
 // block with blocks sorted by their ticket bytes.  The output state must be
 // flushed after calling to guarantee that the state transitions propagate.
+// runMessages also returns the total gas used by the applied messages.  The
+// signatures in sigs are taken as verified.
 //
 // An error is returned if individual blocks contain messages that do not
 // lead to successful state transitions.  An error is also returned if the node
 // faults while running aggregate state computation.
-func (c *Expected) runMessages(ctx context.Context, st state.Tree, vms vm.StorageMap, ts types.TipSet, ancestors []types.TipSet) (state.Tree, error) {
+func (c *Expected) runMessages(ctx context.Context, st state.Tree, vms vm.StorageMap, ts types.TipSet, ancestors []types.TipSet, sigs VerifiedSignatures) (state.Tree, types.GasUnits, error) {
 	var cpySt state.Tree
+	var gasUsed types.GasUnits
 
 	// TODO: order blocks in the tipset by ticket
 	// TODO: don't process messages twice
 	for _, blk := range ts.ToSlice() {
 		cpyCid, err := st.Flush(ctx)
 		if err != nil {
-			return nil, errors.Wrap(err, "error validating block state")
+			return nil, 0, errors.Wrap(err, "error validating block state")
 		}
 		// state copied so changes don't propagate between block validations
 		cpySt, err = state.LoadStateTree(ctx, c.cstore, cpyCid, builtin.Actors)
 		if err != nil {
-			return nil, errors.Wrap(err, "error validating block state")
+			return nil, 0, errors.Wrap(err, "error validating block state")
 		}
 
-		receipts, err := c.processor.ProcessBlock(ctx, cpySt, vms, blk, ancestors)
+		receipts, err := c.processor.ProcessBlock(ctx, cpySt, vms, blk, ancestors, sigs)
 		if err != nil {
-			return nil, errors.Wrap(err, "error validating block state")
+			return nil, 0, errors.Wrap(err, "error validating block state")
 		}
 		// TODO: check that receipts actually match
 		if len(receipts) != len(blk.MessageReceipts) {
-			return nil, fmt.Errorf("found invalid message receipts: %v %v", receipts, blk.MessageReceipts)
+			return nil, 0, fmt.Errorf("found invalid message receipts: %v %v", receipts, blk.MessageReceipts)
+		}
+		if len(ts) == 1 {
+			gasUsed = totalGasUsed(receipts)
 		}
 
 		outCid, err := cpySt.Flush(ctx)
 		if err != nil {
-			return nil, errors.Wrap(err, "error validating block state")
+			return nil, 0, errors.Wrap(err, "error validating block state")
 		}
 		if !outCid.Equals(blk.StateRoot) {
-			return nil, ErrStateRootMismatch
+			return nil, 0, ErrStateRootMismatch
 		}
 	}
 	if len(ts) == 1 { // block validation state == aggregate parent state
-		return cpySt, nil
+		return cpySt, gasUsed, nil
 	}
 	// multiblock tipsets require reapplying messages to get aggregate state
 	// NOTE: It is possible to optimize further by applying block validation
 	// in sorted order to reuse first block transitions as the starting state
 	// for the tipSetProcessor.
-	_, err := c.processor.ProcessTipSet(ctx, st, vms, ts, ancestors)
+	res, err := c.processor.ProcessTipSet(ctx, st, vms, ts, ancestors, sigs)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "error validating tipset")
+	}
+	return st, totalGasUsed(res.Results), nil
+}
+
+// totalGasUsed returns the gas used by all the applied messages of results.
+func totalGasUsed(results []*ApplicationResult) types.GasUnits {
+	var total types.GasUnits
+	for _, r := range results {
+		total += r.GasUsed
+	}
+	return total
+}
+
+// actorGrowth returns the number of actors the state tree with root to has
+// beyond the state tree with root from, which may be negative.  Only the
+// parts of the trees that differ are walked.
+func actorGrowth(ctx context.Context, store *hamt.CborIpldStore, from, to cid.Cid) (int, error) {
+	_, removed, err := state.DiffStateRoots(ctx, store, from, to)
+	if err != nil {
+		return 0, err
+	}
+	_, added, err := state.DiffStateRoots(ctx, store, to, from)
 	if err != nil {
-		return nil, errors.Wrap(err, "error validating tipset")
+		return 0, err
 	}
-	return st, nil
+	return len(added) - len(removed), nil
 }
 
 // CreateTicket computes a valid ticket.
@@ -5,8 +5,10 @@ import (
 	"encoding/hex"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/filecoin-project/go-filecoin/actor/builtin"
+	"github.com/filecoin-project/go-filecoin/actor/builtin/account"
 	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/consensus"
 	"github.com/filecoin-project/go-filecoin/proofs"
@@ -92,6 +94,47 @@ func TestExpected_NewValidTipSet(t *testing.T) {
 		assert.Error(t, err, "Foo")
 		assert.Nil(t, tipSet)
 	})
+
+	t.Run("NewValidTipSet rejects blocks disagreeing on parent weight", func(t *testing.T) {
+		parentBlock := types.NewBlockForTest(nil, 0)
+		parentBlock.StateRoot = types.SomeCid()
+
+		b1 := types.NewBlockForTest(parentBlock, 1)
+		b1.ParentWeight = types.Uint64(10)
+		b2 := types.NewBlockForTest(parentBlock, 2)
+		b2.ParentWeight = types.Uint64(20)
+		require.True(t, b1.Parents.Equals(b2.Parents))
+
+		exp := consensus.NewExpected(cistore, bstore, consensus.NewDefaultProcessor(), ptv, types.SomeCid(), verifier)
+
+		tipSet, err := exp.NewValidTipSet(ctx, []*types.Block{b1, b2})
+		assert.Error(t, err)
+		assert.Nil(t, tipSet)
+	})
+
+	t.Run("NewValidTipSet checks timestamps against the block time grid", func(t *testing.T) {
+		genesisTime := time.Unix(1000, 0)
+		blockTime := 30 * time.Second
+		exp := consensus.NewExpected(cistore, bstore, consensus.NewDefaultProcessor(), ptv, types.SomeCid(), verifier,
+			consensus.WithBlockTimeGrid(genesisTime, blockTime))
+
+		parentBlock := types.NewBlockForTest(nil, 0)
+		onGrid := types.NewBlockForTest(parentBlock, 1)
+		onGrid.Height = types.Uint64(3)
+		onGrid.StateRoot = types.SomeCid()
+		onGrid.Timestamp = types.Uint64(1090)
+		tipSet, err := exp.NewValidTipSet(ctx, []*types.Block{onGrid})
+		assert.NoError(t, err)
+		assert.NotNil(t, tipSet)
+
+		offGrid := types.NewBlockForTest(parentBlock, 2)
+		offGrid.Height = types.Uint64(3)
+		offGrid.StateRoot = types.SomeCid()
+		offGrid.Timestamp = types.Uint64(1091)
+		tipSet, err = exp.NewValidTipSet(ctx, []*types.Block{offGrid})
+		assert.Equal(t, consensus.ErrOffGridTimestamp, errors.Cause(err))
+		assert.Nil(t, tipSet)
+	})
 }
 
 // requireMakeBlocks sets up 3 blocks with 3 owner actors and 3 miner actors and puts them in the state tree.
@@ -163,7 +206,7 @@ func TestExpected_RunStateTransition_validateMining(t *testing.T) {
 		tipSet, err := exp.NewValidTipSet(ctx, blocks)
 		require.NoError(t, err)
 
-		_, err = exp.RunStateTransition(ctx, tipSet, []types.TipSet{pTipSet}, stateTree)
+		_, _, err = exp.RunStateTransition(ctx, tipSet, []types.TipSet{pTipSet}, stateTree)
 		assert.NoError(t, err)
 	})
 
@@ -185,11 +228,242 @@ func TestExpected_RunStateTransition_validateMining(t *testing.T) {
 		tipSet, err := exp.NewValidTipSet(ctx, blocks)
 		require.NoError(t, err)
 
-		_, err = exp.RunStateTransition(ctx, tipSet, []types.TipSet{pTipSet}, stateTree)
+		_, _, err = exp.RunStateTransition(ctx, tipSet, []types.TipSet{pTipSet}, stateTree)
 		assert.EqualError(t, err, "can't check for winning ticket: Couldn't get minerPower: something went wrong with the miner power")
 	})
 }
 
+// actorCreatingProcessor adds account actors at addrs to the state after the
+// wrapped processor runs, as messages creating actors would.
+type actorCreatingProcessor struct {
+	*consensus.DefaultProcessor
+	addrs []address.Address
+}
+
+func (p *actorCreatingProcessor) createActors(ctx context.Context, st state.Tree) error {
+	for _, addr := range p.addrs {
+		act, err := account.NewActor(types.NewZeroAttoFIL())
+		if err != nil {
+			return err
+		}
+		if err := st.SetActor(ctx, addr, act); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *actorCreatingProcessor) ProcessBlock(ctx context.Context, st state.Tree, vms vm.StorageMap, blk *types.Block, ancestors []types.TipSet, sigs consensus.VerifiedSignatures) ([]*consensus.ApplicationResult, error) {
+	results, err := p.DefaultProcessor.ProcessBlock(ctx, st, vms, blk, ancestors, sigs)
+	if err != nil {
+		return nil, err
+	}
+	return results, p.createActors(ctx, st)
+}
+
+func (p *actorCreatingProcessor) ProcessTipSet(ctx context.Context, st state.Tree, vms vm.StorageMap, ts types.TipSet, ancestors []types.TipSet, sigs consensus.VerifiedSignatures) (*consensus.ProcessTipSetResponse, error) {
+	response, err := p.DefaultProcessor.ProcessTipSet(ctx, st, vms, ts, ancestors, sigs)
+	if err != nil {
+		return nil, err
+	}
+	return response, p.createActors(ctx, st)
+}
+
+func TestExpected_RunStateTransition_maxActorGrowth(t *testing.T) {
+	tf.UnitTest(t)
+
+	ctx := context.Background()
+
+	cistore, bstore, verifier := setupCborBlockstoreProofs()
+	genesisBlock, err := consensus.DefaultGenesis(cistore, bstore)
+	require.NoError(t, err)
+	ptv := testhelpers.NewTestPowerTableView(types.NewBytesAmount(1), types.NewBytesAmount(1))
+
+	newAddr := address.NewForTestGetter()
+	processor := &actorCreatingProcessor{
+		DefaultProcessor: testhelpers.NewTestProcessor(),
+		addrs:            []address.Address{newAddr(), newAddr(), newAddr()},
+	}
+
+	// runTransition validates a tipset whose blocks add processor's three
+	// actors to their parent state under the given growth limit.
+	runTransition := func(t *testing.T, maxGrowth uint64) error {
+		exp := consensus.NewExpected(cistore, bstore, processor, ptv, genesisBlock.Cid(), verifier, consensus.WithMaxActorGrowth(maxGrowth))
+		pTipSet, err := exp.NewValidTipSet(ctx, []*types.Block{genesisBlock})
+		require.NoError(t, err)
+
+		parentState, err := state.LoadStateTree(ctx, cistore, genesisBlock.StateRoot, builtin.Actors)
+		require.NoError(t, err)
+		blocks := requireMakeBlocks(ctx, t, pTipSet, parentState, vm.NewStorageMap(bstore))
+
+		parentRoot, err := parentState.Flush(ctx)
+		require.NoError(t, err)
+		grown, err := state.LoadStateTree(ctx, cistore, parentRoot, builtin.Actors)
+		require.NoError(t, err)
+		require.NoError(t, processor.createActors(ctx, grown))
+		grownRoot, err := grown.Flush(ctx)
+		require.NoError(t, err)
+		for _, blk := range blocks {
+			blk.StateRoot = grownRoot
+		}
+
+		tipSet, err := exp.NewValidTipSet(ctx, blocks)
+		require.NoError(t, err)
+		_, _, err = exp.RunStateTransition(ctx, tipSet, []types.TipSet{pTipSet}, parentState)
+		return err
+	}
+
+	t.Run("growth within the limit passes", func(t *testing.T) {
+		assert.NoError(t, runTransition(t, 3))
+	})
+
+	t.Run("growth over the limit is rejected", func(t *testing.T) {
+		err := runTransition(t, 2)
+		assert.Equal(t, consensus.ErrStateGrowthExceeded, errors.Cause(err))
+	})
+}
+
+func TestExpected_ValidateAgainstParent(t *testing.T) {
+	tf.UnitTest(t)
+
+	ctx := context.Background()
+
+	cistore, bstore, verifier := setupCborBlockstoreProofs()
+	genesisBlock, err := consensus.DefaultGenesis(cistore, bstore)
+	require.NoError(t, err)
+
+	ptv := testhelpers.NewTestPowerTableView(types.NewBytesAmount(1), types.NewBytesAmount(1))
+	exp := consensus.NewExpected(cistore, bstore, testhelpers.NewTestProcessor(), ptv, genesisBlock.Cid(), verifier)
+
+	pTipSet, err := exp.NewValidTipSet(ctx, []*types.Block{genesisBlock})
+	require.NoError(t, err)
+
+	// The parent state is built up in memory and never stored against a tipset.
+	parentState, err := state.LoadStateTree(ctx, cistore, genesisBlock.StateRoot, builtin.Actors)
+	require.NoError(t, err)
+	blocks := requireMakeBlocks(ctx, t, pTipSet, parentState, vm.NewStorageMap(bstore))
+	candidate, err := exp.NewValidTipSet(ctx, blocks)
+	require.NoError(t, err)
+
+	t.Run("validates candidate against in-memory parent state", func(t *testing.T) {
+		parentRoot, err := parentState.Flush(ctx)
+		require.NoError(t, err)
+
+		st, err := exp.ValidateAgainstParent(ctx, candidate, parentState, []types.TipSet{pTipSet})
+		require.NoError(t, err)
+		require.NotNil(t, st)
+
+		afterRoot, err := parentState.Flush(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, parentRoot, afterRoot)
+	})
+
+	t.Run("rejects candidate that does not build on the given parent", func(t *testing.T) {
+		other := testhelpers.RequireNewTipSet(t, types.NewBlockForTest(nil, 42))
+		_, err := exp.ValidateAgainstParent(ctx, candidate, parentState, []types.TipSet{other})
+		assert.Equal(t, consensus.ErrInvalidBase, err)
+	})
+
+	t.Run("rejects missing ancestors", func(t *testing.T) {
+		_, err := exp.ValidateAgainstParent(ctx, candidate, parentState, nil)
+		assert.Error(t, err)
+	})
+}
+
+func TestExpected_ValidateAgainstParentWritesNothing(t *testing.T) {
+	tf.UnitTest(t)
+
+	ctx := context.Background()
+
+	cistore, bstore, verifier := setupCborBlockstoreProofs()
+	genesisBlock, err := consensus.DefaultGenesis(cistore, bstore)
+	require.NoError(t, err)
+
+	ptv := testhelpers.NewTestPowerTableView(types.NewBytesAmount(1), types.NewBytesAmount(1))
+	exp := consensus.NewExpected(cistore, bstore, testhelpers.NewTestProcessor(), ptv, genesisBlock.Cid(), verifier)
+
+	pTipSet, err := exp.NewValidTipSet(ctx, []*types.Block{genesisBlock})
+	require.NoError(t, err)
+	parentState, err := state.LoadStateTree(ctx, cistore, genesisBlock.StateRoot, builtin.Actors)
+	require.NoError(t, err)
+	blk := requireMakeBlocks(ctx, t, pTipSet, parentState, vm.NewStorageMap(bstore))[0]
+
+	// A transfer to a new address gives the transition new state to write.
+	mockSigner, _ := types.NewMockSignersAndKeyInfo(1)
+	sender := mockSigner.Addresses[0]
+	require.NoError(t, parentState.SetActor(ctx, sender, testhelpers.RequireNewAccountActor(t, types.NewAttoFILFromFIL(100))))
+	parentRoot, err := parentState.Flush(ctx)
+	require.NoError(t, err)
+	msg := types.NewMessage(sender, address.NewForTestGetter()(), 0, types.NewAttoFILFromFIL(1), "", nil)
+	smsg, err := types.NewSignedMessage(*msg, &mockSigner, types.NewGasPrice(1), types.NewGasUnits(0))
+	require.NoError(t, err)
+	blk.Messages = []*types.SignedMessage{smsg}
+	candidate, err := exp.NewValidTipSet(ctx, []*types.Block{blk})
+	require.NoError(t, err)
+
+	countObjects := func() int {
+		keys, err := bstore.AllKeysChan(ctx)
+		require.NoError(t, err)
+		n := 0
+		for range keys {
+			n++
+		}
+		return n
+	}
+
+	before := countObjects()
+	st, err := exp.ValidateAgainstParent(ctx, candidate, parentState, []types.TipSet{pTipSet})
+	require.NoError(t, err)
+	dryRoot, err := st.Flush(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, before, countObjects())
+
+	// Running the transition for real computes the same root, and does
+	// write new state.
+	pSt, err := state.LoadStateTree(ctx, cistore, parentRoot, builtin.Actors)
+	require.NoError(t, err)
+	realSt, _, err := exp.RunStateTransition(ctx, candidate, []types.TipSet{pTipSet}, pSt)
+	require.NoError(t, err)
+	realRoot, err := realSt.Flush(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, realRoot, dryRoot)
+	assert.NotEqual(t, parentRoot, realRoot)
+	assert.True(t, countObjects() > before)
+}
+
+func TestValidateOwnBlock(t *testing.T) {
+	tf.UnitTest(t)
+
+	ctx := context.Background()
+
+	cistore, bstore, verifier := setupCborBlockstoreProofs()
+	genesisBlock, err := consensus.DefaultGenesis(cistore, bstore)
+	require.NoError(t, err)
+
+	ptv := testhelpers.NewTestPowerTableView(types.NewBytesAmount(1), types.NewBytesAmount(1))
+	exp := consensus.NewExpected(cistore, bstore, testhelpers.NewTestProcessor(), ptv, genesisBlock.Cid(), verifier)
+
+	pTipSet, err := exp.NewValidTipSet(ctx, []*types.Block{genesisBlock})
+	require.NoError(t, err)
+	parentState, err := state.LoadStateTree(ctx, cistore, genesisBlock.StateRoot, builtin.Actors)
+	require.NoError(t, err)
+	blk := requireMakeBlocks(ctx, t, pTipSet, parentState, vm.NewStorageMap(bstore))[0]
+
+	t.Run("accepts a correctly built block", func(t *testing.T) {
+		assert.NoError(t, consensus.ValidateOwnBlock(ctx, exp, blk, pTipSet, parentState, nil))
+	})
+
+	t.Run("rejects a block with a wrong state root", func(t *testing.T) {
+		cpy := *blk
+		cpy.StateRoot = genesisBlock.StateRoot
+		wrongRoot, err := types.DecodeBlock(cpy.ToNode().RawData())
+		require.NoError(t, err)
+
+		err = consensus.ValidateOwnBlock(ctx, exp, wrongRoot, pTipSet, parentState, nil)
+		assert.Equal(t, consensus.ErrStateRootMismatch, errors.Cause(err))
+	})
+}
+
 func TestIsWinningTicket(t *testing.T) {
 	tf.UnitTest(t)
 
@@ -37,11 +37,12 @@ func init() {
 
 // Config is used to configure values in the GenesisInitFunction.
 type Config struct {
-	accounts   map[address.Address]*types.AttoFIL
-	nonces     map[address.Address]uint64
-	actors     map[address.Address]*actor.Actor
-	miners     map[address.Address]*miner.State
-	proofsMode types.ProofsMode
+	accounts    map[address.Address]*types.AttoFIL
+	nonces      map[address.Address]uint64
+	actors      map[address.Address]*actor.Actor
+	miners      map[address.Address]*miner.State
+	proofsMode  types.ProofsMode
+	networkName string
 }
 
 // GenOption is a configuration option for the GenesisInitFunction.
@@ -89,6 +90,15 @@ func ProofsMode(proofsMode types.ProofsMode) GenOption {
 	}
 }
 
+// NetworkName sets the name of the network the genesis block, and so every
+// block descending from it, is produced for.
+func NetworkName(name string) GenOption {
+	return func(gc *Config) error {
+		gc.networkName = name
+		return nil
+	}
+}
+
 // NewEmptyConfig inits and returns an empty config
 func NewEmptyConfig() *Config {
 	return &Config{
@@ -168,8 +178,9 @@ func MakeGenesisFunc(opts ...GenOption) GenesisInitFunc {
 		}
 
 		genesis := &types.Block{
-			StateRoot: c,
-			Nonce:     1337,
+			StateRoot:   c,
+			Nonce:       1337,
+			NetworkName: genCfg.networkName,
 		}
 
 		if _, err := cst.Put(ctx, genesis); err != nil {
@@ -0,0 +1,200 @@
+package consensus
+
+import (
+	"context"
+	"encoding/binary"
+	"sync"
+
+	"github.com/ipfs/go-cid"
+	"github.com/minio/sha256-simd"
+
+	"github.com/filecoin-project/go-filecoin/actor"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/state"
+	"github.com/filecoin-project/go-filecoin/types"
+	"github.com/filecoin-project/go-filecoin/util/lru"
+	"github.com/filecoin-project/go-filecoin/vm"
+	"github.com/filecoin-project/go-filecoin/vm/errors"
+)
+
+// MessageResultCache holds the results of successfully applied messages so
+// that applying the same message to the same inputs, as happens when a reorg
+// replays messages of a dropped chain, need not run the VM again.
+//
+// An entry is keyed by every input to message application: the parent state
+// root, the message cid, the miner owner receiving gas, the block height, the
+// gas already consumed in the block and the ancestor tipsets used for
+// randomness.  It records the receipt, the gas consumed and the final value of
+// every actor the application wrote.  The cache holds at most maxSize entries,
+// evicting the least recently used.
+type MessageResultCache struct {
+	mu sync.Mutex
+	// apps holds messageApplications by key.
+	apps   *lru.Cache
+	hits   uint64
+	misses uint64
+}
+
+// messageApplication is the recorded outcome of applying a message.
+type messageApplication struct {
+	key     string
+	result  *ApplicationResult
+	gasUsed types.GasUnits
+	writes  []actorWrite
+}
+
+// actorWrite is the encoded value an actor held after a message was applied.
+type actorWrite struct {
+	addr  address.Address
+	actor []byte
+}
+
+// NewMessageResultCache returns an empty MessageResultCache holding at most
+// maxSize results.
+func NewMessageResultCache(maxSize int) *MessageResultCache {
+	return &MessageResultCache{
+		apps: lru.New(maxSize),
+	}
+}
+
+// Len returns the number of results in the cache.
+func (c *MessageResultCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.apps.Len()
+}
+
+// Stats returns the number of lookups that found and did not find a result.
+func (c *MessageResultCache) Stats() (hits, misses uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits, c.misses
+}
+
+func (c *MessageResultCache) get(key string) (*messageApplication, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	app, ok := c.apps.Get(key)
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+	c.hits++
+	return app.(*messageApplication), true
+}
+
+func (c *MessageResultCache) add(app *messageApplication) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.apps.Add(app.key, app)
+}
+
+// messageResultKey returns the cache key for applying the message with cid
+// msgCid to the state with root preRoot.
+func messageResultKey(preRoot, msgCid cid.Cid, minerOwnerAddr address.Address, bh *types.BlockHeight, gasConsumed types.GasUnits, ancestors []types.TipSet) string {
+	h := sha256.New()
+	h.Write([]byte(preRoot.KeyString())) // nolint: errcheck
+	h.Write([]byte(msgCid.KeyString()))  // nolint: errcheck
+	h.Write(minerOwnerAddr.Bytes())      // nolint: errcheck
+	if bh != nil {
+		h.Write(bh.Bytes()) // nolint: errcheck
+	}
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(gasConsumed))
+	h.Write(buf[:]) // nolint: errcheck
+	for _, ts := range ancestors {
+		h.Write([]byte(ts.String())) // nolint: errcheck
+	}
+	return string(h.Sum(nil))
+}
+
+// recordingTree is a state tree that records the addresses of actors set in
+// it.
+type recordingTree struct {
+	state.Tree
+	written map[address.Address]struct{}
+	order   []address.Address
+}
+
+func (t *recordingTree) SetActor(ctx context.Context, a address.Address, act *actor.Actor) error {
+	if _, ok := t.written[a]; !ok {
+		t.written[a] = struct{}{}
+		t.order = append(t.order, a)
+	}
+	return t.Tree.SetActor(ctx, a, act)
+}
+
+// applyMessageWithCache applies msg as ApplyMessage does, replaying the
+// cached result if the message was already applied to identical inputs and
+// caching the result otherwise.  Only successful applications are cached.
+// The signatures in sigs are taken as verified.
+func (p *DefaultProcessor) applyMessageWithCache(ctx context.Context, st state.Tree, vms vm.StorageMap, msg *types.SignedMessage, minerOwnerAddr address.Address, bh *types.BlockHeight, gasTracker *vm.GasTracker, ancestors []types.TipSet, sigs VerifiedSignatures) (*ApplicationResult, error) {
+	preRoot, err := st.Flush(ctx)
+	if err != nil {
+		return nil, errors.FaultErrorWrap(err, "could not flush state tree")
+	}
+	msgCid, err := msg.Cid()
+	if err != nil {
+		return nil, errors.FaultErrorWrap(err, "could not get message cid")
+	}
+	gasBefore := gasTracker.GasConsumedByBlock()
+	key := messageResultKey(preRoot, msgCid, minerOwnerAddr, bh, gasBefore, ancestors)
+
+	if app, ok := p.resultCache.get(key); ok {
+		return app.replay(ctx, st, msg, gasTracker)
+	}
+
+	rt := &recordingTree{Tree: st, written: make(map[address.Address]struct{})}
+	result, err := p.applyMessage(ctx, rt, vms, msg, minerOwnerAddr, bh, gasTracker, ancestors, sigs)
+	if err != nil {
+		return nil, err
+	}
+
+	// Actor heads written by the message must be readable from the
+	// blockstore when the result is replayed with a different storage map.
+	if err := vms.Flush(); err != nil {
+		return nil, errors.FaultErrorWrap(err, "could not flush actor storage")
+	}
+
+	app := &messageApplication{
+		key:     key,
+		result:  result,
+		gasUsed: gasTracker.GasConsumedByBlock() - gasBefore,
+	}
+	for _, addr := range rt.order {
+		act, err := st.GetActor(ctx, addr)
+		if err != nil {
+			return nil, errors.FaultErrorWrap(err, "could not load written actor")
+		}
+		data, err := act.Marshal()
+		if err != nil {
+			return nil, errors.FaultErrorWrap(err, "could not encode written actor")
+		}
+		app.writes = append(app.writes, actorWrite{addr: addr, actor: data})
+	}
+	p.resultCache.add(app)
+
+	return result, nil
+}
+
+// replay applies the recorded outcome of a message application to st and
+// gasTracker.
+func (app *messageApplication) replay(ctx context.Context, st state.Tree, msg *types.SignedMessage, gasTracker *vm.GasTracker) (*ApplicationResult, error) {
+	gasTracker.ResetForNewMessage(msg.MeteredMessage)
+	if err := gasTracker.Charge(app.gasUsed); err != nil {
+		return nil, errors.FaultErrorWrap(err, "cached gas exceeds message gas limit")
+	}
+
+	for _, w := range app.writes {
+		var act actor.Actor
+		if err := act.Unmarshal(w.actor); err != nil {
+			return nil, errors.FaultErrorWrap(err, "could not decode cached actor")
+		}
+		if err := st.SetActor(ctx, w.addr, &act); err != nil {
+			return nil, errors.FaultErrorWrap(err, "could not set cached actor")
+		}
+	}
+
+	receipt := *app.result.Receipt
+	return &ApplicationResult{Receipt: &receipt, ExecutionError: app.result.ExecutionError, GasUsed: app.gasUsed}, nil
+}
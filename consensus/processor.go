@@ -40,6 +40,8 @@ type BlockRewarder interface {
 type ApplicationResult struct {
 	Receipt        *types.MessageReceipt
 	ExecutionError error
+	// GasUsed is the gas charged for applying the message.
+	GasUsed types.GasUnits
 }
 
 // ProcessTipSetResponse records the results of successfully applied messages,
@@ -56,6 +58,9 @@ type ProcessTipSetResponse struct {
 type DefaultProcessor struct {
 	signedMessageValidator SignedMessageValidator
 	blockRewarder          BlockRewarder
+	// resultCache, if set, short-circuits re-application of messages to
+	// identical inputs.
+	resultCache *MessageResultCache
 }
 
 var _ Processor = (*DefaultProcessor)(nil)
@@ -76,6 +81,17 @@ func NewConfiguredProcessor(validator SignedMessageValidator, rewarder BlockRewa
 	}
 }
 
+// NewCachingProcessor creates a default processor that caches message
+// application results in cache.  This avoids re-executing messages during
+// reorgs that re-apply them to the same state.
+func NewCachingProcessor(cache *MessageResultCache) *DefaultProcessor {
+	return &DefaultProcessor{
+		signedMessageValidator: NewDefaultMessageValidator(),
+		blockRewarder:          NewDefaultBlockRewarder(),
+		resultCache:            cache,
+	}
+}
+
 // ProcessBlock is the entrypoint for validating the state transitions
 // of the messages in a block. When we receive a new block from the
 // network ProcessBlock applies the block's messages to the beginning
@@ -103,7 +119,10 @@ func NewConfiguredProcessor(validator SignedMessageValidator, rewarder BlockRewa
 // will in many cases be successfully applied even though an
 // error was thrown causing any state changes to be rolled back.
 // See comments on ApplyMessage for specific intent.
-func (p *DefaultProcessor) ProcessBlock(ctx context.Context, st state.Tree, vms vm.StorageMap, blk *types.Block, ancestors []types.TipSet) (results []*ApplicationResult, err error) {
+//
+// The signatures in sigs, which may be nil, are taken as verified; the
+// signatures of other messages are verified as the messages are applied.
+func (p *DefaultProcessor) ProcessBlock(ctx context.Context, st state.Tree, vms vm.StorageMap, blk *types.Block, ancestors []types.TipSet, sigs VerifiedSignatures) (results []*ApplicationResult, err error) {
 	ctx, span := trace.StartSpan(ctx, "DefaultProcessor.ProcessBlock")
 	span.AddAttributes(trace.StringAttribute("block", blk.Cid().String()))
 	defer tracing.AddErrorEndSpan(ctx, span, &err)
@@ -120,7 +139,7 @@ func (p *DefaultProcessor) ProcessBlock(ctx context.Context, st state.Tree, vms
 	}
 
 	bh := types.NewBlockHeight(uint64(blk.Height))
-	res, faultErr := p.ApplyMessagesAndPayRewards(ctx, st, vms, blk.Messages, minerOwnerAddr, bh, ancestors)
+	res, faultErr := p.applyMessagesAndPayRewards(ctx, st, vms, blk.Messages, minerOwnerAddr, bh, ancestors, sigs)
 	if faultErr != nil {
 		return emptyResults, faultErr
 	}
@@ -141,8 +160,9 @@ func (p *DefaultProcessor) ProcessBlock(ctx context.Context, st state.Tree, vms
 // ProcessTipSet only returns errors in the case of faults.  Other errors
 // coming from calls to ApplyMessage can be traced to different blocks in the
 // TipSet containing conflicting messages and are ignored.  Blocks are applied
-// in the sorted order of their tickets.
-func (p *DefaultProcessor) ProcessTipSet(ctx context.Context, st state.Tree, vms vm.StorageMap, ts types.TipSet, ancestors []types.TipSet) (response *ProcessTipSetResponse, err error) {
+// in the sorted order of their tickets.  The signatures in sigs, which may be
+// nil, are taken as verified as by ProcessBlock.
+func (p *DefaultProcessor) ProcessTipSet(ctx context.Context, st state.Tree, vms vm.StorageMap, ts types.TipSet, ancestors []types.TipSet, sigs VerifiedSignatures) (response *ProcessTipSetResponse, err error) {
 	ctx, span := trace.StartSpan(ctx, "DefaultProcessor.ProcessTipSet")
 	span.AddAttributes(trace.StringAttribute("tipset", ts.String()))
 	defer tracing.AddErrorEndSpan(ctx, span, &err)
@@ -184,7 +204,7 @@ func (p *DefaultProcessor) ProcessTipSet(ctx context.Context, st state.Tree, vms
 			// TODO is there ever a reason to try a duplicate failed message again within the same tipset?
 			msgFilter[mCid.String()] = struct{}{}
 		}
-		amRes, err := p.ApplyMessagesAndPayRewards(ctx, st, vms, msgs, minerOwnerAddr, bh, ancestors)
+		amRes, err := p.applyMessagesAndPayRewards(ctx, st, vms, msgs, minerOwnerAddr, bh, ancestors, sigs)
 		if err != nil {
 			return &emptyRes, err
 		}
@@ -276,7 +296,22 @@ func (p *DefaultProcessor) ProcessTipSet(ctx context.Context, st state.Tree, vms
 //       revert errors.
 //   - everything else: successfully applied (include, keep changes)
 //
-func (p *DefaultProcessor) ApplyMessage(ctx context.Context, st state.Tree, vms vm.StorageMap, msg *types.SignedMessage, minerOwnerAddr address.Address, bh *types.BlockHeight, gasTracker *vm.GasTracker, ancestors []types.TipSet) (result *ApplicationResult, err error) {
+func (p *DefaultProcessor) ApplyMessage(ctx context.Context, st state.Tree, vms vm.StorageMap, msg *types.SignedMessage, minerOwnerAddr address.Address, bh *types.BlockHeight, gasTracker *vm.GasTracker, ancestors []types.TipSet) (*ApplicationResult, error) {
+	return p.applyMessageVerified(ctx, st, vms, msg, minerOwnerAddr, bh, gasTracker, ancestors, nil)
+}
+
+// applyMessageVerified applies msg to st as described by ApplyMessage,
+// taking the signatures in sigs as verified.
+func (p *DefaultProcessor) applyMessageVerified(ctx context.Context, st state.Tree, vms vm.StorageMap, msg *types.SignedMessage, minerOwnerAddr address.Address, bh *types.BlockHeight, gasTracker *vm.GasTracker, ancestors []types.TipSet, sigs VerifiedSignatures) (*ApplicationResult, error) {
+	if p.resultCache != nil {
+		return p.applyMessageWithCache(ctx, st, vms, msg, minerOwnerAddr, bh, gasTracker, ancestors, sigs)
+	}
+	return p.applyMessage(ctx, st, vms, msg, minerOwnerAddr, bh, gasTracker, ancestors, sigs)
+}
+
+// applyMessage applies msg to st as described by ApplyMessage, taking the
+// signatures in sigs as verified.
+func (p *DefaultProcessor) applyMessage(ctx context.Context, st state.Tree, vms vm.StorageMap, msg *types.SignedMessage, minerOwnerAddr address.Address, bh *types.BlockHeight, gasTracker *vm.GasTracker, ancestors []types.TipSet, sigs VerifiedSignatures) (result *ApplicationResult, err error) {
 	msgCid, err := msg.Cid()
 	if err != nil {
 		return nil, errors.FaultErrorWrap(err, "could not get message cid")
@@ -292,7 +327,8 @@ func (p *DefaultProcessor) ApplyMessage(ctx context.Context, st state.Tree, vms
 
 	cachedStateTree := state.NewCachedStateTree(st)
 
-	r, err := p.attemptApplyMessage(ctx, cachedStateTree, vms, msg, bh, gasTracker, ancestors)
+	gasBefore := gasTracker.GasConsumedByBlock()
+	r, err := p.attemptApplyMessage(ctx, cachedStateTree, vms, msg, bh, gasTracker, ancestors, sigs)
 	if err == nil {
 		err = cachedStateTree.Commit(ctx)
 		if err != nil {
@@ -338,7 +374,7 @@ func (p *DefaultProcessor) ApplyMessage(ctx context.Context, st state.Tree, vms
 		return nil, errors.FaultErrorWrap(err, "could not set from actor after inc nonce")
 	}
 
-	return &ApplicationResult{Receipt: r, ExecutionError: executionError}, nil
+	return &ApplicationResult{Receipt: r, ExecutionError: executionError, GasUsed: gasTracker.GasConsumedByBlock() - gasBefore}, nil
 }
 
 var (
@@ -353,11 +389,14 @@ var (
 	errNonAccountActor           = errors.NewRevertError("message from non-account actor")
 	errNegativeValue             = errors.NewRevertError("negative value")
 	errInsufficientGas           = errors.NewRevertError("balance insufficient to cover transfer+gas")
-	errInvalidSignature          = errors.NewRevertError("invalid signature by sender over message data")
 	// TODO we'll eventually handle sending to self.
 	errSelfSend = errors.NewRevertError("cannot send to self")
 )
 
+// ErrInvalidSignature is the cause of the error returned applying a message
+// whose signature is not valid.  A block holding such a message is invalid.
+var ErrInvalidSignature = errors.NewRevertError("invalid signature by sender over message data")
+
 // CallQueryMethod calls a method on an actor in the given state tree. It does
 // not make any changes to the state/blockchain and is useful for interrogating
 // actor state. Block height bh is optional; some methods will ignore it.
@@ -440,7 +479,7 @@ func PreviewQueryMethod(ctx context.Context, st state.Tree, vms vm.StorageMap, t
 // should deal with trying to apply the message to the state tree whereas
 // ApplyMessage should deal with any side effects and how it should be presented
 // to the caller. attemptApplyMessage should only be called from ApplyMessage.
-func (p *DefaultProcessor) attemptApplyMessage(ctx context.Context, st *state.CachedTree, store vm.StorageMap, msg *types.SignedMessage, bh *types.BlockHeight, gasTracker *vm.GasTracker, ancestors []types.TipSet) (*types.MessageReceipt, error) {
+func (p *DefaultProcessor) attemptApplyMessage(ctx context.Context, st *state.CachedTree, store vm.StorageMap, msg *types.SignedMessage, bh *types.BlockHeight, gasTracker *vm.GasTracker, ancestors []types.TipSet, sigs VerifiedSignatures) (*types.MessageReceipt, error) {
 	gasTracker.ResetForNewMessage(msg.MeteredMessage)
 	if err := blockGasLimitError(gasTracker); err != nil {
 		return &types.MessageReceipt{
@@ -459,7 +498,7 @@ func (p *DefaultProcessor) attemptApplyMessage(ctx context.Context, st *state.Ca
 		return nil, errors.FaultErrorWrapf(err, "failed to get From actor %s", msg.From)
 	}
 
-	err = p.signedMessageValidator.Validate(ctx, msg, fromActor)
+	err = p.signedMessageValidator.ValidateVerified(ctx, msg, fromActor, sigs)
 	if err != nil {
 		return &types.MessageReceipt{
 			ExitCode:   errors.CodeError(err),
@@ -535,6 +574,12 @@ type ApplyMessagesResponse struct {
 // ApplyMessages will return an error iff a fault message occurs.
 // Precondition: signatures of messages are checked by the caller.
 func (p *DefaultProcessor) ApplyMessagesAndPayRewards(ctx context.Context, st state.Tree, vms vm.StorageMap, messages []*types.SignedMessage, minerOwnerAddr address.Address, bh *types.BlockHeight, ancestors []types.TipSet) (ApplyMessagesResponse, error) {
+	return p.applyMessagesAndPayRewards(ctx, st, vms, messages, minerOwnerAddr, bh, ancestors, nil)
+}
+
+// applyMessagesAndPayRewards is ApplyMessagesAndPayRewards taking the
+// signatures in sigs as verified.
+func (p *DefaultProcessor) applyMessagesAndPayRewards(ctx context.Context, st state.Tree, vms vm.StorageMap, messages []*types.SignedMessage, minerOwnerAddr address.Address, bh *types.BlockHeight, ancestors []types.TipSet, sigs VerifiedSignatures) (ApplyMessagesResponse, error) {
 	var emptyRet ApplyMessagesResponse
 	var ret ApplyMessagesResponse
 
@@ -547,7 +592,7 @@ func (p *DefaultProcessor) ApplyMessagesAndPayRewards(ctx context.Context, st st
 
 	// process all messages
 	for _, smsg := range messages {
-		r, err := p.ApplyMessage(ctx, st, vms, smsg, minerOwnerAddr, bh, gasTracker, ancestors)
+		r, err := p.applyMessageVerified(ctx, st, vms, smsg, minerOwnerAddr, bh, gasTracker, ancestors, sigs)
 		// If the message should not have been in the block, bail somehow.
 		switch {
 		case errors.IsFault(err):
@@ -638,7 +683,7 @@ func isTemporaryError(err error) bool {
 func isPermanentError(err error) bool {
 	return err == errInsufficientGas ||
 		err == errSelfSend ||
-		err == errInvalidSignature ||
+		err == ErrInvalidSignature ||
 		err == errNonceTooLow ||
 		err == errNonAccountActor ||
 		err == errNegativeValue ||
@@ -74,7 +74,7 @@ func TestProcessBlockSuccess(t *testing.T) {
 		Messages:  []*types.SignedMessage{smsg},
 		Miner:     minerAddr,
 	}
-	results, err := NewDefaultProcessor().ProcessBlock(ctx, st, vms, blk, nil)
+	results, err := NewDefaultProcessor().ProcessBlock(ctx, st, vms, blk, nil, nil)
 	assert.NoError(t, err)
 	assert.Len(t, results, 1)
 
@@ -144,7 +144,7 @@ func TestProcessTipSetSuccess(t *testing.T) {
 		Miner:     minerAddr,
 	}
 
-	res, err := NewDefaultProcessor().ProcessTipSet(ctx, st, vms, th.RequireNewTipSet(t, blk1, blk2), nil)
+	res, err := NewDefaultProcessor().ProcessTipSet(ctx, st, vms, th.RequireNewTipSet(t, blk1, blk2), nil, nil)
 	assert.NoError(t, err)
 	assert.Len(t, res.Results, 2)
 
@@ -212,7 +212,7 @@ func TestProcessTipsConflicts(t *testing.T) {
 		Ticket:    []byte{1, 1},
 		Miner:     minerAddr,
 	}
-	res, err := NewDefaultProcessor().ProcessTipSet(ctx, st, vms, th.RequireNewTipSet(t, blk1, blk2), nil)
+	res, err := NewDefaultProcessor().ProcessTipSet(ctx, st, vms, th.RequireNewTipSet(t, blk1, blk2), nil, nil)
 	assert.NoError(t, err)
 	assert.Len(t, res.Results, 1)
 
@@ -269,7 +269,7 @@ func TestProcessBlockBadMsgSig(t *testing.T) {
 		Miner:     minerAddr,
 		Messages:  []*types.SignedMessage{smsg},
 	}
-	results, err := NewDefaultProcessor().ProcessBlock(ctx, st, vms, blk, nil)
+	results, err := NewDefaultProcessor().ProcessBlock(ctx, st, vms, blk, nil, nil)
 	require.Nil(t, results)
 	assert.EqualError(t, err, "apply message failed: invalid signature by sender over message data")
 }
@@ -304,7 +304,7 @@ func TestProcessBlockReward(t *testing.T) {
 		StateRoot: stCid,
 		Messages:  []*types.SignedMessage{},
 	}
-	ret, err := NewDefaultProcessor().ProcessBlock(ctx, st, vms, blk, nil)
+	ret, err := NewDefaultProcessor().ProcessBlock(ctx, st, vms, blk, nil, nil)
 	require.NoError(t, err)
 	assert.Nil(t, ret)
 
@@ -358,7 +358,7 @@ func TestProcessBlockVMErrors(t *testing.T) {
 
 	// The "foo" message will cause a vm error and
 	// we're going to check four things...
-	results, err := NewDefaultProcessor().ProcessBlock(ctx, st, vms, blk, nil)
+	results, err := NewDefaultProcessor().ProcessBlock(ctx, st, vms, blk, nil, nil)
 
 	// 1. That a VM error is not a message failure (err).
 	assert.NoError(t, err)
@@ -803,6 +803,7 @@ func TestApplyMessageChargesGas(t *testing.T) {
 			*gasPrice, gasLimit, minerAddr)
 		assert.NoError(t, err)
 		assert.NoError(t, appResult.ExecutionError)
+		assert.Equal(t, types.NewGasUnits(100), appResult.GasUsed)
 
 		minerActor, err := st.GetActor(ctx, minerAddr)
 		require.NoError(t, err)
@@ -829,6 +830,7 @@ func TestApplyMessageChargesGas(t *testing.T) {
 			*gasPrice, gasLimit, minerAddr)
 		assert.NoError(t, err)
 		assert.EqualError(t, appResult.ExecutionError, "boom")
+		assert.Equal(t, types.NewGasUnits(100), appResult.GasUsed)
 
 		minerActor, err := st.GetActor(ctx, minerAddr)
 		require.NoError(t, err)
@@ -856,6 +858,7 @@ func TestApplyMessageChargesGas(t *testing.T) {
 			*gasPrice, gasLimit, minerAddr)
 		assert.NoError(t, err)
 		assert.EqualError(t, appResult.ExecutionError, "Insufficient gas: gas cost exceeds gas limit")
+		assert.Equal(t, gasLimit, appResult.GasUsed)
 
 		minerActor, err := st.GetActor(ctx, minerAddr)
 		require.NoError(t, err)
@@ -888,6 +891,7 @@ func TestApplyMessageChargesGas(t *testing.T) {
 			*gasPrice, gasLimit, minerAddr)
 		assert.NoError(t, err)
 		assert.NoError(t, appResult.ExecutionError)
+		assert.Equal(t, types.NewGasUnits(200), appResult.GasUsed)
 		minerActor, err := st.GetActor(ctx, minerAddr)
 		require.NoError(t, err)
 
@@ -921,6 +925,7 @@ func TestApplyMessageChargesGas(t *testing.T) {
 			*gasPrice, gasLimit, minerAddr)
 		assert.NoError(t, err)
 		assert.EqualError(t, appResult.ExecutionError, "Insufficient gas: gas cost exceeds gas limit")
+		assert.Equal(t, gasLimit, appResult.GasUsed)
 
 		minerActor, err := st.GetActor(ctx, minerAddr)
 		require.NoError(t, err)
@@ -973,6 +978,9 @@ func TestBlockGasLimitBehavior(t *testing.T) {
 
 		assert.Contains(t, result.SuccessfulMessages, sgnedMsg1)
 		assert.Contains(t, result.SuccessfulMessages, sgnedMsg2)
+		require.Len(t, result.Results, 2)
+		assert.Equal(t, types.BlockGasLimit/4, result.Results[0].GasUsed)
+		assert.Equal(t, types.BlockGasLimit/4, result.Results[1].GasUsed)
 	})
 
 	t.Run("2nd message delayed when 1st usage + 2nd limit > block limit", func(t *testing.T) {
@@ -1075,3 +1083,73 @@ func mustCreateMiner(ctx context.Context, t *testing.T, st state.Tree, vms vm.St
 	require.NoError(t, err)
 	return stCid, miner
 }
+
+func TestApplyMessageResultCache(t *testing.T) {
+	tf.UnitTest(t)
+
+	newAddress := address.NewForTestGetter()
+	ctx := context.Background()
+	cst := hamt.NewCborStore()
+	vms := th.VMStorage()
+	mockSigner, _ := types.NewMockSignersAndKeyInfo(1)
+
+	fromAddr := mockSigner.Addresses[0]
+	toAddr := newAddress()
+	minerOwnerAddr := newAddress()
+	stCid, _ := requireMakeStateTree(t, cst, map[address.Address]*actor.Actor{
+		fromAddr:       th.RequireNewAccountActor(t, types.NewAttoFILFromFIL(10000)),
+		minerOwnerAddr: th.RequireNewAccountActor(t, types.ZeroAttoFIL),
+	})
+
+	msg := types.NewMessage(fromAddr, toAddr, 0, types.NewAttoFILFromFIL(550), "", nil)
+	smsg, err := types.NewSignedMessage(*msg, &mockSigner, types.NewGasPrice(1), types.NewGasUnits(0))
+	require.NoError(t, err)
+
+	apply := func(p *DefaultProcessor, root cid.Cid) (*ApplicationResult, cid.Cid) {
+		st, err := state.LoadStateTree(ctx, cst, root, builtin.Actors)
+		require.NoError(t, err)
+		res, err := p.ApplyMessage(ctx, st, vms, smsg, minerOwnerAddr, types.NewBlockHeight(1), vm.NewGasTracker(), nil)
+		require.NoError(t, err)
+		after, err := st.Flush(ctx)
+		require.NoError(t, err)
+		return res, after
+	}
+
+	expectedRes, expectedRoot := apply(NewDefaultProcessor(), stCid)
+
+	cache := NewMessageResultCache(10)
+	p := NewCachingProcessor(cache)
+
+	t.Run("hit produces identical results", func(t *testing.T) {
+		missRes, missRoot := apply(p, stCid)
+		hits, misses := cache.Stats()
+		assert.Equal(t, uint64(0), hits)
+		assert.Equal(t, uint64(1), misses)
+
+		hitRes, hitRoot := apply(p, stCid)
+		hits, _ = cache.Stats()
+		assert.Equal(t, uint64(1), hits)
+
+		assert.Equal(t, expectedRes, missRes)
+		assert.Equal(t, expectedRes, hitRes)
+		assert.True(t, expectedRoot.Equals(missRoot))
+		assert.True(t, expectedRoot.Equals(hitRoot))
+	})
+
+	t.Run("differing parent state misses", func(t *testing.T) {
+		otherCid, _ := requireMakeStateTree(t, cst, map[address.Address]*actor.Actor{
+			fromAddr:       th.RequireNewAccountActor(t, types.NewAttoFILFromFIL(20000)),
+			minerOwnerAddr: th.RequireNewAccountActor(t, types.ZeroAttoFIL),
+		})
+		hitsBefore, missesBefore := cache.Stats()
+
+		_, otherRoot := apply(p, otherCid)
+		hits, misses := cache.Stats()
+		assert.Equal(t, hitsBefore, hits)
+		assert.Equal(t, missesBefore+1, misses)
+
+		_, uncachedRoot := apply(NewDefaultProcessor(), otherCid)
+		assert.True(t, uncachedRoot.Equals(otherRoot))
+		assert.False(t, otherRoot.Equals(expectedRoot))
+	})
+}
@@ -34,6 +34,12 @@ type Protocol interface {
 	// tipset b is heavier than tipset a.
 	IsHeavier(ctx context.Context, a, b types.TipSet, aSt, bSt state.Tree) (bool, error)
 	// RunStateTransition returns the state resulting from applying the input ts to the parent
-	// state pSt.  It returns an error if the transition is invalid.
-	RunStateTransition(ctx context.Context, ts types.TipSet, ancestors []types.TipSet, pSt state.Tree) (state.Tree, error)
+	// state pSt and the total gas used by the messages it applied.  It returns an error if
+	// the transition is invalid.
+	RunStateTransition(ctx context.Context, ts types.TipSet, ancestors []types.TipSet, pSt state.Tree) (state.Tree, types.GasUnits, error)
+	// ValidateAgainstParent returns the state resulting from applying candidate to
+	// parentState, the state of ancestors[0].  It does not consult the chain
+	// store, does not modify parentState and writes nothing it computes to
+	// storage.
+	ValidateAgainstParent(ctx context.Context, candidate types.TipSet, parentState state.Tree, ancestors []types.TipSet) (state.Tree, error)
 }
@@ -0,0 +1,90 @@
+package consensus
+
+import (
+	"runtime"
+	"sync"
+
+	"github.com/ipfs/go-cid"
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// WithSignatureWorkers sets the number of goroutines verifying the message
+// signatures of a tipset in parallel before its messages are applied in
+// order.  Zero or less uses GOMAXPROCS.  Verification results do not depend
+// on the number of workers.
+func WithSignatureWorkers(workers int) ExpectedOpt {
+	return func(c *Expected) {
+		c.sigWorkers = workers
+	}
+}
+
+// VerifiedSignatures holds whether the signatures of messages verified
+// ahead of applying them are valid, by message cid.
+type VerifiedSignatures map[cid.Cid]bool
+
+// VerifySignatures verifies the signatures of msgs across workers
+// goroutines and returns whether each is valid.  Zero or less workers uses
+// GOMAXPROCS.
+func VerifySignatures(msgs []*types.SignedMessage, workers int) (VerifiedSignatures, error) {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > len(msgs) {
+		workers = len(msgs)
+	}
+
+	cids := make([]cid.Cid, len(msgs))
+	errs := make([]error, len(msgs))
+	valid := make([]bool, len(msgs))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				cids[i], errs[i] = msgs[i].Cid()
+				valid[i] = msgs[i].VerifySignature()
+			}
+		}()
+	}
+	for i := range msgs {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	verified := make(VerifiedSignatures, len(msgs))
+	for i := range msgs {
+		if errs[i] != nil {
+			return nil, errors.Wrap(errs[i], "failed to get message cid")
+		}
+		verified[cids[i]] = valid[i]
+	}
+	return verified, nil
+}
+
+// verify returns whether the signature of msg is valid, verifying it unless
+// sigs holds it.
+func (sigs VerifiedSignatures) verify(msg *types.SignedMessage) bool {
+	if len(sigs) > 0 {
+		if c, err := msg.Cid(); err == nil {
+			if valid, ok := sigs[c]; ok {
+				return valid
+			}
+		}
+	}
+	return msg.VerifySignature()
+}
+
+// verifyTipSetSignatures verifies the signatures of all the messages of ts
+// across workers goroutines.
+func verifyTipSetSignatures(ts types.TipSet, workers int) (VerifiedSignatures, error) {
+	var msgs []*types.SignedMessage
+	for _, blk := range ts.ToSlice() {
+		msgs = append(msgs, blk.Messages...)
+	}
+	return VerifySignatures(msgs, workers)
+}
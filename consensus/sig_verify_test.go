@@ -0,0 +1,66 @@
+package consensus_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/consensus"
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestVerifySignatures(t *testing.T) {
+	tf.UnitTest(t)
+
+	msgs := make([]*types.SignedMessage, 50)
+	expected := consensus.VerifiedSignatures{}
+	for i := range msgs {
+		msgs[i] = newMessage(t, addresses[0], addresses[1], uint64(i), 5, 1, 0)
+		valid := i%3 != 0
+		if !valid {
+			msgs[i].Signature = []byte{}
+		}
+		c, err := msgs[i].Cid()
+		require.NoError(t, err)
+		expected[c] = valid
+	}
+
+	for _, workers := range []int{0, 1, 4, 16, 100} {
+		t.Run(fmt.Sprintf("%d workers", workers), func(t *testing.T) {
+			sigs, err := consensus.VerifySignatures(msgs, workers)
+			require.NoError(t, err)
+			assert.Equal(t, expected, sigs)
+		})
+	}
+
+	t.Run("no messages", func(t *testing.T) {
+		sigs, err := consensus.VerifySignatures(nil, 4)
+		require.NoError(t, err)
+		assert.Empty(t, sigs)
+	})
+}
+
+func BenchmarkVerifySignatures(b *testing.B) {
+	msgs := make([]*types.SignedMessage, 1000)
+	for i := range msgs {
+		msg := types.NewMessage(addresses[0], addresses[1], uint64(i), types.NewAttoFILFromFIL(1), "method", []byte("params"))
+		signed, err := types.NewSignedMessage(*msg, signer, types.NewGasPrice(1), types.NewGasUnits(0))
+		if err != nil {
+			b.Fatal(err)
+		}
+		msgs[i] = signed
+	}
+
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("%d workers", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := consensus.VerifySignatures(msgs, workers); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
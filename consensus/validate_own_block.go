@@ -0,0 +1,44 @@
+package consensus
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/state"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// ValidateOwnBlock runs the checks the syncer runs on a received block against
+// a block a miner just produced on parent, so that the miner does not gossip
+// an invalid block.  It checks the block's structure and mining, runs its
+// state transition on parentState and checks the resulting state root matches
+// the block's.  ancestors are the recent ancestors of the block, starting
+// with parent, used for chain randomness; if empty parent alone is used.  It
+// neither reads nor writes the chain store, does not modify parentState and
+// writes none of the state it computes to storage.
+func ValidateOwnBlock(ctx context.Context, con Protocol, blk *types.Block, parent types.TipSet, parentState state.Tree, ancestors []types.TipSet) error {
+	if len(ancestors) == 0 {
+		ancestors = []types.TipSet{parent}
+	}
+	if !ancestors[0].Equals(parent) {
+		return errors.New("ancestors do not start with parent")
+	}
+
+	candidate, err := con.NewValidTipSet(ctx, []*types.Block{blk})
+	if err != nil {
+		return errors.Wrap(err, "invalid block")
+	}
+	st, err := con.ValidateAgainstParent(ctx, candidate, parentState, ancestors)
+	if err != nil {
+		return errors.Wrap(err, "invalid state transition")
+	}
+	root, err := st.Flush(ctx)
+	if err != nil {
+		return err
+	}
+	if !root.Equals(blk.StateRoot) {
+		return errors.Wrapf(ErrStateRootMismatch, "computed %s, block has %s", root.String(), blk.StateRoot.String())
+	}
+	return nil
+}
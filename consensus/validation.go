@@ -33,6 +33,9 @@ type SignedMessageValidator interface {
 	// Validate checks that a message is semantically valid for processing, returning any
 	// invalidity as an error
 	Validate(ctx context.Context, msg *types.SignedMessage, fromActor *actor.Actor) error
+	// ValidateVerified checks msg like Validate, taking the signatures in
+	// sigs as verified rather than verifying them again.
+	ValidateVerified(ctx context.Context, msg *types.SignedMessage, fromActor *actor.Actor, sigs VerifiedSignatures) error
 }
 
 type defaultMessageValidator struct {
@@ -56,8 +59,12 @@ func NewOutboundMessageValidator() SignedMessageValidator {
 var _ SignedMessageValidator = (*defaultMessageValidator)(nil)
 
 func (v *defaultMessageValidator) Validate(ctx context.Context, msg *types.SignedMessage, fromActor *actor.Actor) error {
-	if !msg.VerifySignature() {
-		return errInvalidSignature
+	return v.ValidateVerified(ctx, msg, fromActor, nil)
+}
+
+func (v *defaultMessageValidator) ValidateVerified(ctx context.Context, msg *types.SignedMessage, fromActor *actor.Actor, sigs VerifiedSignatures) error {
+	if !sigs.verify(msg) {
+		return ErrInvalidSignature
 	}
 
 	if msg.From == msg.To {
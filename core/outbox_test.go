@@ -10,6 +10,7 @@ import (
 	"github.com/filecoin-project/go-filecoin/actor/builtin/account"
 	"github.com/filecoin-project/go-filecoin/actor/builtin/storagemarket"
 	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/consensus"
 	"github.com/filecoin-project/go-filecoin/core"
 	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
 	"github.com/filecoin-project/go-filecoin/types"
@@ -198,6 +199,10 @@ func (v nullValidator) Validate(ctx context.Context, msg *types.SignedMessage, f
 	return nil
 }
 
+func (v nullValidator) ValidateVerified(ctx context.Context, msg *types.SignedMessage, fromActor *actor.Actor, sigs consensus.VerifiedSignatures) error {
+	return v.Validate(ctx, msg, fromActor)
+}
+
 type nullPolicy struct {
 }
 
@@ -375,6 +375,11 @@ func (ggmv *messageValidator) Validate(ctx context.Context, msg *types.SignedMes
 	return nil
 }
 
+// ValidateVerified always returns nil
+func (ggmv *messageValidator) ValidateVerified(ctx context.Context, msg *types.SignedMessage, fromActor *actor.Actor, sigs consensus.VerifiedSignatures) error {
+	return nil
+}
+
 // blockRewarder is a rewarder that doesn't actually add any rewards to simplify state tracking in tests
 type blockRewarder struct{}
 
@@ -78,6 +78,7 @@ func (w *DefaultWorker) Generate(ctx context.Context,
 
 	next := &types.Block{
 		Miner:           w.minerAddr,
+		NetworkName:     baseTipSet.ToSlice()[0].NetworkName,
 		Height:          types.Uint64(blockHeight),
 		Messages:        res.SuccessfulMessages,
 		MessageReceipts: receipts,
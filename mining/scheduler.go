@@ -66,6 +66,10 @@ type timingScheduler struct {
 	// pollHeadFunc is the function the scheduler uses to poll for the
 	// current heaviest tipset
 	pollHeadFunc func() (*types.TipSet, error)
+	// isReadyFunc, if set, is consulted before each mining round.  The
+	// scheduler skips rounds while it returns false, for example while the
+	// node is still syncing far behind the network's head.
+	isReadyFunc func() bool
 
 	isStarted bool
 }
@@ -114,6 +118,10 @@ func (s *timingScheduler) Start(miningCtx context.Context) (<-chan Output, *sync
 				outCh <- NewOutput(nil, errors.New("cannot mine on unset (nil) head"))
 				return
 			}
+			if s.isReadyFunc != nil && !s.isReadyFunc() {
+				log.Infof("Scheduler skipping round, head %s is too far behind the network", base.String())
+				continue
+			}
 			if prevWon && prevBase.Equals(*base) {
 				// Skip this round, this likely means that the new head has not propagated yet through the system.
 				// TODO: investigate if there is a better way to handle this situation.
@@ -168,6 +176,12 @@ func NewScheduler(w Worker, md time.Duration, f func() (*types.TipSet, error)) S
 	return &timingScheduler{worker: w, mineDelay: md, pollHeadFunc: f}
 }
 
+// NewSchedulerWithReadyCheck returns a new timingScheduler that only mines in
+// rounds where isReady returns true.
+func NewSchedulerWithReadyCheck(w Worker, md time.Duration, f func() (*types.TipSet, error), isReady func() bool) Scheduler {
+	return &timingScheduler{worker: w, mineDelay: md, pollHeadFunc: f, isReadyFunc: isReady}
+}
+
 // MineOnce is a convenience function that presents a synchronous blocking
 // interface to the mining scheduler.  The worker will mine as many null blocks
 // on top of the input tipset as necessary and output the winning block.
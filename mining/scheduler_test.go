@@ -2,6 +2,7 @@ package mining
 
 import (
 	"context"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -77,6 +78,45 @@ func TestSchedulerErrorsOnUnsetHead(t *testing.T) {
 	doneWg.Wait()
 }
 
+// The scheduler skips rounds until the ready check passes, without counting
+// the skipped rounds as null blocks.
+func TestSchedulerSkipsRoundsUntilReady(t *testing.T) {
+	tf.UnitTest(t)
+
+	ts := newTestUtils()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var checks int32
+	isReady := func() bool {
+		return atomic.AddInt32(&checks, 1) > 3
+	}
+	var firstChecks int32
+	firstNullBlkCount := -1
+	readyMine := func(c context.Context, inTS types.TipSet, nBC int, outCh chan<- Output) bool {
+		if firstNullBlkCount < 0 {
+			firstChecks = atomic.LoadInt32(&checks)
+			firstNullBlkCount = nBC
+		}
+		select {
+		case outCh <- Output{}:
+		case <-c.Done():
+		}
+		return false
+	}
+	headFunc := func() (*types.TipSet, error) {
+		return &ts, nil
+	}
+	worker := NewTestWorkerWithDeps(readyMine)
+	scheduler := NewSchedulerWithReadyCheck(worker, MineDelayTest, headFunc, isReady)
+	outCh, doneWg := scheduler.Start(ctx)
+	<-outCh
+	cancel()
+	doneWg.Wait()
+
+	assert.Equal(t, int32(4), firstChecks)
+	assert.Equal(t, 0, firstNullBlkCount)
+}
+
 // If head is the same increment the nullblkcount, otherwise make it 0.
 func TestSchedulerUpdatesNullBlkCount(t *testing.T) {
 	tf.UnitTest(t)
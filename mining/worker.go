@@ -84,6 +84,9 @@ type DefaultWorker struct {
 	getStateTree GetStateTree
 	getWeight    GetWeight
 	getAncestors GetAncestors
+	// consensus, if not nil, validates each generated block before it is
+	// output.
+	consensus consensus.Protocol
 
 	// core filecoin things
 	messageSource MessageSource
@@ -94,11 +97,14 @@ type DefaultWorker struct {
 	blockTime     time.Duration
 }
 
-// NewDefaultWorker instantiates a new Worker.
+// NewDefaultWorker instantiates a new Worker.  Blocks it generates are
+// validated against con as the syncer would validate them before they are
+// output, so that the node never publishes an invalid block.
 func NewDefaultWorker(messageSource MessageSource,
 	getStateTree GetStateTree,
 	getWeight GetWeight,
 	getAncestors GetAncestors,
+	con consensus.Protocol,
 	processor MessageApplier,
 	powerTable consensus.PowerTableView,
 	bs blockstore.Blockstore,
@@ -127,6 +133,7 @@ func NewDefaultWorker(messageSource MessageSource,
 	// TODO: create real PoST.
 	// https://github.com/filecoin-project/go-filecoin/issues/1791
 	w.createPoSTFunc = w.fakeCreatePoST
+	w.consensus = con
 
 	return w
 }
@@ -232,6 +239,11 @@ func (w *DefaultWorker) Mine(ctx context.Context, base types.TipSet, nullBlkCoun
 
 	if weHaveAWinner {
 		next, err := w.Generate(ctx, base, ticket, proof, uint64(nullBlkCount))
+		if err == nil {
+			if err = w.validate(ctx, base, next); err != nil {
+				next = nil
+			}
+		}
 		if err == nil {
 			log.SetTag(ctx, "block", next)
 			log.Debugf("Worker.Mine generates new winning block! %s", next.Cid().String())
@@ -243,6 +255,27 @@ func (w *DefaultWorker) Mine(ctx context.Context, base types.TipSet, nullBlkCoun
 	return false
 }
 
+// validate checks blk, just generated on base, as the syncer would check it
+// on receipt, if the worker has a consensus protocol to check with.
+func (w *DefaultWorker) validate(ctx context.Context, base types.TipSet, blk *types.Block) error {
+	if w.consensus == nil {
+		return nil
+	}
+	// Generate modifies the state tree it loads, so load it afresh.
+	parentState, err := w.getStateTree(ctx, base)
+	if err != nil {
+		return errors.Wrap(err, "get state tree")
+	}
+	ancestors, err := w.getAncestors(ctx, base, types.NewBlockHeight(uint64(blk.Height)))
+	if err != nil {
+		return errors.Wrap(err, "get base tip set ancestors")
+	}
+	if err := consensus.ValidateOwnBlock(ctx, w.consensus, blk, base, parentState, ancestors); err != nil {
+		return errors.Wrapf(err, "generated invalid block %s", blk.Cid().String())
+	}
+	return nil
+}
+
 // TODO: Actually use the results of the PoST once it is implemented.
 // Currently createProof just passes the challenge seed through.
 func createProof(challengeSeed types.PoStChallengeSeed, createPoST DoSomeWorkFunc) <-chan types.PoStChallengeSeed {
@@ -81,6 +81,19 @@ func Test_Mine(t *testing.T) {
 
 	})
 
+	t.Run("Generated invalid block is not output", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		worker := mining.NewDefaultWorker(pool, getStateTree, getWeightTest, getAncestors, &rejectingProtocol{}, th.NewTestProcessor(),
+			mining.NewTestPowerTableView(1), bs, cst, minerAddr, minerOwnerAddr, blockSignerAddr, mockSigner, th.BlockTimeTest)
+		outCh := make(chan mining.Output)
+		go worker.Mine(ctx, tipSet, 0, outCh)
+		r := <-outCh
+		assert.Nil(t, r.NewBlock)
+		require.Error(t, r.Err)
+		assert.Contains(t, r.Err.Error(), "rejected")
+		cancel()
+	})
+
 	t.Run("Sent empty tipset", func(t *testing.T) {
 		doSomeWorkCalled = false
 		ctx, cancel := context.WithCancel(context.Background())
@@ -96,6 +109,15 @@ func Test_Mine(t *testing.T) {
 	})
 }
 
+// rejectingProtocol is a consensus protocol rejecting every block.
+type rejectingProtocol struct {
+	consensus.Protocol
+}
+
+func (p *rejectingProtocol) NewValidTipSet(ctx context.Context, blks []*types.Block) (types.TipSet, error) {
+	return nil, errors.New("rejected")
+}
+
 func sharedSetupInitial() (*hamt.CborIpldStore, *core.MessagePool, cid.Cid) {
 	cst := hamt.NewCborStore()
 	pool := core.NewMessagePool(th.NewTestMessagePoolAPI(0), config.NewDefaultConfig().Mpool, th.NewMockMessagePoolValidator())
@@ -53,6 +53,8 @@ type Bootstrapper struct {
 	ctx            context.Context
 	cancel         context.CancelFunc
 	dhtBootStarted bool
+	// trigger requests a bootstrap before the end of the period.
+	trigger chan struct{}
 }
 
 // NewBootstrapper returns a new Bootstrapper that will attempt to keep connected
@@ -64,6 +66,8 @@ func NewBootstrapper(bootstrapPeers []pstore.PeerInfo, h host.Host, d inet.Diale
 		Period:            period,
 		ConnectionTimeout: 20 * time.Second,
 
+		trigger: make(chan struct{}, 1),
+
 		h: h,
 		d: d,
 		r: r,
@@ -86,11 +90,30 @@ func (b *Bootstrapper) Start(ctx context.Context) {
 				return
 			case <-b.ticker.C:
 				b.Bootstrap(b.d.Peers())
+			case <-b.trigger:
+				b.Bootstrap(b.d.Peers())
 			}
 		}
 	}()
 }
 
+// PeerCount returns the number of peers the host is connected to.
+func (b *Bootstrapper) PeerCount() int {
+	return len(b.d.Peers())
+}
+
+// DialPeers asks the Bootstrapper to bootstrap now rather than at the end
+// of its period, connecting to bootstrap peers if the host has fewer than
+// MinPeerThreshold connections.  It does not wait for the connections.  A
+// request made before Start is served when the Bootstrapper starts.
+func (b *Bootstrapper) DialPeers() {
+	select {
+	case b.trigger <- struct{}{}:
+	default:
+		// A bootstrap is already requested.
+	}
+}
+
 // Stop stops the Bootstrapper.
 func (b *Bootstrapper) Stop() {
 	if b.cancel != nil {
@@ -133,3 +133,36 @@ func TestBootstrapperBootstrap(t *testing.T) {
 		lk.Unlock()
 	})
 }
+
+func TestBootstrapperDialPeers(t *testing.T) {
+	tf.UnitTest(t)
+
+	var lk sync.Mutex
+	var connected []peer.ID
+	fakeHost := &th.FakeHost{ConnectImpl: func(_ context.Context, pinfo pstore.PeerInfo) error {
+		lk.Lock()
+		defer lk.Unlock()
+		connected = append(connected, pinfo.ID)
+		return nil
+	}}
+	fakeDialer := &th.FakeDialer{PeersImpl: nopPeers}
+	fakeRouter := offroute.NewOfflineRouter(repo.NewInMemoryRepo().Datastore(), blankValidator{})
+
+	bootstrapPeers := []pstore.PeerInfo{
+		{ID: th.RequireRandomPeerID(t)},
+		{ID: th.RequireRandomPeerID(t)},
+	}
+	// The period is long enough that only DialPeers can cause a bootstrap.
+	b := NewBootstrapper(bootstrapPeers, fakeHost, fakeDialer, fakeRouter, 2, time.Hour)
+	assert.Equal(t, 0, b.PeerCount())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	b.Start(ctx)
+	b.DialPeers()
+	time.Sleep(100 * time.Millisecond)
+
+	lk.Lock()
+	defer lk.Unlock()
+	assert.ElementsMatch(t, []peer.ID{bootstrapPeers[0].ID, bootstrapPeers[1].ID}, connected)
+}
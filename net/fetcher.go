@@ -3,10 +3,14 @@ package net
 import (
 	"context"
 	"fmt"
+	"sync"
 
+	"github.com/ipfs/go-bitswap"
 	"github.com/ipfs/go-block-format"
 	bserv "github.com/ipfs/go-blockservice"
 	"github.com/ipfs/go-cid"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	peer "github.com/libp2p/go-libp2p-peer"
 	"github.com/pkg/errors"
 
 	"github.com/filecoin-project/go-filecoin/types"
@@ -17,19 +21,152 @@ import (
 type Fetcher struct {
 	// session is a bitswap session that enables efficient transfer.
 	session *bserv.Session
+	// codec decodes fetched blocks.
+	codec types.Codec
+	// bs is the local blockstore of the session's block service.
+	bs bstore.Blockstore
+
+	// ledger, if not nil, reports the bytes received from each peer.
+	ledger PeerLedger
+	// bandwidthMu protects bandwidth, seen and fetching.
+	bandwidthMu sync.Mutex
+	// bandwidth is the number of bytes received from each peer while
+	// fetching.
+	bandwidth map[peer.ID]uint64
+	// seen is the ledger's count of bytes received from each peer when it
+	// was last read.
+	seen map[peer.ID]uint64
+	// fetching is the number of fetches in progress.
+	fetching int
+}
+
+// PeerLedger reports the number of bytes received from each peer, as
+// bitswap's ledger does.
+type PeerLedger interface {
+	// Peers returns the peers data may have been received from.
+	Peers() []peer.ID
+	// Received returns the total number of bytes received from p.
+	Received(p peer.ID) uint64
+}
+
+// bitswapLedger is a PeerLedger reading bitswap's ledger.
+type bitswapLedger struct {
+	bswap *bitswap.Bitswap
+	peers func() []peer.ID
+}
+
+// NewBitswapLedger returns a PeerLedger reading bswap's ledger of the peers
+// returned by peers, typically the peers the host is connected to.
+func NewBitswapLedger(bswap *bitswap.Bitswap, peers func() []peer.ID) PeerLedger {
+	return &bitswapLedger{bswap: bswap, peers: peers}
+}
+
+// Peers returns the peers returned by the ledger's peers function.
+func (l *bitswapLedger) Peers() []peer.ID {
+	return l.peers()
+}
+
+// Received returns the bytes bitswap has received from p.
+func (l *bitswapLedger) Received(p peer.ID) uint64 {
+	return l.bswap.LedgerForPeer(p).Recv
 }
 
 // NewFetcher returns a Fetcher wired up to the input BlockService and a newly
 // initialized persistent session of the block service.
 func NewFetcher(ctx context.Context, bsrv bserv.BlockService) *Fetcher {
+	return NewFetcherWithCodec(ctx, bsrv, types.CborCodec)
+}
+
+// NewFetcherWithCodec returns a Fetcher like NewFetcher that decodes fetched
+// blocks with codec.
+func NewFetcherWithCodec(ctx context.Context, bsrv bserv.BlockService, codec types.Codec) *Fetcher {
 	return &Fetcher{
 		session: bserv.NewSession(ctx, bsrv),
+		codec:   codec,
+		bs:      bsrv.Blockstore(),
+	}
+}
+
+// NewFetcherWithLedger returns a Fetcher like NewFetcher that accounts the
+// bytes ledger reports received from each peer while fetching.
+func NewFetcherWithLedger(ctx context.Context, bsrv bserv.BlockService, ledger PeerLedger) *Fetcher {
+	f := NewFetcher(ctx, bsrv)
+	f.ledger = ledger
+	f.bandwidth = make(map[peer.ID]uint64)
+	f.seen = make(map[peer.ID]uint64)
+	return f
+}
+
+// BandwidthByPeer returns the number of bytes received from each peer while
+// the fetcher was fetching blocks.  A bitswap session does not report which
+// peer served a block, so this is the traffic the ledger reports from each
+// peer during fetches, which includes any other bitswap traffic received at
+// the same time.  It is empty for a fetcher without a ledger.
+func (f *Fetcher) BandwidthByPeer() map[peer.ID]uint64 {
+	f.bandwidthMu.Lock()
+	defer f.bandwidthMu.Unlock()
+	bandwidth := make(map[peer.ID]uint64, len(f.bandwidth))
+	for p, n := range f.bandwidth {
+		bandwidth[p] = n
 	}
+	return bandwidth
+}
+
+// startFetch notes the start of a fetch.  Traffic received while no fetch
+// is in progress is not accounted.
+func (f *Fetcher) startFetch() {
+	if f.ledger == nil {
+		return
+	}
+	f.bandwidthMu.Lock()
+	defer f.bandwidthMu.Unlock()
+	if f.fetching == 0 {
+		f.readLedger(false)
+	}
+	f.fetching++
+}
+
+// endFetch accounts the traffic received since the ledger was last read and
+// notes the end of a fetch.
+func (f *Fetcher) endFetch() {
+	if f.ledger == nil {
+		return
+	}
+	f.bandwidthMu.Lock()
+	defer f.bandwidthMu.Unlock()
+	f.readLedger(true)
+	f.fetching--
+}
+
+// readLedger reads the bytes received from each peer from the ledger.  If
+// account is true the bytes received since the ledger was last read are
+// added to the peers' bandwidth.  The caller must hold bandwidthMu.
+func (f *Fetcher) readLedger(account bool) {
+	for _, p := range f.ledger.Peers() {
+		received := f.ledger.Received(p)
+		if account && received > f.seen[p] {
+			f.bandwidth[p] += received - f.seen[p]
+		}
+		f.seen[p] = received
+	}
+}
+
+// HasLocalBlock returns true if the block with cid c is in the local
+// blockstore, so that fetching it does not go to the network.
+func (f *Fetcher) HasLocalBlock(c cid.Cid) bool {
+	has, err := f.bs.Has(c)
+	return err == nil && has
 }
 
 // GetBlocks fetches the blocks with the given cids from the network using the
-// Fetcher's bitswap session.
+// Fetcher's bitswap session.  Bitswap derives the cid of each block it
+// receives from the block's data, so data from a peer that does not hash to a
+// requested cid does not satisfy the request, and the block is fetched from
+// another peer.
 func (f *Fetcher) GetBlocks(ctx context.Context, cids []cid.Cid) ([]*types.Block, error) {
+	f.startFetch()
+	defer f.endFetch()
+
 	var unsanitized []blocks.Block
 	for b := range f.session.GetBlocks(ctx, cids) {
 		unsanitized = append(unsanitized, b)
@@ -47,7 +184,7 @@ func (f *Fetcher) GetBlocks(ctx context.Context, cids []cid.Cid) ([]*types.Block
 
 	var blocks []*types.Block
 	for _, u := range unsanitized {
-		block, err := types.DecodeBlock(u.RawData())
+		block, err := f.codec.DecodeBlock(u.RawData())
 		if err != nil {
 			return nil, errors.Wrap(err, fmt.Sprintf("fetched data (cid %s) was not a block", u.Cid().String()))
 		}
@@ -55,3 +192,49 @@ func (f *Fetcher) GetBlocks(ctx context.Context, cids []cid.Cid) ([]*types.Block
 	}
 	return blocks, nil
 }
+
+// BlockFetcher fetches blocks by cid.
+type BlockFetcher interface {
+	GetBlocks(ctx context.Context, cids []cid.Cid) ([]*types.Block, error)
+}
+
+// FallbackFetcher tries each of its fetchers in order and returns the blocks
+// from the first one that finds them all.  This allows composing e.g. a local
+// fetcher, an HTTP mirror and bitswap.
+type FallbackFetcher struct {
+	fetchers []BlockFetcher
+}
+
+// NewFallbackFetcher returns a FallbackFetcher trying fetchers in the order
+// given.
+func NewFallbackFetcher(fetchers ...BlockFetcher) *FallbackFetcher {
+	return &FallbackFetcher{fetchers: fetchers}
+}
+
+// GetBlocks fetches the blocks with the given cids from the first fetcher that
+// returns all of them.
+func (f *FallbackFetcher) GetBlocks(ctx context.Context, cids []cid.Cid) ([]*types.Block, error) {
+	err := errors.New("no fetchers configured")
+	for _, fetcher := range f.fetchers {
+		var blocks []*types.Block
+		blocks, err = fetcher.GetBlocks(ctx, cids)
+		if err == nil {
+			return blocks, nil
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, err
+}
+
+// HasLocalBlock returns true if any of the fallback fetchers that can tell
+// holds the block with cid c locally.
+func (f *FallbackFetcher) HasLocalBlock(c cid.Cid) bool {
+	for _, fetcher := range f.fetchers {
+		if local, ok := fetcher.(interface{ HasLocalBlock(cid.Cid) bool }); ok && local.HasLocalBlock(c) {
+			return true
+		}
+	}
+	return false
+}
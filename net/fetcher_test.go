@@ -2,18 +2,29 @@ package net_test
 
 import (
 	"context"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/ipfs/go-bitswap"
+	bsnet "github.com/ipfs/go-bitswap/network"
+	blocks "github.com/ipfs/go-block-format"
 	bserv "github.com/ipfs/go-blockservice"
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-datastore"
 	dss "github.com/ipfs/go-datastore/sync"
 	bstore "github.com/ipfs/go-ipfs-blockstore"
 	"github.com/ipfs/go-ipfs-exchange-offline"
+	offroute "github.com/ipfs/go-ipfs-routing/offline"
 	ipld "github.com/ipfs/go-ipld-format"
+	"github.com/libp2p/go-libp2p-host"
+	peer "github.com/libp2p/go-libp2p-peer"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/filecoin-project/go-filecoin/net"
+	th "github.com/filecoin-project/go-filecoin/testhelpers"
 	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
 	"github.com/filecoin-project/go-filecoin/types"
 )
@@ -83,3 +94,185 @@ func TestFetchNotBlockFormat(t *testing.T) {
 	require.Error(t, err)
 	require.Nil(t, blocks)
 }
+
+func TestFetcherHasLocalBlock(t *testing.T) {
+	tf.UnitTest(t)
+
+	bs := bstore.NewBlockstore(dss.MutexWrap(datastore.NewMapDatastore()))
+	fetcher := net.NewFetcher(context.Background(), bserv.New(bs, offline.Exchange(bs)))
+	local := types.NewBlockForTest(nil, uint64(0))
+	remote := types.NewBlockForTest(nil, uint64(1))
+	requireBlockStorePut(t, bs, local.ToNode())
+
+	require.True(t, fetcher.HasLocalBlock(local.Cid()))
+	require.False(t, fetcher.HasLocalBlock(remote.Cid()))
+
+	fallback := net.NewFallbackFetcher(net.NewHTTPFetcher("http://127.0.0.1:0", nil, 0), fetcher)
+	require.True(t, fallback.HasLocalBlock(local.Cid()))
+	require.False(t, fallback.HasLocalBlock(remote.Cid()))
+}
+
+// mockLedger is a PeerLedger of fixed peers.
+type mockLedger struct {
+	mu       sync.Mutex
+	received map[peer.ID]uint64
+}
+
+func (l *mockLedger) Peers() []peer.ID {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var peers []peer.ID
+	for p := range l.received {
+		peers = append(peers, p)
+	}
+	return peers
+}
+
+func (l *mockLedger) Received(p peer.ID) uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.received[p]
+}
+
+func (l *mockLedger) receive(p peer.ID, n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.received[p] += uint64(n)
+}
+
+// servingBlockstore is a Blockstore calling onGet with each block read.
+type servingBlockstore struct {
+	bstore.Blockstore
+	onGet func(blocks.Block)
+}
+
+func (bs *servingBlockstore) Get(c cid.Cid) (blocks.Block, error) {
+	b, err := bs.Blockstore.Get(c)
+	if err == nil {
+		bs.onGet(b)
+	}
+	return b, err
+}
+
+func TestFetcherBandwidthByPeer(t *testing.T) {
+	tf.UnitTest(t)
+
+	block1 := types.NewBlockForTest(nil, uint64(0))
+	block2 := types.NewBlockForTest(nil, uint64(1))
+	block3 := types.NewBlockForTest(nil, uint64(2))
+	light, heavy := th.RequireRandomPeerID(t), th.RequireRandomPeerID(t)
+	ledger := &mockLedger{received: map[peer.ID]uint64{light: 100, heavy: 0}}
+
+	// Reading a block from the blockstore stands in for a peer sending it.
+	servedBy := map[cid.Cid]peer.ID{block1.Cid(): light, block2.Cid(): heavy, block3.Cid(): heavy}
+	bs := &servingBlockstore{
+		Blockstore: bstore.NewBlockstore(dss.MutexWrap(datastore.NewMapDatastore())),
+		onGet: func(b blocks.Block) {
+			ledger.receive(servedBy[b.Cid()], len(b.RawData()))
+		},
+	}
+	requireBlockStorePut(t, bs, block1.ToNode())
+	requireBlockStorePut(t, bs, block2.ToNode())
+	requireBlockStorePut(t, bs, block3.ToNode())
+	size := func(b *types.Block) uint64 { return uint64(len(b.ToNode().RawData())) }
+
+	fetcher := net.NewFetcherWithLedger(context.Background(), bserv.New(bs, offline.Exchange(bs)), ledger)
+	assert.Empty(t, fetcher.BandwidthByPeer())
+
+	_, err := fetcher.GetBlocks(context.Background(), []cid.Cid{block1.Cid(), block2.Cid(), block3.Cid()})
+	require.NoError(t, err)
+	assert.Equal(t, map[peer.ID]uint64{
+		light: size(block1),
+		heavy: size(block2) + size(block3),
+	}, fetcher.BandwidthByPeer())
+
+	// Traffic received outside a fetch is not accounted.
+	ledger.receive(light, 50)
+	_, err = fetcher.GetBlocks(context.Background(), []cid.Cid{block1.Cid()})
+	require.NoError(t, err)
+	assert.Equal(t, 2*size(block1), fetcher.BandwidthByPeer()[light])
+
+	// A fetcher without a ledger accounts nothing.
+	plain := net.NewFetcher(context.Background(), bserv.New(bs, offline.Exchange(bs)))
+	_, err = plain.GetBlocks(context.Background(), []cid.Cid{block1.Cid()})
+	require.NoError(t, err)
+	assert.Empty(t, plain.BandwidthByPeer())
+}
+
+// corruptBlockstore is a Blockstore serving the data substitute under every
+// cid it holds, as a misbehaving peer would.
+type corruptBlockstore struct {
+	bstore.Blockstore
+	substitute []byte
+}
+
+func (bs *corruptBlockstore) Get(c cid.Cid) (blocks.Block, error) {
+	if _, err := bs.Blockstore.Get(c); err != nil {
+		return nil, err
+	}
+	return blocks.NewBlockWithCid(bs.substitute, c)
+}
+
+// blankValidator is a record validator accepting every record.
+type blankValidator struct{}
+
+func (blankValidator) Validate(_ string, _ []byte) error        { return nil }
+func (blankValidator) Select(_ string, _ [][]byte) (int, error) { return 0, nil }
+
+// newBitswapService returns a block service exchanging the blocks of bs over
+// bitswap on h.
+func newBitswapService(ctx context.Context, h host.Host, bs bstore.Blockstore) bserv.BlockService {
+	router := offroute.NewOfflineRouter(dss.MutexWrap(datastore.NewMapDatastore()), blankValidator{})
+	return bserv.New(bs, bitswap.New(ctx, bsnet.NewFromIpfsHost(h, router), bs))
+}
+
+func TestFetchFromCorruptPeer(t *testing.T) {
+	tf.UnitTest(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	newBlockstore := func() bstore.Blockstore {
+		return bstore.NewBlockstore(dss.MutexWrap(datastore.NewMapDatastore()))
+	}
+
+	block := types.NewBlockForTest(nil, uint64(0))
+	other := types.NewBlockForTest(nil, uint64(1))
+
+	mn, err := mocknet.WithNPeers(ctx, 3)
+	require.NoError(t, err)
+	require.NoError(t, mn.LinkAll())
+	local, corrupt, good := mn.Hosts()[0], mn.Hosts()[1], mn.Hosts()[2]
+
+	// The corrupt peer serves the bytes of other for block, the good peer the
+	// bytes of block.
+	corruptBs := &corruptBlockstore{Blockstore: newBlockstore(), substitute: other.ToNode().RawData()}
+	requireBlockStorePut(t, corruptBs, block.ToNode())
+	newBitswapService(ctx, corrupt, corruptBs)
+	goodBs := newBlockstore()
+	requireBlockStorePut(t, goodBs, block.ToNode())
+	newBitswapService(ctx, good, goodBs)
+
+	fetcher := net.NewFetcher(ctx, newBitswapService(ctx, local, newBlockstore()))
+
+	t.Run("corrupt data is not accepted", func(t *testing.T) {
+		_, err := mn.ConnectPeers(local.ID(), corrupt.ID())
+		require.NoError(t, err)
+
+		fetchCtx, fetchCancel := context.WithTimeout(ctx, time.Second)
+		defer fetchCancel()
+		_, err = fetcher.GetBlocks(fetchCtx, []cid.Cid{block.Cid()})
+		assert.Error(t, err)
+	})
+
+	t.Run("the block is fetched from the good peer", func(t *testing.T) {
+		_, err := mn.ConnectPeers(local.ID(), good.ID())
+		require.NoError(t, err)
+
+		fetchCtx, fetchCancel := context.WithTimeout(ctx, 10*time.Second)
+		defer fetchCancel()
+		fetched, err := fetcher.GetBlocks(fetchCtx, []cid.Cid{block.Cid()})
+		require.NoError(t, err)
+		require.Len(t, fetched, 1)
+		assert.True(t, block.Cid().Equals(fetched[0].Cid()))
+	})
+}
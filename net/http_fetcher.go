@@ -0,0 +1,111 @@
+package net
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// maxHTTPBlockSize bounds the number of bytes read for a single block from an
+// HTTP mirror.
+const maxHTTPBlockSize = 4 << 20
+
+// DefaultHTTPFetchTimeout is the longest an HTTPFetcher waits on its mirror
+// for the blocks of one request.  It is well below the syncer's block wait
+// time, so that a hung mirror leaves time for the fetchers tried after it.
+const DefaultHTTPFetchTimeout = 5 * time.Second
+
+// HTTPFetcher fetches blocks from an HTTP(S) block mirror.  The mirror serves
+// the raw bytes of the block with cid c at GET <endpoint>/block/<c>.  Mirrors
+// are not trusted: fetched bytes are only accepted if they hash to the
+// requested cid.
+type HTTPFetcher struct {
+	endpoint string
+	client   *http.Client
+	timeout  time.Duration
+	codec    types.Codec
+}
+
+// NewHTTPFetcher returns an HTTPFetcher reading from the mirror at endpoint,
+// waiting at most timeout for the blocks of each request.  If client is nil
+// http.DefaultClient is used, and if timeout is zero DefaultHTTPFetchTimeout.
+func NewHTTPFetcher(endpoint string, client *http.Client, timeout time.Duration) *HTTPFetcher {
+	return NewHTTPFetcherWithCodec(endpoint, client, timeout, types.CborCodec)
+}
+
+// NewHTTPFetcherWithCodec returns an HTTPFetcher like NewHTTPFetcher that
+// decodes fetched blocks with codec.
+func NewHTTPFetcherWithCodec(endpoint string, client *http.Client, timeout time.Duration, codec types.Codec) *HTTPFetcher {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if timeout == 0 {
+		timeout = DefaultHTTPFetchTimeout
+	}
+	return &HTTPFetcher{
+		endpoint: strings.TrimRight(endpoint, "/"),
+		client:   client,
+		timeout:  timeout,
+		codec:    codec,
+	}
+}
+
+// GetBlocks fetches the blocks with the given cids from the mirror.  It fails
+// if any block is missing or does not match its cid, or if the mirror does
+// not serve them all within the fetcher's timeout.
+func (f *HTTPFetcher) GetBlocks(ctx context.Context, cids []cid.Cid) ([]*types.Block, error) {
+	ctx, cancel := context.WithTimeout(ctx, f.timeout)
+	defer cancel()
+
+	var blocks []*types.Block
+	for _, c := range cids {
+		block, err := f.getBlock(ctx, c)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to fetch block %s from %s", c.String(), f.endpoint)
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks, nil
+}
+
+func (f *HTTPFetcher) getBlock(ctx context.Context, c cid.Cid) (*types.Block, error) {
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/block/%s", f.endpoint, c.String()), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := f.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close() // nolint: errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxHTTPBlockSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxHTTPBlockSize {
+		return nil, fmt.Errorf("block exceeds %d bytes", maxHTTPBlockSize)
+	}
+
+	actual, err := c.Prefix().Sum(data)
+	if err != nil {
+		return nil, err
+	}
+	if !actual.Equals(c) {
+		return nil, fmt.Errorf("fetched data hashes to %s", actual.String())
+	}
+
+	return f.codec.DecodeBlock(data)
+}
@@ -0,0 +1,110 @@
+package net_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/net"
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// newMirror returns a test server serving the given raw data keyed by cid
+// string at /block/<cid>.
+func newMirror(data map[string][]byte) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, ok := data[strings.TrimPrefix(r.URL.Path, "/block/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(raw) // nolint: errcheck
+	}))
+}
+
+func TestHTTPFetcher(t *testing.T) {
+	tf.UnitTest(t)
+
+	ctx := context.Background()
+	block1 := types.NewBlockForTest(nil, uint64(0))
+	block2 := types.NewBlockForTest(nil, uint64(1))
+
+	t.Run("fetches and verifies blocks", func(t *testing.T) {
+		mirror := newMirror(map[string][]byte{
+			block1.Cid().String(): block1.ToNode().RawData(),
+			block2.Cid().String(): block2.ToNode().RawData(),
+		})
+		defer mirror.Close()
+
+		fetched, err := net.NewHTTPFetcher(mirror.URL+"/", nil, 0).GetBlocks(ctx, []cid.Cid{block1.Cid(), block2.Cid()})
+		require.NoError(t, err)
+		require.Equal(t, 2, len(fetched))
+		assert.True(t, block1.Cid().Equals(fetched[0].Cid()))
+		assert.True(t, block2.Cid().Equals(fetched[1].Cid()))
+	})
+
+	t.Run("rejects data not matching the cid", func(t *testing.T) {
+		mirror := newMirror(map[string][]byte{
+			block1.Cid().String(): block2.ToNode().RawData(),
+		})
+		defer mirror.Close()
+
+		_, err := net.NewHTTPFetcher(mirror.URL, nil, 0).GetBlocks(ctx, []cid.Cid{block1.Cid()})
+		assert.Error(t, err)
+	})
+
+	t.Run("missing block fails", func(t *testing.T) {
+		mirror := newMirror(map[string][]byte{})
+		defer mirror.Close()
+
+		_, err := net.NewHTTPFetcher(mirror.URL, nil, 0).GetBlocks(ctx, []cid.Cid{block1.Cid()})
+		assert.Error(t, err)
+	})
+}
+
+func TestFallbackFetcher(t *testing.T) {
+	tf.UnitTest(t)
+
+	ctx := context.Background()
+	block := types.NewBlockForTest(nil, uint64(0))
+
+	empty := newMirror(map[string][]byte{})
+	defer empty.Close()
+	full := newMirror(map[string][]byte{block.Cid().String(): block.ToNode().RawData()})
+	defer full.Close()
+
+	t.Run("falls back to later fetchers", func(t *testing.T) {
+		fetcher := net.NewFallbackFetcher(net.NewHTTPFetcher(empty.URL, nil, 0), net.NewHTTPFetcher(full.URL, nil, 0))
+		fetched, err := fetcher.GetBlocks(ctx, []cid.Cid{block.Cid()})
+		require.NoError(t, err)
+		require.Equal(t, 1, len(fetched))
+		assert.True(t, block.Cid().Equals(fetched[0].Cid()))
+	})
+
+	t.Run("falls back from a hung mirror", func(t *testing.T) {
+		hung := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+		}))
+		defer hung.Close()
+
+		fetcher := net.NewFallbackFetcher(net.NewHTTPFetcher(hung.URL, nil, 50*time.Millisecond), net.NewHTTPFetcher(full.URL, nil, 0))
+		fetched, err := fetcher.GetBlocks(ctx, []cid.Cid{block.Cid()})
+		require.NoError(t, err)
+		require.Equal(t, 1, len(fetched))
+		assert.True(t, block.Cid().Equals(fetched[0].Cid()))
+	})
+
+	t.Run("fails when no fetcher has the blocks", func(t *testing.T) {
+		fetcher := net.NewFallbackFetcher(net.NewHTTPFetcher(empty.URL, nil, 0))
+		_, err := fetcher.GetBlocks(ctx, []cid.Cid{block.Cid()})
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,70 @@
+package net
+
+import (
+	"context"
+
+	"github.com/ipfs/go-cid"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// ErrBlockNotLocal is returned by LocalFetcher for a block missing from its
+// blockstore.
+var ErrBlockNotLocal = errors.New("block not in local blockstore")
+
+// LocalFetcher fetches blocks from a local blockstore only.  It never goes to
+// the network, so a missing block fails immediately with ErrBlockNotLocal
+// rather than waiting out a fetch timeout.  This lets a node validate a chain
+// it already holds, e.g. one imported from a snapshot, with networking off.
+type LocalFetcher struct {
+	// bs is the blockstore blocks are read from.
+	bs bstore.Blockstore
+	// codec decodes read blocks.
+	codec types.Codec
+}
+
+// NewLocalFetcher returns a LocalFetcher reading blocks from bs.
+func NewLocalFetcher(bs bstore.Blockstore) *LocalFetcher {
+	return NewLocalFetcherWithCodec(bs, types.CborCodec)
+}
+
+// NewLocalFetcherWithCodec returns a LocalFetcher like NewLocalFetcher that
+// decodes read blocks with codec.
+func NewLocalFetcherWithCodec(bs bstore.Blockstore, codec types.Codec) *LocalFetcher {
+	return &LocalFetcher{
+		bs:    bs,
+		codec: codec,
+	}
+}
+
+// HasLocalBlock returns true if the block with cid c is in the blockstore.
+func (f *LocalFetcher) HasLocalBlock(c cid.Cid) bool {
+	has, err := f.bs.Has(c)
+	return err == nil && has
+}
+
+// GetBlocks reads the blocks with the given cids from the blockstore.  It
+// returns ErrBlockNotLocal, wrapped with the cid, for the first block missing.
+func (f *LocalFetcher) GetBlocks(ctx context.Context, cids []cid.Cid) ([]*types.Block, error) {
+	blocks := make([]*types.Block, 0, len(cids))
+	for _, c := range cids {
+		if err := ctx.Err(); err != nil {
+			return nil, errors.Wrap(err, "failed to fetch all requested blocks")
+		}
+		raw, err := f.bs.Get(c)
+		if err == bstore.ErrNotFound {
+			return nil, errors.Wrapf(ErrBlockNotLocal, "block %s", c.String())
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read block %s", c.String())
+		}
+		block, err := f.codec.DecodeBlock(raw.RawData())
+		if err != nil {
+			return nil, errors.Wrapf(err, "stored data (cid %s) was not a block", c.String())
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks, nil
+}
@@ -0,0 +1,44 @@
+package net_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dss "github.com/ipfs/go-datastore/sync"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/net"
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestLocalFetcher(t *testing.T) {
+	tf.UnitTest(t)
+
+	ctx := context.Background()
+	bs := bstore.NewBlockstore(dss.MutexWrap(datastore.NewMapDatastore()))
+	block1 := types.NewBlockForTest(nil, uint64(0))
+	block2 := types.NewBlockForTest(nil, uint64(1))
+	requireBlockStorePut(t, bs, block1.ToNode())
+	fetcher := net.NewLocalFetcher(bs)
+
+	t.Run("reads local blocks", func(t *testing.T) {
+		fetched, err := fetcher.GetBlocks(ctx, []cid.Cid{block1.Cid()})
+		require.NoError(t, err)
+		require.Equal(t, 1, len(fetched))
+		assert.True(t, block1.Cid().Equals(fetched[0].Cid()))
+		assert.True(t, fetcher.HasLocalBlock(block1.Cid()))
+	})
+
+	t.Run("fails on a missing block", func(t *testing.T) {
+		_, err := fetcher.GetBlocks(ctx, []cid.Cid{block1.Cid(), block2.Cid()})
+		assert.Equal(t, net.ErrBlockNotLocal, errors.Cause(err))
+		assert.Contains(t, err.Error(), block2.Cid().String())
+		assert.False(t, fetcher.HasLocalBlock(block2.Cid()))
+	})
+}
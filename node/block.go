@@ -56,6 +56,7 @@ func (node *Node) processBlock(ctx context.Context, pubSubMsg pubsub.Message) (e
 	log.Infof("Received new block from network cid: %s", blk.Cid().String())
 	log.Debugf("Received new block from network: %s", blk)
 
+	node.chainImporter.ObserveHead(types.NewSortedCidSet(blk.Cid()), uint64(blk.Height))
 	err = node.Syncer.HandleNewTipset(ctx, types.NewSortedCidSet(blk.Cid()))
 	if err != nil {
 		return errors.Wrap(err, "processing block from network")
@@ -65,7 +65,7 @@ func TestBlockPropsManyNodes(t *testing.T) {
 		Miner:        minerAddr,
 		Parents:      baseTS.ToSortedCidSet(),
 		Height:       types.Uint64(1),
-		ParentWeight: types.Uint64(10000),
+		ParentWeight: types.Uint64(0), // genesis weighs nothing
 		StateRoot:    baseTS.ToSlice()[0].StateRoot,
 		Proof:        proof,
 		Ticket:       ticket,
@@ -113,6 +113,10 @@ func TestChainSync(t *testing.T) {
 	nextBlk1 := testhelpers.NewValidTestBlockFromTipSet(baseTS, stateRoot, 1, minerAddr, mockSignerPubKey, signer)
 	nextBlk2 := testhelpers.NewValidTestBlockFromTipSet(baseTS, stateRoot, 2, minerAddr, mockSignerPubKey, signer)
 	nextBlk3 := testhelpers.NewValidTestBlockFromTipSet(baseTS, stateRoot, 3, minerAddr, mockSignerPubKey, signer)
+	// The blocks claim the weight of genesis, their parent, which is zero.
+	for _, blk := range []*types.Block{nextBlk1, nextBlk2, nextBlk3} {
+		blk.ParentWeight = 0
+	}
 
 	assert.NoError(t, nodes[0].AddNewBlock(ctx, nextBlk1))
 	assert.NoError(t, nodes[0].AddNewBlock(ctx, nextBlk2))
@@ -0,0 +1,121 @@
+package node
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ipfs/go-datastore"
+
+	"github.com/filecoin-project/go-filecoin/chain"
+)
+
+// HealthVerdict summarizes the health of a node.
+type HealthVerdict int
+
+const (
+	// Healthy is the verdict on a node with nothing wrong.
+	Healthy HealthVerdict = iota
+	// Degraded is the verdict on a node that works but is not fully
+	// serving, e.g. because it is still syncing or has no peers.
+	Degraded
+	// Unhealthy is the verdict on a node that needs intervention, e.g.
+	// because its datastore is inaccessible or its head has stalled.
+	Unhealthy
+)
+
+func (v HealthVerdict) String() string {
+	switch v {
+	case Healthy:
+		return "healthy"
+	case Degraded:
+		return "degraded"
+	case Unhealthy:
+		return "unhealthy"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText encodes the verdict as its name.
+func (v HealthVerdict) MarshalText() ([]byte, error) {
+	return []byte(v.String()), nil
+}
+
+// healthProbeKey is the datastore key read to check that the datastore is
+// accessible.  Whether it is present does not matter.
+var healthProbeKey = datastore.NewKey("/health")
+
+// HealthStatus aggregates the status of a node's syncer, repo and peers into
+// a single verdict, for liveness and readiness probes.
+type HealthStatus struct {
+	// Verdict is the overall health of the node.
+	Verdict HealthVerdict
+	// Ready is whether the node is caught up with the network and healthy
+	// enough to serve.  It is false while the node applies a chain above
+	// its head, as during initial sync.
+	Ready bool
+	// Reasons explains every finding that lowered the verdict.
+	Reasons []string `json:",omitempty"`
+
+	// SyncMode is the mode of the node's syncer.
+	SyncMode chain.SyncMode
+	// HeadStalled is whether the node is caught up but its head has
+	// stopped advancing.  It is only ever true if head stall detection is
+	// configured.
+	HeadStalled bool
+	// Behind is whether the node's head is below a chain the node fetched
+	// from the network.  Unlike SyncMode, it does not count the heights
+	// peers merely claim, so readiness does not depend on them.
+	Behind bool
+	// DatastoreError is the error reading the chain datastore, empty if it
+	// is accessible.  A closed repo, which has released its lock, is
+	// inaccessible.
+	DatastoreError string `json:",omitempty"`
+	// Peers is the number of peers the node is connected to.
+	Peers int
+}
+
+// Health checks the node's syncer, repo and peers and returns its health.
+// Syncers other than the DefaultSyncer are assumed caught up.
+func (node *Node) Health(ctx context.Context) HealthStatus {
+	status := HealthStatus{SyncMode: chain.CaughtUp}
+	if syncer, ok := node.Syncer.(*chain.DefaultSyncer); ok {
+		status.SyncMode = syncer.Mode()
+		status.HeadStalled, _ = syncer.HeadStalled()
+		status.Behind = syncer.IsBehindConfirmed()
+	}
+	if _, err := node.Repo.ChainDatastore().Has(healthProbeKey); err != nil {
+		status.DatastoreError = err.Error()
+	}
+	if node.Host() != nil {
+		status.Peers = len(node.Host().Network().Peers())
+	}
+	status.judge()
+	return status
+}
+
+// judge sets the verdict, readiness and reasons of s from its findings.
+func (s *HealthStatus) judge() {
+	s.Verdict = Healthy
+	s.Reasons = nil
+	lower := func(v HealthVerdict, reason string) {
+		if v > s.Verdict {
+			s.Verdict = v
+		}
+		s.Reasons = append(s.Reasons, reason)
+	}
+
+	if s.DatastoreError != "" {
+		lower(Unhealthy, fmt.Sprintf("datastore inaccessible: %s", s.DatastoreError))
+	}
+	if s.HeadStalled {
+		lower(Unhealthy, "head stalled")
+	}
+	if s.SyncMode != chain.CaughtUp {
+		lower(Degraded, fmt.Sprintf("sync mode is %s", s.SyncMode))
+	}
+	if s.Peers == 0 {
+		lower(Degraded, "no peers")
+	}
+	s.Ready = s.Verdict != Unhealthy && !s.Behind
+}
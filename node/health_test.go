@@ -0,0 +1,87 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/repo"
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+)
+
+// unreadableRepo is a repo whose chain datastore cannot be read.
+type unreadableRepo struct {
+	repo.Repo
+}
+
+func (r *unreadableRepo) ChainDatastore() repo.Datastore {
+	return unreadableDatastore{r.Repo.ChainDatastore()}
+}
+
+type unreadableDatastore struct {
+	repo.Datastore
+}
+
+func (unreadableDatastore) Has(datastore.Key) (bool, error) {
+	return false, errors.New("injected failure")
+}
+
+func TestHealthVerdict(t *testing.T) {
+	tf.UnitTest(t)
+
+	cases := []struct {
+		name    string
+		status  HealthStatus
+		verdict HealthVerdict
+		ready   bool
+	}{
+		{"caught up", HealthStatus{SyncMode: chain.CaughtUp, Peers: 3}, Healthy, true},
+		{"syncing", HealthStatus{SyncMode: chain.Syncing, Behind: true, Peers: 3}, Degraded, false},
+		{"claimed height only", HealthStatus{SyncMode: chain.Syncing, Peers: 3}, Degraded, true},
+		{"stalled head", HealthStatus{SyncMode: chain.CaughtUp, HeadStalled: true, Peers: 3}, Unhealthy, false},
+		{"no peers", HealthStatus{SyncMode: chain.CaughtUp}, Degraded, true},
+		{"datastore inaccessible", HealthStatus{SyncMode: chain.CaughtUp, DatastoreError: "closed", Peers: 3}, Unhealthy, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			status := c.status
+			status.judge()
+			assert.Equal(t, c.verdict, status.Verdict)
+			assert.Equal(t, c.ready, status.Ready)
+			if c.verdict == Healthy {
+				assert.Empty(t, status.Reasons)
+			} else {
+				assert.NotEmpty(t, status.Reasons)
+			}
+		})
+	}
+}
+
+func TestHealth(t *testing.T) {
+	tf.UnitTest(t)
+	ctx := context.Background()
+
+	nd := MakeOfflineNode(t)
+	require.NoError(t, nd.Start(ctx))
+	defer nd.Stop(ctx)
+
+	// An offline node at its genesis is caught up but has no peers.
+	status := nd.Health(ctx)
+	assert.Equal(t, chain.CaughtUp, status.SyncMode)
+	assert.False(t, status.HeadStalled)
+	assert.False(t, status.Behind)
+	assert.Equal(t, 0, status.Peers)
+	assert.Equal(t, Degraded, status.Verdict)
+	assert.True(t, status.Ready)
+
+	nd.Repo = &unreadableRepo{nd.Repo}
+	status = nd.Health(ctx)
+	assert.Contains(t, status.DatastoreError, "injected failure")
+	assert.Equal(t, Unhealthy, status.Verdict)
+	assert.False(t, status.Ready)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 
 	bserv "github.com/ipfs/go-blockservice"
+	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-hamt-ipld"
 	bstore "github.com/ipfs/go-ipfs-blockstore"
 	offline "github.com/ipfs/go-ipfs-exchange-offline"
@@ -12,18 +13,27 @@ import (
 
 	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/config"
 	"github.com/filecoin-project/go-filecoin/consensus"
 	"github.com/filecoin-project/go-filecoin/repo"
+	"github.com/filecoin-project/go-filecoin/types"
 	"github.com/filecoin-project/go-filecoin/wallet"
 )
 
 var ErrLittleBits = errors.New("Bitsize less than 1024 is considered unsafe") // nolint: golint
 
+// ErrGenesisStateMismatch is returned by Init when the genesis state root
+// differs from the expected root.
+var ErrGenesisStateMismatch = errors.New("genesis state root does not match the expected root")
+
 // InitCfg contains configuration for initializing a node
 type InitCfg struct {
 	PeerKey                 ci.PrivKey
 	DefaultWalletAddress    address.Address
 	AutoSealIntervalSeconds uint
+	// ExpectedGenesisStateRoot, if defined, is the state root the genesis
+	// block must have.
+	ExpectedGenesisStateRoot cid.Cid
 }
 
 // InitOpt is an init option function
@@ -51,6 +61,17 @@ func AutoSealIntervalSecondsOpt(autoSealIntervalSeconds uint) InitOpt {
 	}
 }
 
+// ExpectedGenesisStateRootOpt configures Init to fail with
+// ErrGenesisStateMismatch, before writing anything to the repo, if the state
+// root of the generated genesis block is not root.  Networks publish the root
+// so that nodes can detect genesis templates that diverge from the network's
+// in the initial state alone.
+func ExpectedGenesisStateRootOpt(root cid.Cid) InitOpt {
+	return func(c *InitCfg) {
+		c.ExpectedGenesisStateRoot = root
+	}
+}
+
 // Init initializes a filecoin node in the given repo.
 func Init(ctx context.Context, r repo.Repo, gen consensus.GenesisInitFunc, opts ...InitOpt) error {
 	cfg := new(InitCfg)
@@ -58,12 +79,38 @@ func Init(ctx context.Context, r repo.Repo, gen consensus.GenesisInitFunc, opts
 		o(cfg)
 	}
 
+	if cfg.ExpectedGenesisStateRoot.Defined() {
+		gen = checkGenesisStateRoot(gen, cfg.ExpectedGenesisStateRoot)
+	}
+
+	// Stage the writes so that a failure part way leaves r untouched.
+	tx, err := r.BeginInit()
+	if err != nil {
+		return errors.Wrap(err, "failed to begin init")
+	}
+	if err := initRepo(ctx, tx, gen, cfg); err != nil {
+		tx.Abort() // nolint: errcheck
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "failed to commit init")
+	}
+	return nil
+}
+
+// initRepo writes the genesis block, keys and config of a new node to r.
+func initRepo(ctx context.Context, r repo.Repo, gen consensus.GenesisInitFunc, cfg *InitCfg) error {
 	bs := bstore.NewBlockstore(r.Datastore())
 	cst := &hamt.CborIpldStore{Blocks: bserv.New(bs, offline.Exchange(bs))}
 
-	if _, err := chain.Init(ctx, r, bs, cst, gen); err != nil {
+	chainStore, err := chain.Init(ctx, r, bs, cst, gen)
+	if err != nil {
 		return errors.Wrap(err, "Could not Init Node")
 	}
+	genesis, err := chainStore.GetBlock(ctx, chainStore.GenesisCid())
+	if err != nil {
+		return errors.Wrap(err, "failed to read genesis block")
+	}
 
 	if cfg.PeerKey == nil {
 		// TODO: make size configurable
@@ -82,6 +129,7 @@ func Init(ctx context.Context, r repo.Repo, gen consensus.GenesisInitFunc, opts
 	newConfig := r.Config()
 
 	newConfig.Mining.AutoSealIntervalSeconds = cfg.AutoSealIntervalSeconds
+	newConfig.NetworkName = genesis.NetworkName
 
 	if cfg.DefaultWalletAddress != (address.Undef) {
 		newConfig.Wallet.DefaultAddress = cfg.DefaultWalletAddress
@@ -102,6 +150,88 @@ func Init(ctx context.Context, r repo.Repo, gen consensus.GenesisInitFunc, opts
 	return nil
 }
 
+// InitPreview is the result of initializing a node without writing to its
+// repo.
+type InitPreview struct {
+	Config     *config.Config
+	GenesisCid cid.Cid
+}
+
+// PreviewInit returns the config and genesis cid that Init would produce for
+// r, without modifying r.  It runs Init against an in-memory repo starting
+// from a copy of r's config.
+func PreviewInit(ctx context.Context, r repo.Repo, gen consensus.GenesisInitFunc, opts ...InitOpt) (*InitPreview, error) {
+	cfg, err := r.Config().Copy()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to copy config")
+	}
+
+	memRepo := repo.NewInMemoryRepo()
+	if err := memRepo.ReplaceConfig(cfg); err != nil {
+		return nil, err
+	}
+	if err := Init(ctx, memRepo, gen, opts...); err != nil {
+		return nil, err
+	}
+
+	genCid, err := readGenesisCid(memRepo.Datastore())
+	if err != nil {
+		return nil, err
+	}
+	return &InitPreview{
+		Config:     memRepo.Config(),
+		GenesisCid: genCid,
+	}, nil
+}
+
+// RotatePeerKey replaces the private key of the node's libp2p identity, the
+// 'self' key, with newKey, generating a new key if newKey is nil.  All other
+// repo data, including the chain, is preserved.  No config values reference
+// the peer ID, but a miner's peer ID recorded on chain must be updated
+// separately.  The node using r must not be running.
+func RotatePeerKey(r repo.Repo, newKey ci.PrivKey) error {
+	if newKey == nil {
+		// TODO: make size configurable
+		peerKey, err := makePrivateKey(2048)
+		if err != nil {
+			return errors.Wrap(err, "failed to create nodes private key")
+		}
+		newKey = peerKey
+	}
+
+	oldKey, err := r.Keystore().Get("self")
+	if err != nil {
+		return errors.Wrap(err, "failed to get current private key")
+	}
+	if err := r.Keystore().Delete("self"); err != nil {
+		return errors.Wrap(err, "failed to remove current private key")
+	}
+	if err := r.Keystore().Put("self", newKey); err != nil {
+		// Restore the old identity rather than leave the repo without one.
+		if restoreErr := r.Keystore().Put("self", oldKey); restoreErr != nil {
+			return errors.Wrapf(err, "failed to store private key and failed to restore previous key (%s)", restoreErr)
+		}
+		return errors.Wrap(err, "failed to store private key")
+	}
+	return nil
+}
+
+// checkGenesisStateRoot returns a GenesisInitFunc that fails with
+// ErrGenesisStateMismatch if the genesis block gen generates does not have
+// state root expected.
+func checkGenesisStateRoot(gen consensus.GenesisInitFunc, expected cid.Cid) consensus.GenesisInitFunc {
+	return func(cst *hamt.CborIpldStore, bs bstore.Blockstore) (*types.Block, error) {
+		genesis, err := gen(cst, bs)
+		if err != nil {
+			return nil, err
+		}
+		if !genesis.StateRoot.Equals(expected) {
+			return nil, errors.Wrapf(ErrGenesisStateMismatch, "computed %s, expected %s", genesis.StateRoot.String(), expected.String())
+		}
+		return genesis, nil
+	}
+}
+
 // makePrivateKey generates a new private key, which is the basis for a libp2p identity.
 // borrowed from go-ipfs: `repo/config/init.go`
 func makePrivateKey(nbits int) (ci.PrivKey, error) {
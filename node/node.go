@@ -5,10 +5,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strconv"
 	"sync"
 	"time"
 
-	ps "github.com/cskr/pubsub"
 	"github.com/ipfs/go-bitswap"
 	bsnet "github.com/ipfs/go-bitswap/network"
 	bserv "github.com/ipfs/go-blockservice"
@@ -63,7 +63,6 @@ import (
 	"github.com/filecoin-project/go-filecoin/protocol/retrieval"
 	"github.com/filecoin-project/go-filecoin/protocol/storage"
 	"github.com/filecoin-project/go-filecoin/repo"
-	"github.com/filecoin-project/go-filecoin/sampling"
 	"github.com/filecoin-project/go-filecoin/state"
 	"github.com/filecoin-project/go-filecoin/types"
 	"github.com/filecoin-project/go-filecoin/wallet"
@@ -71,6 +70,10 @@ import (
 
 const (
 	filecoinDHTProtocol dhtprotocol.ID = "/fil/kad/1.0.0"
+
+	// headBufferSize is the number of heads buffered for the node's head
+	// subscription.
+	headBufferSize = 16
 )
 
 var log = logging.Logger("node") // nolint: deadcode
@@ -88,7 +91,9 @@ type nodeChainReader interface {
 	GetHead() types.SortedCidSet
 	GetTipSet(types.SortedCidSet) (*types.TipSet, error)
 	GetTipSetStateRoot(tsKey types.SortedCidSet) (cid.Cid, error)
-	HeadEvents() *ps.PubSub
+	SubscribeHeads(buffer int, policy chain.HeadDropPolicy) *chain.HeadSubscription
+	UnsubscribeHeads(sub *chain.HeadSubscription)
+	Check(ctx context.Context, repair bool) (*chain.StoreCheckResult, error)
 	Load(context.Context) error
 	Stop()
 }
@@ -103,13 +108,17 @@ type Node struct {
 	Syncer      chain.Syncer
 	PowerTable  consensus.PowerTableView
 
+	// chainImporter imports chain CARs and is told of the heads peers
+	// announce, which it syncs to after an import.
+	chainImporter *chain.CarImporter
+
 	BlockMiningAPI *block.MiningAPI
 	PorcelainAPI   *porcelain.API
 	RetrievalAPI   *retrieval.API
 	StorageAPI     *storage.API
 
-	// HeavyTipSetCh is a subscription to the heaviest tipset topic on the chain.
-	HeaviestTipSetCh chan interface{}
+	// headSub is a subscription to the heads of the chain.
+	headSub *chain.HeadSubscription
 	// HeavyTipSetHandled is a hook for tests because pubsub notifications
 	// arrive async. It's called after handling a new heaviest tipset.
 	// Remove this after replacing the tipset "pubsub" with a synchronous event bus:
@@ -135,6 +144,9 @@ type Node struct {
 	}
 	miningCtx    context.Context
 	miningDoneWg *sync.WaitGroup
+	// samplingLookback is the number of tipsets preceding the live proving
+	// periods gathered for consensus to sample randomness from.
+	samplingLookback uint
 
 	// Storage Market Interfaces
 	StorageMiner *storage.Miner
@@ -265,6 +277,24 @@ type blankValidator struct{}
 func (blankValidator) Validate(_ string, _ []byte) error        { return nil }
 func (blankValidator) Select(_ string, _ [][]byte) (int, error) { return 0, nil }
 
+// parseExpectedStateRoots converts the configured height to state root
+// strings into the form used by the syncer.
+func parseExpectedStateRoots(cfgRoots map[string]string) (map[uint64]cid.Cid, error) {
+	roots := make(map[uint64]cid.Cid, len(cfgRoots))
+	for heightStr, rootStr := range cfgRoots {
+		height, err := strconv.ParseUint(heightStr, 10, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid height %s", heightStr)
+		}
+		root, err := cid.Decode(rootStr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid state root for height %s", heightStr)
+		}
+		roots[height] = root
+	}
+	return roots, nil
+}
+
 // readGenesisCid is a helper function that queries the provided datastore for
 // an entry with the genesisKey cid, returning if found.
 func readGenesisCid(ds datastore.Datastore) (cid.Cid, error) {
@@ -382,17 +412,27 @@ func (nc *Config) Build(ctx context.Context) (*Node, error) {
 	//nwork := bsnet.NewFromIpfsHost(innerHost, router)
 	bswap := bitswap.New(ctx, nwork, bs)
 	bservice := bserv.New(bs, bswap)
-	fetcher := net.NewFetcher(ctx, bservice)
+	fetcher := net.NewFetcherWithLedger(ctx, bservice, net.NewBitswapLedger(bswap.(*bitswap.Bitswap), peerHost.Network().Peers))
 
-	cstOffline := hamt.CborIpldStore{Blocks: bserv.New(bs, offline.Exchange(bs))}
+	// State is read through an optional in-memory cache.
+	var stateBs bstore.Blockstore = bs
+	if cacheBytes := nc.Repo.Config().Sync.StateCacheBytes; cacheBytes > 0 {
+		stateBs = chain.NewStateCache(bs, cacheBytes)
+	}
+	cstOffline := hamt.CborIpldStore{Blocks: bserv.New(stateBs, offline.Exchange(stateBs))}
 	genCid, err := readGenesisCid(nc.Repo.Datastore())
 	if err != nil {
 		return nil, err
 	}
 
 	// set up chainstore
-	chainStore := chain.NewDefaultStore(nc.Repo.ChainDatastore(), genCid)
-	chainState := cst.NewChainStateProvider(chainStore, &cstOffline)
+	storeOpts := []chain.StoreOpt{chain.VerifyHeadState(chain.NewCborStateStore(&cstOffline))}
+	if syncCfg := nc.Repo.Config().Sync; syncCfg.PruneFinalizedMessages && syncCfg.FinalityDepth > 0 {
+		storeOpts = append(storeOpts, chain.KeepMessagesWithinFinality(syncCfg.FinalityDepth))
+	}
+	chainStore := chain.NewDefaultStore(nc.Repo.ChainDatastore(), genCid, storeOpts...)
+	samplingLookback := nc.Repo.Config().Sync.SamplingLookback
+	chainState := cst.NewChainStateProvider(chainStore, &cstOffline, samplingLookback)
 	powerTable := &consensus.MarketView{}
 
 	// set up processor
@@ -404,11 +444,15 @@ func (nc *Config) Build(ctx context.Context) (*Node, error) {
 	}
 
 	// set up consensus
+	consensusOpts := []consensus.ExpectedOpt{consensus.WithSignatureWorkers(nc.Repo.Config().Sync.SignatureWorkers)}
+	if maxGrowth := nc.Repo.Config().Sync.MaxActorGrowth; maxGrowth > 0 {
+		consensusOpts = append(consensusOpts, consensus.WithMaxActorGrowth(maxGrowth))
+	}
 	var nodeConsensus consensus.Protocol
 	if nc.Verifier == nil {
-		nodeConsensus = consensus.NewExpected(&cstOffline, bs, processor, powerTable, genCid, &proofs.RustVerifier{})
+		nodeConsensus = consensus.NewExpected(&cstOffline, bs, processor, powerTable, genCid, &proofs.RustVerifier{}, consensusOpts...)
 	} else {
-		nodeConsensus = consensus.NewExpected(&cstOffline, bs, processor, powerTable, genCid, nc.Verifier)
+		nodeConsensus = consensus.NewExpected(&cstOffline, bs, processor, powerTable, genCid, nc.Verifier, consensusOpts...)
 	}
 
 	// Set up libp2p network
@@ -423,8 +467,116 @@ func (nc *Config) Build(ctx context.Context) (*Node, error) {
 	}
 	fcWallet := wallet.New(backend)
 
+	// Bootstrapping network peers.
+	periodStr := nc.Repo.Config().Bootstrap.Period
+	period, err := time.ParseDuration(periodStr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "couldn't parse bootstrap period %s", periodStr)
+	}
+
+	// Bootstrapper maintains connections to some subset of addresses
+	ba := nc.Repo.Config().Bootstrap.Addresses
+	bpi, err := net.PeerAddrsToPeerInfos(ba)
+	if err != nil {
+		return nil, errors.Wrapf(err, "couldn't parse bootstrap addresses [%s]", ba)
+	}
+	minPeerThreshold := nc.Repo.Config().Bootstrap.MinPeerThreshold
+	bootstrapper := net.NewBootstrapper(bpi, peerHost, peerHost.Network(), router, minPeerThreshold, period)
+
 	// only the syncer gets the storage which is online connected
-	chainSyncer := chain.NewDefaultSyncer(&cstOffline, nodeConsensus, chainStore, fetcher)
+	var syncerOpts []chain.SyncerOpt
+	if nc.Repo.Config().Sync.DisableWiden {
+		syncerOpts = append(syncerOpts, chain.DisableWiden())
+	}
+	if len(nc.Repo.Config().Sync.ExpectedStateRoots) > 0 {
+		roots, err := parseExpectedStateRoots(nc.Repo.Config().Sync.ExpectedStateRoots)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid sync.expectedStateRoots")
+		}
+		syncerOpts = append(syncerOpts, chain.ExpectedStateRoots(roots))
+	}
+	lateBlockGrace, err := time.ParseDuration(nc.Repo.Config().Sync.LateBlockGracePeriod)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid sync.lateBlockGracePeriod")
+	}
+	if lateBlockGrace > 0 {
+		syncerOpts = append(syncerOpts, chain.LateBlockGracePeriod(lateBlockGrace))
+	}
+	headStallThreshold, err := time.ParseDuration(nc.Repo.Config().Sync.HeadStallThreshold)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid sync.headStallThreshold")
+	}
+	if headStallThreshold > 0 {
+		syncerOpts = append(syncerOpts, chain.DetectHeadStall(headStallThreshold, nil))
+	}
+	orphanWindow, err := time.ParseDuration(nc.Repo.Config().Sync.OrphanWindow)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid sync.orphanWindow")
+	}
+	if orphanWindow > 0 {
+		syncerOpts = append(syncerOpts, chain.BufferOrphans(orphanWindow))
+	}
+	if threshold := nc.Repo.Config().Sync.StallThreshold; threshold > 0 {
+		// The block mirror, if configured, is already tried before bitswap,
+		// so a stall has no further fallback.
+		syncerOpts = append(syncerOpts, chain.DetectStalls(threshold, nil, nil))
+	}
+	if depth := nc.Repo.Config().Sync.FinalityDepth; depth > 0 {
+		syncerOpts = append(syncerOpts, chain.FinalityDepth(depth, chain.DefaultBadTipSetCompactionInterval))
+	}
+	syncerOpts = append(syncerOpts, chain.RequireNetworkName(nc.Repo.Config().NetworkName))
+	syncerOpts = append(syncerOpts, chain.SamplingLookback(samplingLookback))
+	syncerOpts = append(syncerOpts,
+		chain.NodeVersion(flags.Commit),
+		chain.QuarantineTo(chain.NewDatastoreQuarantineStore(nc.Repo.ChainDatastore())),
+	)
+	// The block validator also keeps stored blocks of miners off the list
+	// out of widened tipsets.
+	if miners := nc.Repo.Config().MinerAllowlist; len(miners) > 0 {
+		syncerOpts = append(syncerOpts, chain.ValidateBlocks(chain.MinerAllowlist(miners)))
+	}
+	if nc.Repo.Config().Sync.StrictWiden {
+		syncerOpts = append(syncerOpts, chain.StrictWiden(false))
+	}
+	if maxBlocks := nc.Repo.Config().Sync.MaxBlocksPerSync; maxBlocks > 0 {
+		syncerOpts = append(syncerOpts,
+			chain.MaxBlocksPerSync(maxBlocks),
+			chain.CheckpointTo(chain.NewDatastoreCheckpointStore(nc.Repo.ChainDatastore())),
+		)
+	}
+	if retries := nc.Repo.Config().Sync.TransientRetries; retries > 0 {
+		syncerOpts = append(syncerOpts, chain.RetryTransient(retries, chain.DefaultRetryBackoff))
+	}
+	if maxPending := nc.Repo.Config().Sync.MaxPendingSyncs; maxPending > 0 {
+		syncerOpts = append(syncerOpts, chain.MaxPendingSyncs(maxPending))
+	}
+	if nc.Repo.Config().Sync.EagerDialPeers {
+		syncerOpts = append(syncerOpts, chain.DialPeersWhenThin(bootstrapper, minPeerThreshold))
+	}
+	if minBlocks := nc.Repo.Config().Sync.MinBlocksPerTipSet; minBlocks > 0 {
+		syncerOpts = append(syncerOpts, chain.WarnLowParticipation(minBlocks, nil))
+	}
+	var syncFetcher net.BlockFetcher = fetcher
+	if mirror := nc.Repo.Config().Sync.BlockMirrorURL; mirror != "" {
+		localFetcher := net.NewFetcher(ctx, bserv.New(bs, offline.Exchange(bs)))
+		syncFetcher = net.NewFallbackFetcher(localFetcher, net.NewHTTPFetcher(mirror, nil, 0), fetcher)
+	}
+	if nc.Repo.Config().Sync.RestoreGenesis {
+		// The genesis block and state are written to the blockstore at init,
+		// so they outlive a wiped chain datastore.
+		syncerOpts = append(syncerOpts, chain.RestoreGenesis(func(ctx context.Context) (*types.Block, error) {
+			var genesis types.Block
+			if err := cstOffline.Get(ctx, genCid, &genesis); err != nil {
+				return nil, err
+			}
+			return &genesis, nil
+		}))
+	}
+	if nc.Repo.Config().Sync.LocalOnly {
+		syncFetcher = net.NewLocalFetcher(bs)
+	}
+	chainSyncer := chain.NewDefaultSyncer(chain.NewCborStateStore(&cstOffline), nodeConsensus, chain.NewCachingChainReader(chainStore, chain.DefaultTipSetCacheSize), syncFetcher, syncerOpts...)
+	chainImporter := chain.NewCarImporter(chainStore, bs, chainSyncer)
 	msgPool := core.NewMessagePool(chainStore, nc.Repo.Config().Mpool, consensus.NewIngestionValidator(chainState, nc.Repo.Config().Mpool))
 	msgQueue := core.NewMessageQueue()
 
@@ -435,13 +587,14 @@ func (nc *Config) Build(ctx context.Context) (*Node, error) {
 	PorcelainAPI := porcelain.New(plumbing.New(&plumbing.APIDeps{
 		Bitswap:      bswap,
 		Chain:        chainState,
+		ChainImport:  chainImporter,
 		Config:       cfg.NewConfig(nc.Repo),
 		DAG:          dag.NewDAG(merkledag.NewDAGService(bservice)),
 		Deals:        strgdls.New(nc.Repo.DealsDatastore()),
 		MsgPool:      msgPool,
 		MsgPreviewer: msg.NewPreviewer(fcWallet, chainStore, &cstOffline, bs),
 		MsgQueryer:   msg.NewQueryer(nc.Repo, fcWallet, chainStore, &cstOffline, bs),
-		MsgWaiter:    msg.NewWaiter(chainStore, bs, &cstOffline),
+		MsgWaiter:    msg.NewWaiter(chainStore, bs, &cstOffline, samplingLookback),
 		Network:      net.New(peerHost, pubsub.NewPublisher(fsub), pubsub.NewSubscriber(fsub), net.NewRouter(router), bandwidthTracker, net.NewPinger(peerHost, pingService)),
 		Outbox:       outbox,
 		Wallet:       fcWallet,
@@ -469,21 +622,9 @@ func (nc *Config) Build(ctx context.Context) (*Node, error) {
 		Router:       router,
 	}
 
-	// Bootstrapping network peers.
-	periodStr := nd.Repo.Config().Bootstrap.Period
-	period, err := time.ParseDuration(periodStr)
-	if err != nil {
-		return nil, errors.Wrapf(err, "couldn't parse bootstrap period %s", periodStr)
-	}
-
-	// Bootstrapper maintains connections to some subset of addresses
-	ba := nd.Repo.Config().Bootstrap.Addresses
-	bpi, err := net.PeerAddrsToPeerInfos(ba)
-	if err != nil {
-		return nil, errors.Wrapf(err, "couldn't parse bootstrap addresses [%s]", ba)
-	}
-	minPeerThreshold := nd.Repo.Config().Bootstrap.MinPeerThreshold
-	nd.Bootstrapper = net.NewBootstrapper(bpi, nd.Host(), nd.Host().Network(), nd.Router, minPeerThreshold, period)
+	nd.Bootstrapper = bootstrapper
+	nd.chainImporter = chainImporter
+	nd.samplingLookback = samplingLookback
 
 	return nd, nil
 }
@@ -499,9 +640,23 @@ func (node *Node) Start(ctx context.Context) error {
 	}
 
 	var err error
+	if node.Repo.Config().Sync.SafeBoot {
+		if err = node.safeBoot(ctx); err != nil {
+			return err
+		}
+	}
 	if err = node.ChainReader.Load(ctx); err != nil {
 		return err
 	}
+	if syncer, ok := node.Syncer.(*chain.DefaultSyncer); ok {
+		if err = syncer.CheckGenesis(ctx); err != nil {
+			return err
+		}
+	}
+
+	if err = node.resolveDefaultWalletAddress(); err != nil {
+		return err
+	}
 
 	// Only set these up if there is a miner configured.
 	if _, err := node.miningAddress(); err == nil {
@@ -514,6 +669,7 @@ func (node *Node) Start(ctx context.Context) error {
 	// Start up 'hello' handshake service
 	syncCallBack := func(pid libp2ppeer.ID, cids []cid.Cid, height uint64) {
 		cidSet := types.NewSortedCidSet(cids...)
+		node.chainImporter.ObserveHead(cidSet, height)
 		err := node.Syncer.HandleNewTipset(context.Background(), cidSet)
 		if err != nil {
 			log.Infof("error handling blocks: %s", cidSet.String())
@@ -548,13 +704,23 @@ func (node *Node) Start(ctx context.Context) error {
 	go node.handleSubscription(cctx, node.processMessage, "processMessage", node.MessageSub, "MessageSub")
 
 	node.HeaviestTipSetHandled = func() {}
-	node.HeaviestTipSetCh = node.ChainReader.HeadEvents().Sub(chain.NewHeadTopic)
+	// Each head is handled against the last head handled, so heads dropped
+	// while handling falls behind are not missed.
+	node.headSub = node.ChainReader.SubscribeHeads(headBufferSize, chain.DropOldestHead)
 	head, err := node.PorcelainAPI.ChainHead()
 	if err != nil {
 		return errors.Wrap(err, "failed to get chain head")
 	}
 	go node.handleNewHeaviestTipSet(cctx, *head)
 
+	if syncer, ok := node.Syncer.(*chain.DefaultSyncer); ok {
+		go syncer.RunBadTipSetCompaction(cctx)
+		go syncer.RunHeadStallDetection(cctx, chain.DefaultHeadStallCheckInterval)
+	}
+	if store, ok := node.ChainReader.(*chain.DefaultStore); ok {
+		go store.RunMessagePruning(cctx, chain.DefaultMessagePruningInterval)
+	}
+
 	if !node.OfflineMode {
 		node.Bootstrapper.Start(context.Background())
 	}
@@ -647,15 +813,10 @@ func (node *Node) handleNewMiningOutput(miningOutCh <-chan mining.Output) {
 func (node *Node) handleNewHeaviestTipSet(ctx context.Context, head types.TipSet) {
 	for {
 		select {
-		case ts, ok := <-node.HeaviestTipSetCh:
+		case newHead, ok := <-node.headSub.Heads():
 			if !ok {
 				return
 			}
-			newHead, ok := ts.(types.TipSet)
-			if !ok {
-				log.Error("non-tipset published on heaviest tipset channel")
-				continue
-			}
 			if len(newHead) == 0 {
 				log.Error("tipset of size 0 published on heaviest tipset channel. ignoring and waiting for a new heaviest tipset.")
 				continue
@@ -697,7 +858,7 @@ func (node *Node) cancelSubscriptions() {
 
 // Stop initiates the shutdown of the node.
 func (node *Node) Stop(ctx context.Context) {
-	node.ChainReader.HeadEvents().Unsub(node.HeaviestTipSetCh)
+	node.ChainReader.UnsubscribeHeads(node.headSub)
 	node.StopMining(ctx)
 
 	node.cancelSubscriptions()
@@ -763,6 +924,46 @@ func (node *Node) SetBlockTime(blockTime time.Duration) {
 	node.blockTime = blockTime
 }
 
+// safeBoot checks the chain store for consistency, repairing its head if the
+// stored chain is broken, so that the node never syncs on top of a corrupt
+// chain.
+func (node *Node) safeBoot(ctx context.Context) error {
+	result, err := node.ChainReader.Check(ctx, true)
+	if err != nil {
+		return errors.Wrap(err, "safe boot failed")
+	}
+	if result.Consistent() {
+		log.Infof("safe boot: chain store consistent, checked %d tipsets from head %s", result.TipSetsChecked, result.Head.String())
+		return nil
+	}
+	log.Warningf("safe boot: chain store inconsistent after %d tipsets from head %s: %s", result.TipSetsChecked, result.Head.String(), result.Err)
+	log.Warningf("safe boot: head reset to %s", result.RepairedHead.String())
+	return nil
+}
+
+// resolveDefaultWalletAddress checks that the wallet holds a key for the
+// configured default address.  If it does not, for instance after a partial
+// restore of the keystore, the first wallet address becomes the default.
+func (node *Node) resolveDefaultWalletAddress() error {
+	cfg := node.Repo.Config()
+	configured := cfg.Wallet.DefaultAddress
+	if configured.Empty() {
+		return nil
+	}
+
+	addr, err := node.Wallet.ResolveDefaultAddress(configured)
+	if err != nil {
+		return errors.Wrapf(err, "no key for default wallet address %s", configured)
+	}
+	if addr == configured {
+		return nil
+	}
+
+	log.Warningf("no key for default wallet address %s, falling back to %s", configured, addr)
+	cfg.Wallet.DefaultAddress = addr
+	return node.Repo.ReplaceConfig(cfg)
+}
+
 // StartMining causes the node to start feeding blocks to the mining worker and initializes
 // the SectorBuilder for the mining address.
 func (node *Node) StartMining(ctx context.Context) error {
@@ -794,7 +995,7 @@ func (node *Node) StartMining(ctx context.Context) error {
 		}
 	}
 	if node.MiningScheduler == nil {
-		node.MiningScheduler = mining.NewScheduler(node.MiningWorker, mineDelay, node.PorcelainAPI.ChainHead)
+		node.MiningScheduler = mining.NewSchedulerWithReadyCheck(node.MiningWorker, mineDelay, node.PorcelainAPI.ChainHead, node.isCaughtUpForMining)
 	}
 
 	// paranoid check
@@ -973,6 +1174,20 @@ func (node *Node) StopMining(ctx context.Context) {
 	// TODO: stop node.StorageMiner
 }
 
+// isCaughtUpForMining returns false if the node's head lags the network by
+// more than the configured stale head tolerance.
+func (node *Node) isCaughtUpForMining() bool {
+	tolerance := node.Repo.Config().Mining.StaleHeadTolerance
+	if tolerance == 0 {
+		return true
+	}
+	syncer, ok := node.Syncer.(*chain.DefaultSyncer)
+	if !ok {
+		return true
+	}
+	return syncer.IsCaughtUpForMining(tolerance)
+}
+
 // NewAddress creates a new account address on the default wallet backend.
 func (node *Node) NewAddress() (address.Address, error) {
 	return wallet.NewAddress(node.Wallet)
@@ -1050,7 +1265,7 @@ func (node *Node) CreateMiningWorker(ctx context.Context) (mining.Worker, error)
 		return nil, err
 	}
 	return mining.NewDefaultWorker(
-		node.MsgPool, node.getStateTree, node.getWeight, node.getAncestors, processor, node.PowerTable,
+		node.MsgPool, node.getStateTree, node.getWeight, node.getAncestors, node.Consensus, processor, node.PowerTable,
 		node.Blockstore, node.CborStore(), minerAddr, minerOwnerAddr, minerPubKey,
 		node.Wallet, node.blockTime), nil
 }
@@ -1089,7 +1304,7 @@ func (node *Node) getWeight(ctx context.Context, ts types.TipSet) (uint64, error
 // getAncestors is the default GetAncestors function for the mining worker.
 func (node *Node) getAncestors(ctx context.Context, ts types.TipSet, newBlockHeight *types.BlockHeight) ([]types.TipSet, error) {
 	ancestorHeight := types.NewBlockHeight(consensus.AncestorRoundsNeeded)
-	return chain.GetRecentAncestors(ctx, ts, node.ChainReader, newBlockHeight, ancestorHeight, sampling.LookbackParameter)
+	return chain.GetRecentAncestors(ctx, ts, node.ChainReader, newBlockHeight, ancestorHeight, node.samplingLookback)
 }
 
 // -- Accessors
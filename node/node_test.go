@@ -2,11 +2,13 @@ package node_test
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"testing"
 	"time"
 
+	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/chain"
 	"github.com/filecoin-project/go-filecoin/config"
 	"github.com/filecoin-project/go-filecoin/consensus"
@@ -20,6 +22,11 @@ import (
 	"github.com/filecoin-project/go-filecoin/types"
 
 	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/ipfs/go-hamt-ipld"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	"github.com/libp2p/go-libp2p-peer"
 	"github.com/libp2p/go-libp2p-peerstore"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -135,6 +142,155 @@ func TestNodeInit(t *testing.T) {
 	nd.Stop(ctx)
 }
 
+func TestInitNetworkName(t *testing.T) {
+	tf.UnitTest(t)
+
+	ctx := context.Background()
+	r := repo.NewInMemoryRepo()
+
+	gen := consensus.MakeGenesisFunc(consensus.NetworkName("testnet"))
+	require.NoError(t, node.Init(ctx, r, gen, node.PeerKeyOpt(node.PeerKeys[0])))
+	assert.Equal(t, "testnet", r.Config().NetworkName)
+}
+
+func TestPreviewInit(t *testing.T) {
+	tf.UnitTest(t)
+
+	ctx := context.Background()
+	r := repo.NewInMemoryRepo()
+
+	preview, err := node.PreviewInit(ctx, r, consensus.DefaultGenesis, node.PeerKeyOpt(node.PeerKeys[0]), node.AutoSealIntervalSecondsOpt(7))
+	require.NoError(t, err)
+	assert.True(t, preview.GenesisCid.Defined())
+	assert.NotEqual(t, address.Undef, preview.Config.Wallet.DefaultAddress)
+	assert.Equal(t, uint(7), preview.Config.Mining.AutoSealIntervalSeconds)
+
+	// The target repo is untouched.
+	has, err := r.Datastore().Has(chain.GenesisKey)
+	require.NoError(t, err)
+	assert.False(t, has)
+	keys, err := r.Keystore().List()
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+	assert.Equal(t, address.Undef, r.Config().Wallet.DefaultAddress)
+	assert.Equal(t, config.NewDefaultConfig().Mining.AutoSealIntervalSeconds, r.Config().Mining.AutoSealIntervalSeconds)
+
+	// A real init produces the previewed genesis.
+	require.NoError(t, node.Init(ctx, r, consensus.DefaultGenesis, node.PeerKeyOpt(node.PeerKeys[0])))
+	genesis, err := r.Datastore().Get(chain.GenesisKey)
+	require.NoError(t, err)
+	var genCid cid.Cid
+	require.NoError(t, json.Unmarshal(genesis, &genCid))
+	assert.Equal(t, preview.GenesisCid, genCid)
+}
+
+func TestInitExpectedGenesisStateRoot(t *testing.T) {
+	tf.UnitTest(t)
+	ctx := context.Background()
+
+	bs := bstore.NewBlockstore(repo.NewInMemoryRepo().Datastore())
+	genesis, err := consensus.DefaultGenesis(hamt.NewCborStore(), bs)
+	require.NoError(t, err)
+
+	t.Run("a matching state root initializes", func(t *testing.T) {
+		r := repo.NewInMemoryRepo()
+		require.NoError(t, node.Init(ctx, r, consensus.DefaultGenesis, node.PeerKeyOpt(node.PeerKeys[0]), node.ExpectedGenesisStateRootOpt(genesis.StateRoot)))
+		has, err := r.Datastore().Has(chain.GenesisKey)
+		require.NoError(t, err)
+		assert.True(t, has)
+	})
+
+	t.Run("a mismatching state root fails before writing the repo", func(t *testing.T) {
+		r := repo.NewInMemoryRepo()
+		err := node.Init(ctx, r, consensus.DefaultGenesis, node.PeerKeyOpt(node.PeerKeys[0]), node.ExpectedGenesisStateRootOpt(types.SomeCid()))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), node.ErrGenesisStateMismatch.Error())
+		has, err := r.Datastore().Has(chain.GenesisKey)
+		require.NoError(t, err)
+		assert.False(t, has)
+		keys, err := r.Keystore().List()
+		require.NoError(t, err)
+		assert.Empty(t, keys)
+	})
+}
+
+func TestInitFailureLeavesRepoUntouched(t *testing.T) {
+	tf.UnitTest(t)
+	ctx := context.Background()
+
+	// The genesis state is written before the failure.
+	failingGen := func(cst *hamt.CborIpldStore, bs bstore.Blockstore) (*types.Block, error) {
+		if _, err := consensus.DefaultGenesis(cst, bs); err != nil {
+			return nil, err
+		}
+		return nil, errors.New("injected failure")
+	}
+
+	r := repo.NewInMemoryRepo()
+	err := node.Init(ctx, r, failingGen, node.PeerKeyOpt(node.PeerKeys[0]))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "injected failure")
+
+	for _, ds := range []repo.Datastore{r.Datastore(), r.ChainDatastore(), r.WalletDatastore()} {
+		results, err := ds.Query(query.Query{KeysOnly: true})
+		require.NoError(t, err)
+		entries, err := results.Rest()
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	}
+	keys, err := r.Keystore().List()
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+	assert.Equal(t, address.Undef, r.Config().Wallet.DefaultAddress)
+
+	// The repo can be initialized again.
+	require.NoError(t, node.Init(ctx, r, consensus.DefaultGenesis, node.PeerKeyOpt(node.PeerKeys[0])))
+	has, err := r.Datastore().Has(chain.GenesisKey)
+	require.NoError(t, err)
+	assert.True(t, has)
+	assert.NotEqual(t, address.Undef, r.Config().Wallet.DefaultAddress)
+}
+
+func TestRotatePeerKey(t *testing.T) {
+	tf.UnitTest(t)
+
+	ctx := context.Background()
+	r := repo.NewInMemoryRepo()
+	require.NoError(t, node.Init(ctx, r, consensus.DefaultGenesis, node.PeerKeyOpt(node.PeerKeys[0])))
+	genesis, err := r.Datastore().Get(chain.GenesisKey)
+	require.NoError(t, err)
+
+	oldKey, err := r.Keystore().Get("self")
+	require.NoError(t, err)
+	oldID, err := peer.IDFromPrivateKey(oldKey)
+	require.NoError(t, err)
+
+	t.Run("with a provided key", func(t *testing.T) {
+		require.NoError(t, node.RotatePeerKey(r, node.PeerKeys[1]))
+
+		newKey, err := r.Keystore().Get("self")
+		require.NoError(t, err)
+		assert.True(t, newKey.Equals(node.PeerKeys[1]))
+		newID, err := peer.IDFromPrivateKey(newKey)
+		require.NoError(t, err)
+		assert.NotEqual(t, oldID, newID)
+	})
+
+	t.Run("with a generated key", func(t *testing.T) {
+		require.NoError(t, node.RotatePeerKey(r, nil))
+
+		newKey, err := r.Keystore().Get("self")
+		require.NoError(t, err)
+		assert.False(t, newKey.Equals(node.PeerKeys[1]))
+		assert.False(t, newKey.Equals(oldKey))
+	})
+
+	// Chain data is untouched.
+	after, err := r.Datastore().Get(chain.GenesisKey)
+	require.NoError(t, err)
+	assert.Equal(t, genesis, after)
+}
+
 func TestNodeStartMining(t *testing.T) {
 	tf.UnitTest(t)
 
@@ -169,6 +325,49 @@ func TestNodeStartMining(t *testing.T) {
 
 }
 
+// countingRepo counts the config replacements made through it.
+type countingRepo struct {
+	repo.Repo
+	replaced int
+}
+
+func (r *countingRepo) ReplaceConfig(cfg *config.Config) error {
+	r.replaced++
+	return r.Repo.ReplaceConfig(cfg)
+}
+
+func TestNodeStartWritesConfigOnlyOnChange(t *testing.T) {
+	tf.UnitTest(t)
+
+	ctx := context.Background()
+
+	t.Run("a default address with a key is left alone", func(t *testing.T) {
+		nd := node.MakeOfflineNode(t)
+		r := &countingRepo{Repo: nd.Repo}
+		nd.Repo = r
+		configured := r.Config().Wallet.DefaultAddress
+
+		require.NoError(t, nd.Start(ctx))
+		defer nd.Stop(ctx)
+		assert.Equal(t, 0, r.replaced)
+		assert.Equal(t, configured, r.Config().Wallet.DefaultAddress)
+	})
+
+	t.Run("a default address without a key is replaced once", func(t *testing.T) {
+		nd := node.MakeOfflineNode(t)
+		r := &countingRepo{Repo: nd.Repo}
+		nd.Repo = r
+		cfg := r.Config()
+		cfg.Wallet.DefaultAddress = address.NewForTestGetter()()
+		require.NoError(t, r.Repo.ReplaceConfig(cfg))
+
+		require.NoError(t, nd.Start(ctx))
+		defer nd.Stop(ctx)
+		assert.Equal(t, 1, r.replaced)
+		assert.True(t, nd.Wallet.HasAddress(r.Config().Wallet.DefaultAddress))
+	})
+}
+
 func TestUpdateMessagePool(t *testing.T) {
 	tf.UnitTest(t)
 
@@ -44,6 +44,7 @@ type API struct {
 
 	bitswap      exchange.Interface
 	chain        *cst.ChainStateProvider
+	chainImport  *chain.CarImporter
 	config       *cfg.Config
 	dag          *dag.DAG
 	msgPool      *core.MessagePool
@@ -60,6 +61,7 @@ type API struct {
 type APIDeps struct {
 	Bitswap      exchange.Interface
 	Chain        *cst.ChainStateProvider
+	ChainImport  *chain.CarImporter
 	Config       *cfg.Config
 	DAG          *dag.DAG
 	Deals        *strgdls.Store
@@ -79,6 +81,7 @@ func New(deps *APIDeps) *API {
 
 		bitswap:      deps.Bitswap,
 		chain:        deps.Chain,
+		chainImport:  deps.ChainImport,
 		config:       deps.Config,
 		dag:          deps.DAG,
 		msgPool:      deps.MsgPool,
@@ -135,11 +138,24 @@ func (api *API) ChainHead() (*types.TipSet, error) {
 	return api.chain.Head()
 }
 
+// ChainImport imports the chain in the CAR read from in and syncs from the
+// imported head to the head of the network.  It returns the imported head.
+func (api *API) ChainImport(ctx context.Context, in io.Reader) (types.TipSet, error) {
+	return api.chainImport.Import(ctx, in)
+}
+
 // ChainLs returns an iterator of tipsets from head to genesis
 func (api *API) ChainLs(ctx context.Context) (*chain.TipsetIterator, error) {
 	return api.chain.Ls(ctx)
 }
 
+// ChainMessageInclusion locates a message in the tipset with key tsKey, or in
+// the head tipset if tsKey is empty, returning the cid of the block that
+// includes it and its index in that block's messages.
+func (api *API) ChainMessageInclusion(ctx context.Context, msgCid cid.Cid, tsKey types.SortedCidSet) (cid.Cid, int, bool, error) {
+	return api.chain.MessageInclusion(ctx, msgCid, tsKey)
+}
+
 // ChainSampleRandomness produces a slice of random bytes sampled from a TipSet
 // in the blockchain at a given height, useful for things like PoSt challenge seed
 // generation.
@@ -147,6 +163,12 @@ func (api *API) ChainSampleRandomness(ctx context.Context, sampleHeight *types.B
 	return api.chain.SampleRandomness(ctx, sampleHeight)
 }
 
+// ChainTotalSupply returns the sum of the balances of every actor in the
+// state of the tipset with key tsKey, or in the head state if tsKey is empty.
+func (api *API) ChainTotalSupply(ctx context.Context, tsKey types.SortedCidSet) (*types.AttoFIL, error) {
+	return api.chain.TotalSupply(ctx, tsKey)
+}
+
 // DealsLs a slice of all storagedeals in the local datastore and possibly an error
 func (api *API) DealsLs() ([]*storagedeal.Deal, error) {
 	return api.storagedeals.Ls()
@@ -200,6 +222,12 @@ func (api *API) MessageQuery(ctx context.Context, optFrom, to address.Address, m
 	return api.msgQueryer.Query(ctx, optFrom, to, method, params...)
 }
 
+// MinerPowerTable returns the power of every miner and the total power of
+// the network at the tipset with key tsKey, or at the head if tsKey is empty.
+func (api *API) MinerPowerTable(ctx context.Context, tsKey types.SortedCidSet) (map[address.Address]*types.BytesAmount, *types.BytesAmount, error) {
+	return api.msgQueryer.PowerTable(ctx, tsKey)
+}
+
 // MessageSend sends a message. It uses the default from address if none is given and signs the
 // message using the wallet. This call "sends" in the sense that it enqueues the
 // message in the msg pool and broadcasts it to the network; it does not wait for the
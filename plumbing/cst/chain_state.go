@@ -5,7 +5,6 @@ import (
 	"fmt"
 
 	"github.com/filecoin-project/go-filecoin/actor"
-	"github.com/filecoin-project/go-filecoin/actor/builtin"
 	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/chain"
 	"github.com/filecoin-project/go-filecoin/exec"
@@ -20,16 +19,19 @@ import (
 type chainReader interface {
 	BlockHeight() (uint64, error)
 	GetBlock(context.Context, cid.Cid) (*types.Block, error)
+	GetBlockHeader(context.Context, cid.Cid) (*types.Block, error)
 	GetHead() types.SortedCidSet
 	GetTipSet(types.SortedCidSet) (*types.TipSet, error)
 	GetTipSetStateRoot(tsKey types.SortedCidSet) (cid.Cid, error)
+	TotalSupply(ctx context.Context, stateStore *hamt.CborIpldStore, tsKey types.SortedCidSet) (*types.AttoFIL, error)
 }
 
 // ChainStateProvider composes a chain and a state store to provide access to
 // the state (including actors) derived from a chain.
 type ChainStateProvider struct {
-	reader chainReader         // Provides chain blocks and tipsets.
-	cst    *hamt.CborIpldStore // Provides state trees.
+	reader   chainReader         // Provides chain blocks and tipsets.
+	cst      *hamt.CborIpldStore // Provides state trees.
+	lookback uint                // Tipsets gathered to sample randomness.
 }
 
 var (
@@ -42,11 +44,14 @@ var (
 	ErrNoActorImpl = errors.New("no actor implementation")
 )
 
-// NewChainStateProvider returns a new ChainStateProvider.
-func NewChainStateProvider(chainReader chainReader, cst *hamt.CborIpldStore) *ChainStateProvider {
+// NewChainStateProvider returns a new ChainStateProvider.  lookback is the
+// number of tipsets preceding the live proving periods gathered to sample
+// randomness from.
+func NewChainStateProvider(chainReader chainReader, cst *hamt.CborIpldStore, lookback uint) *ChainStateProvider {
 	return &ChainStateProvider{
-		reader: chainReader,
-		cst:    cst,
+		reader:   chainReader,
+		cst:      cst,
+		lookback: lookback,
 	}
 }
 
@@ -59,13 +64,26 @@ func (chn *ChainStateProvider) Head() (*types.TipSet, error) {
 	return ts, nil
 }
 
-// Ls returns an iterator over tipsets from head to genesis.
+// Ls returns an iterator over tipsets from head to genesis.  Blocks whose
+// message bodies were pruned are listed without their messages.
 func (chn *ChainStateProvider) Ls(ctx context.Context) (*chain.TipsetIterator, error) {
 	ts, err := chn.reader.GetTipSet(chn.reader.GetHead())
 	if err != nil {
 		return nil, err
 	}
-	return chain.IterAncestors(ctx, chn.reader, *ts), nil
+	return chain.IterAncestors(ctx, headerReader{chn.reader}, *ts), nil
+}
+
+// headerReader provides blocks of the chain without their messages if their
+// bodies were pruned.
+type headerReader struct {
+	reader chainReader
+}
+
+// GetBlock returns the block with cid c, without its messages if they were
+// pruned.
+func (r headerReader) GetBlock(ctx context.Context, c cid.Cid) (*types.Block, error) {
+	return r.reader.GetBlockHeader(ctx, c)
 }
 
 // GetBlock gets a block by CID
@@ -73,9 +91,25 @@ func (chn *ChainStateProvider) GetBlock(ctx context.Context, id cid.Cid) (*types
 	return chn.reader.GetBlock(ctx, id)
 }
 
+// TotalSupply returns the sum of the balances of every actor in the state of
+// the tipset with key tsKey, or in the head state if tsKey is empty.
+func (chn *ChainStateProvider) TotalSupply(ctx context.Context, tsKey types.SortedCidSet) (*types.AttoFIL, error) {
+	return chn.reader.TotalSupply(ctx, chn.cst, tsKey)
+}
+
+// MessageInclusion locates the message with cid msgCid in the tipset with key
+// tsKey, or in the head tipset if tsKey is empty.  It returns the cid of the
+// block containing the message and the message's index in that block.
+func (chn *ChainStateProvider) MessageInclusion(ctx context.Context, msgCid cid.Cid, tsKey types.SortedCidSet) (cid.Cid, int, bool, error) {
+	if tsKey.Len() == 0 {
+		tsKey = chn.reader.GetHead()
+	}
+	return chain.MessageInclusion(ctx, chn.reader, msgCid, tsKey)
+}
+
 // SampleRandomness samples randomness from the chain at the given height.
 func (chn *ChainStateProvider) SampleRandomness(ctx context.Context, sampleHeight *types.BlockHeight) ([]byte, error) {
-	tipSetBuffer, err := chain.GetRecentAncestorsOfHeaviestChain(ctx, chn.reader, sampleHeight)
+	tipSetBuffer, err := chain.GetRecentAncestorsOfHeaviestChain(ctx, chn.reader, sampleHeight, chn.lookback)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to get recent ancestors")
 	}
@@ -85,25 +119,13 @@ func (chn *ChainStateProvider) SampleRandomness(ctx context.Context, sampleHeigh
 
 // GetActor returns an actor from the latest state on the chain
 func (chn *ChainStateProvider) GetActor(ctx context.Context, addr address.Address) (*actor.Actor, error) {
-	return chn.GetActorAt(ctx, chn.reader.GetHead(), addr)
+	return chain.GetActor(ctx, chn.reader, chn.cst, addr)
 }
 
-// GetActorAt returns an actor at a specified tipset key.
+// GetActorAt returns an actor at a specified tipset key, which must not be
+// empty.
 func (chn *ChainStateProvider) GetActorAt(ctx context.Context, tipKey types.SortedCidSet, addr address.Address) (*actor.Actor, error) {
-	stateCid, err := chn.reader.GetTipSetStateRoot(tipKey)
-	if err != nil {
-		return nil, err
-	}
-	tree, err := state.LoadStateTree(ctx, chn.cst, stateCid, builtin.Actors)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to load latest state")
-	}
-
-	actr, err := tree.GetActor(ctx, addr)
-	if err != nil {
-		return nil, errors.Wrapf(err, "no actor at address %s", addr)
-	}
-	return actr, nil
+	return chain.GetActorAt(ctx, chn.reader, chn.cst, addr, tipKey)
 }
 
 // LsActors returns a channel with actors from the latest state on the chain
@@ -68,3 +68,10 @@ func (q *Queryer) Query(ctx context.Context, optFrom, to address.Address, method
 	}
 	return r, nil
 }
+
+// PowerTable returns the power of every miner and the total power of the
+// network in the state of the tipset with key tsKey, or in the head state if
+// tsKey is empty.
+func (q *Queryer) PowerTable(ctx context.Context, tsKey types.SortedCidSet) (map[address.Address]*types.BytesAmount, *types.BytesAmount, error) {
+	return chain.PowerTable(ctx, q.chainReader, q.cst, q.bs, tsKey)
+}
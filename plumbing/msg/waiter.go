@@ -4,7 +4,6 @@ import (
 	"context"
 	"fmt"
 
-	"github.com/cskr/pubsub"
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-hamt-ipld"
 	bstore "github.com/ipfs/go-ipfs-blockstore"
@@ -14,7 +13,6 @@ import (
 	"github.com/filecoin-project/go-filecoin/actor/builtin"
 	"github.com/filecoin-project/go-filecoin/chain"
 	"github.com/filecoin-project/go-filecoin/consensus"
-	"github.com/filecoin-project/go-filecoin/sampling"
 	"github.com/filecoin-project/go-filecoin/state"
 	"github.com/filecoin-project/go-filecoin/types"
 	"github.com/filecoin-project/go-filecoin/vm"
@@ -28,14 +26,20 @@ type waiterChainReader interface {
 	GetHead() types.SortedCidSet
 	GetTipSet(tsKey types.SortedCidSet) (*types.TipSet, error)
 	GetTipSetStateRoot(tsKey types.SortedCidSet) (cid.Cid, error)
-	HeadEvents() *pubsub.PubSub
+	SubscribeHeads(buffer int, policy chain.HeadDropPolicy) *chain.HeadSubscription
+	UnsubscribeHeads(sub *chain.HeadSubscription)
 }
 
+// waitHeadBufferSize is the number of heads buffered for a waiter's head
+// subscription.
+const waitHeadBufferSize = 16
+
 // Waiter waits for a message to appear on chain.
 type Waiter struct {
 	chainReader waiterChainReader
 	cst         *hamt.CborIpldStore
 	bs          bstore.Blockstore
+	lookback    uint
 }
 
 // ChainMessage is an on-chain message with its block and receipt.
@@ -45,12 +49,15 @@ type ChainMessage struct {
 	Receipt *types.MessageReceipt
 }
 
-// NewWaiter returns a new Waiter.
-func NewWaiter(chainStore waiterChainReader, bs bstore.Blockstore, cst *hamt.CborIpldStore) *Waiter {
+// NewWaiter returns a new Waiter.  lookback is the number of tipsets
+// preceding the live proving periods gathered to sample randomness from when
+// recomputing receipts.
+func NewWaiter(chainStore waiterChainReader, bs bstore.Blockstore, cst *hamt.CborIpldStore, lookback uint) *Waiter {
 	return &Waiter{
 		chainReader: chainStore,
 		cst:         cst,
 		bs:          bs,
+		lookback:    lookback,
 	}
 }
 
@@ -80,8 +87,8 @@ func (w *Waiter) Wait(ctx context.Context, msgCid cid.Cid, cb func(*types.Block,
 	defer log.Finish(ctx)
 	log.Infof("Calling Waiter.Wait CID: %s", msgCid.String())
 
-	ch := w.chainReader.HeadEvents().Sub(chain.NewHeadTopic)
-	defer w.chainReader.HeadEvents().Unsub(ch, chain.NewHeadTopic)
+	sub := w.chainReader.SubscribeHeads(waitHeadBufferSize, chain.DropOldestHead)
+	defer w.chainReader.UnsubscribeHeads(sub)
 
 	chainMsg, found, err := w.Find(ctx, msgCid)
 	if err != nil {
@@ -91,7 +98,7 @@ func (w *Waiter) Wait(ctx context.Context, msgCid cid.Cid, cb func(*types.Block,
 		return cb(chainMsg.Block, chainMsg.Message, chainMsg.Receipt)
 	}
 
-	chainMsg, found, err = w.waitForMessage(ctx, ch, msgCid)
+	chainMsg, found, err = w.waitForMessage(ctx, sub, msgCid)
 	if found {
 		return cb(chainMsg.Block, chainMsg.Message, chainMsg.Receipt)
 	}
@@ -127,42 +134,40 @@ func (w *Waiter) findMessage(ctx context.Context, ts *types.TipSet, msgCid cid.C
 	return nil, false, nil
 }
 
-// waitForMessage looks for a message CID in a channel of tipsets and returns
-// the message, block and receipt, when it is found. Reads until the channel is
-// closed or the context done. Returns the found message/block (or nil if the
-// channel closed without finding it), whether it was found, or an error.
-func (w *Waiter) waitForMessage(ctx context.Context, ch <-chan interface{}, msgCid cid.Cid) (*ChainMessage, bool, error) {
+// waitForMessage looks for a message CID in the heads delivered by sub and
+// returns the message, block and receipt, when it is found.  If sub drops
+// heads it looks for the message in the whole chain instead.  Reads until the
+// subscription is cancelled or the context done. Returns the found
+// message/block (or nil if the subscription ended without finding it),
+// whether it was found, or an error.
+func (w *Waiter) waitForMessage(ctx context.Context, sub *chain.HeadSubscription, msgCid cid.Cid) (*ChainMessage, bool, error) {
 	for {
 		select {
 		case <-ctx.Done():
 			return nil, false, ctx.Err()
-		case raw, more := <-ch:
+		case <-sub.Missed():
+			chainMsg, found, err := w.Find(ctx, msgCid)
+			if err != nil || found {
+				return chainMsg, found, err
+			}
+		case ts, more := <-sub.Heads():
 			if !more {
 				return nil, false, nil
 			}
-			switch raw := raw.(type) {
-			case error:
-				e := raw.(error)
-				log.Errorf("Waiter.Wait: %s", e)
-				return nil, false, e
-			case types.TipSet:
-				for _, blk := range raw {
-					for _, msg := range blk.Messages {
-						c, err := msg.Cid()
+			for _, blk := range ts {
+				for _, msg := range blk.Messages {
+					c, err := msg.Cid()
+					if err != nil {
+						return nil, false, err
+					}
+					if c.Equals(msgCid) {
+						recpt, err := w.receiptFromTipSet(ctx, msgCid, ts)
 						if err != nil {
-							return nil, false, err
-						}
-						if c.Equals(msgCid) {
-							recpt, err := w.receiptFromTipSet(ctx, msgCid, raw)
-							if err != nil {
-								return nil, false, errors.Wrap(err, "error retrieving receipt from tipset")
-							}
-							return &ChainMessage{msg, blk, recpt}, true, nil
+							return nil, false, errors.Wrap(err, "error retrieving receipt from tipset")
 						}
+						return &ChainMessage{msg, blk, recpt}, true, nil
 					}
 				}
-			default:
-				return nil, false, fmt.Errorf("unexpected type in channel: %T", raw)
 			}
 		}
 	}
@@ -215,12 +220,12 @@ func (w *Waiter) receiptFromTipSet(ctx context.Context, msgCid cid.Cid, ts types
 	if err != nil {
 		return nil, err
 	}
-	ancestors, err := chain.GetRecentAncestors(ctx, *parentTs, w.chainReader, tsBlockHeight, ancestorHeight, sampling.LookbackParameter)
+	ancestors, err := chain.GetRecentAncestors(ctx, *parentTs, w.chainReader, tsBlockHeight, ancestorHeight, w.lookback)
 	if err != nil {
 		return nil, err
 	}
 
-	res, err := consensus.NewDefaultProcessor().ProcessTipSet(ctx, st, vm.NewStorageMap(w.bs), ts, ancestors)
+	res, err := consensus.NewDefaultProcessor().ProcessTipSet(ctx, st, vm.NewStorageMap(w.bs), ts, ancestors, nil)
 	if err != nil {
 		return nil, err
 	}
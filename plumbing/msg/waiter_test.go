@@ -13,6 +13,7 @@ import (
 	"github.com/filecoin-project/go-filecoin/chain"
 	"github.com/filecoin-project/go-filecoin/consensus"
 	"github.com/filecoin-project/go-filecoin/core"
+	"github.com/filecoin-project/go-filecoin/sampling"
 	th "github.com/filecoin-project/go-filecoin/testhelpers"
 	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
 	"github.com/filecoin-project/go-filecoin/types"
@@ -46,12 +47,12 @@ type smsgsSet [][]*types.SignedMessage
 
 func setupTest(t *testing.T) (*hamt.CborIpldStore, *chain.DefaultStore, *Waiter) {
 	d := requiredCommonDeps(t, consensus.DefaultGenesis)
-	return d.cst, d.chainStore, NewWaiter(d.chainStore, d.blockstore, d.cst)
+	return d.cst, d.chainStore, NewWaiter(d.chainStore, d.blockstore, d.cst, sampling.LookbackParameter)
 }
 
 func setupTestWithGif(t *testing.T, gif consensus.GenesisInitFunc) (*hamt.CborIpldStore, *chain.DefaultStore, *Waiter) {
 	d := requiredCommonDeps(t, gif)
-	return d.cst, d.chainStore, NewWaiter(d.chainStore, d.blockstore, d.cst)
+	return d.cst, d.chainStore, NewWaiter(d.chainStore, d.blockstore, d.cst, sampling.LookbackParameter)
 }
 
 func TestWait(t *testing.T) {
@@ -1,6 +1,7 @@
 package repo
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -162,6 +163,13 @@ func (r *FSRepo) loadFromDisk() error {
 	if err := r.openDealsDatastore(); err != nil {
 		return errors.Wrap(err, "failed to open deals datastore")
 	}
+
+	if r.cfg.Datastore.Instrument {
+		r.ds = NewInstrumentedDatastore(r.ds)
+		r.walletDs = NewInstrumentedDatastore(r.walletDs)
+		r.chainDs = NewInstrumentedDatastore(r.chainDs)
+		r.dealsDs = NewInstrumentedDatastore(r.dealsDs)
+	}
 	return nil
 }
 
@@ -235,29 +243,84 @@ func (r *FSRepo) Keystore() keystore.Keystore {
 	return r.keystore
 }
 
-// Close closes the repo.
-func (r *FSRepo) Close() error {
-	if err := r.ds.Close(); err != nil {
-		return errors.Wrap(err, "failed to close datastore")
-	}
+// compactor is implemented by datastores that can reclaim space, such as
+// badger's value log garbage collection.
+type compactor interface {
+	CollectGarbage() error
+}
 
-	if err := r.walletDs.Close(); err != nil {
-		return errors.Wrap(err, "failed to close wallet datastore")
+// Compact runs a compaction pass over each of the repo's datastores that
+// supports one.
+func (r *FSRepo) Compact(ctx context.Context) error {
+	start := time.Now()
+	stores := []struct {
+		name string
+		ds   Datastore
+	}{
+		{"datastore", r.ds},
+		{"wallet datastore", r.walletDs},
+		{"chain datastore", r.chainDs},
+		{"miner deals datastore", r.dealsDs},
 	}
+	for _, s := range stores {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		// hopeful type check, not all datastores can compact
+		c, ok := s.ds.(compactor)
+		if !ok {
+			continue
+		}
+		if err := c.CollectGarbage(); err != nil {
+			return errors.Wrapf(err, "failed to compact %s", s.name)
+		}
+	}
+	log.Infof("compacted repo datastores in %s", time.Since(start))
+	return nil
+}
 
-	if err := r.chainDs.Close(); err != nil {
-		return errors.Wrap(err, "failed to close chain datastore")
+// Snapshot streams a copy of the repo to w.  Each datastore is copied from
+// a consistent view of its own; the copy is not consistent across
+// datastores.
+func (r *FSRepo) Snapshot(ctx context.Context, w io.Writer) error {
+	start := time.Now()
+	if err := writeSnapshot(ctx, r, w); err != nil {
+		return err
 	}
+	log.Infof("snapshotted repo in %s", time.Since(start))
+	return nil
+}
+
+// BeginInit begins initializing the repo.
+func (r *FSRepo) BeginInit() (*InitTx, error) {
+	return beginInit(r)
+}
 
-	if err := r.dealsDs.Close(); err != nil {
-		return errors.Wrap(err, "failed to close miner deals datastore")
+// Close closes the repo, first compacting its datastores if configured to.
+func (r *FSRepo) Close() error {
+	// Every step runs even if an earlier one fails, so that the datastores
+	// are closed and the lock released.
+	var failures []string
+	check := func(err error, msg string) {
+		if err != nil {
+			failures = append(failures, errors.Wrap(err, msg).Error())
+		}
 	}
 
-	if err := r.removeAPIFile(); err != nil {
-		return errors.Wrap(err, "error removing API file")
+	if r.cfg.Datastore.CompactOnClose {
+		check(r.Compact(context.Background()), "failed to compact datastores")
 	}
+	check(r.ds.Close(), "failed to close datastore")
+	check(r.walletDs.Close(), "failed to close wallet datastore")
+	check(r.chainDs.Close(), "failed to close chain datastore")
+	check(r.dealsDs.Close(), "failed to close miner deals datastore")
+	check(r.removeAPIFile(), "error removing API file")
+	check(r.lockfile.Close(), "failed to release repo lock")
 
-	return r.lockfile.Close()
+	if len(failures) > 0 {
+		return errors.New(strings.Join(failures, "; "))
+	}
+	return nil
 }
 
 func (r *FSRepo) removeFile(path string) error {
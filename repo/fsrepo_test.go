@@ -1,6 +1,8 @@
 package repo
 
 import (
+	"context"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -40,7 +42,9 @@ const (
 	},
 	"datastore": {
 		"type": "badgerds",
-		"path": "badger"
+		"path": "badger",
+		"compactOnClose": false,
+		"instrument": false
 	},
 	"heartbeat": {
 		"beatTarget": "",
@@ -48,16 +52,19 @@ const (
 		"reconnectPeriod": "10s",
 		"nickname": ""
 	},
+	"minerAllowlist": [],
 	"mining": {
 		"minerAddress": "empty",
 		"autoSealIntervalSeconds": 120,
-		"storagePrice": "0"
+		"storagePrice": "0",
+		"staleHeadTolerance": 0
 	},
 	"mpool": {
 		"maxPoolSize": 10000,
 		"maxNonceGap": "100"
 	},
 	"net": "",
+	"networkName": "",
 	"observability": {
 		"metrics": {
 			"prometheusEnabled": false,
@@ -76,6 +83,30 @@ const (
 	"swarm": {
 		"address": "/ip4/0.0.0.0/tcp/6000"
 	},
+	"sync": {
+		"blockMirrorURL": "",
+		"disableWiden": false,
+		"eagerDialPeers": false,
+		"expectedStateRoots": {},
+		"finalityDepth": 900,
+		"headStallThreshold": "0s",
+		"lateBlockGracePeriod": "0s",
+		"localOnly": false,
+		"maxActorGrowth": null,
+		"maxBlocksPerSync": 0,
+		"maxPendingSyncs": 0,
+		"minBlocksPerTipSet": 0,
+		"orphanWindow": "0s",
+		"pruneFinalizedMessages": false,
+		"restoreGenesis": false,
+		"safeBoot": false,
+		"samplingLookback": null,
+		"signatureWorkers": 0,
+		"stallThreshold": 3,
+		"stateCacheBytes": 0,
+		"strictWiden": false,
+		"transientRetries": 0
+	},
 	"wallet": {
 		"defaultAddress": "empty"
 	}
@@ -222,6 +253,83 @@ func TestFSRepoRoundtrip(t *testing.T) {
 	assert.NoError(t, r2.Close())
 }
 
+func TestFSRepoCompact(t *testing.T) {
+	tf.UnitTest(t)
+
+	t.Run("compacts without losing data", func(t *testing.T) {
+		withFSRepo(t, func(r *FSRepo) {
+			for i := 0; i < 100; i++ {
+				require.NoError(t, r.Datastore().Put(ds.NewKey(fmt.Sprintf("key%d", i)), []byte("value")))
+			}
+			for i := 0; i < 50; i++ {
+				require.NoError(t, r.Datastore().Delete(ds.NewKey(fmt.Sprintf("key%d", i))))
+			}
+
+			assert.NoError(t, r.Compact(context.Background()))
+
+			for i := 50; i < 100; i++ {
+				val, err := r.Datastore().Get(ds.NewKey(fmt.Sprintf("key%d", i)))
+				require.NoError(t, err)
+				assert.Equal(t, []byte("value"), val)
+			}
+			assert.NoError(t, r.Close())
+		})
+	})
+
+	t.Run("compacts on close when configured", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "")
+		require.NoError(t, err)
+		defer func() {
+			require.NoError(t, os.RemoveAll(dir))
+		}()
+
+		cfg := config.NewDefaultConfig()
+		cfg.Datastore.CompactOnClose = true
+		r, err := initAndOpenRepo(dir, cfg)
+		require.NoError(t, err)
+		require.NoError(t, r.Datastore().Put(ds.NewKey("beep"), []byte("boop")))
+		require.NoError(t, r.Close())
+
+		r2, err := OpenFSRepo(dir)
+		require.NoError(t, err)
+		val, err := r2.Datastore().Get(ds.NewKey("beep"))
+		require.NoError(t, err)
+		assert.Equal(t, []byte("boop"), val)
+		assert.NoError(t, r2.Close())
+	})
+
+	t.Run("a failed compaction on close still releases the repo", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "")
+		require.NoError(t, err)
+		defer func() {
+			require.NoError(t, os.RemoveAll(dir))
+		}()
+
+		cfg := config.NewDefaultConfig()
+		cfg.Datastore.CompactOnClose = true
+		r, err := initAndOpenRepo(dir, cfg)
+		require.NoError(t, err)
+		r.ds = &failingCompactor{r.ds}
+
+		err = r.Close()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "injected failure")
+
+		r2, err := OpenFSRepo(dir)
+		require.NoError(t, err)
+		assert.NoError(t, r2.Close())
+	})
+}
+
+// failingCompactor is a Datastore whose compaction fails.
+type failingCompactor struct {
+	Datastore
+}
+
+func (d *failingCompactor) CollectGarbage() error {
+	return fmt.Errorf("injected failure")
+}
+
 func TestFSRepoReplaceAndSnapshotConfig(t *testing.T) {
 	tf.UnitTest(t)
 
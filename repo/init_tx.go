@@ -0,0 +1,239 @@
+package repo
+
+import (
+	"sync"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/ipfs/go-ipfs-keystore"
+	ci "github.com/libp2p/go-libp2p-crypto"
+	"github.com/pkg/errors"
+)
+
+// ErrInitDone is returned when committing or aborting an InitTx that was
+// already committed or aborted.
+var ErrInitDone = errors.New("repo initialization already committed or aborted")
+
+// ErrAlreadyInitialized is returned when committing an InitTx begun on a repo
+// that is already initialized.
+var ErrAlreadyInitialized = errors.New("repo is already initialized")
+
+// initializedKey is the key of the general datastore entry marking a repo
+// whose initialization was committed in full.
+var initializedKey = datastore.NewKey("/repo/initialized")
+
+// InitTx is a Repo staging the writes that initialize a repo, so that a
+// failed initialization leaves the repo uninitialized.  Writes are held in
+// memory until Commit, and dropped by Abort.  Reads see only the writes
+// staged in the InitTx and a copy of the config of the repo it was begun on.
+type InitTx struct {
+	*MemRepo
+
+	base Repo
+
+	lk   sync.Mutex
+	done bool
+}
+
+var _ Repo = (*InitTx)(nil)
+
+// beginInit begins staging the initialization of r.
+func beginInit(r Repo) (*InitTx, error) {
+	cfg, err := r.Config().Copy()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to copy config")
+	}
+
+	staged := NewInMemoryRepo()
+	staged.C = cfg
+	return &InitTx{MemRepo: staged, base: r}, nil
+}
+
+// Path returns the path of the repo being initialized.
+func (tx *InitTx) Path() (string, error) {
+	return tx.base.Path()
+}
+
+// Commit writes the staged keys, datastore entries and config to the repo
+// the InitTx was begun on, then marks the repo initialized.  It fails with
+// ErrAlreadyInitialized if the repo is marked initialized already.
+//
+// The marker is written last, so a repo is only marked initialized once
+// everything else is written, even if the process dies part way through.  A
+// repo without the marker is treated as uninitialized: keys and entries left
+// by an earlier commit that did not finish are overwritten.  If a write
+// fails, the writes already made are undone.
+func (tx *InitTx) Commit() error {
+	tx.lk.Lock()
+	defer tx.lk.Unlock()
+	if tx.done {
+		return ErrInitDone
+	}
+	tx.done = true
+
+	initialized, err := IsInitialized(tx.base)
+	if err != nil {
+		return err
+	}
+	if initialized {
+		return ErrAlreadyInitialized
+	}
+
+	names, err := tx.Keystore().List()
+	if err != nil {
+		return errors.Wrap(err, "failed to list staged keys")
+	}
+
+	var undo []func()
+	rollback := func() {
+		for i := len(undo) - 1; i >= 0; i-- {
+			undo[i]()
+		}
+	}
+
+	stores := []struct {
+		name   string
+		staged Datastore
+		base   Datastore
+	}{
+		{"chain", tx.ChainDatastore(), tx.base.ChainDatastore()},
+		{"general", tx.Datastore(), tx.base.Datastore()},
+		{"wallet", tx.WalletDatastore(), tx.base.WalletDatastore()},
+		{"deals", tx.DealsDatastore(), tx.base.DealsDatastore()},
+	}
+	for _, s := range stores {
+		previous, err := commitDatastore(s.staged, s.base)
+		if err != nil {
+			rollback()
+			return errors.Wrapf(err, "failed to commit %s datastore", s.name)
+		}
+		base := s.base
+		undo = append(undo, func() {
+			for k, v := range previous {
+				if v == nil {
+					base.Delete(k) // nolint: errcheck
+				} else {
+					base.Put(k, v) // nolint: errcheck
+				}
+			}
+		})
+	}
+
+	for _, name := range names {
+		k, err := tx.Keystore().Get(name)
+		if err != nil {
+			rollback()
+			return errors.Wrapf(err, "failed to get staged key %s", name)
+		}
+		previous, err := replaceKey(tx.base.Keystore(), name, k)
+		if err != nil {
+			rollback()
+			return errors.Wrapf(err, "failed to commit key %s", name)
+		}
+		name := name
+		undo = append(undo, func() {
+			tx.base.Keystore().Delete(name) // nolint: errcheck
+			if previous != nil {
+				tx.base.Keystore().Put(name, previous) // nolint: errcheck
+			}
+		})
+	}
+
+	previousCfg := tx.base.Config()
+	if err := tx.base.ReplaceConfig(tx.Config()); err != nil {
+		rollback()
+		return errors.Wrap(err, "failed to commit config")
+	}
+	undo = append(undo, func() {
+		tx.base.ReplaceConfig(previousCfg) // nolint: errcheck
+	})
+
+	if err := tx.base.Datastore().Put(initializedKey, []byte{}); err != nil {
+		rollback()
+		return errors.Wrap(err, "failed to mark repo initialized")
+	}
+	return nil
+}
+
+// IsInitialized returns true if r's initialization was committed in full.
+func IsInitialized(r Repo) (bool, error) {
+	has, err := r.Datastore().Has(initializedKey)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to check repo is initialized")
+	}
+	return has, nil
+}
+
+// replaceKey puts k under name in ks, replacing any key stored under name.
+// It returns the replaced key, nil if there was none.
+func replaceKey(ks keystore.Keystore, name string, k ci.PrivKey) (ci.PrivKey, error) {
+	has, err := ks.Has(name)
+	if err != nil {
+		return nil, err
+	}
+	var previous ci.PrivKey
+	if has {
+		if previous, err = ks.Get(name); err != nil {
+			return nil, err
+		}
+		if err := ks.Delete(name); err != nil {
+			return nil, err
+		}
+	}
+	if err := ks.Put(name, k); err != nil {
+		if previous != nil {
+			ks.Put(name, previous) // nolint: errcheck
+		}
+		return nil, err
+	}
+	return previous, nil
+}
+
+// Abort drops the staged writes.
+func (tx *InitTx) Abort() error {
+	tx.lk.Lock()
+	defer tx.lk.Unlock()
+	if tx.done {
+		return ErrInitDone
+	}
+	tx.done = true
+	return nil
+}
+
+// commitDatastore writes every entry of staged to base in a single batch.
+// It returns the values the written keys had in base before, nil for keys
+// base did not have.
+func commitDatastore(staged, base Datastore) (map[datastore.Key][]byte, error) {
+	results, err := staged.Query(query.Query{})
+	if err != nil {
+		return nil, err
+	}
+	entries, err := results.Rest()
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	previous := make(map[datastore.Key][]byte, len(entries))
+	batch, err := base.Batch()
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		k := datastore.NewKey(e.Key)
+		v, err := base.Get(k)
+		if err != nil && err != datastore.ErrNotFound {
+			return nil, err
+		}
+		previous[k] = v
+		if err := batch.Put(k, e.Value); err != nil {
+			return nil, err
+		}
+	}
+	if err := batch.Commit(); err != nil {
+		return nil, err
+	}
+	return previous, nil
+}
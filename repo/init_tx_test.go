@@ -0,0 +1,149 @@
+package repo
+
+import (
+	"crypto/rand"
+	"testing"
+
+	ds "github.com/ipfs/go-datastore"
+	ci "github.com/libp2p/go-libp2p-crypto"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/config"
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+)
+
+// failingConfigRepo is a MemRepo whose config cannot be replaced.
+type failingConfigRepo struct {
+	*MemRepo
+}
+
+func (r *failingConfigRepo) ReplaceConfig(cfg *config.Config) error {
+	return errors.New("injected failure")
+}
+
+func TestInitTx(t *testing.T) {
+	tf.UnitTest(t)
+
+	priv, _, err := ci.GenerateEd25519Key(rand.Reader)
+	require.NoError(t, err)
+	existing := ds.NewKey("/existing")
+	staged := ds.NewKey("/staged")
+
+	stage := func(t *testing.T, tx *InitTx) {
+		require.NoError(t, tx.Keystore().Put("self", priv))
+		require.NoError(t, tx.Datastore().Put(staged, []byte("new")))
+		require.NoError(t, tx.Datastore().Put(existing, []byte("new")))
+		require.NoError(t, tx.ChainDatastore().Put(staged, []byte("new")))
+		cfg := tx.Config()
+		cfg.NetworkName = "staged"
+		require.NoError(t, tx.ReplaceConfig(cfg))
+	}
+
+	t.Run("commit writes the staged changes", func(t *testing.T) {
+		r := NewInMemoryRepo()
+		require.NoError(t, r.Datastore().Put(existing, []byte("old")))
+		tx, err := r.BeginInit()
+		require.NoError(t, err)
+		stage(t, tx)
+
+		// Nothing is written before commit.
+		has, err := r.Datastore().Has(staged)
+		require.NoError(t, err)
+		assert.False(t, has)
+		assert.NotEqual(t, "staged", r.Config().NetworkName)
+
+		require.NoError(t, tx.Commit())
+		v, err := r.Datastore().Get(existing)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("new"), v)
+		v, err = r.ChainDatastore().Get(staged)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("new"), v)
+		has, err = r.Keystore().Has("self")
+		require.NoError(t, err)
+		assert.True(t, has)
+		assert.Equal(t, "staged", r.Config().NetworkName)
+		initialized, err := IsInitialized(r)
+		require.NoError(t, err)
+		assert.True(t, initialized)
+
+		assert.Equal(t, ErrInitDone, tx.Commit())
+		assert.Equal(t, ErrInitDone, tx.Abort())
+	})
+
+	t.Run("abort drops the staged changes", func(t *testing.T) {
+		r := NewInMemoryRepo()
+		tx, err := r.BeginInit()
+		require.NoError(t, err)
+		stage(t, tx)
+
+		require.NoError(t, tx.Abort())
+		has, err := r.Datastore().Has(staged)
+		require.NoError(t, err)
+		assert.False(t, has)
+		keys, err := r.Keystore().List()
+		require.NoError(t, err)
+		assert.Empty(t, keys)
+		assert.Equal(t, ErrInitDone, tx.Commit())
+	})
+
+	t.Run("a failed commit undoes its writes", func(t *testing.T) {
+		mem := NewInMemoryRepo()
+		require.NoError(t, mem.Datastore().Put(existing, []byte("old")))
+		tx, err := beginInit(&failingConfigRepo{mem})
+		require.NoError(t, err)
+		stage(t, tx)
+
+		assert.Error(t, tx.Commit())
+		v, err := mem.Datastore().Get(existing)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("old"), v)
+		for _, d := range []Datastore{mem.Datastore(), mem.ChainDatastore()} {
+			has, err := d.Has(staged)
+			require.NoError(t, err)
+			assert.False(t, has)
+		}
+		keys, err := mem.Keystore().List()
+		require.NoError(t, err)
+		assert.Empty(t, keys)
+		initialized, err := IsInitialized(mem)
+		require.NoError(t, err)
+		assert.False(t, initialized)
+	})
+
+	t.Run("commit overwrites what an unfinished commit left", func(t *testing.T) {
+		r := NewInMemoryRepo()
+		leftover, _, err := ci.GenerateEd25519Key(rand.Reader)
+		require.NoError(t, err)
+		require.NoError(t, r.Keystore().Put("self", leftover))
+		require.NoError(t, r.Datastore().Put(staged, []byte("leftover")))
+		tx, err := r.BeginInit()
+		require.NoError(t, err)
+		stage(t, tx)
+
+		require.NoError(t, tx.Commit())
+		k, err := r.Keystore().Get("self")
+		require.NoError(t, err)
+		assert.True(t, priv.Equals(k))
+		v, err := r.Datastore().Get(staged)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("new"), v)
+	})
+
+	t.Run("commit refuses an initialized repo", func(t *testing.T) {
+		r := NewInMemoryRepo()
+		tx, err := r.BeginInit()
+		require.NoError(t, err)
+		require.NoError(t, tx.Commit())
+
+		tx, err = r.BeginInit()
+		require.NoError(t, err)
+		stage(t, tx)
+		assert.Equal(t, ErrAlreadyInitialized, tx.Commit())
+		has, err := r.Datastore().Has(staged)
+		require.NoError(t, err)
+		assert.False(t, has)
+	})
+}
@@ -0,0 +1,76 @@
+package repo
+
+import (
+	"testing"
+
+	ds "github.com/ipfs/go-datastore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opencensus.io/stats/view"
+
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+)
+
+// recordedCount returns the number of measurements recorded by the timer
+// view named name.
+func recordedCount(t *testing.T, name string) int64 {
+	rows, err := view.RetrieveData(name)
+	require.NoError(t, err)
+	var count int64
+	for _, row := range rows {
+		count += row.Data.(*view.DistributionData).Count
+	}
+	return count
+}
+
+func TestInstrumentedDatastore(t *testing.T) {
+	tf.UnitTest(t)
+
+	r := NewInMemoryRepo()
+	underlying := r.Datastore()
+	r.Instrument()
+	ids := r.Datastore()
+	require.IsType(t, &InstrumentedDatastore{}, ids)
+
+	key := ds.NewKey("/a")
+	missing := ds.NewKey("/missing")
+
+	// requireRecorded runs op and requires it to record one measurement
+	// with the timer view named name.
+	requireRecorded := func(name string, op func()) {
+		before := recordedCount(t, name)
+		op()
+		assert.Equal(t, before+1, recordedCount(t, name), name)
+	}
+
+	requireRecorded("repo/datastore_put", func() {
+		require.NoError(t, ids.Put(key, []byte("value")))
+	})
+	has, err := underlying.Has(key)
+	require.NoError(t, err)
+	assert.True(t, has)
+
+	requireRecorded("repo/datastore_get", func() {
+		value, err := ids.Get(key)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("value"), value)
+	})
+	requireRecorded("repo/datastore_get", func() {
+		_, err := ids.Get(missing)
+		_, underlyingErr := underlying.Get(missing)
+		assert.Equal(t, underlyingErr, err)
+	})
+
+	requireRecorded("repo/datastore_has", func() {
+		has, err := ids.Has(key)
+		require.NoError(t, err)
+		assert.True(t, has)
+	})
+
+	requireRecorded("repo/datastore_delete", func() {
+		require.NoError(t, ids.Delete(key))
+	})
+	has, err = underlying.Has(key)
+	require.NoError(t, err)
+	assert.False(t, has)
+}
@@ -1,6 +1,8 @@
 package repo
 
 import (
+	"context"
+	"io"
 	"sync"
 
 	"github.com/ipfs/go-datastore"
@@ -83,6 +85,15 @@ func (mr *MemRepo) DealsDatastore() Datastore {
 	return mr.DealsDs
 }
 
+// Instrument wraps the repo's datastores in InstrumentedDatastores recording
+// the latency of their operations.
+func (mr *MemRepo) Instrument() {
+	mr.D = NewInstrumentedDatastore(mr.D)
+	mr.W = NewInstrumentedDatastore(mr.W)
+	mr.Chain = NewInstrumentedDatastore(mr.Chain)
+	mr.DealsDs = NewInstrumentedDatastore(mr.DealsDs)
+}
+
 // Version returns the version of the repo.
 func (mr *MemRepo) Version() uint {
 	return mr.version
@@ -94,6 +105,21 @@ func (mr *MemRepo) Close() error {
 	return nil
 }
 
+// Compact is a no-op for the in-memory repo.
+func (mr *MemRepo) Compact(ctx context.Context) error {
+	return nil
+}
+
+// Snapshot streams a copy of the repo to w.
+func (mr *MemRepo) Snapshot(ctx context.Context, w io.Writer) error {
+	return writeSnapshot(ctx, mr, w)
+}
+
+// BeginInit begins initializing the repo.
+func (mr *MemRepo) BeginInit() (*InitTx, error) {
+	return beginInit(mr)
+}
+
 // SetAPIAddr writes the address of the running API to memory.
 func (mr *MemRepo) SetAPIAddr(addr string) error {
 	mr.apiAddress = addr
@@ -1,6 +1,9 @@
 package repo
 
 import (
+	"context"
+	"io"
+
 	"github.com/ipfs/go-datastore"
 	"github.com/ipfs/go-ipfs-keystore"
 
@@ -49,6 +52,21 @@ type Repo interface {
 	// Path returns the repo path.
 	Path() (string, error)
 
+	// Compact reclaims space held by the repo's datastores.
+	Compact(ctx context.Context) error
+
+	// Snapshot streams a copy of the repo's config, keystore and datastores
+	// to w without stopping writers.  Each datastore is copied from a
+	// consistent view, but the views of different datastores are taken one
+	// after another, so writes made in between may be in one and not
+	// another.  It can be restored with RestoreSnapshot.
+	Snapshot(ctx context.Context, w io.Writer) error
+
+	// BeginInit begins initializing the repo.  Writes through the returned
+	// InitTx are applied to the repo together on Commit, or dropped on
+	// Abort, so a failed initialization leaves the repo untouched.
+	BeginInit() (*InitTx, error)
+
 	// Close shuts down the repo.
 	Close() error
 }
@@ -0,0 +1,164 @@
+package repo
+
+import (
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"io"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/ipfs/go-ipfs-keystore"
+	ci "github.com/libp2p/go-libp2p-crypto"
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/config"
+)
+
+// Sections of a repo snapshot.
+const (
+	snapshotConfig    = "config"
+	snapshotKeystore  = "keystore"
+	snapshotChain     = "chain"
+	snapshotDatastore = "datastore"
+	snapshotWallet    = "wallet"
+	snapshotDeals     = "deals"
+)
+
+// snapshotRecord is a single entry of a repo snapshot.
+type snapshotRecord struct {
+	Section string
+	Key     string
+	Value   []byte
+}
+
+// writeSnapshot streams the config, keystore and datastores of r to w.
+//
+// Each datastore is read through a single query, which datastores serve
+// from a consistent view.  The chain datastore is read before the general
+// datastore: the chain head is only advanced after the tipsets and state it
+// references are written, so everything reachable from the snapshotted head
+// is in the snapshot even while sync continues.
+func writeSnapshot(ctx context.Context, r Repo, w io.Writer) error {
+	enc := gob.NewEncoder(w)
+
+	cfg, err := json.Marshal(r.Config())
+	if err != nil {
+		return errors.Wrap(err, "failed to encode config")
+	}
+	if err := enc.Encode(snapshotRecord{Section: snapshotConfig, Value: cfg}); err != nil {
+		return err
+	}
+
+	names, err := r.Keystore().List()
+	if err != nil {
+		return errors.Wrap(err, "failed to list keystore")
+	}
+	for _, name := range names {
+		k, err := r.Keystore().Get(name)
+		if err != nil {
+			return errors.Wrapf(err, "failed to get key %s", name)
+		}
+		raw, err := ci.MarshalPrivateKey(k)
+		if err != nil {
+			return errors.Wrapf(err, "failed to encode key %s", name)
+		}
+		if err := enc.Encode(snapshotRecord{Section: snapshotKeystore, Key: name, Value: raw}); err != nil {
+			return err
+		}
+	}
+
+	stores := []struct {
+		section string
+		ds      Datastore
+	}{
+		{snapshotChain, r.ChainDatastore()},
+		{snapshotDatastore, r.Datastore()},
+		{snapshotWallet, r.WalletDatastore()},
+		{snapshotDeals, r.DealsDatastore()},
+	}
+	for _, s := range stores {
+		if err := snapshotDatastoreTo(ctx, enc, s.section, s.ds); err != nil {
+			return errors.Wrapf(err, "failed to snapshot %s datastore", s.section)
+		}
+	}
+	return nil
+}
+
+// snapshotDatastoreTo encodes every entry of ds as a record of section.
+func snapshotDatastoreTo(ctx context.Context, enc *gob.Encoder, section string, ds Datastore) error {
+	results, err := ds.Query(query.Query{})
+	if err != nil {
+		return err
+	}
+	defer results.Close() // nolint: errcheck
+
+	for res := range results.Next() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if res.Error != nil {
+			return res.Error
+		}
+		if err := enc.Encode(snapshotRecord{Section: section, Key: res.Key, Value: res.Value}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RestoreSnapshot reads a snapshot written by Repo.Snapshot from in into r,
+// replacing r's config and adding the snapshotted keys and datastore entries.
+// r should be empty.
+func RestoreSnapshot(in io.Reader, r Repo) error {
+	dec := gob.NewDecoder(in)
+	stores := map[string]Datastore{
+		snapshotChain:     r.ChainDatastore(),
+		snapshotDatastore: r.Datastore(),
+		snapshotWallet:    r.WalletDatastore(),
+		snapshotDeals:     r.DealsDatastore(),
+	}
+	for {
+		var rec snapshotRecord
+		if err := dec.Decode(&rec); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return errors.Wrap(err, "failed to read snapshot")
+		}
+
+		switch rec.Section {
+		case snapshotConfig:
+			cfg := config.NewDefaultConfig()
+			if err := json.Unmarshal(rec.Value, cfg); err != nil {
+				return errors.Wrap(err, "failed to decode config")
+			}
+			if err := r.ReplaceConfig(cfg); err != nil {
+				return errors.Wrap(err, "failed to restore config")
+			}
+		case snapshotKeystore:
+			if err := restoreKey(r.Keystore(), rec.Key, rec.Value); err != nil {
+				return err
+			}
+		default:
+			ds, ok := stores[rec.Section]
+			if !ok {
+				return errors.Errorf("unknown snapshot section %q", rec.Section)
+			}
+			if err := ds.Put(datastore.NewKey(rec.Key), rec.Value); err != nil {
+				return errors.Wrapf(err, "failed to restore %s datastore", rec.Section)
+			}
+		}
+	}
+}
+
+// restoreKey puts the encoded private key raw in ks under name.
+func restoreKey(ks keystore.Keystore, name string, raw []byte) error {
+	k, err := ci.UnmarshalPrivateKey(raw)
+	if err != nil {
+		return errors.Wrapf(err, "failed to decode key %s", name)
+	}
+	if err := ks.Put(name, k); err != nil {
+		return errors.Wrapf(err, "failed to restore key %s", name)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package repo
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"strconv"
+	"testing"
+
+	ds "github.com/ipfs/go-datastore"
+	ci "github.com/libp2p/go-libp2p-crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	tf.UnitTest(t)
+	ctx := context.Background()
+
+	r := NewInMemoryRepo()
+	cfg := r.Config()
+	cfg.Sync.SafeBoot = true
+	require.NoError(t, r.ReplaceConfig(cfg))
+	priv, _, err := ci.GenerateEd25519Key(rand.Reader)
+	require.NoError(t, err)
+	require.NoError(t, r.Keystore().Put("self", priv))
+	require.NoError(t, r.WalletDatastore().Put(ds.NewKey("/wallet"), []byte("secret")))
+
+	// Concurrently write state to the datastore and then advance a head
+	// pointing at it in the chain datastore, as sync does.
+	stateKey := func(i int) ds.Key {
+		return ds.NewKey(fmt.Sprintf("/state/%d", i))
+	}
+	headKey := ds.NewKey("/head")
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if !assert.NoError(t, r.Datastore().Put(stateKey(i), []byte(strconv.Itoa(i)))) {
+				return
+			}
+			if !assert.NoError(t, r.ChainDatastore().Put(headKey, []byte(strconv.Itoa(i)))) {
+				return
+			}
+		}
+	}()
+
+	var buf bytes.Buffer
+	err = r.Snapshot(ctx, &buf)
+	close(stop)
+	<-done
+	require.NoError(t, err)
+
+	restored := NewInMemoryRepo()
+	require.NoError(t, RestoreSnapshot(&buf, restored))
+
+	assert.True(t, restored.Config().Sync.SafeBoot)
+	restoredPriv, err := restored.Keystore().Get("self")
+	require.NoError(t, err)
+	assert.True(t, priv.Equals(restoredPriv))
+	wallet, err := restored.WalletDatastore().Get(ds.NewKey("/wallet"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("secret"), wallet)
+
+	// Everything the restored head references was restored.
+	raw, err := restored.ChainDatastore().Get(headKey)
+	if err == ds.ErrNotFound {
+		return // the snapshot ran before the first head was written
+	}
+	require.NoError(t, err)
+	head, err := strconv.Atoi(string(raw))
+	require.NoError(t, err)
+	for i := 0; i <= head; i++ {
+		val, err := restored.Datastore().Get(stateKey(i))
+		require.NoError(t, err)
+		assert.Equal(t, []byte(strconv.Itoa(i)), val)
+	}
+}
+
+func TestRestoreSnapshotRejectsCorruptInput(t *testing.T) {
+	tf.UnitTest(t)
+
+	assert.Error(t, RestoreSnapshot(bytes.NewReader([]byte("not a snapshot")), NewInMemoryRepo()))
+}
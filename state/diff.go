@@ -0,0 +1,135 @@
+package state
+
+import (
+	"bytes"
+	"context"
+	"sort"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-hamt-ipld"
+	cbor "github.com/ipfs/go-ipld-cbor"
+
+	"github.com/filecoin-project/go-filecoin/actor"
+	"github.com/filecoin-project/go-filecoin/address"
+)
+
+// DiffStateRoots returns the actors of the state tree with root to that are
+// not in the state tree with root from, or differ from it there, and the
+// addresses of the actors of from that are not in to.  Removed addresses are
+// sorted.
+//
+// Subtrees the two trees share are skipped without being loaded, so the cost
+// of the diff is proportional to the size of the change rather than of the
+// state, which makes diffing the states of adjacent tipsets cheap.
+func DiffStateRoots(ctx context.Context, store *hamt.CborIpldStore, from, to cid.Cid) (changed map[address.Address]*actor.Actor, removed []address.Address, err error) {
+	changed = make(map[address.Address]*actor.Actor)
+	if from.Equals(to) {
+		return changed, nil, nil
+	}
+
+	fromActors := make(map[address.Address]*actor.Actor)
+	toActors := make(map[address.Address]*actor.Actor)
+	fromLinks := []cid.Cid{from}
+	toLinks := []cid.Cid{to}
+	for len(fromLinks) > 0 || len(toLinks) > 0 {
+		fromLinks, toLinks = dropCommonLinks(fromLinks, toLinks)
+		if fromLinks, err = expandNodes(ctx, store, fromLinks, fromActors); err != nil {
+			return nil, nil, err
+		}
+		if toLinks, err = expandNodes(ctx, store, toLinks, toActors); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for addr, toAct := range toActors {
+		fromAct, ok := fromActors[addr]
+		if ok {
+			same, err := sameActor(fromAct, toAct)
+			if err != nil {
+				return nil, nil, err
+			}
+			if same {
+				continue
+			}
+		}
+		changed[addr] = toAct
+	}
+	for addr := range fromActors {
+		if _, ok := toActors[addr]; !ok {
+			removed = append(removed, addr)
+		}
+	}
+	sort.Slice(removed, func(i, j int) bool { return removed[i].String() < removed[j].String() })
+	return changed, removed, nil
+}
+
+// dropCommonLinks returns a and b without the links they have in common.  A
+// subtree in both trees holds the same actors in both, so it cannot
+// contribute to the diff.
+func dropCommonLinks(a, b []cid.Cid) ([]cid.Cid, []cid.Cid) {
+	inA := make(map[cid.Cid]struct{}, len(a))
+	for _, c := range a {
+		inA[c] = struct{}{}
+	}
+	common := make(map[cid.Cid]struct{})
+	for _, c := range b {
+		if _, ok := inA[c]; ok {
+			common[c] = struct{}{}
+		}
+	}
+	if len(common) == 0 {
+		return a, b
+	}
+	keep := func(links []cid.Cid) []cid.Cid {
+		var kept []cid.Cid
+		for _, c := range links {
+			if _, ok := common[c]; !ok {
+				kept = append(kept, c)
+			}
+		}
+		return kept
+	}
+	return keep(a), keep(b)
+}
+
+// expandNodes loads the hamt nodes with the given cids, adds the actors they
+// hold directly to actors and returns the links to their children.
+func expandNodes(ctx context.Context, store *hamt.CborIpldStore, links []cid.Cid, actors map[address.Address]*actor.Actor) ([]cid.Cid, error) {
+	var children []cid.Cid
+	for _, c := range links {
+		nd, err := hamt.LoadNode(ctx, store, c)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range nd.Pointers {
+			for _, kv := range p.KVs {
+				var a actor.Actor
+				if err := hackTransferObject(kv.Value, &a); err != nil {
+					return nil, err
+				}
+				addr, err := address.NewFromString(kv.Key)
+				if err != nil {
+					return nil, err
+				}
+				actors[addr] = &a
+			}
+			if p.Link.Defined() {
+				children = append(children, p.Link)
+			}
+		}
+	}
+	return children, nil
+}
+
+// sameActor returns true if a and b encode identically.
+func sameActor(a, b *actor.Actor) (bool, error) {
+	aBytes, err := cbor.DumpObject(a)
+	if err != nil {
+		return false, err
+	}
+	bBytes, err := cbor.DumpObject(b)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(aBytes, bBytes), nil
+}
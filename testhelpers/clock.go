@@ -0,0 +1,96 @@
+package testhelpers
+
+import (
+	"sync"
+	"time"
+
+	"github.com/filecoin-project/go-filecoin/clock"
+)
+
+// FakeClock is a clock.Clock whose time only changes when set.  Its timers
+// fire when the clock is advanced past them.
+type FakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+var _ clock.Clock = (*FakeClock)(nil)
+
+// NewFakeClock returns a FakeClock reading now.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// Now returns the fake clock's time.
+func (fc *FakeClock) Now() time.Time {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return fc.now
+}
+
+// Advance moves the fake clock's time forward by d, firing the timers it
+// passes.
+func (fc *FakeClock) Advance(d time.Duration) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.now = fc.now.Add(d)
+
+	pending := fc.timers[:0]
+	for _, t := range fc.timers {
+		if !t.fireBy(fc.now) {
+			pending = append(pending, t)
+		}
+	}
+	fc.timers = pending
+}
+
+// NewTimer returns a timer firing once the clock is advanced by d.
+func (fc *FakeClock) NewTimer(d time.Duration) clock.Timer {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	t := &fakeTimer{deadline: fc.now.Add(d), c: make(chan time.Time, 1)}
+	if !t.fireBy(fc.now) {
+		fc.timers = append(fc.timers, t)
+	}
+	return t
+}
+
+// fakeTimer is a clock.Timer of a FakeClock.
+type fakeTimer struct {
+	mu       sync.Mutex
+	deadline time.Time
+	c        chan time.Time
+	done     bool
+}
+
+// fireBy fires the timer if now is at or past its deadline, returning true
+// if the timer is done.
+func (t *fakeTimer) fireBy(now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.done {
+		return true
+	}
+	if now.Before(t.deadline) {
+		return false
+	}
+	t.done = true
+	t.c <- now
+	return true
+}
+
+// Chan returns the channel the timer fires on.
+func (t *fakeTimer) Chan() <-chan time.Time {
+	return t.c
+}
+
+// Stop prevents the timer from firing, returning false if it already fired
+// or was stopped.
+func (t *fakeTimer) Stop() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stopped := !t.done
+	t.done = true
+	return stopped
+}
@@ -110,6 +110,11 @@ func (tsmv *TestSignedMessageValidator) Validate(ctx context.Context, msg *types
 	return nil
 }
 
+// ValidateVerified always returns nil
+func (tsmv *TestSignedMessageValidator) ValidateVerified(ctx context.Context, msg *types.SignedMessage, fromActor *actor.Actor, sigs consensus.VerifiedSignatures) error {
+	return nil
+}
+
 // TestBlockRewarder is a rewarder that doesn't actually add any rewards to simplify state tracking in tests
 type TestBlockRewarder struct{}
 
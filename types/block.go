@@ -1,7 +1,6 @@
 package types
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"sort"
@@ -39,6 +38,15 @@ type Block struct {
 	// Nonce is a temporary field used to differentiate blocks for testing
 	Nonce Uint64 `json:"nonce"`
 
+	// NetworkName is the name of the network the block was produced for,
+	// binding the block to that network.  It is inherited from genesis.
+	NetworkName string `json:"networkName,omitempty" refmt:",omitempty"`
+
+	// Timestamp is the start of the round the block was mined in, in
+	// seconds since the Unix epoch.  For a genesis block it is the time the
+	// network started.
+	Timestamp Uint64 `json:"timestamp,omitempty" refmt:",omitempty"`
+
 	// Messages is the set of messages included in this block
 	// TODO: should be a merkletree-ish thing
 	Messages []*SignedMessage `json:"messages"`
@@ -142,6 +150,19 @@ func (b *Block) Score() uint64 {
 	return uint64(b.Height)
 }
 
+// WithoutMessages returns a copy of b with its messages removed whose cid is
+// c, the cid of the block before its messages were removed.  It is used to
+// retain the header of a block whose message bodies have been pruned.  The
+// copy's content no longer hashes to its cid, so it must never be sent to
+// peers or validated.
+func (b *Block) WithoutMessages(c cid.Cid) *Block {
+	out := *b
+	out.Messages = nil
+	out.cachedBytes = nil
+	out.cachedCid = c
+	return &out
+}
+
 // Equals returns true if the Block is equal to other.
 func (b *Block) Equals(other *Block) bool {
 	return b.Cid().Equals(other.Cid())
@@ -150,6 +171,6 @@ func (b *Block) Equals(other *Block) bool {
 // SortBlocks sorts a slice of blocks in the canonical order (by min tickets)
 func SortBlocks(blks []*Block) {
 	sort.Slice(blks, func(i, j int) bool {
-		return bytes.Compare(blks[i].Ticket, blks[j].Ticket) == -1
+		return TicketOf(blks[i]).Less(TicketOf(blks[j]))
 	})
 }
@@ -0,0 +1,30 @@
+package types
+
+// Codec encodes and decodes blocks for storage and transfer.  Alternate
+// codecs allow experimenting with other encodings, or versioning the encoding
+// across protocol upgrades, without changing the code that stores and
+// fetches blocks.  Codecs do not change identity: block cids are always
+// computed over the canonical cbor encoding.
+//
+// Codecs only cover blocks.  Messages are stored and fetched inside the
+// blocks that include them, and blocks and messages gossiped over pubsub
+// always use their canonical cbor encoding.
+type Codec interface {
+	EncodeBlock(blk *Block) ([]byte, error)
+	DecodeBlock(data []byte) (*Block, error)
+}
+
+// CborCodec is the default Codec, encoding blocks as cbor.
+var CborCodec Codec = cborCodec{}
+
+type cborCodec struct{}
+
+// EncodeBlock encodes blk as cbor.
+func (cborCodec) EncodeBlock(blk *Block) ([]byte, error) {
+	return blk.ToNode().RawData(), nil
+}
+
+// DecodeBlock decodes a cbor encoded block.
+func (cborCodec) DecodeBlock(data []byte) (*Block, error) {
+	return DecodeBlock(data)
+}
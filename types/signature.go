@@ -2,6 +2,7 @@ package types
 
 import (
 	logging "github.com/ipfs/go-log"
+	ci "github.com/libp2p/go-libp2p-crypto"
 
 	"github.com/filecoin-project/go-filecoin/address"
 	wutil "github.com/filecoin-project/go-filecoin/wallet/util"
@@ -12,9 +13,36 @@ var log = logging.Logger("types")
 // Signature is the result of a cryptographic sign operation.
 type Signature []byte
 
+// secp256k1SignatureBytes is the length of a secp256k1 signature, including
+// the recovery id.
+const secp256k1SignatureBytes = 65
+
+// ed25519SignatureBytes is the length of an Ed25519 signature.
+const ed25519SignatureBytes = 64
+
 // IsValidSignature cryptographically verifies that 'sig' is the signed hash of 'data' with
-// the public key belonging to `addr`.
+// the public key belonging to `addr`.  The signature scheme is that of the protocol of
+// `addr`, and a signature made with another scheme is not valid.  Addresses of protocols
+// without a signature scheme have no valid signatures.
 func IsValidSignature(data []byte, addr address.Address, sig Signature) bool {
+	switch addr.Protocol() {
+	case address.SECP256K1:
+		return isValidSecp256k1Signature(data, addr, sig)
+	case address.Ed25519:
+		return isValidEd25519Signature(data, addr, sig)
+	default:
+		log.Infof("address %s has no signature scheme", addr)
+		return false
+	}
+}
+
+// isValidSecp256k1Signature verifies a secp256k1 signature by recovering the
+// public key that made it and comparing its address to `addr`.
+func isValidSecp256k1Signature(data []byte, addr address.Address, sig Signature) bool {
+	if len(sig) != secp256k1SignatureBytes {
+		log.Infof("invalid secp256k1 signature length %d", len(sig))
+		return false
+	}
 	maybePk, err := wutil.Ecrecover(data, sig)
 	if err != nil {
 		// Any error returned from Ecrecover means this signature is not valid.
@@ -29,3 +57,23 @@ func IsValidSignature(data []byte, addr address.Address, sig Signature) bool {
 
 	return maybeAddr == addr
 }
+
+// isValidEd25519Signature verifies an Ed25519 signature with the public key
+// `addr` holds.
+func isValidEd25519Signature(data []byte, addr address.Address, sig Signature) bool {
+	if len(sig) != ed25519SignatureBytes {
+		log.Infof("invalid ed25519 signature length %d", len(sig))
+		return false
+	}
+	pk, err := ci.UnmarshalEd25519PublicKey(addr.Payload())
+	if err != nil {
+		log.Infof("error in ed25519 public key: %s", err)
+		return false
+	}
+	valid, err := pk.Verify(data, sig)
+	if err != nil {
+		log.Infof("error in signature validation: %s", err)
+		return false
+	}
+	return valid
+}
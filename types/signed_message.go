@@ -94,8 +94,9 @@ func (smsg *SignedMessage) RecoverAddress(r Recoverer) (address.Address, error)
 
 }
 
-// VerifySignature returns true iff the signature over the message as calculated
-// from EC recover matches the message sender address.
+// VerifySignature returns true iff the signature over the message is valid for
+// the message sender address, under the signature scheme of the address's
+// protocol.
 func (smsg *SignedMessage) VerifySignature() bool {
 	bmsg, err := smsg.MeteredMessage.Marshal()
 	if err != nil {
@@ -0,0 +1,31 @@
+package types
+
+import (
+	"bytes"
+	"encoding/hex"
+)
+
+// Ticket is the winning ticket submitted with a block.  Tickets are
+// compared bytewise when expected consensus breaks ties between tipsets of
+// equal weight: the tipset holding the smallest ticket wins.
+type Ticket []byte
+
+// Less returns true if t orders strictly before other.
+func (t Ticket) Less(other Ticket) bool {
+	return bytes.Compare(t, other) < 0
+}
+
+// Equals returns true if t and other hold the same bytes.
+func (t Ticket) Equals(other Ticket) bool {
+	return bytes.Equal(t, other)
+}
+
+// String returns the hex encoding of the ticket.
+func (t Ticket) String() string {
+	return hex.EncodeToString(t)
+}
+
+// TicketOf returns the ticket of the given block.
+func TicketOf(b *Block) Ticket {
+	return Ticket(b.Ticket)
+}
@@ -0,0 +1,47 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+)
+
+func TestTicketLess(t *testing.T) {
+	tf.UnitTest(t)
+
+	assert.True(t, Ticket([]byte{0}).Less(Ticket([]byte{1})))
+	assert.False(t, Ticket([]byte{1}).Less(Ticket([]byte{0})))
+	assert.False(t, Ticket([]byte{1}).Less(Ticket([]byte{1})))
+
+	// Bytewise ordering, a prefix orders first.
+	assert.True(t, Ticket([]byte{1}).Less(Ticket([]byte{1, 0})))
+	assert.True(t, Ticket([]byte{0, 9}).Less(Ticket([]byte{1})))
+	assert.True(t, Ticket(nil).Less(Ticket([]byte{0})))
+}
+
+func TestTicketEquals(t *testing.T) {
+	tf.UnitTest(t)
+
+	assert.True(t, Ticket([]byte{1, 2}).Equals(Ticket([]byte{1, 2})))
+	assert.False(t, Ticket([]byte{1, 2}).Equals(Ticket([]byte{1})))
+}
+
+func TestTipSetMinTicketMultiBlock(t *testing.T) {
+	tf.UnitTest(t)
+
+	b1, b2, b3 := RequireTestBlocks(t)
+	b1.Ticket = []byte{3, 1}
+	b2.Ticket = []byte{2, 9}
+	b3.Ticket = []byte{3, 0}
+	ts := RequireNewTipSet(t, b1, b2, b3)
+
+	mt, err := ts.MinTicket()
+	require.NoError(t, err)
+	assert.Equal(t, Ticket([]byte{2, 9}), mt)
+
+	_, err = TipSet{}.MinTicket()
+	assert.Equal(t, ErrEmptyTipSet, err)
+}
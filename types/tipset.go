@@ -1,7 +1,7 @@
 package types
 
 import (
-	"bytes"
+	"fmt"
 
 	"github.com/ipfs/go-cid"
 	"github.com/pkg/errors"
@@ -87,6 +87,17 @@ func (ts TipSet) String() string {
 	return ts.ToSortedCidSet().String()
 }
 
+// Describe returns a human readable summary of the TipSet for logging:
+// height=<h> weight=<w> blocks=<n> key={ <cid1> <cid2> }
+// Unlike String it is not a stable identifier and should not be parsed.
+func (ts TipSet) Describe() string {
+	if len(ts) == 0 {
+		return "empty tipset"
+	}
+	blk := ts.ToSlice()[0]
+	return fmt.Sprintf("height=%d weight=%d blocks=%d key=%s", blk.Height, blk.ParentWeight, len(ts), ts.String())
+}
+
 // Equals returns true if the tipset contains the same blocks as another set.
 // Equality is not tested deeply.  If blocks of two tipsets are stored at
 // different memory addresses but have the same cids the tipsets will be equal.
@@ -116,16 +127,17 @@ func (ts TipSet) ToSlice() []*Block {
 	return sl
 }
 
-// MinTicket returns the smallest ticket of all blocks in the tipset.
-func (ts TipSet) MinTicket() (Signature, error) {
+// MinTicket returns the smallest ticket of all blocks in the tipset.  Expected
+// consensus uses this ticket to break ties between tipsets of equal weight.
+func (ts TipSet) MinTicket() (Ticket, error) {
 	if len(ts) == 0 {
 		return nil, ErrEmptyTipSet
 	}
 	blks := ts.ToSlice()
-	min := blks[0].Ticket
-	for i := range blks[0:] {
-		if bytes.Compare(blks[i].Ticket, min) < 0 {
-			min = blks[i].Ticket
+	min := TicketOf(blks[0])
+	for _, blk := range blks[1:] {
+		if t := TicketOf(blk); t.Less(min) {
+			min = t
 		}
 	}
 	return min, nil
@@ -0,0 +1,55 @@
+package types
+
+import (
+	"encoding/json"
+	"io/ioutil"
+
+	"github.com/ipfs/go-cid"
+	"github.com/pkg/errors"
+)
+
+// SaveTipSetKey writes key to the file at path as a JSON array of cid
+// strings, so that checkpoints and sync targets can be read and shared by
+// operators.
+func SaveTipSetKey(path string, key SortedCidSet) error {
+	if key.Empty() {
+		return errors.New("cannot save empty tipset key")
+	}
+	strs := make([]string, 0, key.Len())
+	for it := key.Iter(); !it.Complete(); it.Next() {
+		strs = append(strs, it.Value().String())
+	}
+	out, err := json.MarshalIndent(strs, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(out, '\n'), 0644)
+}
+
+// LoadTipSetKey reads a tipset key from the file at path as written by
+// SaveTipSetKey.  The cids may be listed in any order.
+func LoadTipSetKey(path string) (SortedCidSet, error) {
+	in, err := ioutil.ReadFile(path)
+	if err != nil {
+		return SortedCidSet{}, err
+	}
+	var strs []string
+	if err := json.Unmarshal(in, &strs); err != nil {
+		return SortedCidSet{}, errors.Wrapf(err, "malformed tipset key file %s", path)
+	}
+
+	var key SortedCidSet
+	for _, s := range strs {
+		c, err := cid.Decode(s)
+		if err != nil {
+			return SortedCidSet{}, errors.Wrapf(err, "malformed cid %q in tipset key file %s", s, path)
+		}
+		if !key.Add(c) {
+			return SortedCidSet{}, errors.Errorf("duplicate cid %s in tipset key file %s", s, path)
+		}
+	}
+	if key.Empty() {
+		return SortedCidSet{}, errors.Errorf("empty tipset key in file %s", path)
+	}
+	return key, nil
+}
@@ -0,0 +1,73 @@
+package types
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+)
+
+func TestTipSetKeyFile(t *testing.T) {
+	tf.UnitTest(t)
+
+	dir, err := ioutil.TempDir("", "tipsetkey")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(dir))
+	}()
+
+	makeCid := NewCidForTestGetter()
+	c1, c2 := makeCid(), makeCid()
+
+	writeFile := func(t *testing.T, content string) string {
+		path := filepath.Join(dir, t.Name())
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+		return path
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		key := NewSortedCidSet(c1, c2)
+		path := filepath.Join(dir, "key.json")
+		require.NoError(t, SaveTipSetKey(path, key))
+
+		loaded, err := LoadTipSetKey(path)
+		require.NoError(t, err)
+		assert.Equal(t, key.ToSlice(), loaded.ToSlice())
+	})
+
+	t.Run("cids in any order", func(t *testing.T) {
+		path := writeFile(t, `["`+c2.String()+`", "`+c1.String()+`"]`)
+		loaded, err := LoadTipSetKey(path)
+		require.NoError(t, err)
+		assert.Equal(t, NewSortedCidSet(c1, c2).ToSlice(), loaded.ToSlice())
+	})
+
+	t.Run("empty key is not saved", func(t *testing.T) {
+		assert.Error(t, SaveTipSetKey(filepath.Join(dir, "empty.json"), SortedCidSet{}))
+	})
+
+	t.Run("malformed input errors", func(t *testing.T) {
+		for name, content := range map[string]string{
+			"not json":  `{{`,
+			"not array": `{"cid": "` + c1.String() + `"}`,
+			"bad cid":   `["notacid"]`,
+			"duplicate": `["` + c1.String() + `", "` + c1.String() + `"]`,
+			"empty":     `[]`,
+		} {
+			path := writeFile(t, content)
+			_, err := LoadTipSetKey(path)
+			assert.Error(t, err, name)
+		}
+	})
+
+	t.Run("missing file errors", func(t *testing.T) {
+		_, err := LoadTipSetKey(filepath.Join(dir, "missing.json"))
+		assert.Error(t, err)
+	})
+}
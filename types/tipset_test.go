@@ -1,6 +1,7 @@
 package types
 
 import (
+	"fmt"
 	"sort"
 	"testing"
 
@@ -185,7 +186,7 @@ func TestTipSetMinTicket(t *testing.T) {
 	ts := RequireTestTipSet(t)
 	mt, err := ts.MinTicket()
 	assert.NoError(t, err)
-	assert.Equal(t, Signature([]byte{0}), mt)
+	assert.Equal(t, Ticket([]byte{0}), mt)
 }
 
 func TestTipSetHeight(t *testing.T) {
@@ -237,6 +238,21 @@ func TestTipSetString(t *testing.T) {
 	assert.Equal(t, strExp, ts.String())
 }
 
+func TestTipSetDescribe(t *testing.T) {
+	tf.UnitTest(t)
+
+	ts := RequireTestTipSet(t)
+	h, err := ts.Height()
+	require.NoError(t, err)
+
+	desc := ts.Describe()
+	assert.Contains(t, desc, fmt.Sprintf("height=%d", h))
+	assert.Contains(t, desc, "blocks=3")
+	assert.Contains(t, desc, ts.String())
+
+	assert.Equal(t, "empty tipset", TipSet{}.Describe())
+}
+
 func TestTipSetToSlice(t *testing.T) {
 	tf.UnitTest(t)
 
@@ -0,0 +1,116 @@
+// Package lru provides a string keyed least recently used cache.
+package lru
+
+import (
+	"container/list"
+)
+
+// Cache is a string keyed least recently used cache bounded by the total
+// cost of the values it holds.  Values added with Add cost one, so a cache
+// holding only those is bounded by its number of values.  It is not safe for
+// concurrent use.
+type Cache struct {
+	maxCost int
+	cost    int
+	// order holds entries, most recently used at the front.
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type entry struct {
+	key   string
+	value interface{}
+	cost  int
+}
+
+// New returns an empty Cache holding values of total cost at most maxCost.
+func New(maxCost int) *Cache {
+	return &Cache{
+		maxCost: maxCost,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// Get returns the value with the given key and marks it most recently used.
+func (c *Cache) Get(key string) (interface{}, bool) {
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*entry).value, true
+}
+
+// Peek returns the value with the given key without marking it used.
+func (c *Cache) Peek(key string) (interface{}, bool) {
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	return el.Value.(*entry).value, true
+}
+
+// Add adds value with the given key and a cost of one, replacing any value
+// the key holds, marks it most recently used and evicts the least recently
+// used values beyond the cache's cost.
+func (c *Cache) Add(key string, value interface{}) {
+	c.AddWithCost(key, value, 1)
+}
+
+// AddWithCost is Add for a value of the given cost.  A value costing more
+// than the whole cache is not added.
+func (c *Cache) AddWithCost(key string, value interface{}, cost int) {
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+	if cost > c.maxCost {
+		return
+	}
+	c.entries[key] = c.order.PushFront(&entry{key: key, value: value, cost: cost})
+	c.cost += cost
+	c.Shrink(c.maxCost)
+}
+
+// Remove removes the value with the given key, returning false if there is
+// none.
+func (c *Cache) Remove(key string) bool {
+	el, ok := c.entries[key]
+	if ok {
+		c.remove(el)
+	}
+	return ok
+}
+
+// Shrink evicts the least recently used values until the cache's values cost
+// at most maxCost.  The cache's own bound is unchanged.
+func (c *Cache) Shrink(maxCost int) {
+	for c.cost > maxCost && c.order.Len() > 0 {
+		c.remove(c.order.Back())
+	}
+}
+
+// Len returns the number of values in the cache.
+func (c *Cache) Len() int {
+	return c.order.Len()
+}
+
+// Cost returns the total cost of the values in the cache.
+func (c *Cache) Cost() int {
+	return c.cost
+}
+
+// Keys returns the keys in the cache, most recently used first.
+func (c *Cache) Keys() []string {
+	keys := make([]string, 0, c.order.Len())
+	for el := c.order.Front(); el != nil; el = el.Next() {
+		keys = append(keys, el.Value.(*entry).key)
+	}
+	return keys
+}
+
+func (c *Cache) remove(el *list.Element) {
+	e := c.order.Remove(el).(*entry)
+	delete(c.entries, e.key)
+	c.cost -= e.cost
+}
@@ -0,0 +1,70 @@
+package lru_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+	"github.com/filecoin-project/go-filecoin/util/lru"
+)
+
+func TestCache(t *testing.T) {
+	tf.UnitTest(t)
+
+	t.Run("evicts the least recently used", func(t *testing.T) {
+		c := lru.New(2)
+		c.Add("a", 1)
+		c.Add("b", 2)
+		_, ok := c.Get("a")
+		assert.True(t, ok)
+		c.Add("c", 3)
+
+		_, ok = c.Peek("b")
+		assert.False(t, ok)
+		assert.Equal(t, []string{"c", "a"}, c.Keys())
+	})
+
+	t.Run("peek does not mark used", func(t *testing.T) {
+		c := lru.New(2)
+		c.Add("a", 1)
+		c.Add("b", 2)
+		v, ok := c.Peek("a")
+		assert.True(t, ok)
+		assert.Equal(t, 1, v)
+		c.Add("c", 3)
+
+		_, ok = c.Peek("a")
+		assert.False(t, ok)
+	})
+
+	t.Run("add replaces and remove drops", func(t *testing.T) {
+		c := lru.New(2)
+		c.Add("a", 1)
+		c.Add("a", 2)
+		v, _ := c.Get("a")
+		assert.Equal(t, 2, v)
+		assert.Equal(t, 1, c.Len())
+
+		assert.True(t, c.Remove("a"))
+		assert.False(t, c.Remove("a"))
+		assert.Equal(t, 0, c.Len())
+	})
+
+	t.Run("bounded by cost", func(t *testing.T) {
+		c := lru.New(10)
+		c.AddWithCost("a", 1, 4)
+		c.AddWithCost("b", 2, 4)
+		c.AddWithCost("c", 3, 4)
+		assert.Equal(t, []string{"c", "b"}, c.Keys())
+		assert.Equal(t, 8, c.Cost())
+
+		c.AddWithCost("huge", 4, 11)
+		_, ok := c.Peek("huge")
+		assert.False(t, ok)
+
+		c.Shrink(4)
+		assert.Equal(t, []string{"c"}, c.Keys())
+		assert.Equal(t, 4, c.Cost())
+	})
+}
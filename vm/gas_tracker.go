@@ -40,6 +40,12 @@ func (gasTracker *GasTracker) Charge(cost types.GasUnits) error {
 	return nil
 }
 
+// GasConsumedByBlock returns the gas used so far by the messages of the
+// current block.
+func (gasTracker *GasTracker) GasConsumedByBlock() types.GasUnits {
+	return gasTracker.gasConsumedByBlock
+}
+
 // GasAboveBlockLimit will return true if the MsgGasLimit of the current message is greater than the block gas limit.
 func (gasTracker *GasTracker) GasAboveBlockLimit() bool {
 	return gasTracker.MsgGasLimit > types.BlockGasLimit
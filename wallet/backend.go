@@ -14,7 +14,9 @@ type Backend interface {
 	// Contains returns true if this backend stores the passed in address.
 	HasAddress(addr address.Address) bool
 
-	// Sign cryptographically signs `data` using the private key `priv`.
+	// SignBytes cryptographically signs `data` using the private key of
+	// `addr`.  The signature verifies with types.IsValidSignature, as
+	// message signatures are verified.
 	SignBytes(data []byte, addr address.Address) (types.Signature, error)
 
 	// Verify cryptographically verifies that 'sig' is the signed hash of 'data' with
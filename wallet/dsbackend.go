@@ -136,7 +136,8 @@ func (backend *DSBackend) putKeyInfo(ki *types.KeyInfo) error {
 	return nil
 }
 
-// SignBytes cryptographically signs `data` using the private key `priv`.
+// SignBytes cryptographically signs `data` using the private key of `addr`,
+// looked up in the backend's datastore.
 func (backend *DSBackend) SignBytes(data []byte, addr address.Address) (types.Signature, error) {
 	ki, err := backend.GetKeyInfo(addr)
 	if err != nil {
@@ -8,7 +8,9 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/filecoin-project/go-filecoin/address"
 	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+	"github.com/filecoin-project/go-filecoin/types"
 )
 
 func TestDSBackendSimple(t *testing.T) {
@@ -68,6 +70,39 @@ func TestDSBackendKeyPairMatchAddress(t *testing.T) {
 	assert.Equal(t, addr, dAddr)
 }
 
+func TestDSBackendSignBytes(t *testing.T) {
+	tf.UnitTest(t)
+
+	ds := datastore.NewMapDatastore()
+	defer func() {
+		require.NoError(t, ds.Close())
+	}()
+
+	fs, err := NewDSBackend(ds)
+	require.NoError(t, err)
+	addr, err := fs.NewAddress()
+	require.NoError(t, err)
+	ki, err := fs.GetKeyInfo(addr)
+	require.NoError(t, err)
+
+	data := []byte("data to sign")
+	sig, err := fs.SignBytes(data, addr)
+	require.NoError(t, err)
+
+	t.Log("signature verifies against the address's public key")
+	assert.True(t, fs.Verify(data, ki.PublicKey(), sig))
+	assert.True(t, types.IsValidSignature(data, addr, sig))
+
+	t.Log("signature does not verify for other data")
+	assert.False(t, types.IsValidSignature([]byte("other data"), addr, sig))
+
+	t.Log("signing with an unknown address fails")
+	other, err := address.NewActorAddress([]byte("other"))
+	require.NoError(t, err)
+	_, err = fs.SignBytes(data, other)
+	assert.Error(t, err)
+}
+
 func TestDSBackendErrorsForUnknownAddress(t *testing.T) {
 	tf.UnitTest(t)
 
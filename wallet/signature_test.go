@@ -9,9 +9,11 @@
 package wallet
 
 import (
+	"crypto/rand"
 	"testing"
 
 	"github.com/ipfs/go-datastore"
+	ci "github.com/libp2p/go-libp2p-crypto"
 
 	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/types"
@@ -166,3 +168,71 @@ func TestSignedMessageCorrupted(t *testing.T) {
 	smsg.Message.Nonce = types.Uint64(uint64(42))
 	assert.False(t, smsg.VerifySignature())
 }
+
+/* Test signature schemes */
+
+// ed25519Signer signs with a single Ed25519 key.
+type ed25519Signer struct {
+	key  ci.PrivKey
+	addr address.Address
+}
+
+func requireEd25519Signer(t *testing.T) *ed25519Signer {
+	key, pub, err := ci.GenerateEd25519Key(rand.Reader)
+	require.NoError(t, err)
+	raw, err := pub.Raw()
+	require.NoError(t, err)
+	addr, err := address.NewEd25519Address(raw)
+	require.NoError(t, err)
+	return &ed25519Signer{key: key, addr: addr}
+}
+
+func (s *ed25519Signer) SignBytes(data []byte, addr address.Address) (types.Signature, error) {
+	return s.key.Sign(data)
+}
+
+// Messages verify under the signature scheme of their sender's address only.
+func TestSignedMessageSchemes(t *testing.T) {
+	tf.UnitTest(t)
+
+	secpSigner, secpAddr := requireSignerAddr(t)
+	edSigner := requireEd25519Signer(t)
+	edAddr := edSigner.addr
+
+	sign := func(signer types.Signer, from address.Address) *types.SignedMessage {
+		msg := types.NewMessage(from, address.TestAddress, 1, nil, "", nil)
+		smsg, err := types.NewSignedMessage(*msg, signer, types.NewGasPrice(0), types.NewGasUnits(0))
+		require.NoError(t, err)
+		return smsg
+	}
+	// validFor verifies the signature of smsg against addr rather than its
+	// sender.
+	validFor := func(smsg *types.SignedMessage, addr address.Address) bool {
+		bmsg, err := smsg.MeteredMessage.Marshal()
+		require.NoError(t, err)
+		return types.IsValidSignature(bmsg, addr, smsg.Signature)
+	}
+
+	t.Run("secp256k1", func(t *testing.T) {
+		smsg := sign(secpSigner, secpAddr)
+		assert.True(t, smsg.VerifySignature())
+		assert.False(t, validFor(smsg, edAddr))
+	})
+
+	t.Run("ed25519", func(t *testing.T) {
+		smsg := sign(edSigner, edAddr)
+		assert.True(t, smsg.VerifySignature())
+		assert.False(t, validFor(smsg, secpAddr))
+	})
+
+	t.Run("corrupted ed25519", func(t *testing.T) {
+		smsg := sign(edSigner, edAddr)
+		smsg.Signature[0] = smsg.Signature[0] ^ 0xFF
+		assert.False(t, smsg.VerifySignature())
+	})
+
+	t.Run("address without a scheme", func(t *testing.T) {
+		smsg := sign(secpSigner, secpAddr)
+		assert.False(t, validFor(smsg, address.TestAddress2))
+	})
+}
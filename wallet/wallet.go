@@ -17,6 +17,9 @@ import (
 var (
 	// ErrUnknownAddress is returned when the given address is not stored in this wallet.
 	ErrUnknownAddress = errors.New("unknown address")
+	// ErrNoAddresses is returned when a default address is requested from a
+	// wallet holding no addresses.
+	ErrNoAddresses = errors.New("wallet holds no addresses")
 )
 
 // Wallet manages the locally stored addresses.
@@ -96,6 +99,25 @@ func (w *Wallet) Backends(kind reflect.Type) []Backend {
 	return cpy
 }
 
+// ResolveDefaultAddress returns configured if the wallet holds a usable key
+// for it.  Otherwise it falls back to the first address in the wallet, which
+// keeps a node usable when its configured default has drifted from its
+// keystore.  It returns ErrNoAddresses if the wallet holds no addresses.
+// Safe for concurrent access.
+func (w *Wallet) ResolveDefaultAddress(configured address.Address) (address.Address, error) {
+	if !configured.Empty() {
+		if _, err := w.keyInfoForAddr(configured); err == nil {
+			return configured, nil
+		}
+	}
+
+	addrs := w.Addresses()
+	if len(addrs) == 0 {
+		return address.Undef, ErrNoAddresses
+	}
+	return addrs[0], nil
+}
+
 // SignBytes cryptographically signs `data` using the private key corresponding to
 // address `addr`
 func (w *Wallet) SignBytes(data []byte, addr address.Address) (types.Signature, error) {
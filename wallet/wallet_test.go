@@ -66,6 +66,49 @@ func TestWalletSimple(t *testing.T) {
 	}
 }
 
+func TestResolveDefaultAddress(t *testing.T) {
+	tf.UnitTest(t)
+
+	t.Run("configured default with a key is used", func(t *testing.T) {
+		fs, err := wallet.NewDSBackend(datastore.NewMapDatastore())
+		require.NoError(t, err)
+		w := wallet.New(fs)
+
+		_, err = fs.NewAddress()
+		require.NoError(t, err)
+		configured, err := fs.NewAddress()
+		require.NoError(t, err)
+
+		addr, err := w.ResolveDefaultAddress(configured)
+		require.NoError(t, err)
+		assert.Equal(t, configured, addr)
+	})
+
+	t.Run("configured default without a key falls back", func(t *testing.T) {
+		fs, err := wallet.NewDSBackend(datastore.NewMapDatastore())
+		require.NoError(t, err)
+		w := wallet.New(fs)
+
+		_, err = fs.NewAddress()
+		require.NoError(t, err)
+		_, err = fs.NewAddress()
+		require.NoError(t, err)
+
+		addr, err := w.ResolveDefaultAddress(address.NewForTestGetter()())
+		require.NoError(t, err)
+		assert.Equal(t, w.Addresses()[0], addr)
+	})
+
+	t.Run("no addresses errors", func(t *testing.T) {
+		fs, err := wallet.NewDSBackend(datastore.NewMapDatastore())
+		require.NoError(t, err)
+		w := wallet.New(fs)
+
+		_, err = w.ResolveDefaultAddress(address.NewForTestGetter()())
+		assert.Equal(t, wallet.ErrNoAddresses, err)
+	})
+}
+
 func TestSimpleSignAndVerify(t *testing.T) {
 	tf.UnitTest(t)
 